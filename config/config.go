@@ -7,15 +7,21 @@ import (
 
 type (
 	Config struct {
-		App     App
-		Cache   Cache
-		HTTP    HTTP
-		Log     Log
-		Pg      Pg
-		Redis   Redis
-		Swagger Swagger
-		JWT     JWT
-		OAuth   OAuth
+		App      App
+		Cache    Cache
+		HTTP     HTTP
+		Log      Log
+		Pg       Pg
+		Redis    Redis
+		Swagger  Swagger
+		JWT      JWT
+		Auth     Auth
+		Password Password
+		WebAuthn WebAuthn
+		Mailer   Mailer
+		OAuth    OAuth
+		Authz    Authz
+		Org      Org
 	}
 
 	App struct {
@@ -57,19 +63,98 @@ type (
 	}
 
 	JWT struct {
-		Secret             string `env:"JWT_SECRET,required"`
-		AccessTokenExpiry  string `env:"JWT_ACCESS_TOKEN_EXPIRY"  envDefault:"24h"`
-		RefreshTokenExpiry string `env:"JWT_REFRESH_TOKEN_EXPIRY" envDefault:"7d"`
+		Algorithm          string            `env:"JWT_ALGORITHM"            envDefault:"HS512"`
+		Secret             string            `env:"JWT_SECRET"`
+		Keys               map[string]string `env:"JWT_KEYS"                 envKeyValSeparator:"="`
+		KeysRetireAt       map[string]string `env:"JWT_KEYS_RETIRE_AT"       envKeyValSeparator:"="`
+		KeysAlgorithm      map[string]string `env:"JWT_KEYS_ALGORITHM"       envKeyValSeparator:"="`
+		SigningKeyID       string            `env:"JWT_SIGNING_KEY_ID"`
+		Audience           string            `env:"JWT_AUDIENCE"`
+		AccessTokenExpiry  string            `env:"JWT_ACCESS_TOKEN_EXPIRY"  envDefault:"24h"`
+		RefreshTokenExpiry string            `env:"JWT_REFRESH_TOKEN_EXPIRY" envDefault:"7d"`
+		MFATokenExpiry     string            `env:"JWT_MFA_TOKEN_EXPIRY"     envDefault:"5m"`
+		MagicLinkExpiry    string            `env:"JWT_MAGIC_LINK_EXPIRY"    envDefault:"15m"`
+	}
+
+	Auth struct {
+		RequireVerifiedEmail    bool   `env:"AUTH_REQUIRE_VERIFIED_EMAIL"    envDefault:"false"`
+		VerifyEmailURL          string `env:"AUTH_VERIFY_EMAIL_URL"          envDefault:"http://localhost:3000/verify-email"`
+		ResetPasswordURL        string `env:"AUTH_RESET_PASSWORD_URL"        envDefault:"http://localhost:3000/reset-password"`
+		ConfirmEmailChangeURL   string `env:"AUTH_CONFIRM_EMAIL_CHANGE_URL"  envDefault:"http://localhost:3000/confirm-email-change"`
+		MagicLinkURL            string `env:"AUTH_MAGIC_LINK_URL"            envDefault:"http://localhost:3000/magic-link"`
+		MagicLinkEmailLimit     int    `env:"AUTH_MAGIC_LINK_EMAIL_LIMIT"    envDefault:"3"`
+		MagicLinkIPLimit        int    `env:"AUTH_MAGIC_LINK_IP_LIMIT"       envDefault:"10"`
+		LockoutAccountThreshold int    `env:"AUTH_LOCKOUT_ACCOUNT_THRESHOLD" envDefault:"5"`
+		LockoutIPThreshold      int    `env:"AUTH_LOCKOUT_IP_THRESHOLD"      envDefault:"20"`
+		LockoutBaseDelay        string `env:"AUTH_LOCKOUT_BASE_DELAY"        envDefault:"30s"`
+		LockoutMaxDelay         string `env:"AUTH_LOCKOUT_MAX_DELAY"         envDefault:"1h"`
+	}
+
+	Password struct {
+		MinLength         int    `env:"PASSWORD_MIN_LENGTH"         envDefault:"8"`
+		MaxLength         int    `env:"PASSWORD_MAX_LENGTH"         envDefault:"72"`
+		RequireUpper      bool   `env:"PASSWORD_REQUIRE_UPPER"      envDefault:"false"`
+		RequireLower      bool   `env:"PASSWORD_REQUIRE_LOWER"      envDefault:"false"`
+		RequireDigit      bool   `env:"PASSWORD_REQUIRE_DIGIT"      envDefault:"false"`
+		RequireSymbol     bool   `env:"PASSWORD_REQUIRE_SYMBOL"     envDefault:"false"`
+		MinScore          int    `env:"PASSWORD_MIN_SCORE"          envDefault:"2"`
+		BreachedPath      string `env:"PASSWORD_BREACHED_PATH"`
+		HashAlgorithm     string `env:"PASSWORD_HASH_ALGORITHM"     envDefault:"argon2id"`
+		BcryptCost        int    `env:"PASSWORD_BCRYPT_COST"        envDefault:"10"`
+		Argon2Memory      uint32 `env:"PASSWORD_ARGON2_MEMORY"      envDefault:"65536"`
+		Argon2Iterations  uint32 `env:"PASSWORD_ARGON2_ITERATIONS"  envDefault:"3"`
+		Argon2Parallelism uint8  `env:"PASSWORD_ARGON2_PARALLELISM" envDefault:"4"`
+	}
+
+	WebAuthn struct {
+		RPID          string   `env:"WEBAUTHN_RP_ID"           envDefault:"localhost"`
+		RPDisplayName string   `env:"WEBAUTHN_RP_DISPLAY_NAME" envDefault:"Goth"`
+		RPOrigins     []string `env:"WEBAUTHN_RP_ORIGINS"      envDefault:"http://localhost:3000"`
+		Timeout       string   `env:"WEBAUTHN_TIMEOUT"         envDefault:"5m"`
+	}
+
+	Mailer struct {
+		Driver        string `env:"MAILER_DRIVER,required"`
+		From          string `env:"MAILER_FROM"           envDefault:"Goth <no-reply@localhost>"`
+		DefaultLocale string `env:"MAILER_DEFAULT_LOCALE" envDefault:"en"`
+		FilePath      string `env:"MAILER_FILE_PATH"      envDefault:"mail.jsonl"`
+		Workers       int    `env:"MAILER_WORKERS"        envDefault:"2"`
+		QueueSize     int    `env:"MAILER_QUEUE_SIZE"     envDefault:"100"`
+		SMTP          SMTP
+	}
+
+	SMTP struct {
+		Host        string `env:"SMTP_HOST"`
+		Port        int    `env:"SMTP_PORT"         envDefault:"587"`
+		Username    string `env:"SMTP_USERNAME"`
+		Password    string `env:"SMTP_PASSWORD"`
+		ImplicitTLS bool   `env:"SMTP_IMPLICIT_TLS" envDefault:"false"`
 	}
 
 	OAuth struct {
-		Google GoogleOAuth `env:"OAUTH_GOOGLE"`
+		Providers    []OAuthProvider `envPrefix:"OAUTH_PROVIDERS"`
+		RedirectURIs []string        `env:"OAUTH_REDIRECT_URIS"`
+		StateExpiry  string          `env:"OAUTH_STATE_EXPIRY"  envDefault:"10m"`
+		CookieSecure bool            `env:"OAUTH_COOKIE_SECURE" envDefault:"true"`
+	}
+
+	OAuthProvider struct {
+		Name         string   `env:"NAME,required"`
+		Type         string   `env:"TYPE"          envDefault:"oidc"`
+		Issuer       string   `env:"ISSUER"`
+		ClientID     string   `env:"CLIENT_ID,required"`
+		ClientSecret string   `env:"CLIENT_SECRET,required"`
+		RedirectURL  string   `env:"REDIRECT_URL,required"`
+		Scopes       []string `env:"SCOPES"`
+	}
+
+	Authz struct {
+		PolicyPaths []string `env:"AUTHZ_POLICY_PATHS" envDefault:"config/policies"`
 	}
 
-	GoogleOAuth struct {
-		ClientID     string `env:"OAUTH_GOOGLE_CLIENT_ID,required"`
-		ClientSecret string `env:"OAUTH_GOOGLE_CLIENT_SECRET,required"`
-		RedirectURL  string `env:"OAUTH_GOOGLE_REDIRECT_URL,required"`
+	Org struct {
+		InvitationURL    string `env:"ORG_INVITATION_URL"    envDefault:"http://localhost:3000/accept-invitation"`
+		InvitationExpiry string `env:"ORG_INVITATION_EXPIRY" envDefault:"7d"`
 	}
 )
 
@@ -1,21 +1,66 @@
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1 AND deleted_at IS NULL LIMIT 1;
 
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1 AND deleted_at IS NULL LIMIT 1;
+
 -- name: CreateUser :one
-INSERT INTO users (email, password, level, google_id, full_name, profile_image, is_verified) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+INSERT INTO users (email, password, full_name, profile_image, is_verified) VALUES ($1, $2, $3, $4, $5) RETURNING *;
 
 -- name: UpdateUser :one
-UPDATE users SET email = $1, password = $2, google_id = $3, full_name = $4, profile_image = $5, is_verified = $6, updated_at = now()
-    WHERE id = $7 AND deleted_at IS NULL RETURNING *;
+UPDATE users SET email = $1, password = $2, full_name = $3, profile_image = $4, is_verified = $5, updated_at = now()
+    WHERE id = $6 AND deleted_at IS NULL RETURNING *;
 
 -- name: UpdateLastLogin :one
 UPDATE users SET last_login = now() WHERE id = $1 AND deleted_at IS NULL RETURNING id;
 
+-- name: GetUserByIDWithDeleted :one
+SELECT * FROM users WHERE id = $1 LIMIT 1;
+
+-- name: ListUsers :many
+-- Users come sorted by sort, one of created_at, -created_at, email and -email, with ties broken by id in
+-- the same direction. A page continues after the user of cursor_id and its sort value.
+SELECT * FROM users
+    WHERE (sqlc.narg(email_prefix)::text IS NULL OR email ILIKE sqlc.narg(email_prefix) || '%')
+        AND (sqlc.narg(is_verified)::boolean IS NULL OR is_verified = sqlc.narg(is_verified))
+        AND (sqlc.narg(role)::text IS NULL OR EXISTS (
+            SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+                WHERE user_roles.user_id = users.id AND roles.name = sqlc.narg(role)))
+        AND (sqlc.narg(created_from)::timestamp IS NULL OR created_at >= sqlc.narg(created_from))
+        AND (sqlc.narg(created_to)::timestamp IS NULL OR created_at < sqlc.narg(created_to))
+        AND (sqlc.narg(deleted)::boolean IS NULL OR (deleted_at IS NOT NULL) = sqlc.narg(deleted))
+        AND (sqlc.narg(cursor_id)::uuid IS NULL OR CASE sqlc.arg(sort)::text
+            WHEN 'created_at' THEN (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id))
+            WHEN '-created_at' THEN (created_at, id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id))
+            WHEN 'email' THEN (email, id) > (sqlc.narg(cursor_email)::text, sqlc.narg(cursor_id))
+            ELSE (email, id) < (sqlc.narg(cursor_email), sqlc.narg(cursor_id))
+        END)
+    ORDER BY
+        CASE WHEN sqlc.arg(sort) = 'created_at' THEN created_at END ASC,
+        CASE WHEN sqlc.arg(sort) = '-created_at' THEN created_at END DESC,
+        CASE WHEN sqlc.arg(sort) = 'email' THEN email END ASC,
+        CASE WHEN sqlc.arg(sort) = '-email' THEN email END DESC,
+        CASE WHEN sqlc.arg(sort) IN ('created_at', 'email') THEN id END ASC,
+        CASE WHEN sqlc.arg(sort) IN ('-created_at', '-email') THEN id END DESC
+    LIMIT sqlc.arg(page_size);
+
+-- name: DeleteUser :one
+UPDATE users SET deleted_at = now(), updated_at = now() WHERE id = $1 AND deleted_at IS NULL RETURNING *;
+
+-- name: RestoreUser :one
+UPDATE users SET deleted_at = NULL, updated_at = now() WHERE id = $1 AND deleted_at IS NOT NULL RETURNING *;
+
 -- name: CreateEmailVerification :one
 INSERT INTO email_verifications (user_id, token) VALUES ($1, $2) RETURNING *;
 
 -- name: GetEmailVerificationByToken :one
-SELECT * FROM email_verifications WHERE token = $1 AND expires_at > now() LIMIT 1;
+SELECT * FROM email_verifications WHERE token = $1 AND expires_at > now() AND used_at IS NULL LIMIT 1;
+
+-- name: ConsumeEmailVerification :one
+UPDATE email_verifications SET used_at = now() WHERE id = $1 AND used_at IS NULL RETURNING *;
+
+-- name: InvalidateEmailVerifications :exec
+UPDATE email_verifications SET used_at = now() WHERE user_id = $1 AND used_at IS NULL;
 
 -- name: VerifyEmail :one
 UPDATE users SET is_verified = true WHERE id = $1 AND deleted_at IS NULL RETURNING *;
@@ -24,7 +69,229 @@ UPDATE users SET is_verified = true WHERE id = $1 AND deleted_at IS NULL RETURNI
 INSERT INTO password_resets (user_id, token) VALUES ($1, $2) RETURNING *;
 
 -- name: GetPasswordResetByToken :one
-SELECT * FROM password_resets WHERE token = $1 AND expires_at > now() LIMIT 1;
+SELECT * FROM password_resets WHERE token = $1 AND expires_at > now() AND used_at IS NULL LIMIT 1;
+
+-- name: ConsumePasswordReset :one
+UPDATE password_resets SET used_at = now() WHERE id = $1 AND used_at IS NULL RETURNING *;
+
+-- name: InvalidatePasswordResets :exec
+UPDATE password_resets SET used_at = now() WHERE user_id = $1 AND used_at IS NULL;
 
 -- name: ResetPassword :one
-UPDATE users SET password = $1 WHERE id = $2 AND deleted_at IS NULL RETURNING *;
+UPDATE users SET password = $1, updated_at = now() WHERE id = $2 AND deleted_at IS NULL RETURNING *;
+
+-- name: RehashPassword :exec
+UPDATE users SET password = sqlc.arg(new_password) WHERE id = sqlc.arg(id) AND password = sqlc.arg(old_password);
+
+-- name: CreateEmailChange :one
+INSERT INTO email_changes (user_id, new_email, token) VALUES ($1, $2, $3) RETURNING *;
+
+-- name: GetEmailChangeByToken :one
+SELECT * FROM email_changes WHERE token = $1 AND expires_at > now() AND used_at IS NULL LIMIT 1;
+
+-- name: ConsumeEmailChange :one
+UPDATE email_changes SET used_at = now() WHERE id = $1 AND used_at IS NULL RETURNING *;
+
+-- name: InvalidateEmailChanges :exec
+UPDATE email_changes SET used_at = now() WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: GetUserMFA :one
+SELECT * FROM user_mfa WHERE user_id = $1 LIMIT 1;
+
+-- name: UpsertUserMFA :one
+INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+    ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, updated_at = now()
+    WHERE user_mfa.enabled_at IS NULL RETURNING *;
+
+-- name: EnableUserMFA :one
+UPDATE user_mfa SET enabled_at = now(), updated_at = now() WHERE user_id = $1 AND enabled_at IS NULL RETURNING *;
+
+-- name: UseMFAStep :one
+UPDATE user_mfa SET last_used_step = $1, updated_at = now() WHERE user_id = $2 AND last_used_step < $1 RETURNING *;
+
+-- name: DeleteUserMFA :exec
+DELETE FROM user_mfa WHERE user_id = $1;
+
+-- name: CreateMFARecoveryCode :exec
+INSERT INTO mfa_recovery_codes (user_id, code) VALUES ($1, $2);
+
+-- name: ConsumeMFARecoveryCode :one
+UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code = $2 AND used_at IS NULL RETURNING *;
+
+-- name: DeleteMFARecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1;
+
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (user_id, credential_id, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+
+-- name: ListWebAuthnCredentialsByUser :many
+SELECT * FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at;
+
+-- name: UpdateWebAuthnCredentialUsage :exec
+UPDATE webauthn_credentials SET sign_count = $1, backup_state = $2, last_used_at = now() WHERE credential_id = $3;
+
+-- name: GetUserIdentity :one
+SELECT * FROM user_identities WHERE provider = $1 AND subject = $2 LIMIT 1;
+
+-- name: CreateUserIdentity :one
+INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4) RETURNING *;
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities WHERE user_id = $1 ORDER BY linked_at;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM user_identities WHERE user_id = $1 AND provider = $2;
+
+-- name: CreateSession :exec
+INSERT INTO user_sessions (id, user_id, device_name, user_agent, ip_address) VALUES ($1, $2, $3, $4, $5);
+
+-- name: TouchSession :exec
+UPDATE user_sessions SET last_seen_at = now(), user_agent = $2, ip_address = $3 WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: GetSession :one
+SELECT * FROM user_sessions WHERE id = $1 LIMIT 1;
+
+-- name: ListActiveSessions :many
+SELECT * FROM user_sessions WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > sqlc.arg(seen_after)
+    ORDER BY last_seen_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE user_sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :many
+UPDATE user_sessions SET revoked_at = now() WHERE user_id = $1 AND id <> sqlc.arg(keep_id) AND revoked_at IS NULL
+    RETURNING id;
+
+-- name: RevokeAllSessions :exec
+UPDATE user_sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListRoles :many
+SELECT * FROM roles ORDER BY name;
+
+-- name: GetRoleByName :one
+SELECT * FROM roles WHERE name = $1 LIMIT 1;
+
+-- name: CreateRole :one
+INSERT INTO roles (name, description, is_default) VALUES ($1, $2, $3) RETURNING *;
+
+-- name: UpdateRole :one
+UPDATE roles SET description = $2, is_default = $3, updated_at = now() WHERE name = $1 RETURNING *;
+
+-- name: DeleteRole :execrows
+DELETE FROM roles WHERE id = $1 AND NOT builtin;
+
+-- name: ListPermissions :many
+SELECT * FROM permissions ORDER BY name;
+
+-- name: ListRolePermissions :many
+SELECT permissions.name FROM permissions
+    JOIN role_permissions ON role_permissions.permission_id = permissions.id
+    WHERE role_permissions.role_id = $1 ORDER BY permissions.name;
+
+-- name: DeleteRolePermissions :exec
+DELETE FROM role_permissions WHERE role_id = $1;
+
+-- name: AddRolePermissions :execrows
+INSERT INTO role_permissions (role_id, permission_id)
+    SELECT sqlc.arg(role_id), id FROM permissions WHERE name = ANY(sqlc.arg(permissions)::text[]);
+
+-- name: ListRoleUserIDs :many
+SELECT user_id FROM user_roles WHERE role_id = $1;
+
+-- name: ListUserRoles :many
+SELECT roles.* FROM roles JOIN user_roles ON user_roles.role_id = roles.id WHERE user_roles.user_id = $1 ORDER BY roles.name;
+
+-- name: ListUserPermissions :many
+SELECT DISTINCT permissions.name FROM permissions
+    JOIN role_permissions ON role_permissions.permission_id = permissions.id
+    JOIN user_roles ON user_roles.role_id = role_permissions.role_id
+    WHERE user_roles.user_id = $1 ORDER BY permissions.name;
+
+-- name: AssignRole :exec
+INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;
+
+-- name: UnassignRole :execrows
+DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2;
+
+-- name: AssignDefaultRoles :exec
+INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE is_default;
+
+-- name: CreateOrganization :one
+INSERT INTO organizations (name, slug) VALUES ($1, $2) RETURNING *;
+
+-- name: GetOrganization :one
+SELECT * FROM organizations WHERE id = $1 LIMIT 1;
+
+-- name: LockOrganization :exec
+SELECT id FROM organizations WHERE id = $1 FOR UPDATE;
+
+-- name: ListUserOrganizations :many
+SELECT organizations.id, organizations.name, organizations.slug, organization_members.role, organization_members.joined_at
+    FROM organizations JOIN organization_members ON organization_members.org_id = organizations.id
+    WHERE organization_members.user_id = $1 ORDER BY organization_members.joined_at, organizations.id;
+
+-- name: GetDefaultOrganizationID :one
+SELECT org_id FROM organization_members WHERE user_id = $1 ORDER BY joined_at, org_id LIMIT 1;
+
+-- name: GetMember :one
+SELECT * FROM organization_members WHERE org_id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: GetMemberByEmail :one
+SELECT organization_members.* FROM organization_members JOIN users ON users.id = organization_members.user_id
+    WHERE organization_members.org_id = $1 AND users.email = $2 LIMIT 1;
+
+-- name: ListMembers :many
+SELECT organization_members.user_id, users.email, users.full_name, organization_members.role, organization_members.joined_at
+    FROM organization_members JOIN users ON users.id = organization_members.user_id
+    WHERE organization_members.org_id = $1 ORDER BY organization_members.joined_at, organization_members.user_id;
+
+-- name: AddMember :exec
+INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;
+
+-- name: UpdateMemberRole :execrows
+UPDATE organization_members SET role = $3 WHERE org_id = $1 AND user_id = $2;
+
+-- name: RemoveMember :execrows
+DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2;
+
+-- name: CountOwners :one
+SELECT count(*) FROM organization_members WHERE org_id = $1 AND role = 'owner';
+
+-- name: CreateInvitation :one
+INSERT INTO organization_invitations (org_id, email, role, invited_by, token_hash, expires_at)
+    VALUES ($1, $2, $3, $4, $5, now() + sqlc.arg(expiry)::interval)
+    ON CONFLICT (org_id, email) DO UPDATE SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by,
+        token_hash = EXCLUDED.token_hash, expires_at = EXCLUDED.expires_at, status = 'pending', created_at = now(), updated_at = now()
+    RETURNING *;
+
+-- name: ListInvitations :many
+SELECT * FROM organization_invitations WHERE org_id = $1 ORDER BY created_at DESC, id;
+
+-- name: GetInvitationForUpdate :one
+SELECT * FROM organization_invitations WHERE id = $1 AND org_id = $2 FOR UPDATE;
+
+-- name: GetInvitationByToken :one
+SELECT * FROM organization_invitations WHERE token_hash = $1 AND status = 'pending' AND expires_at > now();
+
+-- name: RenewInvitation :one
+UPDATE organization_invitations SET token_hash = $2, expires_at = now() + sqlc.arg(expiry)::interval, updated_at = now()
+    WHERE id = $1 RETURNING *;
+
+-- name: RevokeInvitation :exec
+UPDATE organization_invitations SET status = 'revoked', updated_at = now() WHERE id = $1;
+
+-- name: ListUserInvitations :many
+SELECT organization_invitations.id, organization_invitations.org_id, organizations.name AS org_name,
+    organization_invitations.role, organization_invitations.expires_at, organization_invitations.created_at
+    FROM organization_invitations JOIN organizations ON organizations.id = organization_invitations.org_id
+    WHERE organization_invitations.email = $1 AND organization_invitations.status = 'pending'
+        AND organization_invitations.expires_at > now()
+    ORDER BY organization_invitations.created_at DESC, organization_invitations.id;
+
+-- name: RespondToInvitation :one
+UPDATE organization_invitations SET status = $3, updated_at = now()
+    WHERE id = $1 AND email = $2 AND status = 'pending' AND expires_at > now() RETURNING *;
+
+-- name: CreateAuditLog :exec
+INSERT INTO audit_logs (org_id, actor_id, action, target_type, target_id, metadata) VALUES ($1, $2, $3, $4, $5, $6);
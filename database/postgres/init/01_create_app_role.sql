@@ -0,0 +1,9 @@
+-- Runs once, when the database container is first created. Migrations run as the superuser, which
+-- owns the tables; the application connects as goth, an ordinary role, because superusers are not
+-- subject to row-level security.
+CREATE ROLE goth LOGIN PASSWORD 'goth';
+
+CREATE ROLE app_cross_tenant NOLOGIN BYPASSRLS;
+GRANT app_cross_tenant TO goth;
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO goth;
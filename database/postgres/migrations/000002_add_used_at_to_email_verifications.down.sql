@@ -0,0 +1 @@
+ALTER TABLE email_verifications DROP COLUMN used_at;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE email_verifications ADD COLUMN IF NOT EXISTS used_at TIMESTAMP DEFAULT NULL;
+
+-- Pending verification links were stored in plaintext and cannot be matched against hashed tokens.
+DELETE FROM email_verifications;
+
+COMMIT;
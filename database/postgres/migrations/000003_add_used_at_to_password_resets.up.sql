@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE password_resets ADD COLUMN IF NOT EXISTS used_at TIMESTAMP DEFAULT NULL;
+
+-- Outstanding reset links held plaintext tokens; drop them rather than leave them unusable.
+DELETE FROM password_resets;
+
+COMMIT;
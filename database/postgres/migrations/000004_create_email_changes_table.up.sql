@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS email_changes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    new_email VARCHAR(255) NOT NULL,
+    token VARCHAR(255) UNIQUE NOT NULL,
+    expires_at TIMESTAMP DEFAULT now() + INTERVAL '1 hours',
+    created_at TIMESTAMP DEFAULT now(),
+    used_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX idx_email_changes_user_id ON email_changes(user_id);
+CREATE INDEX idx_email_changes_token ON email_changes(token);
+
+COMMIT;
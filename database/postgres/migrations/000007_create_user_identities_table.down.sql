@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN google_id VARCHAR(255) UNIQUE;
+CREATE INDEX idx_users_google_id ON users(google_id);
+
+UPDATE users SET google_id = user_identities.subject
+    FROM user_identities WHERE user_identities.user_id = users.id AND user_identities.provider = 'google';
+
+DROP TABLE user_identities;
+
+COMMIT;
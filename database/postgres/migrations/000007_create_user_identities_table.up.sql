@@ -0,0 +1,20 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(64) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    linked_at TIMESTAMP DEFAULT now(),
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+INSERT INTO user_identities (user_id, provider, subject, email)
+    SELECT id, 'google', google_id, email FROM users WHERE google_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_google_id;
+ALTER TABLE users DROP COLUMN google_id;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_name VARCHAR(255) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT now(),
+    last_seen_at TIMESTAMP DEFAULT now(),
+    revoked_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN level CHAR(1) NOT NULL DEFAULT '1';
+
+DROP TABLE user_roles;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
+
+COMMIT;
@@ -0,0 +1,53 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS roles (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(64) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    builtin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT now(),
+    updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(128) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id UUID NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    assigned_at TIMESTAMP DEFAULT now(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+INSERT INTO roles (name, description, is_default, builtin) VALUES
+    ('user', 'Every account', TRUE, TRUE),
+    ('admin', 'Administrators', FALSE, TRUE);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'View accounts of other users'),
+    ('users:write', 'Change, lock and unlock accounts of other users'),
+    ('roles:read', 'View roles and whom they are assigned to'),
+    ('roles:write', 'Manage roles and assign them to users');
+
+INSERT INTO role_permissions (role_id, permission_id)
+    SELECT roles.id, permissions.id FROM roles, permissions WHERE roles.name = 'admin';
+
+-- Every account so far had level 1, a plain user. The first administrator is granted by hand.
+INSERT INTO user_roles (user_id, role_id)
+    SELECT users.id, roles.id FROM users, roles WHERE roles.name = 'user';
+
+ALTER TABLE users DROP COLUMN level;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE organization_invitations;
+DROP TABLE organization_members;
+DROP TABLE organizations;
+
+COMMIT;
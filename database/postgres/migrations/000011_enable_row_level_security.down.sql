@@ -0,0 +1,27 @@
+BEGIN;
+
+DROP POLICY tenant_isolation ON organization_invitations;
+ALTER TABLE organization_invitations NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE organization_invitations DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY tenant_isolation ON organization_members;
+ALTER TABLE organization_members NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE organization_members DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY tenant_isolation ON organizations;
+ALTER TABLE organizations NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE organizations DISABLE ROW LEVEL SECURITY;
+
+-- The role is shared by every database of the cluster, so it is only stripped of its privileges here.
+DO $$
+BEGIN
+    EXECUTE format('ALTER DEFAULT PRIVILEGES IN SCHEMA %I REVOKE ALL ON TABLES FROM app_cross_tenant', current_schema());
+    EXECUTE format('REVOKE ALL ON ALL TABLES IN SCHEMA %I FROM app_cross_tenant', current_schema());
+    EXECUTE format('REVOKE USAGE ON SCHEMA %I FROM app_cross_tenant', current_schema());
+END
+$$;
+
+DROP FUNCTION app_tenant_id();
+DROP FUNCTION app_user_id();
+
+COMMIT;
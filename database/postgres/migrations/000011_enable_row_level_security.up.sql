@@ -0,0 +1,54 @@
+BEGIN;
+
+-- Transactions of a request run with app.user_id and app.tenant_id set to the signed in user and
+-- their active organization. The policies fail closed: without a tenant a query sees no organization
+-- data, except for the organizations and memberships of its user, which it needs to list them.
+--
+-- Superusers and roles with BYPASSRLS are not subject to the policies, so the application must
+-- connect as an ordinary role for them to take effect.
+CREATE OR REPLACE FUNCTION app_user_id() RETURNS UUID LANGUAGE sql STABLE AS
+$$ SELECT NULLIF(current_setting('app.user_id', true), '')::uuid $$;
+
+CREATE OR REPLACE FUNCTION app_tenant_id() RETURNS UUID LANGUAGE sql STABLE AS
+$$ SELECT NULLIF(current_setting('app.tenant_id', true), '')::uuid $$;
+
+-- The few things that happen outside of an organization, such as creating one or accepting an
+-- invitation to it, run as app_cross_tenant, which row-level security does not apply to. The role
+-- the application connects as must be granted it, e.g. GRANT app_cross_tenant TO goth. Creating a
+-- role with BYPASSRLS takes a superuser.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'app_cross_tenant') THEN
+        CREATE ROLE app_cross_tenant NOLOGIN BYPASSRLS;
+    END IF;
+
+    EXECUTE format('GRANT USAGE ON SCHEMA %I TO app_cross_tenant', current_schema());
+    EXECUTE format('GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA %I TO app_cross_tenant', current_schema());
+    EXECUTE format('ALTER DEFAULT PRIVILEGES IN SCHEMA %I GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO app_cross_tenant',
+        current_schema());
+END
+$$;
+
+ALTER TABLE organizations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE organizations FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON organizations
+    USING (id = app_tenant_id() OR EXISTS (
+        SELECT FROM organization_members WHERE org_id = organizations.id AND user_id = app_user_id()))
+    WITH CHECK (id = app_tenant_id());
+
+-- Members see their own memberships in other organizations, but only change the active one.
+ALTER TABLE organization_members ENABLE ROW LEVEL SECURITY;
+ALTER TABLE organization_members FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON organization_members
+    USING (org_id = app_tenant_id() OR user_id = app_user_id())
+    WITH CHECK (org_id = app_tenant_id());
+
+ALTER TABLE organization_invitations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE organization_invitations FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON organization_invitations
+    USING (org_id = app_tenant_id());
+
+COMMIT;
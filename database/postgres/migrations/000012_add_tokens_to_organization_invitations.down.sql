@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP TABLE audit_logs;
+
+ALTER TABLE organization_invitations
+    DROP COLUMN token_hash,
+    DROP COLUMN status,
+    DROP COLUMN expires_at,
+    DROP COLUMN updated_at;
+
+COMMIT;
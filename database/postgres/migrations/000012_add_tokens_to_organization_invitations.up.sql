@@ -0,0 +1,33 @@
+BEGIN;
+
+-- Invitations are accepted with a token emailed to the invitee, stored as a SHA-256 hash. Invitations
+-- made before have no token to accept them with, so they are dropped.
+DELETE FROM organization_invitations;
+
+ALTER TABLE organization_invitations
+    ADD COLUMN token_hash VARCHAR(64) NOT NULL UNIQUE,
+    ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'revoked')),
+    ADD COLUMN expires_at TIMESTAMP NOT NULL,
+    ADD COLUMN updated_at TIMESTAMP DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL,
+    target_id UUID NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_audit_logs_org_id ON audit_logs(org_id, created_at);
+CREATE INDEX idx_audit_logs_target ON audit_logs(target_type, target_id);
+
+ALTER TABLE audit_logs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_logs FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY tenant_isolation ON audit_logs
+    USING (org_id = app_tenant_id());
+
+COMMIT;
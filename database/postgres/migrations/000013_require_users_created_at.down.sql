@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE users ALTER COLUMN created_at DROP NOT NULL;
+
+COMMIT;
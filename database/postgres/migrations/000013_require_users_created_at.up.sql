@@ -0,0 +1,8 @@
+BEGIN;
+
+-- Users are paginated by created_at, which a NULL would drop out of every page after the first.
+UPDATE users SET created_at = COALESCE(updated_at, now()) WHERE created_at IS NULL;
+
+ALTER TABLE users ALTER COLUMN created_at SET NOT NULL;
+
+COMMIT;
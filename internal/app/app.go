@@ -20,6 +20,11 @@ func Run(cfg *config.Config) {
 
 	defer app.PG.Pool.Close()
 	defer app.Redis.Close()
+	defer func() {
+		if err := app.Mailer.Close(); err != nil {
+			app.Logger.Error(fmt.Errorf("app - Run - mailer.Close: %w", err))
+		}
+	}()
 
 	if err := app.PG.Ping(context.Background()); err != nil {
 		app.Logger.Fatal(fmt.Errorf("app - Run - postgres.Ping: %w", err))
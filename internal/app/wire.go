@@ -4,24 +4,35 @@
 package app
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/wire"
 	"github.com/savioruz/goth/config"
 	"github.com/savioruz/goth/internal/delivery/http"
+	"github.com/savioruz/goth/internal/delivery/mail"
 	authHandler "github.com/savioruz/goth/internal/domains/auth/handler"
 	authService "github.com/savioruz/goth/internal/domains/auth/service"
 	oauthHandler "github.com/savioruz/goth/internal/domains/oauth/handler"
 	oauthService "github.com/savioruz/goth/internal/domains/oauth/service"
+	orgHandler "github.com/savioruz/goth/internal/domains/org/handler"
+	orgService "github.com/savioruz/goth/internal/domains/org/service"
+	rbacHandler "github.com/savioruz/goth/internal/domains/rbac/handler"
+	rbacService "github.com/savioruz/goth/internal/domains/rbac/service"
 	userHandler "github.com/savioruz/goth/internal/domains/user/handler"
 	userRepository "github.com/savioruz/goth/internal/domains/user/repository"
 	userService "github.com/savioruz/goth/internal/domains/user/service"
+	"github.com/savioruz/goth/pkg/authz"
 	"github.com/savioruz/goth/pkg/httpserver"
 	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/mailer"
 	"github.com/savioruz/goth/pkg/oauth"
+	"github.com/savioruz/goth/pkg/password"
 	"github.com/savioruz/goth/pkg/postgres"
 	"github.com/savioruz/goth/pkg/redis"
 )
@@ -33,6 +44,7 @@ type Application struct {
 	PG         *postgres.Postgres
 	Redis      *redis.Redis
 	JWT        *jwt.JWT
+	Mailer     *mailer.Mailer
 }
 
 func InitializeApp(cfg *config.Config) (*Application, error) {
@@ -44,20 +56,40 @@ func InitializeApp(cfg *config.Config) (*Application, error) {
 		provideValidator,
 		provideRedis,
 		provideRedisCache,
+		provideJWTKeys,
 		provideJWT,
-		provideGoogleOAuth,
+		wire.Bind(new(jwt.TokenIssuer), new(*jwt.JWT)),
+		wire.Bind(new(jwt.TokenVerifier), new(*jwt.JWT)),
+		provideOAuthRegistry,
+		provideWebAuthn,
+		provideMailer,
+		wire.Bind(new(mailer.Interface), new(*mailer.Mailer)),
+		providePasswordPolicy,
+		providePasswordHashers,
+		provideAuthz,
+		wire.Bind(new(authz.Enforcer), new(*authz.Engine)),
 
 		// Repository providers
 		provideUserQuerier,
 
 		// Service providers
 		authService.New,
+		authService.NewTokenService,
+		authService.NewMailNotifier,
+		authService.NewPasskeyService,
+		authService.NewMagicLinkService,
+		authService.NewLockoutService,
+		authService.NewLogLockoutListener,
 		oauthService.New,
+		orgService.New,
+		rbacService.New,
 		userService.New,
 
 		// Handler providers
 		authHandler.New,
 		oauthHandler.New,
+		orgHandler.New,
+		rbacHandler.New,
 		userHandler.New,
 
 		// HTTP server
@@ -76,7 +108,13 @@ func provideRouter(
 	l logger.Interface,
 	authHandler *authHandler.Handler,
 	oauthHandler *oauthHandler.Handler,
+	orgHandler *orgHandler.Handler,
+	rbacHandler *rbacHandler.Handler,
 	userHandler *userHandler.Handler,
+	verifier jwt.TokenVerifier,
+	tokens authService.TokenService,
+	rbac rbacService.RBACService,
+	org orgService.OrgService,
 ) *fiber.App {
 	app := fiber.New()
 
@@ -86,7 +124,13 @@ func provideRouter(
 		l,
 		authHandler,
 		oauthHandler,
+		orgHandler,
+		rbacHandler,
 		userHandler,
+		verifier,
+		tokens,
+		rbac,
+		org,
 	)
 
 	return app
@@ -100,9 +144,117 @@ func provideLogger(cfg *config.Config) logger.Interface {
 	return logger.New(cfg.Log.Level)
 }
 
-func provideJWT(cfg *config.Config) *jwt.JWT {
-	jwt.Initialize(cfg.App.Name, cfg.JWT.Secret, jwt.ParseDuration(cfg.JWT.AccessTokenExpiry), jwt.ParseDuration(cfg.JWT.RefreshTokenExpiry))
-	return jwt.GetInstance()
+func provideJWTKeys(cfg *config.Config) (*jwt.KeySet, error) {
+	if len(cfg.JWT.Keys) == 0 {
+		key, err := jwt.NewHMACKey(cfg.JWT.SigningKeyID, cfg.JWT.Algorithm, cfg.JWT.Secret)
+		if err != nil {
+			return nil, err
+		}
+
+		return jwt.NewKeySet(key.ID, key)
+	}
+
+	keys := make([]*jwt.Key, 0, len(cfg.JWT.Keys))
+	for id, path := range cfg.JWT.Keys {
+		var retireAt time.Time
+		if value, ok := cfg.JWT.KeysRetireAt[id]; ok {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("jwt: invalid retirement time for key %s: %w", id, err)
+			}
+			retireAt = t
+		}
+
+		algorithm := cfg.JWT.Algorithm
+		if value, ok := cfg.JWT.KeysAlgorithm[id]; ok {
+			algorithm = value
+		}
+
+		key, err := jwt.LoadPEMKey(id, algorithm, path, retireAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return jwt.NewKeySet(cfg.JWT.SigningKeyID, keys...)
+}
+
+func provideJWT(cfg *config.Config, keys *jwt.KeySet) (*jwt.JWT, error) {
+	return jwt.New(cfg.App.Name, keys,
+		jwt.Audience(cfg.JWT.Audience),
+		jwt.AccessTokenExpiry(jwt.ParseDuration(cfg.JWT.AccessTokenExpiry)),
+		jwt.RefreshTokenExpiry(jwt.ParseDuration(cfg.JWT.RefreshTokenExpiry)),
+		jwt.MFATokenExpiry(jwt.ParseDuration(cfg.JWT.MFATokenExpiry)),
+		jwt.MagicLinkTokenExpiry(jwt.ParseDuration(cfg.JWT.MagicLinkExpiry)),
+	)
+}
+
+func provideWebAuthn(cfg *config.Config) (*webauthn.WebAuthn, error) {
+	timeout := webauthn.TimeoutConfig{
+		Enforce:    true,
+		Timeout:    jwt.ParseDuration(cfg.WebAuthn.Timeout),
+		TimeoutUVD: jwt.ParseDuration(cfg.WebAuthn.Timeout),
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        timeout,
+			Registration: timeout,
+		},
+	})
+}
+
+func providePasswordPolicy(cfg *config.Config) (*password.Policy, error) {
+	opts := []password.Option{
+		password.MinLength(cfg.Password.MinLength),
+		password.MaxLength(cfg.Password.MaxLength),
+		password.RequireUpper(cfg.Password.RequireUpper),
+		password.RequireLower(cfg.Password.RequireLower),
+		password.RequireDigit(cfg.Password.RequireDigit),
+		password.RequireSymbol(cfg.Password.RequireSymbol),
+		password.MinScore(cfg.Password.MinScore),
+	}
+
+	if cfg.Password.BreachedPath != "" {
+		breaches, err := password.OpenBreaches(cfg.Password.BreachedPath)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, password.Breaches(breaches))
+	}
+
+	return password.NewPolicy(opts...), nil
+}
+
+func providePasswordHashers(cfg *config.Config) (*password.Hashers, error) {
+	bcrypt := password.NewBcrypt(cfg.Password.BcryptCost)
+	argon2id := password.NewArgon2id(cfg.Password.Argon2Memory, cfg.Password.Argon2Iterations,
+		cfg.Password.Argon2Parallelism)
+
+	switch cfg.Password.HashAlgorithm {
+	case "argon2id":
+		return password.NewHashers(argon2id, bcrypt), nil
+	case "bcrypt":
+		return password.NewHashers(bcrypt, argon2id), nil
+	default:
+		return nil, fmt.Errorf("password: unknown hash algorithm %q", cfg.Password.HashAlgorithm)
+	}
+}
+
+func provideAuthz(cfg *config.Config, l logger.Interface) (*authz.Engine, error) {
+	policies, err := authz.Load(cfg.Authz.PolicyPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	return authz.New(policies,
+		authz.Logger(authz.NewLogDecisionLogger(l)),
+	)
 }
 
 func providePostgres(cfg *config.Config, l logger.Interface) (*postgres.Postgres, error) {
@@ -115,7 +267,7 @@ func providePostgres(cfg *config.Config, l logger.Interface) (*postgres.Postgres
 }
 
 func providePgxIface(pg *postgres.Postgres) postgres.PgxIface {
-	return pg.Pool
+	return postgres.Scoped(pg.Pool)
 }
 
 func provideRedis(cfg *config.Config) (*redis.Redis, error) {
@@ -131,8 +283,68 @@ func provideValidator() *validator.Validate {
 	return validator.New(validator.WithRequiredStructEnabled())
 }
 
-func provideGoogleOAuth(cfg *config.Config) oauth.GoogleProviderIface {
-	return oauth.NewGoogleProvider(cfg.OAuth.Google.ClientID, cfg.OAuth.Google.ClientSecret, cfg.OAuth.Google.RedirectURL)
+func provideOAuthRegistry(cfg *config.Config) (*oauth.Registry, error) {
+	// OIDC issuers are discovered at startup, so that a misconfigured one is noticed right away.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	providers := make([]oauth.Provider, 0, len(cfg.OAuth.Providers))
+	seen := make(map[string]bool, len(cfg.OAuth.Providers))
+
+	for _, p := range cfg.OAuth.Providers {
+		if seen[p.Name] {
+			return nil, fmt.Errorf("oauth provider %q is configured twice", p.Name)
+		}
+
+		seen[p.Name] = true
+
+		switch p.Type {
+		case "oidc":
+			provider, err := oauth.NewOIDCProvider(ctx, p.Name, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURL,
+				oauth.Scopes(p.Scopes...))
+			if err != nil {
+				return nil, err
+			}
+
+			providers = append(providers, provider)
+		case "github":
+			providers = append(providers, oauth.NewGitHubProvider(p.Name, p.Issuer, p.ClientID, p.ClientSecret,
+				p.RedirectURL, oauth.Scopes(p.Scopes...)))
+		default:
+			return nil, fmt.Errorf("unknown type %q of oauth provider %q", p.Type, p.Name)
+		}
+	}
+
+	return oauth.NewRegistry(providers...), nil
+}
+
+func provideMailer(cfg *config.Config, l logger.Interface) (*mailer.Mailer, error) {
+	templates, err := mailer.ParseTemplates(mail.Templates(), cfg.Mailer.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	var sender mailer.Sender
+	switch cfg.Mailer.Driver {
+	case "smtp":
+		sender = mailer.NewSMTPSender(cfg.Mailer.SMTP.Host, cfg.Mailer.SMTP.Port, cfg.Mailer.SMTP.Username,
+			cfg.Mailer.SMTP.Password, cfg.Mailer.SMTP.ImplicitTLS)
+	case "file":
+		sender, err = mailer.NewFileSender(cfg.Mailer.FilePath)
+		if err != nil {
+			return nil, err
+		}
+	case "memory":
+		sender = mailer.NewMemorySender()
+	default:
+		return nil, fmt.Errorf("mailer: unknown driver %q", cfg.Mailer.Driver)
+	}
+
+	return mailer.New(sender, templates, l,
+		mailer.From(cfg.Mailer.From),
+		mailer.Workers(cfg.Mailer.Workers),
+		mailer.QueueSize(cfg.Mailer.QueueSize),
+	), nil
 }
 
 func provideHTTPServer(cfg *config.Config, app *fiber.App) *httpserver.Server {
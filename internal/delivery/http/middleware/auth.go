@@ -1,15 +1,23 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"github.com/savioruz/goth/pkg/failure"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/savioruz/goth/internal/delivery/http/response"
 	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/postgres"
 )
 
-func Jwt() fiber.Handler {
+// Revoker reports whether a token was revoked before it expired, e.g. by logging out.
+type Revoker interface {
+	IsRevoked(ctx context.Context, claims *jwt.Claims) (bool, error)
+}
+
+func Jwt(verifier jwt.TokenVerifier, revoker Revoker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -25,19 +33,51 @@ func Jwt() fiber.Handler {
 			return response.WithError(c, err)
 		}
 
-		claims, err := jwt.ValidateToken(parts[1])
+		claims, err := verifier.ValidateAccessToken(parts[1])
+		if err != nil {
+			err := failure.Unauthorized(tokenErrorReason(err))
+
+			return response.WithError(c, err)
+		}
+
+		revoked, err := revoker.IsRevoked(c.UserContext(), claims)
 		if err != nil {
-			err := failure.Unauthorized("invalid token")
+			return response.WithError(c, failure.InternalError(err))
+		}
+
+		if revoked {
+			err := failure.Unauthorized("token revoked")
 
 			return response.WithError(c, err)
 		}
 
 		if claims != nil {
+			c.Locals("claims", claims)
 			c.Locals("user_id", claims.ID)
 			c.Locals("email", claims.Email)
-			c.Locals("level", claims.Level)
+			c.SetUserContext(postgres.WithScope(c.UserContext(), postgres.Scope{UserID: claims.ID}))
 		}
 
 		return c.Next()
 	}
 }
+
+// tokenErrorReason maps a token validation error to the reason returned to the client.
+func tokenErrorReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "token expired"
+	case errors.Is(err, jwt.ErrTokenNotYetValid):
+		return "token not yet valid"
+	case errors.Is(err, jwt.ErrWrongTokenType):
+		return "wrong token type"
+	case errors.Is(err, jwt.ErrInvalidSignature):
+		return "invalid token signature"
+	case errors.Is(err, jwt.ErrInvalidAudience):
+		return "invalid token audience"
+	case errors.Is(err, jwt.ErrInvalidIssuer):
+		return "invalid token issuer"
+	default:
+		return "invalid token"
+	}
+}
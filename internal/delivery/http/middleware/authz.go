@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/internal/delivery/http/response"
+	"github.com/savioruz/goth/pkg/authz"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+)
+
+// Authorize guards a route with the policies of the action. resource describes what the request acts
+// on, nil for nothing in particular. The subject carries the permissions Require looked up, so it
+// should run after Jwt and Require.
+func Authorize(enforcer authz.Enforcer, action string, resource func(c *fiber.Ctx) authz.Resource) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := authz.Request{
+			Action:      action,
+			Environment: authz.Environment{IP: c.IP()},
+		}
+
+		if claims, ok := c.Locals("claims").(*jwt.Claims); ok {
+			req.Subject = claims
+		}
+
+		if permissions, ok := c.Locals("permissions").([]string); ok {
+			req.SubjectAttributes = map[string]any{"permissions": permissions}
+		}
+
+		if resource != nil {
+			req.Resource = resource(c)
+		}
+
+		err := enforcer.Authorize(c.UserContext(), req)
+		if errors.Is(err, authz.ErrDenied) {
+			return response.WithError(c, failure.Forbidden("not allowed to "+action))
+		}
+
+		if err != nil {
+			return response.WithError(c, failure.InternalError(err))
+		}
+
+		return c.Next()
+	}
+}
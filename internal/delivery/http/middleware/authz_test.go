@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/pkg/authz"
+	"github.com/savioruz/goth/pkg/authz/mock"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestAuthorize(t *testing.T) {
+	claims := &jwt.Claims{ID: "u1"}
+	permissions := []string{"roles:read"}
+
+	tests := []struct {
+		name     string
+		err      error
+		resource func(c *fiber.Ctx) authz.Resource
+		want     authz.Request
+		status   int
+	}{
+		{
+			name:   "success: allowed",
+			want:   authz.Request{Action: "roles:assign"},
+			status: http.StatusNoContent,
+		},
+		{
+			name: "success: resource of the request",
+			resource: func(c *fiber.Ctx) authz.Resource {
+				return authz.Resource{Type: "user", ID: c.Params("id")}
+			},
+			want:   authz.Request{Action: "roles:assign", Resource: authz.Resource{Type: "user", ID: "u2"}},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "error: denied",
+			err:    authz.ErrDenied,
+			want:   authz.Request{Action: "roles:assign"},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "error: enforcer failed",
+			err:    errors.New("policy store unavailable"),
+			want:   authz.Request{Action: "roles:assign"},
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			enforcer := mock.NewMockEnforcer(ctrl)
+
+			var got authz.Request
+			enforcer.EXPECT().Authorize(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ any, req authz.Request) error {
+					got = req
+
+					return tt.err
+				})
+
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("claims", claims)
+				c.Locals("permissions", permissions)
+
+				return c.Next()
+			})
+			app.Post("/users/:id/roles", Authorize(enforcer, "roles:assign", tt.resource), func(c *fiber.Ctx) error {
+				return c.SendStatus(http.StatusNoContent)
+			})
+
+			res, err := app.Test(httptest.NewRequest(http.MethodPost, "/users/u2/roles", nil))
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.status, res.StatusCode)
+			assert.Equal(t, tt.want.Action, got.Action)
+			assert.Equal(t, tt.want.Resource, got.Resource)
+			assert.Equal(t, claims, got.Subject)
+			assert.Equal(t, map[string]any{"permissions": permissions}, got.SubjectAttributes)
+			assert.NotEmpty(t, got.Environment.IP)
+		})
+	}
+}
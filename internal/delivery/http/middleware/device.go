@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/pkg/device"
+)
+
+// Device puts the device of the request in its context, for the sessions started or refreshed by it.
+// Clients may name themselves with the X-Device-Name header.
+func Device() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		info := device.New(c.Get("X-Device-Name"), c.Get(fiber.HeaderUserAgent), c.IP())
+
+		c.SetUserContext(device.NewContext(c.UserContext(), info))
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/pkg/mailer"
+)
+
+// Locale puts the preferred language of the request in its context, for the emails sent on its behalf.
+func Locale() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if locale := mailer.PreferredLocale(c.Get(fiber.HeaderAcceptLanguage)); locale != "" {
+			c.SetUserContext(mailer.WithLocale(c.UserContext(), locale))
+		}
+
+		return c.Next()
+	}
+}
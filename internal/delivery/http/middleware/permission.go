@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/internal/delivery/http/response"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+)
+
+// Authorizer returns the names of the permissions a user holds.
+type Authorizer interface {
+	Permissions(ctx context.Context, userID string) ([]string, error)
+}
+
+// Require only lets users through that hold every one of the permissions. It must run after Jwt.
+// The permissions of the user are looked up once per request.
+func Require(authorizer Authorizer, permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("claims").(*jwt.Claims)
+		if !ok {
+			return response.WithError(c, failure.Forbidden("permission required"))
+		}
+
+		held, ok := c.Locals("permissions").([]string)
+		if !ok {
+			var err error
+
+			held, err = authorizer.Permissions(c.UserContext(), claims.ID)
+			if err != nil {
+				return response.WithError(c, err)
+			}
+
+			c.Locals("permissions", held)
+		}
+
+		for _, permission := range permissions {
+			if !slices.Contains(held, permission) {
+				return response.WithError(c, failure.Forbidden("missing permission "+permission))
+			}
+		}
+
+		return c.Next()
+	}
+}
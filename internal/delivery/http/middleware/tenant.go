@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/internal/delivery/http/response"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/tenant"
+)
+
+// Memberships looks up the membership of a user in an organization, failing for non-members.
+type Memberships interface {
+	Membership(ctx context.Context, orgID, userID string) (tenant.Tenant, error)
+}
+
+// Tenant puts the active organization of the token in the context of the request, for routes that
+// act in it. Membership is checked on every request, so that members who were removed lose access
+// right away rather than when their token expires. Queries of the request are scoped to the
+// organization for row-level security. It must run after Jwt.
+func Tenant(memberships Memberships) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("claims").(*jwt.Claims)
+		if !ok || claims.OrgID == "" {
+			return response.WithError(c, failure.Forbidden("no active organization"))
+		}
+
+		t, err := memberships.Membership(c.UserContext(), claims.OrgID, claims.ID)
+		if err != nil {
+			return response.WithError(c, err)
+		}
+
+		c.Locals("tenant", t)
+		ctx := tenant.NewContext(c.UserContext(), t)
+		ctx = postgres.WithScope(ctx, postgres.Scope{UserID: t.UserID, TenantID: t.OrgID})
+
+		c.SetUserContext(ctx)
+
+		return c.Next()
+	}
+}
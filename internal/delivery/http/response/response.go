@@ -10,7 +10,8 @@ type Data[T any] struct {
 }
 
 type Error struct {
-	Error *string `json:"error,omitempty"`
+	Error  *string              `json:"error,omitempty"`
+	Fields []failure.FieldError `json:"fields,omitempty"`
 }
 
 func WithJSON(ctx *fiber.Ctx, code int, payload interface{}) error {
@@ -26,7 +27,7 @@ func WithError(ctx *fiber.Ctx, err error) error {
 	code := failure.GetCode(err)
 	errMsg := err.Error()
 
-	return response(ctx, code, Error{Error: &errMsg})
+	return response(ctx, code, Error{Error: &errMsg, Fields: failure.GetFields(err)})
 }
 
 func response(ctx *fiber.Ctx, code int, payload interface{}) error {
@@ -6,10 +6,14 @@ import (
 	"github.com/savioruz/goth/config"
 	_ "github.com/savioruz/goth/docs" // Swagger docs
 	authHandler "github.com/savioruz/goth/internal/domains/auth/handler"
+	authService "github.com/savioruz/goth/internal/domains/auth/service"
 	oauthHandler "github.com/savioruz/goth/internal/domains/oauth/handler"
+	orgHandler "github.com/savioruz/goth/internal/domains/org/handler"
+	rbacHandler "github.com/savioruz/goth/internal/domains/rbac/handler"
 	userHandler "github.com/savioruz/goth/internal/domains/user/handler"
 
 	"github.com/savioruz/goth/internal/delivery/http/middleware"
+	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/logger"
 )
 
@@ -26,22 +30,47 @@ func NewRouter(
 	l logger.Interface,
 	authHandler *authHandler.Handler,
 	oauthHandler *oauthHandler.Handler,
+	orgHandler *orgHandler.Handler,
+	rbacHandler *rbacHandler.Handler,
 	userHandler *userHandler.Handler,
+	verifier jwt.TokenVerifier,
+	tokens authService.TokenService,
+	authorizer middleware.Authorizer,
+	memberships middleware.Memberships,
 ) {
 	// Options
 	app.Use(middleware.Logger(l))
 	app.Use(middleware.Recovery(l))
 	app.Use(middleware.RequestID())
+	app.Use(middleware.Device())
+	app.Use(middleware.Locale())
+
+	app.Get("/.well-known/jwks.json", authHandler.JWKS)
 
 	if cfg.Swagger.Enabled {
 		app.Get("/swagger/*", swagger.HandlerDefault)
 	}
 
+	requireAuth := middleware.Jwt(verifier, tokens)
+	requireTenant := middleware.Tenant(memberships)
+	require := func(permissions ...string) fiber.Handler {
+		return middleware.Require(authorizer, permissions...)
+	}
+
 	apiV1Group := app.Group("/v1")
 	{
-		authHandler.RegisterRoutes(apiV1Group)
-		oauthHandler.RegisterRoutes(apiV1Group)
-		userHandler.RegisterRoutes(apiV1Group)
+		authHandler.RegisterRoutes(apiV1Group, requireAuth)
+		oauthHandler.RegisterRoutes(apiV1Group, requireAuth)
+		orgHandler.RegisterRoutes(apiV1Group, requireAuth, requireTenant)
+		rbacHandler.RegisterRoutes(apiV1Group, requireAuth)
+		userHandler.RegisterRoutes(apiV1Group, requireAuth)
+	}
+
+	adminGroup := apiV1Group.Group("/admin", requireAuth)
+	{
+		authHandler.RegisterAdminRoutes(adminGroup, require)
+		rbacHandler.RegisterAdminRoutes(adminGroup, require)
+		userHandler.RegisterAdminRoutes(adminGroup, require)
 	}
 
 	app.Use("*", func(c *fiber.Ctx) error {
@@ -0,0 +1,19 @@
+// Package mail embeds the templates of the emails sent by the application, see mailer.ParseTemplates.
+package mail
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed templates
+var templates embed.FS
+
+func Templates() fs.FS {
+	sub, err := fs.Sub(templates, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
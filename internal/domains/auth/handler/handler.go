@@ -1,44 +1,90 @@
 package handler
 
 import (
+	"errors"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/savioruz/goth/internal/delivery/http/response"
 	"github.com/savioruz/goth/internal/domains/auth/service"
 	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/logger"
 )
 
+var (
+	ErrClaimsNil = errors.New("claims is nil")
+)
+
 type Handler struct {
-	service   service.AuthService
-	logger    logger.Interface
-	validator *validator.Validate
+	service    service.AuthService
+	passkeys   service.PasskeyService
+	magicLinks service.MagicLinkService
+	logger     logger.Interface
+	validator  *validator.Validate
 }
 
-func New(s service.AuthService, l logger.Interface, v *validator.Validate) *Handler {
+func New(
+	s service.AuthService,
+	p service.PasskeyService,
+	m service.MagicLinkService,
+	l logger.Interface,
+	v *validator.Validate,
+) *Handler {
 	return &Handler{
-		service:   s,
-		logger:    l,
-		validator: v,
+		service:    s,
+		passkeys:   p,
+		magicLinks: m,
+		logger:     l,
+		validator:  v,
 	}
 }
 
-func (h *Handler) RegisterRoutes(r fiber.Router) {
+func (h *Handler) RegisterRoutes(r fiber.Router, requireAuth fiber.Handler) {
 	auth := r.Group("/auth")
 
 	auth.Post("/register", h.Register)
 	auth.Post("/login", h.Login)
+	auth.Post("/refresh", h.Refresh)
+	auth.Post("/logout", requireAuth, h.Logout)
+	auth.Post("/logout/all", requireAuth, h.LogoutAll)
+	auth.Post("/verify-email/send", requireAuth, h.SendVerification)
+	auth.Post("/verify-email/resend", h.ResendVerification)
+	auth.Post("/verify-email/confirm", h.ConfirmEmail)
+	auth.Post("/password/forgot", h.ForgotPassword)
+	auth.Post("/password/reset", h.ResetPassword)
+	auth.Post("/magic-link", h.SendMagicLink)
+	auth.Post("/magic-link/consume", h.ConsumeMagicLink)
+	auth.Post("/mfa/enroll", requireAuth, h.EnrollMFA)
+	auth.Post("/mfa/confirm", requireAuth, h.ConfirmMFA)
+	auth.Post("/mfa/disable", requireAuth, h.DisableMFA)
+	auth.Post("/mfa/verify", h.VerifyMFA)
+	auth.Post("/passkeys/register/begin", requireAuth, h.BeginPasskeyRegistration)
+	auth.Post("/passkeys/register/finish", requireAuth, h.FinishPasskeyRegistration)
+	auth.Post("/passkeys/login/begin", h.BeginPasskeyLogin)
+	auth.Post("/passkeys/login/finish", h.FinishPasskeyLogin)
+
+	r.Get("/users/me/sessions", requireAuth, h.ListSessions)
+	r.Delete("/users/me/sessions", requireAuth, h.RevokeOtherSessions)
+	r.Delete("/users/me/sessions/:id", requireAuth, h.RevokeSession)
+}
+
+// RegisterAdminRoutes registers routes on a group of signed in users. require guards a route with
+// the permissions it needs.
+func (h *Handler) RegisterAdminRoutes(r fiber.Router, require func(permissions ...string) fiber.Handler) {
+	r.Post("/users/:id/unlock", require("users:write"), h.UnlockUser)
 }
 
 // Register godoc
 // @Summary Register new user
-// @Description Register new user with email and password
+// @Description Register new user with email and password. A password that breaks the password policy is rejected with a 400 listing every broken rule in fields.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param register body dto.UserRegisterRequest true "User register request"
 // @Success 201 {object} response.Data[dto.UserRegisterResponse]
 // @Failure 400 {object} response.Error
+// @Failure 409 {object} response.Error
 // @Failure 500 {object} response.Error
 // @Router /auth/register [post]
 func (h *Handler) Register(ctx *fiber.Ctx) error {
@@ -72,13 +118,14 @@ func (h *Handler) Register(ctx *fiber.Ctx) error {
 
 // Login godoc
 // @Summary Login user
-// @Description Login user with email and password
+// @Description Login user with email and password. Accounts with MFA enabled get an mfa_token to pass to /auth/mfa/verify instead of a token pair. Repeated failures lock the account or client IP out for a growing delay; unknown emails, wrong passwords of any length and lockouts all return the same 401.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param login body dto.UserLoginRequest true "User login request"
 // @Success 201 {object} response.Data[dto.UserLoginResponse]
 // @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
 // @Failure 500 {object} response.Error
 // @Router /auth/login [post]
 func (h *Handler) Login(ctx *fiber.Ctx) error {
@@ -95,7 +142,7 @@ func (h *Handler) Login(ctx *fiber.Ctx) error {
 		return response.WithError(ctx, err)
 	}
 
-	data, err := h.service.Login(ctx.UserContext(), req)
+	data, err := h.service.Login(ctx.UserContext(), req, ctx.IP())
 	if err != nil {
 		reqID := "unknown"
 		if id, ok := ctx.Locals("request_id").(string); ok {
@@ -109,3 +156,808 @@ func (h *Handler) Login(ctx *fiber.Ctx) error {
 
 	return response.WithJSON(ctx, fiber.StatusOK, data)
 }
+
+// Refresh godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access and refresh token pair. Each refresh token can be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param refresh body dto.RefreshTokenRequest true "Refresh token request"
+// @Success 200 {object} response.Data[dto.UserLoginResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/refresh [post]
+func (h *Handler) Refresh(ctx *fiber.Ctx) error {
+	var req dto.RefreshTokenRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - refresh - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - refresh - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.Refresh(ctx.UserContext(), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - refresh - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// Logout godoc
+// @Summary Logout current device
+// @Description Revoke the current access token and its refresh token family
+// @Tags auth
+// @Produce json
+// @Success 204
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/logout [post]
+// @Security BearerAuth
+func (h *Handler) Logout(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - logout - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.Logout(ctx.UserContext(), claims); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - logout - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// LogoutAll godoc
+// @Summary Logout all devices
+// @Description Revoke every access and refresh token issued to the current user
+// @Tags auth
+// @Produce json
+// @Success 204
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/logout/all [post]
+// @Security BearerAuth
+func (h *Handler) LogoutAll(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - logout all - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.LogoutAll(ctx.UserContext(), claims); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - logout all - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ListSessions godoc
+// @Summary List sessions
+// @Description List the devices the signed in user is logged in on, most recently used first. The session of the request is marked current.
+// @Tags users
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.SessionResponse]
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/sessions [get]
+// @Security BearerAuth
+func (h *Handler) ListSessions(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - user - list sessions - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.service.ListSessions(ctx.UserContext(), claims)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - user - list sessions - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// RevokeSession godoc
+// @Summary Revoke a session
+// @Description Log the signed in user out of the device of the session. Its tokens stop working right away.
+// @Tags users
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/sessions/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) RevokeSession(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - user - revoke session - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.RevokeSession(ctx.UserContext(), claims, ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - user - revoke session - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeOtherSessions godoc
+// @Summary Revoke other sessions
+// @Description Log the signed in user out of every device but the one making the request
+// @Tags users
+// @Produce json
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/sessions [delete]
+// @Security BearerAuth
+func (h *Handler) RevokeOtherSessions(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - user - revoke other sessions - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.RevokeOtherSessions(ctx.UserContext(), claims); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - user - revoke other sessions - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// SendVerification godoc
+// @Summary Send verification email
+// @Description Send a new email verification link to the current user. Earlier links stop working.
+// @Tags auth
+// @Produce json
+// @Success 202
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/verify-email/send [post]
+// @Security BearerAuth
+func (h *Handler) SendVerification(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - send verification - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.SendVerification(ctx.UserContext(), claims); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - send verification - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new email verification link to an unverified account. The response does not reveal whether the account exists.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param resend body dto.ResendVerificationRequest true "Resend verification request"
+// @Success 202
+// @Failure 400 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/verify-email/resend [post]
+func (h *Handler) ResendVerification(ctx *fiber.Ctx) error {
+	var req dto.ResendVerificationRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - resend verification - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - resend verification - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.ResendVerification(ctx.UserContext(), req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - resend verification - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// ConfirmEmail godoc
+// @Summary Confirm email address
+// @Description Consume an email verification token and mark the email address as verified
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param confirm body dto.ConfirmEmailRequest true "Confirm email request"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/verify-email/confirm [post]
+func (h *Handler) ConfirmEmail(ctx *fiber.Ctx) error {
+	var req dto.ConfirmEmailRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - confirm email - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - confirm email - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.ConfirmEmail(ctx.UserContext(), req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - confirm email - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Send a password reset link to the given email. The response does not reveal whether the account exists.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param forgot body dto.ForgotPasswordRequest true "Forgot password request"
+// @Success 202
+// @Failure 400 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/password/forgot [post]
+func (h *Handler) ForgotPassword(ctx *fiber.Ctx) error {
+	var req dto.ForgotPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - forgot password - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - forgot password - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.ForgotPassword(ctx.UserContext(), req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - forgot password - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// SendMagicLink godoc
+// @Summary Request magic link
+// @Description Send a one-time sign-in link to the given email. The response does not reveal whether the account exists.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param magicLink body dto.MagicLinkRequest true "Magic link request"
+// @Success 202
+// @Failure 400 {object} response.Error
+// @Failure 429 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/magic-link [post]
+func (h *Handler) SendMagicLink(ctx *fiber.Ctx) error {
+	var req dto.MagicLinkRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - send magic link - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - send magic link - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.magicLinks.Send(ctx.UserContext(), req, ctx.IP()); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - send magic link - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// ConsumeMagicLink godoc
+// @Summary Sign in with magic link
+// @Description Exchange the token from a magic link for a token pair, creating the account if needed. Accounts with MFA get an mfa_token instead. Each link can be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param consume body dto.ConsumeMagicLinkRequest true "Consume magic link request"
+// @Success 200 {object} response.Data[dto.UserLoginResponse]
+// @Failure 400 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/magic-link/consume [post]
+func (h *Handler) ConsumeMagicLink(ctx *fiber.Ctx) error {
+	var req dto.ConsumeMagicLinkRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - consume magic link - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - consume magic link - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.magicLinks.Consume(ctx.UserContext(), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - consume magic link - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with a password reset token. The new password must meet the password policy; broken rules are listed in fields. Every session of the user is signed out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reset body dto.ResetPasswordRequest true "Reset password request"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/password/reset [post]
+func (h *Handler) ResetPassword(ctx *fiber.Ctx) error {
+	var req dto.ResetPasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - reset password - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - reset password - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.ResetPassword(ctx.UserContext(), req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - reset password - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// EnrollMFA godoc
+// @Summary Start MFA enrollment
+// @Description Generate a TOTP secret for the current user. MFA is enabled once a code is confirmed.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} response.Data[dto.MFAEnrollResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/mfa/enroll [post]
+// @Security BearerAuth
+func (h *Handler) EnrollMFA(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - enroll mfa - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.service.EnrollMFA(ctx.UserContext(), claims)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - enroll mfa - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// ConfirmMFA godoc
+// @Summary Confirm MFA enrollment
+// @Description Enable MFA with a code from the authenticator app. The recovery codes in the response are shown only once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param confirm body dto.ConfirmMFARequest true "Confirm MFA request"
+// @Success 200 {object} response.Data[dto.MFARecoveryCodesResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/mfa/confirm [post]
+// @Security BearerAuth
+func (h *Handler) ConfirmMFA(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - confirm mfa - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	var req dto.ConfirmMFARequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - confirm mfa - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - confirm mfa - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.ConfirmMFA(ctx.UserContext(), claims, req, ctx.IP())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - confirm mfa - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// DisableMFA godoc
+// @Summary Disable MFA
+// @Description Disable MFA with a code from the authenticator app or a recovery code.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param disable body dto.DisableMFARequest true "Disable MFA request"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/mfa/disable [post]
+// @Security BearerAuth
+func (h *Handler) DisableMFA(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - disable mfa - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	var req dto.DisableMFARequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - disable mfa - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - disable mfa - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.DisableMFA(ctx.UserContext(), claims, req, ctx.IP()); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - disable mfa - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// VerifyMFA godoc
+// @Summary Verify MFA
+// @Description Exchange the mfa_token from login and a code from the authenticator app or a recovery code for a token pair. Each mfa_token can be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param verify body dto.VerifyMFARequest true "Verify MFA request"
+// @Success 200 {object} response.Data[dto.UserLoginResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/mfa/verify [post]
+func (h *Handler) VerifyMFA(ctx *fiber.Ctx) error {
+	var req dto.VerifyMFARequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - auth - verify mfa - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - auth - verify mfa - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.VerifyMFA(ctx.UserContext(), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - verify mfa - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// BeginPasskeyRegistration godoc
+// @Summary Begin passkey registration
+// @Description Get the options to pass to navigator.credentials.create for the current user.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} response.Data[any]
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/passkeys/register/begin [post]
+// @Security BearerAuth
+func (h *Handler) BeginPasskeyRegistration(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - begin passkey registration - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.passkeys.BeginRegistration(ctx.UserContext(), claims)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - begin passkey registration - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// FinishPasskeyRegistration godoc
+// @Summary Finish passkey registration
+// @Description Register the credential returned by navigator.credentials.create, posted as JSON.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 201 {object} response.Data[dto.PasskeyResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/passkeys/register/finish [post]
+// @Security BearerAuth
+func (h *Handler) FinishPasskeyRegistration(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - auth - finish passkey registration - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.passkeys.FinishRegistration(ctx.UserContext(), claims, ctx.Body())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - finish passkey registration - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusCreated, data)
+}
+
+// BeginPasskeyLogin godoc
+// @Summary Begin passkey login
+// @Description Get the options to pass to navigator.credentials.get. The authenticator offers its passkeys for this site.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} response.Data[any]
+// @Failure 500 {object} response.Error
+// @Router /auth/passkeys/login/begin [post]
+func (h *Handler) BeginPasskeyLogin(ctx *fiber.Ctx) error {
+	data, err := h.passkeys.BeginLogin(ctx.UserContext())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - begin passkey login - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// FinishPasskeyLogin godoc
+// @Summary Finish passkey login
+// @Description Exchange the assertion returned by navigator.credentials.get, posted as JSON, for a token pair.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Data[dto.UserLoginResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /auth/passkeys/login/finish [post]
+func (h *Handler) FinishPasskeyLogin(ctx *fiber.Ctx) error {
+	data, err := h.passkeys.FinishLogin(ctx.UserContext(), ctx.Body())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - auth - finish passkey login - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// JWKS serves the public signing keys so that other services can verify tokens without sharing secrets.
+// It is mounted at /.well-known/jwks.json, outside the versioned API.
+func (h *Handler) JWKS(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+	return ctx.Status(fiber.StatusOK).JSON(h.service.PublicKeys())
+}
+
+// UnlockUser godoc
+// @Summary Unlock user
+// @Description Lift a login lockout of the user's account and forget its failed logins. Requires users:write.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id}/unlock [post]
+// @Security BearerAuth
+func (h *Handler) UnlockUser(ctx *fiber.Ctx) error {
+	if err := h.service.UnlockUser(ctx.UserContext(), ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - unlock user - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
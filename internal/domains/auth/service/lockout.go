@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/savioruz/goth/config"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/redis"
+)
+
+// LockoutService tracks failed password logins per account and per client IP. Once either reaches
+// its threshold it is locked out, first for the base delay, and the delay doubles with every further
+// failure up to the maximum. Failures are forgotten a day after the last one, and an account's
+// failures are also forgotten when it signs in.
+type LockoutService interface {
+	Locked(ctx context.Context, email, ip string) (bool, error)
+	Fail(ctx context.Context, email, ip string)
+	Reset(ctx context.Context, email string)
+	Unlock(ctx context.Context, email string) error
+}
+
+const (
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+
+	loginFailuresKey = "auth:login_failures:%s:%s"
+	lockoutKey       = "auth:lockout:%s:%s"
+
+	loginFailureWindow = 24 * time.Hour
+)
+
+// LockoutListener is told about every lockout, e.g. to alert on credential stuffing.
+type LockoutListener interface {
+	Locked(ctx context.Context, event dto.LockoutEvent)
+}
+
+type lockoutService struct {
+	cache        redis.IRedisCache
+	listener     LockoutListener
+	accountLimit int64
+	ipLimit      int64
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	logger       logger.Interface
+	now          func() time.Time
+}
+
+func NewLockoutService(c redis.IRedisCache, ll LockoutListener, cfg *config.Config, l logger.Interface) LockoutService {
+	return &lockoutService{
+		cache:        c,
+		listener:     ll,
+		accountLimit: int64(cfg.Auth.LockoutAccountThreshold),
+		ipLimit:      int64(cfg.Auth.LockoutIPThreshold),
+		baseDelay:    jwt.ParseDuration(cfg.Auth.LockoutBaseDelay),
+		maxDelay:     jwt.ParseDuration(cfg.Auth.LockoutMaxDelay),
+		logger:       l,
+		now:          time.Now,
+	}
+}
+
+func (s *lockoutService) Locked(ctx context.Context, email, ip string) (bool, error) {
+	locked, err := s.cache.Exists(ctx, fmt.Sprintf(lockoutKey, LockoutScopeAccount, normalizeEmail(email)))
+	if err != nil || locked {
+		return locked, err
+	}
+
+	return s.cache.Exists(ctx, fmt.Sprintf(lockoutKey, LockoutScopeIP, ip))
+}
+
+// Fail records a failed login. Errors are only logged so that the caller answers the same either way.
+func (s *lockoutService) Fail(ctx context.Context, email, ip string) {
+	s.fail(ctx, LockoutScopeAccount, normalizeEmail(email), s.accountLimit)
+	s.fail(ctx, LockoutScopeIP, ip, s.ipLimit)
+}
+
+func (s *lockoutService) Reset(ctx context.Context, email string) {
+	err := s.cache.Delete(ctx, fmt.Sprintf(loginFailuresKey, LockoutScopeAccount, normalizeEmail(email)))
+	if err != nil {
+		s.logger.Error("lockout - service - failed to reset login failures: %w", err)
+	}
+}
+
+func (s *lockoutService) Unlock(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+
+	if err := s.cache.Delete(ctx, fmt.Sprintf(lockoutKey, LockoutScopeAccount, email)); err != nil {
+		s.logger.Error("lockout - service - failed to delete lockout: %w", err)
+
+		return err
+	}
+
+	if err := s.cache.Delete(ctx, fmt.Sprintf(loginFailuresKey, LockoutScopeAccount, email)); err != nil {
+		s.logger.Error("lockout - service - failed to reset login failures: %w", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *lockoutService) fail(ctx context.Context, scope, subject string, limit int64) {
+	failures, err := s.cache.IncrementSliding(ctx, fmt.Sprintf(loginFailuresKey, scope, subject), ttlSeconds(loginFailureWindow))
+	if err != nil {
+		s.logger.Error("lockout - service - failed to count login failure: %w", err)
+
+		return
+	}
+
+	if limit <= 0 || failures < limit {
+		return
+	}
+
+	delay := s.delay(failures - limit)
+
+	err = s.cache.Save(ctx, fmt.Sprintf(lockoutKey, scope, subject), failures, ttlSeconds(delay))
+	if err != nil {
+		s.logger.Error("lockout - service - failed to save lockout: %w", err)
+
+		return
+	}
+
+	s.listener.Locked(ctx, dto.LockoutEvent{
+		Scope:    scope,
+		Subject:  subject,
+		Failures: failures,
+		Until:    s.now().Add(delay),
+	})
+}
+
+// delay returns the base delay doubled once per failure beyond the threshold, capped at the maximum.
+func (s *lockoutService) delay(excess int64) time.Duration {
+	delay := s.baseDelay
+	for i := int64(0); i < excess && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, s.maxDelay)
+}
+
+type logLockoutListener struct {
+	logger logger.Interface
+}
+
+// NewLogLockoutListener returns a listener that writes lockouts to the log.
+func NewLogLockoutListener(l logger.Interface) LockoutListener {
+	return &logLockoutListener{logger: l}
+}
+
+func (l *logLockoutListener) Locked(_ context.Context, event dto.LockoutEvent) {
+	l.logger.Warn("lockout - %s %s locked out until %s after %d failed logins",
+		event.Scope, event.Subject, event.Until.Format(time.RFC3339), event.Failures)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
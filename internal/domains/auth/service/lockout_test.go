@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestLockoutService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockListener := authMock.NewMockLockoutListener(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	cfg := &config.Config{}
+	cfg.Auth.LockoutAccountThreshold = 5
+	cfg.Auth.LockoutIPThreshold = 20
+	cfg.Auth.LockoutBaseDelay = "30s"
+	cfg.Auth.LockoutMaxDelay = "1h"
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	service := NewLockoutService(mockRedis, mockListener, cfg, mockLogger)
+	service.(*lockoutService).now = func() time.Time { return now }
+
+	email := "Test@Example.com "
+	ip := "203.0.113.7"
+	accountFailures := "auth:login_failures:account:test@example.com"
+	ipFailures := "auth:login_failures:ip:203.0.113.7"
+	accountLock := "auth:lockout:account:test@example.com"
+	ipLock := "auth:lockout:ip:203.0.113.7"
+
+	t.Run("success: not locked", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), accountLock).Return(false, nil)
+		mockRedis.EXPECT().Exists(gomock.Any(), ipLock).Return(false, nil)
+
+		locked, err := service.Locked(ctx, email, ip)
+
+		assert.NoError(t, err)
+		assert.False(t, locked)
+	})
+
+	t.Run("success: account locked", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), accountLock).Return(true, nil)
+
+		locked, err := service.Locked(ctx, email, ip)
+
+		assert.NoError(t, err)
+		assert.True(t, locked)
+	})
+
+	t.Run("success: ip locked", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), accountLock).Return(false, nil)
+		mockRedis.EXPECT().Exists(gomock.Any(), ipLock).Return(true, nil)
+
+		locked, err := service.Locked(ctx, email, ip)
+
+		assert.NoError(t, err)
+		assert.True(t, locked)
+	})
+
+	t.Run("error: failure checking lockout", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), accountLock).Return(false, mockError)
+
+		_, err := service.Locked(ctx, email, ip)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("success: failures below threshold", func(t *testing.T) {
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), accountFailures, 86400).Return(int64(4), nil)
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), ipFailures, 86400).Return(int64(19), nil)
+
+		service.Fail(ctx, email, ip)
+	})
+
+	t.Run("success: every failure restarts the window", func(t *testing.T) {
+		gomock.InOrder(
+			mockRedis.EXPECT().IncrementSliding(gomock.Any(), accountFailures, 86400).Return(int64(1), nil),
+			mockRedis.EXPECT().IncrementSliding(gomock.Any(), ipFailures, 86400).Return(int64(1), nil),
+			mockRedis.EXPECT().IncrementSliding(gomock.Any(), accountFailures, 86400).Return(int64(2), nil),
+			mockRedis.EXPECT().IncrementSliding(gomock.Any(), ipFailures, 86400).Return(int64(2), nil),
+		)
+
+		service.Fail(ctx, email, ip)
+		service.Fail(ctx, email, ip)
+	})
+
+	backoff := []struct {
+		failures int64
+		delay    time.Duration
+	}{
+		{5, 30 * time.Second},
+		{6, time.Minute},
+		{7, 2 * time.Minute},
+		{11, 32 * time.Minute},
+		{12, time.Hour},
+		{40, time.Hour},
+	}
+
+	for _, tc := range backoff {
+		t.Run(fmt.Sprintf("success: account locked out after %d failures", tc.failures), func(t *testing.T) {
+			mockRedis.EXPECT().IncrementSliding(gomock.Any(), accountFailures, 86400).Return(tc.failures, nil)
+			mockRedis.EXPECT().Save(gomock.Any(), accountLock, tc.failures, int(tc.delay/time.Second)).Return(nil)
+			mockListener.EXPECT().Locked(gomock.Any(), dto.LockoutEvent{
+				Scope:    LockoutScopeAccount,
+				Subject:  "test@example.com",
+				Failures: tc.failures,
+				Until:    now.Add(tc.delay),
+			})
+			mockRedis.EXPECT().IncrementSliding(gomock.Any(), ipFailures, 86400).Return(int64(1), nil)
+
+			service.Fail(ctx, email, ip)
+		})
+	}
+
+	t.Run("success: ip locked out", func(t *testing.T) {
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), accountFailures, 86400).Return(int64(1), nil)
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), ipFailures, 86400).Return(int64(21), nil)
+		mockRedis.EXPECT().Save(gomock.Any(), ipLock, int64(21), 60).Return(nil)
+		mockListener.EXPECT().Locked(gomock.Any(), dto.LockoutEvent{
+			Scope:    LockoutScopeIP,
+			Subject:  ip,
+			Failures: 21,
+			Until:    now.Add(time.Minute),
+		})
+
+		service.Fail(ctx, email, ip)
+	})
+
+	t.Run("error: failure counting is only logged", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).Times(2)
+
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), accountFailures, 86400).Return(int64(0), mockError)
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), ipFailures, 86400).Return(int64(0), mockError)
+
+		service.Fail(ctx, email, ip)
+	})
+
+	t.Run("error: no event when the lockout is not saved", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), accountFailures, 86400).Return(int64(5), nil)
+		mockRedis.EXPECT().Save(gomock.Any(), accountLock, int64(5), 30).Return(mockError)
+		mockRedis.EXPECT().IncrementSliding(gomock.Any(), ipFailures, 86400).Return(int64(1), nil)
+
+		service.Fail(ctx, email, ip)
+	})
+
+	t.Run("success: reset forgets account failures", func(t *testing.T) {
+		mockRedis.EXPECT().Delete(gomock.Any(), accountFailures).Return(nil)
+
+		service.Reset(ctx, email)
+	})
+
+	t.Run("error: failure unlocking", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockRedis.EXPECT().Delete(gomock.Any(), accountLock).Return(mockError)
+
+		err := service.Unlock(ctx, email)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("success: unlocked", func(t *testing.T) {
+		mockRedis.EXPECT().Delete(gomock.Any(), accountLock).Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), accountFailures).Return(nil)
+
+		err := service.Unlock(ctx, email)
+
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/config"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/redis"
+)
+
+// MagicLinkService signs users in through a link emailed to them, so that accounts without a password
+// can sign in too. Consuming a link for an address without an account creates one.
+type MagicLinkService interface {
+	Send(ctx context.Context, req dto.MagicLinkRequest, ip string) error
+	Consume(ctx context.Context, req dto.ConsumeMagicLinkRequest) (*dto.UserLoginResponse, error)
+}
+
+const (
+	magicLinkEmailThrottleKey = "auth:magic_link_throttle:email:%s"
+	magicLinkIPThrottleKey    = "auth:magic_link_throttle:ip:%s"
+
+	magicLinkThrottleWindow = time.Hour
+)
+
+type magicLinkService struct {
+	db       postgres.PgxIface
+	repo     repository.Querier
+	tokens   TokenService
+	notifier Notifier
+	cache    redis.IRedisCache
+	config   *config.Config
+	logger   logger.Interface
+}
+
+func NewMagicLinkService(
+	db postgres.PgxIface,
+	r repository.Querier,
+	t TokenService,
+	n Notifier,
+	c redis.IRedisCache,
+	cfg *config.Config,
+	l logger.Interface,
+) MagicLinkService {
+	return &magicLinkService{
+		db:       db,
+		repo:     r,
+		tokens:   t,
+		notifier: n,
+		cache:    c,
+		config:   cfg,
+		logger:   l,
+	}
+}
+
+// Send emails a sign-in link to the given address. The account is not looked up, so the response
+// is the same whether or not the address belongs to one.
+func (s *magicLinkService) Send(ctx context.Context, req dto.MagicLinkRequest, ip string) error {
+	if err := s.throttle(ctx, magicLinkIPThrottleKey, ip, s.config.Auth.MagicLinkIPLimit); err != nil {
+		return err
+	}
+
+	err := s.throttle(ctx, magicLinkEmailThrottleKey, normalizeEmail(req.Email), s.config.Auth.MagicLinkEmailLimit)
+	if err != nil {
+		return err
+	}
+
+	token, err := s.tokens.MagicLink(ctx, req.Email)
+	if err != nil {
+		return err
+	}
+
+	if err = s.notifier.SendMagicLink(ctx, req.Email, token); err != nil {
+		s.logger.Error("magic link - service - failed to send magic link: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// Consume exchanges a magic link for a token pair, or an MFA challenge when the account has MFA
+// enabled. Following the link proves ownership of the address, so it is marked as verified.
+func (s *magicLinkService) Consume(ctx context.Context, req dto.ConsumeMagicLinkRequest) (*dto.UserLoginResponse, error) {
+	claims, err := s.tokens.ConsumeMagicLink(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("magic link - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("magic link - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.repo.GetUserByEmail(ctx, tx, claims.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("magic link - service - failed to get user by email: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	switch {
+	case user.Email == "":
+		user, err = s.repo.CreateUser(ctx, tx, repository.CreateUserParams{
+			Email: claims.Email,
+			IsVerified: pgtype.Bool{
+				Bool:  true,
+				Valid: true,
+			},
+		})
+		if postgres.IsUniqueViolation(err) {
+			s.logger.Error("magic link - service - email already in use")
+
+			return nil, failure.Conflict("email already in use")
+		}
+
+		if err != nil {
+			s.logger.Error("magic link - service - failed to create user: %w", err)
+
+			return nil, failure.InternalError(err)
+		}
+
+		if err = s.repo.AssignDefaultRoles(ctx, tx, user.ID); err != nil {
+			s.logger.Error("magic link - service - failed to assign default roles: %w", err)
+
+			return nil, failure.InternalError(err)
+		}
+	case !user.IsVerified.Bool:
+		user, err = s.repo.VerifyEmail(ctx, tx, user.ID)
+		if err != nil {
+			s.logger.Error("magic link - service - failed to verify email: %w", err)
+
+			return nil, failure.InternalError(err)
+		}
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, tx, user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("magic link - service - failed to get mfa: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	// The last login is recorded once the second factor has been verified.
+	if !mfa.EnabledAt.Valid {
+		if _, err = s.repo.UpdateLastLogin(ctx, tx, user.ID); err != nil {
+			s.logger.Error("magic link - service - failed to update last login: %w", err)
+
+			return nil, failure.InternalError(err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("magic link - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if mfa.EnabledAt.Valid {
+		return s.tokens.Challenge(ctx, user)
+	}
+
+	return s.tokens.Issue(ctx, user)
+}
+
+// throttle counts a request against subject within a fixed window and rejects it once limit is exceeded.
+func (s *magicLinkService) throttle(ctx context.Context, key, subject string, limit int) error {
+	hits, err := s.cache.Increment(ctx, fmt.Sprintf(key, subject), ttlSeconds(magicLinkThrottleWindow))
+	if err != nil {
+		s.logger.Error("magic link - service - failed to count request: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if hits > int64(limit) {
+		s.logger.Error("magic link - service - too many requests")
+
+		return failure.TooManyRequests("too many magic link requests, try again later")
+	}
+
+	return nil
+}
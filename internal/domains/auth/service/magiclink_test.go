@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/postgres"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMagicLinkService_Send(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	cfg := &config.Config{}
+	cfg.Auth.MagicLinkEmailLimit = 3
+	cfg.Auth.MagicLinkIPLimit = 10
+
+	service := NewMagicLinkService(mockPgx, mockQuerier, mockTokens, mockNotifier, mockRedis, cfg, mockLogger)
+
+	req := dto.MagicLinkRequest{Email: "Test@Example.com"}
+	ip := "203.0.113.7"
+	ipKey := "auth:magic_link_throttle:ip:203.0.113.7"
+	emailKey := "auth:magic_link_throttle:email:test@example.com"
+
+	t.Run("error: too many requests from ip", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockRedis.EXPECT().Increment(gomock.Any(), ipKey, 3600).Return(int64(11), nil)
+
+		err := service.Send(ctx, req, ip)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, failure.GetCode(err))
+	})
+
+	t.Run("error: too many requests for email", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockRedis.EXPECT().Increment(gomock.Any(), ipKey, 3600).Return(int64(1), nil)
+		mockRedis.EXPECT().Increment(gomock.Any(), emailKey, 3600).Return(int64(4), nil)
+
+		err := service.Send(ctx, req, ip)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, failure.GetCode(err))
+	})
+
+	t.Run("error: failure counting requests", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockRedis.EXPECT().Increment(gomock.Any(), ipKey, 3600).Return(int64(0), mockError)
+
+		err := service.Send(ctx, req, ip)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: failure sending magic link", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockRedis.EXPECT().Increment(gomock.Any(), ipKey, 3600).Return(int64(1), nil)
+		mockRedis.EXPECT().Increment(gomock.Any(), emailKey, 3600).Return(int64(1), nil)
+		mockTokens.EXPECT().MagicLink(gomock.Any(), req.Email).Return("token", nil)
+		mockNotifier.EXPECT().SendMagicLink(gomock.Any(), req.Email, "token").Return(mockError)
+
+		err := service.Send(ctx, req, ip)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: magic link sent without looking up the account", func(t *testing.T) {
+		mockRedis.EXPECT().Increment(gomock.Any(), ipKey, 3600).Return(int64(10), nil)
+		mockRedis.EXPECT().Increment(gomock.Any(), emailKey, 3600).Return(int64(3), nil)
+		mockTokens.EXPECT().MagicLink(gomock.Any(), req.Email).Return("token", nil)
+		mockNotifier.EXPECT().SendMagicLink(gomock.Any(), req.Email, "token").Return(nil)
+
+		err := service.Send(ctx, req, ip)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestMagicLinkService_Consume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := NewMagicLinkService(mockPgx, mockQuerier, mockTokens, mockNotifier, mockRedis, &config.Config{}, mockLogger)
+
+	req := dto.ConsumeMagicLinkRequest{Token: "token"}
+	claims := &jwt.Claims{Email: "test@example.com"}
+	mockUser := repository.User{
+		ID:         pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email:      "test@example.com",
+		IsVerified: pgtype.Bool{Bool: true, Valid: true},
+	}
+	pair := &dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}
+
+	t.Run("error: invalid magic link", func(t *testing.T) {
+		mockTokens.EXPECT().ConsumeMagicLink(gomock.Any(), "token").
+			Return(nil, failure.BadRequestFromString("invalid or expired magic link"))
+
+		res, err := service.Consume(ctx, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: failure creating user", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockTokens.EXPECT().ConsumeMagicLink(gomock.Any(), "token").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.User{}, mockError)
+
+		res, err := service.Consume(ctx, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: email of a deleted account", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockTokens.EXPECT().ConsumeMagicLink(gomock.Any(), "token").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.User{}, &pgconn.PgError{Code: postgres.UniqueViolation})
+
+		res, err := service.Consume(ctx, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: passwordless account created", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockTokens.EXPECT().ConsumeMagicLink(gomock.Any(), "token").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().CreateUser(gomock.Any(), gomock.Any(), repository.CreateUserParams{
+			Email:      "test@example.com",
+			IsVerified: pgtype.Bool{Bool: true, Valid: true},
+		}).Return(mockUser, nil)
+		mockQuerier.EXPECT().AssignDefaultRoles(gomock.Any(), gomock.Any(), mockUser.ID).Return(nil)
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().UpdateLastLogin(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser.ID, nil)
+		mockTokens.EXPECT().Issue(gomock.Any(), mockUser).Return(pair, nil)
+
+		res, err := service.Consume(ctx, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, pair, res)
+	})
+
+	t.Run("success: unverified account verified", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		unverified := mockUser
+		unverified.IsVerified = pgtype.Bool{Bool: false, Valid: true}
+
+		mockTokens.EXPECT().ConsumeMagicLink(gomock.Any(), "token").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").Return(unverified, nil)
+		mockQuerier.EXPECT().VerifyEmail(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().UpdateLastLogin(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser.ID, nil)
+		mockTokens.EXPECT().Issue(gomock.Any(), mockUser).Return(pair, nil)
+
+		res, err := service.Consume(ctx, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, pair, res)
+	})
+
+	t.Run("success: mfa challenge", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		challenge := new(dto.UserLoginResponse).ToMFAChallengeResponse("mfa")
+
+		mockTokens.EXPECT().ConsumeMagicLink(gomock.Any(), "token").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").Return(mockUser, nil)
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(repository.UserMfa{EnabledAt: pgtype.Timestamp{Valid: true}}, nil)
+		mockTokens.EXPECT().Challenge(gomock.Any(), mockUser).Return(challenge, nil)
+
+		res, err := service.Consume(ctx, req)
+
+		assert.NoError(t, err)
+		assert.True(t, res.MFARequired)
+		assert.Empty(t, res.AccessToken)
+	})
+
+	assert.NoError(t, mockPgx.ExpectationsWereMet())
+}
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/secret"
+	"github.com/savioruz/goth/pkg/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollMFA starts TOTP enrollment with a new shared secret. MFA stays off until the first code
+// is confirmed, so enrolling again before that simply replaces the secret.
+func (s *authService) EnrollMFA(ctx context.Context, claims *jwt.Claims) (*dto.MFAEnrollResponse, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("mfa enroll - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("mfa enroll - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := totp.GenerateSecret()
+	if err != nil {
+		s.logger.Error("mfa enroll - service - failed to generate secret: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	// The upsert leaves an enabled secret alone and returns no row for it.
+	_, err = s.repo.UpsertUserMFA(ctx, tx, repository.UpsertUserMFAParams{
+		UserID: userID,
+		Secret: key,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("mfa enroll - service - mfa already enabled")
+
+		return nil, failure.BadRequestFromString("mfa already enabled")
+	}
+
+	if err != nil {
+		s.logger.Error("mfa enroll - service - failed to save mfa secret: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("mfa enroll - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return &dto.MFAEnrollResponse{
+		Secret: key,
+		URI:    totp.URI(s.config.App.Name, claims.Email, key),
+	}, nil
+}
+
+// ConfirmMFA turns MFA on once the user proves the authenticator is set up, and returns the
+// recovery codes. The codes are only stored hashed and are never shown again. Wrong codes count
+// towards the login lockout of the account and ip.
+func (s *authService) ConfirmMFA(
+	ctx context.Context,
+	claims *jwt.Claims,
+	req dto.ConfirmMFARequest,
+	ip string,
+) (*dto.MFARecoveryCodesResponse, error) {
+	locked, err := s.lockout.Locked(ctx, claims.Email, ip)
+	if err != nil {
+		s.logger.Error("mfa confirm - service - failed to check lockout: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if locked {
+		s.logger.Error("mfa confirm - service - locked out")
+
+		return nil, failure.BadRequestFromString("invalid mfa code")
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("mfa confirm - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("mfa confirm - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, tx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("mfa confirm - service - mfa enrollment not started")
+
+		return nil, failure.BadRequestFromString("mfa enrollment not started")
+	}
+
+	if err != nil {
+		s.logger.Error("mfa confirm - service - failed to get mfa: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if mfa.EnabledAt.Valid {
+		s.logger.Error("mfa confirm - service - mfa already enabled")
+
+		return nil, failure.BadRequestFromString("mfa already enabled")
+	}
+
+	ok, err := s.useTOTP(ctx, tx, mfa, req.Code)
+	if err != nil {
+		s.logger.Error("mfa confirm - service - failed to check code: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !ok {
+		s.lockout.Fail(ctx, claims.Email, ip)
+		s.logger.Error("mfa confirm - service - invalid code")
+
+		return nil, failure.BadRequestFromString("invalid mfa code")
+	}
+
+	if _, err = s.repo.EnableUserMFA(ctx, tx, userID); err != nil {
+		s.logger.Error("mfa confirm - service - failed to enable mfa: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		s.logger.Error("mfa confirm - service - failed to create recovery codes: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("mfa confirm - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return &dto.MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns MFA off. It takes a current code or a recovery code so that a stolen access
+// token alone is not enough, and wrong codes count towards the login lockout of the account and ip.
+func (s *authService) DisableMFA(ctx context.Context, claims *jwt.Claims, req dto.DisableMFARequest, ip string) error {
+	locked, err := s.lockout.Locked(ctx, claims.Email, ip)
+	if err != nil {
+		s.logger.Error("mfa disable - service - failed to check lockout: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if locked {
+		s.logger.Error("mfa disable - service - locked out")
+
+		return failure.BadRequestFromString("invalid mfa code")
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("mfa disable - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("mfa disable - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return err
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, tx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("mfa disable - service - failed to get mfa: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if !mfa.EnabledAt.Valid {
+		s.logger.Error("mfa disable - service - mfa not enabled")
+
+		return failure.BadRequestFromString("mfa not enabled")
+	}
+
+	ok, err := s.checkMFACode(ctx, tx, mfa, req.Code)
+	if err != nil {
+		s.logger.Error("mfa disable - service - failed to check code: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if !ok {
+		s.lockout.Fail(ctx, claims.Email, ip)
+		s.logger.Error("mfa disable - service - invalid code")
+
+		return failure.BadRequestFromString("invalid mfa code")
+	}
+
+	if err = s.repo.DeleteMFARecoveryCodes(ctx, tx, userID); err != nil {
+		s.logger.Error("mfa disable - service - failed to delete recovery codes: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.repo.DeleteUserMFA(ctx, tx, userID); err != nil {
+		s.logger.Error("mfa disable - service - failed to delete mfa: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("mfa disable - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// VerifyMFA exchanges the challenge token handed out by Login and a TOTP or recovery code for a
+// token pair.
+func (s *authService) VerifyMFA(ctx context.Context, req dto.VerifyMFARequest) (*dto.UserLoginResponse, error) {
+	claims, err := s.tokens.ConsumeChallenge(ctx, req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("mfa verify - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("mfa verify - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, tx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("mfa verify - service - user not found")
+
+		return nil, failure.Unauthorized("invalid mfa token")
+	}
+
+	if err != nil {
+		s.logger.Error("mfa verify - service - failed to get user by id: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, tx, userID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("mfa verify - service - failed to get mfa: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !mfa.EnabledAt.Valid {
+		s.logger.Error("mfa verify - service - mfa not enabled")
+
+		return nil, failure.Unauthorized("invalid mfa token")
+	}
+
+	ok, err := s.checkMFACode(ctx, tx, mfa, req.Code)
+	if err != nil {
+		s.logger.Error("mfa verify - service - failed to check code: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !ok {
+		s.logger.Error("mfa verify - service - invalid code")
+
+		return nil, failure.Unauthorized("invalid mfa code")
+	}
+
+	if _, err = s.repo.UpdateLastLogin(ctx, tx, user.ID); err != nil {
+		s.logger.Error("mfa verify - service - failed to update last login: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("mfa verify - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return s.tokens.Issue(ctx, user)
+}
+
+// checkMFACode accepts either a TOTP code or an unused recovery code, which is used up.
+func (s *authService) checkMFACode(ctx context.Context, db repository.DBTX, mfa repository.UserMfa, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.useTOTP(ctx, db, mfa, code)
+	}
+
+	_, err := s.repo.ConsumeMFARecoveryCode(ctx, db, repository.ConsumeMFARecoveryCodeParams{
+		UserID: mfa.UserID,
+		Code:   secret.Hash(normalizeRecoveryCode(code)),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// useTOTP validates a TOTP code and records its time step, so that a code cannot be replayed
+// within its validity window.
+func (s *authService) useTOTP(ctx context.Context, db repository.DBTX, mfa repository.UserMfa, code string) (bool, error) {
+	step, err := totp.Validate(code, mfa.Secret, time.Now())
+	if errors.Is(err, totp.ErrInvalidCode) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.repo.UseMFAStep(ctx, db, repository.UseMFAStepParams{
+		LastUsedStep: step,
+		UserID:       mfa.UserID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *authService) replaceRecoveryCodes(ctx context.Context, db repository.DBTX, userID pgtype.UUID) ([]string, error) {
+	if err := s.repo.DeleteMFARecoveryCodes(ctx, db, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.repo.CreateMFARecoveryCode(ctx, db, repository.CreateMFARecoveryCodeParams{
+			UserID: userID,
+			Code:   secret.Hash(normalizeRecoveryCode(code)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		codes[i] = code
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCode returns a code formatted as xxxx-xxxx for readability.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+
+	return code[:4] + "-" + code[4:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func parseUserID(claims *jwt.Claims) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	if err := id.Scan(claims.ID); err != nil {
+		return pgtype.UUID{}, failure.Unauthorized("invalid token subject")
+	}
+
+	return id, nil
+}
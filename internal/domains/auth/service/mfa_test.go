@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	jwtMock "github.com/savioruz/goth/pkg/jwt/mock"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/password"
+	"github.com/savioruz/goth/pkg/secret"
+	"github.com/savioruz/goth/pkg/totp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService_EnrollMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{App: config.App{Name: "goth"}}
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), Email: "test@example.com"}
+
+	t.Run("error: invalid token subject", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		res, err := service.EnrollMFA(ctx, &jwt.Claims{ID: "not-a-uuid"})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: mfa already enabled", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			UpsertUserMFA(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
+
+		res, err := service.EnrollMFA(ctx, claims)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success: secret and otpauth uri", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		var stored string
+
+		mockQuerier.EXPECT().
+			UpsertUserMFA(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.UpsertUserMFAParams) (repository.UserMfa, error) {
+				assert.Equal(t, userID, arg.UserID)
+				stored = arg.Secret
+
+				return repository.UserMfa{UserID: arg.UserID, Secret: arg.Secret}, nil
+			})
+
+		res, err := service.EnrollMFA(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.Equal(t, stored, res.Secret)
+		assert.True(t, strings.HasPrefix(res.URI, "otpauth://totp/goth:test@example.com?"))
+		assert.Contains(t, res.URI, "secret="+res.Secret)
+	})
+}
+
+func TestAuthService_ConfirmMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
+
+	key, _ := totp.GenerateSecret()
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), Email: "test@example.com"}
+	pending := repository.UserMfa{UserID: userID, Secret: key}
+
+	t.Run("error: locked out", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(true, nil)
+
+		res, err := service.ConfirmMFA(ctx, claims, dto.ConfirmMFARequest{Code: "123456"}, "127.0.0.1")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: enrollment not started", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(false, nil)
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(repository.UserMfa{}, pgx.ErrNoRows)
+
+		res, err := service.ConfirmMFA(ctx, claims, dto.ConfirmMFARequest{Code: "123456"}, "127.0.0.1")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: invalid code", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(false, nil)
+		mockLockout.EXPECT().Fail(gomock.Any(), "test@example.com", "127.0.0.1")
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(pending, nil)
+
+		code, _ := totp.Code(key, time.Now().Add(-time.Hour))
+
+		res, err := service.ConfirmMFA(ctx, claims, dto.ConfirmMFARequest{Code: code}, "127.0.0.1")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: code replayed", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(false, nil)
+		mockLockout.EXPECT().Fail(gomock.Any(), "test@example.com", "127.0.0.1")
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(pending, nil)
+		mockQuerier.EXPECT().UseMFAStep(gomock.Any(), gomock.Any(), gomock.Any()).Return(repository.UserMfa{}, pgx.ErrNoRows)
+
+		code, _ := totp.Code(key, time.Now())
+
+		res, err := service.ConfirmMFA(ctx, claims, dto.ConfirmMFARequest{Code: code}, "127.0.0.1")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success: mfa enabled with hashed recovery codes", func(t *testing.T) {
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(false, nil)
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		stored := make(map[string]bool)
+
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(pending, nil)
+		mockQuerier.EXPECT().
+			UseMFAStep(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.UseMFAStepParams) (repository.UserMfa, error) {
+				assert.Equal(t, userID, arg.UserID)
+				assert.InDelta(t, totp.Step(time.Now()), arg.LastUsedStep, 1)
+
+				return pending, nil
+			})
+		mockQuerier.EXPECT().EnableUserMFA(gomock.Any(), gomock.Any(), userID).Return(pending, nil)
+		mockQuerier.EXPECT().DeleteMFARecoveryCodes(gomock.Any(), gomock.Any(), userID).Return(nil)
+		mockQuerier.EXPECT().
+			CreateMFARecoveryCode(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateMFARecoveryCodeParams) error {
+				stored[arg.Code] = true
+
+				return nil
+			}).
+			Times(recoveryCodeCount)
+
+		code, _ := totp.Code(key, time.Now())
+
+		res, err := service.ConfirmMFA(ctx, claims, dto.ConfirmMFARequest{Code: code}, "127.0.0.1")
+
+		assert.NoError(t, err)
+		assert.Len(t, res.RecoveryCodes, recoveryCodeCount)
+		assert.Len(t, stored, recoveryCodeCount)
+
+		for _, c := range res.RecoveryCodes {
+			assert.True(t, stored[secret.Hash(normalizeRecoveryCode(c))])
+			assert.False(t, stored[c])
+		}
+	})
+}
+
+func TestAuthService_DisableMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
+
+	key, _ := totp.GenerateSecret()
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), Email: "test@example.com"}
+	enabled := repository.UserMfa{
+		UserID:    userID,
+		Secret:    key,
+		EnabledAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
+	}
+
+	t.Run("error: locked out", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(true, nil)
+
+		err := service.DisableMFA(ctx, claims, dto.DisableMFARequest{Code: "123456"}, "127.0.0.1")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: mfa not enabled", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(false, nil)
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(repository.UserMfa{}, pgx.ErrNoRows)
+
+		err := service.DisableMFA(ctx, claims, dto.DisableMFARequest{Code: "123456"}, "127.0.0.1")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: unknown recovery code", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(false, nil)
+		mockLockout.EXPECT().Fail(gomock.Any(), "test@example.com", "127.0.0.1")
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(enabled, nil)
+		mockQuerier.EXPECT().
+			ConsumeMFARecoveryCode(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.MfaRecoveryCode{}, pgx.ErrNoRows)
+
+		err := service.DisableMFA(ctx, claims, dto.DisableMFARequest{Code: "abcd-efgh"}, "127.0.0.1")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success: disabled with a recovery code", func(t *testing.T) {
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "127.0.0.1").Return(false, nil)
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(enabled, nil)
+		mockQuerier.EXPECT().
+			ConsumeMFARecoveryCode(gomock.Any(), gomock.Any(), repository.ConsumeMFARecoveryCodeParams{
+				UserID: userID,
+				Code:   secret.Hash("abcdefgh"),
+			}).
+			Return(repository.MfaRecoveryCode{}, nil)
+		mockQuerier.EXPECT().DeleteMFARecoveryCodes(gomock.Any(), gomock.Any(), userID).Return(nil)
+		mockQuerier.EXPECT().DeleteUserMFA(gomock.Any(), gomock.Any(), userID).Return(nil)
+
+		err := service.DisableMFA(ctx, claims, dto.DisableMFARequest{Code: "ABCD-EFGH"}, "127.0.0.1")
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthService_VerifyMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
+
+	key, _ := totp.GenerateSecret()
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), Email: "test@example.com", TokenType: jwt.MFATokenType}
+	mockUser := repository.User{ID: userID, Email: "test@example.com"}
+	enabled := repository.UserMfa{
+		UserID:    userID,
+		Secret:    key,
+		EnabledAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
+	}
+
+	t.Run("error: invalid challenge", func(t *testing.T) {
+		mockTokens.EXPECT().ConsumeChallenge(gomock.Any(), "bad").Return(nil, failure.Unauthorized("invalid mfa token"))
+
+		res, err := service.VerifyMFA(ctx, dto.VerifyMFARequest{MFAToken: "bad", Code: "123456"})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: invalid code", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockTokens.EXPECT().ConsumeChallenge(gomock.Any(), "mfa").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(enabled, nil)
+
+		code, _ := totp.Code(key, time.Now().Add(-time.Hour))
+
+		res, err := service.VerifyMFA(ctx, dto.VerifyMFARequest{MFAToken: "mfa", Code: code})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: mfa disabled since the challenge", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockTokens.EXPECT().ConsumeChallenge(gomock.Any(), "mfa").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(repository.UserMfa{}, pgx.ErrNoRows)
+
+		res, err := service.VerifyMFA(ctx, dto.VerifyMFARequest{MFAToken: "mfa", Code: "123456"})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("success: tokens issued", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockTokens.EXPECT().ConsumeChallenge(gomock.Any(), "mfa").Return(claims, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().GetUserMFA(gomock.Any(), gomock.Any(), userID).Return(enabled, nil)
+		mockQuerier.EXPECT().UseMFAStep(gomock.Any(), gomock.Any(), gomock.Any()).Return(enabled, nil)
+		mockQuerier.EXPECT().UpdateLastLogin(gomock.Any(), gomock.Any(), userID).Return(userID, nil)
+		mockTokens.EXPECT().
+			Issue(gomock.Any(), mockUser).
+			Return(&dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil)
+
+		code, _ := totp.Code(key, time.Now())
+
+		res, err := service.VerifyMFA(ctx, dto.VerifyMFARequest{MFAToken: "mfa", Code: code})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "access", res.AccessToken)
+		assert.False(t, res.MFARequired)
+	})
+}
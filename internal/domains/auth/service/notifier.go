@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/savioruz/goth/config"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/mailer"
+)
+
+// Notifier delivers account emails. Tokens are passed in plain text and never stored that way.
+type Notifier interface {
+	SendEmailVerification(ctx context.Context, user repository.User, token string) error
+	SendPasswordReset(ctx context.Context, user repository.User, token string) error
+	SendEmailChange(ctx context.Context, user repository.User, email, token string) error
+	SendMagicLink(ctx context.Context, email, token string) error
+	SendInvitation(ctx context.Context, email, organization, token string) error
+}
+
+const (
+	emailVerificationTemplate = "email_verification"
+	passwordResetTemplate     = "password_reset"
+	emailChangeTemplate       = "email_change"
+	magicLinkTemplate         = "magic_link"
+	invitationTemplate        = "organization_invitation"
+)
+
+// notification is the data passed to account email templates.
+type notification struct {
+	Name         string
+	Link         string
+	Organization string
+}
+
+type mailNotifier struct {
+	mailer mailer.Interface
+	config *config.Config
+}
+
+func NewMailNotifier(m mailer.Interface, cfg *config.Config) Notifier {
+	return &mailNotifier{
+		mailer: m,
+		config: cfg,
+	}
+}
+
+func (n *mailNotifier) SendEmailVerification(ctx context.Context, user repository.User, token string) error {
+	return n.send(ctx, user.Email, user, emailVerificationTemplate, n.config.Auth.VerifyEmailURL, token)
+}
+
+func (n *mailNotifier) SendPasswordReset(ctx context.Context, user repository.User, token string) error {
+	return n.send(ctx, user.Email, user, passwordResetTemplate, n.config.Auth.ResetPasswordURL, token)
+}
+
+// SendEmailChange asks the owner of the new address to confirm it, so it is sent there rather than to the user.
+func (n *mailNotifier) SendEmailChange(ctx context.Context, user repository.User, email, token string) error {
+	return n.send(ctx, email, user, emailChangeTemplate, n.config.Auth.ConfirmEmailChangeURL, token)
+}
+
+// SendMagicLink is sent to an address that may not belong to an account yet.
+func (n *mailNotifier) SendMagicLink(ctx context.Context, email, token string) error {
+	return n.send(ctx, email, repository.User{Email: email}, magicLinkTemplate, n.config.Auth.MagicLinkURL, token)
+}
+
+// SendInvitation invites an address to join an organization, whether or not it belongs to an account.
+func (n *mailNotifier) SendInvitation(ctx context.Context, email, organization, token string) error {
+	link, err := withToken(n.config.Org.InvitationURL, token)
+	if err != nil {
+		return err
+	}
+
+	return n.mailer.Send(ctx, email, invitationTemplate, n.locale(ctx), notification{
+		Name:         email,
+		Link:         link,
+		Organization: organization,
+	})
+}
+
+func (n *mailNotifier) send(ctx context.Context, to string, user repository.User, template, link, token string) error {
+	link, err := withToken(link, token)
+	if err != nil {
+		return err
+	}
+
+	name := user.FullName.String
+	if name == "" {
+		name = user.Email
+	}
+
+	return n.mailer.Send(ctx, to, template, n.locale(ctx), notification{
+		Name: name,
+		Link: link,
+	})
+}
+
+// locale is the language of the request the email is sent for, or the default one.
+func (n *mailNotifier) locale(ctx context.Context) string {
+	if locale := mailer.LocaleFromContext(ctx); locale != "" {
+		return locale
+	}
+
+	return n.config.Mailer.DefaultLocale
+}
+
+// withToken appends the token to the query of link.
+func withToken(link, token string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
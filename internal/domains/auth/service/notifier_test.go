@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/config"
+	"github.com/savioruz/goth/internal/delivery/mail"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/mailer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestMailNotifier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockLogger := log.NewMockInterface(ctrl)
+
+	templates, err := mailer.ParseTemplates(mail.Templates(), "en")
+	assert.NoError(t, err)
+
+	sender := mailer.NewMemorySender()
+	m := mailer.New(sender, templates, mockLogger, mailer.From("Goth <no-reply@example.com>"), mailer.Workers(0))
+
+	cfg := &config.Config{}
+	cfg.Auth.VerifyEmailURL = "https://app.example.com/verify-email"
+	cfg.Auth.ResetPasswordURL = "https://app.example.com/reset-password?source=email"
+	cfg.Auth.MagicLinkURL = "https://app.example.com/magic-link"
+	cfg.Org.InvitationURL = "https://app.example.com/accept-invitation"
+
+	notifier := NewMailNotifier(m, cfg)
+
+	user := repository.User{
+		Email:    "test@example.com",
+		FullName: pgtype.Text{String: "Test User", Valid: true},
+	}
+
+	t.Run("success: verification link carries the token", func(t *testing.T) {
+		sender.Reset()
+
+		err := notifier.SendEmailVerification(ctx, user, "a+b/c")
+
+		assert.NoError(t, err)
+		assert.Len(t, sender.Messages(), 1)
+
+		msg := sender.Messages()[0]
+		assert.Equal(t, []string{"test@example.com"}, msg.To)
+		assert.Equal(t, "Goth <no-reply@example.com>", msg.From)
+		assert.Equal(t, "Verify your email address", msg.Subject)
+		assert.Contains(t, msg.Text, "Hi Test User,")
+		assert.Contains(t, msg.Text, "https://app.example.com/verify-email?token="+url.QueryEscape("a+b/c"))
+		assert.Contains(t, msg.HTML, "https://app.example.com/verify-email?token=a%2Bb%2Fc")
+	})
+
+	t.Run("success: reset link keeps existing query", func(t *testing.T) {
+		sender.Reset()
+
+		err := notifier.SendPasswordReset(ctx, user, "token")
+
+		assert.NoError(t, err)
+		assert.Len(t, sender.Messages(), 1)
+
+		msg := sender.Messages()[0]
+		assert.Equal(t, "Reset your password", msg.Subject)
+		assert.Contains(t, msg.Text, "https://app.example.com/reset-password?source=email&token=token")
+	})
+
+	t.Run("success: magic link greets the address", func(t *testing.T) {
+		sender.Reset()
+
+		err := notifier.SendMagicLink(ctx, "new@example.com", "token")
+
+		assert.NoError(t, err)
+		assert.Len(t, sender.Messages(), 1)
+
+		msg := sender.Messages()[0]
+		assert.Equal(t, []string{"new@example.com"}, msg.To)
+		assert.Equal(t, "Your sign-in link", msg.Subject)
+		assert.Contains(t, msg.Text, "Hi new@example.com,")
+		assert.Contains(t, msg.Text, "https://app.example.com/magic-link?token=token")
+	})
+
+	t.Run("success: invitation names the organization", func(t *testing.T) {
+		sender.Reset()
+
+		err := notifier.SendInvitation(ctx, "new@example.com", "Acme", "token")
+
+		assert.NoError(t, err)
+		assert.Len(t, sender.Messages(), 1)
+
+		msg := sender.Messages()[0]
+		assert.Equal(t, []string{"new@example.com"}, msg.To)
+		assert.Equal(t, "You are invited to join Acme", msg.Subject)
+		assert.Contains(t, msg.Text, "https://app.example.com/accept-invitation?token=token")
+	})
+
+	t.Run("success: localized template", func(t *testing.T) {
+		sender.Reset()
+		cfg.Mailer.DefaultLocale = "id-ID"
+		defer func() { cfg.Mailer.DefaultLocale = "" }()
+
+		err := notifier.SendPasswordReset(ctx, user, "token")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Atur ulang kata sandi Anda", sender.Messages()[0].Subject)
+	})
+
+	t.Run("success: locale of the request", func(t *testing.T) {
+		sender.Reset()
+		cfg.Mailer.DefaultLocale = "en"
+		defer func() { cfg.Mailer.DefaultLocale = "" }()
+
+		err := notifier.SendPasswordReset(mailer.WithLocale(ctx, "id"), user, "token")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Atur ulang kata sandi Anda", sender.Messages()[0].Subject)
+	})
+}
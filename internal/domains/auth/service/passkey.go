@@ -0,0 +1,412 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/config"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/redis"
+)
+
+// PasskeyService is the WebAuthn relying party. A signed in user registers passkeys, which then sign
+// in without a password. Each ceremony is tracked by its challenge, which is kept in the cache until
+// it is used or expires.
+type PasskeyService interface {
+	BeginRegistration(ctx context.Context, claims *jwt.Claims) (*protocol.CredentialCreation, error)
+	FinishRegistration(ctx context.Context, claims *jwt.Claims, body []byte) (*dto.PasskeyResponse, error)
+	BeginLogin(ctx context.Context) (*protocol.CredentialAssertion, error)
+	FinishLogin(ctx context.Context, body []byte) (*dto.UserLoginResponse, error)
+}
+
+const (
+	webauthnSessionKey     = "auth:webauthn_session:%s"
+	webauthnSessionUsedKey = "auth:webauthn_session_used:%s"
+)
+
+var errInvalidUserHandle = errors.New("invalid user handle")
+
+type passkeyService struct {
+	db           postgres.PgxIface
+	repo         repository.Querier
+	tokens       TokenService
+	relyingParty *webauthn.WebAuthn
+	cache        redis.IRedisCache
+	config       *config.Config
+	logger       logger.Interface
+}
+
+func NewPasskeyService(
+	db postgres.PgxIface,
+	r repository.Querier,
+	t TokenService,
+	rp *webauthn.WebAuthn,
+	c redis.IRedisCache,
+	cfg *config.Config,
+	l logger.Interface,
+) PasskeyService {
+	return &passkeyService{
+		db:           db,
+		repo:         r,
+		tokens:       t,
+		relyingParty: rp,
+		cache:        c,
+		config:       cfg,
+		logger:       l,
+	}
+}
+
+// BeginRegistration returns the options for navigator.credentials.create. Passkeys already registered
+// are excluded so that an authenticator is not enrolled twice.
+func (s *passkeyService) BeginRegistration(ctx context.Context, claims *jwt.Claims) (*protocol.CredentialCreation, error) {
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(ctx, s.db, userID)
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to load user: %w", err)
+
+		return nil, err
+	}
+
+	creation, session, err := s.relyingParty.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to begin registration: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.saveSession(ctx, session); err != nil {
+		s.logger.Error("passkey register - service - failed to save session: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return creation, nil
+}
+
+// FinishRegistration verifies the attestation returned by the authenticator and stores the passkey.
+func (s *passkeyService) FinishRegistration(ctx context.Context, claims *jwt.Claims, body []byte) (*dto.PasskeyResponse, error) {
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(body)
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to parse response: %w", err)
+
+		return nil, failure.BadRequestFromString("invalid passkey response")
+	}
+
+	session, err := s.takeSession(ctx, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to take session: %w", err)
+
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("passkey register - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.loadUser(ctx, tx, userID)
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to load user: %w", err)
+
+		return nil, err
+	}
+
+	credential, err := s.relyingParty.CreateCredential(user, session, parsed)
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to verify attestation: %w", err)
+
+		return nil, failure.BadRequestFromString("invalid passkey response")
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	passkey, err := s.repo.CreateWebAuthnCredential(ctx, tx, repository.CreateWebAuthnCredentialParams{
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		Aaguid:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+
+	if postgres.IsUniqueViolation(err) {
+		s.logger.Error("passkey register - service - passkey already registered")
+
+		return nil, failure.Conflict("passkey already registered")
+	}
+
+	if err != nil {
+		s.logger.Error("passkey register - service - failed to create credential: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("passkey register - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.PasskeyResponse).ToPasskeyResponse(passkey), nil
+}
+
+// BeginLogin returns the options for navigator.credentials.get. No account is named up front: the
+// authenticator offers its discoverable passkeys and the chosen one identifies the user.
+func (s *passkeyService) BeginLogin(ctx context.Context) (*protocol.CredentialAssertion, error) {
+	assertion, session, err := s.relyingParty.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		s.logger.Error("passkey login - service - failed to begin login: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.saveSession(ctx, session); err != nil {
+		s.logger.Error("passkey login - service - failed to save session: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return assertion, nil
+}
+
+// FinishLogin verifies the assertion and issues a token pair the same way a password login does.
+func (s *passkeyService) FinishLogin(ctx context.Context, body []byte) (*dto.UserLoginResponse, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body)
+	if err != nil {
+		s.logger.Error("passkey login - service - failed to parse response: %w", err)
+
+		return nil, failure.BadRequestFromString("invalid passkey response")
+	}
+
+	session, err := s.takeSession(ctx, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		s.logger.Error("passkey login - service - failed to take session: %w", err)
+
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("passkey login - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("passkey login - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	var owner *passkeyUser
+
+	findUser := func(_, userHandle []byte) (webauthn.User, error) {
+		var id pgtype.UUID
+		if len(userHandle) != len(id.Bytes) {
+			return nil, errInvalidUserHandle
+		}
+
+		copy(id.Bytes[:], userHandle)
+		id.Valid = true
+
+		user, err := s.loadUser(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		owner = user
+
+		return user, nil
+	}
+
+	_, credential, err := s.relyingParty.ValidatePasskeyLogin(findUser, session, parsed)
+	if err != nil {
+		s.logger.Error("passkey login - service - failed to verify assertion: %w", err)
+
+		return nil, failure.Unauthorized("invalid passkey")
+	}
+
+	if credential.Authenticator.CloneWarning {
+		s.logger.Warn("passkey login - service - signature counter went backwards, possible cloned authenticator")
+
+		return nil, failure.Unauthorized("invalid passkey")
+	}
+
+	if s.config.Auth.RequireVerifiedEmail && !owner.user.IsVerified.Bool {
+		s.logger.Error("passkey login - service - email not verified")
+
+		return nil, failure.Forbidden("email not verified")
+	}
+
+	err = s.repo.UpdateWebAuthnCredentialUsage(ctx, tx, repository.UpdateWebAuthnCredentialUsageParams{
+		SignCount:    int64(credential.Authenticator.SignCount),
+		BackupState:  credential.Flags.BackupState,
+		CredentialID: credential.ID,
+	})
+	if err != nil {
+		s.logger.Error("passkey login - service - failed to update credential: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if _, err = s.repo.UpdateLastLogin(ctx, tx, owner.user.ID); err != nil {
+		s.logger.Error("passkey login - service - failed to update last login: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("passkey login - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return s.tokens.Issue(ctx, owner.user)
+}
+
+func (s *passkeyService) saveSession(ctx context.Context, session *webauthn.SessionData) error {
+	return s.cache.Save(ctx, fmt.Sprintf(webauthnSessionKey, session.Challenge), session, ttlSeconds(time.Until(session.Expires)))
+}
+
+// takeSession looks up the ceremony a response answers and makes sure it is answered only once.
+func (s *passkeyService) takeSession(ctx context.Context, challenge string) (webauthn.SessionData, error) {
+	var session webauthn.SessionData
+
+	key := fmt.Sprintf(webauthnSessionKey, challenge)
+
+	err := s.cache.Get(ctx, key, &session)
+	if errors.Is(err, redis.ErrCacheMiss) {
+		return webauthn.SessionData{}, failure.BadRequestFromString("invalid or expired passkey challenge")
+	}
+
+	if err != nil {
+		return webauthn.SessionData{}, failure.InternalError(err)
+	}
+
+	first, err := s.cache.SaveNX(ctx, fmt.Sprintf(webauthnSessionUsedKey, challenge), challenge, ttlSeconds(time.Until(session.Expires)))
+	if err != nil {
+		return webauthn.SessionData{}, failure.InternalError(err)
+	}
+
+	if !first {
+		return webauthn.SessionData{}, failure.BadRequestFromString("invalid or expired passkey challenge")
+	}
+
+	if err = s.cache.Delete(ctx, key); err != nil {
+		s.logger.Error("passkey - service - failed to delete session: %w", err)
+	}
+
+	return session, nil
+}
+
+func (s *passkeyService) loadUser(ctx context.Context, db repository.DBTX, id pgtype.UUID) (*passkeyUser, error) {
+	user, err := s.repo.GetUserByID(ctx, db, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		return nil, failure.InternalError(err)
+	}
+
+	rows, err := s.repo.ListWebAuthnCredentialsByUser(ctx, db, id)
+	if err != nil {
+		return nil, failure.InternalError(err)
+	}
+
+	credentials := make([]webauthn.Credential, len(rows))
+	for i, row := range rows {
+		credentials[i] = toWebAuthnCredential(row)
+	}
+
+	return &passkeyUser{user: user, credentials: credentials}, nil
+}
+
+// passkeyUser adapts a user and their passkeys to webauthn.User. The user handle is the user ID.
+type passkeyUser struct {
+	user        repository.User
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	id := u.user.ID.Bytes
+
+	return id[:]
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.FullName.String != "" {
+		return u.user.FullName.String
+	}
+
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func toWebAuthnCredential(row repository.WebauthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, len(row.Transports))
+	for i, transport := range row.Transports {
+		transports[i] = protocol.AuthenticatorTransport(transport)
+	}
+
+	return webauthn.Credential{
+		ID:              row.CredentialID,
+		PublicKey:       row.PublicKey,
+		AttestationType: row.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: row.BackupEligible,
+			BackupState:    row.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    row.Aaguid,
+			SignCount: uint32(row.SignCount),
+		},
+	}
+}
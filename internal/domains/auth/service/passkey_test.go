@@ -0,0 +1,533 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/postgres"
+	redisPkg "github.com/savioruz/goth/pkg/redis"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+var b64 = base64.RawURLEncoding
+
+// softAuthenticator is a platform authenticator with a P-256 key that answers ceremonies the way a
+// browser would, from the JSON options the relying party sends.
+type softAuthenticator struct {
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, origin string) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	credentialID := make([]byte, 16)
+	_, _ = rand.Read(credentialID)
+
+	return &softAuthenticator{origin: origin, key: key, credentialID: credentialID}
+}
+
+type ceremonyOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+func decodeOptions(t *testing.T, options any) ceremonyOptions {
+	t.Helper()
+
+	raw, err := json.Marshal(options)
+	assert.NoError(t, err)
+
+	var opts ceremonyOptions
+	assert.NoError(t, json.Unmarshal(raw, &opts))
+
+	return opts
+}
+
+func (a *softAuthenticator) clientData(ceremony, challenge string) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+
+	return data
+}
+
+func (a *softAuthenticator) authenticatorData(rpID string, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+
+	return append(data, attested...)
+}
+
+// create answers navigator.credentials.create with "none" attestation.
+func (a *softAuthenticator) create(t *testing.T, options any) []byte {
+	t.Helper()
+
+	opts := decodeOptions(t, options)
+
+	var err error
+
+	a.userHandle, err = b64.DecodeString(opts.PublicKey.User.ID)
+	assert.NoError(t, err)
+
+	point, err := a.key.PublicKey.ECDH()
+	assert.NoError(t, err)
+
+	xy := point.Bytes()[1:]
+	publicKey, err := cbor.Marshal(map[int]any{1: 2, 3: -7, -1: 1, -2: xy[:32], -3: xy[32:]})
+	assert.NoError(t, err)
+
+	attested := make([]byte, 16) // AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	// User present, user verified, attested credential data included.
+	authData := a.authenticatorData(opts.PublicKey.RP.ID, 0x45, attested)
+
+	attestation, err := cbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	assert.NoError(t, err)
+
+	body, _ := json.Marshal(map[string]any{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", opts.PublicKey.Challenge)),
+			"attestationObject": b64.EncodeToString(attestation),
+			"transports":        []string{"internal"},
+		},
+	})
+
+	return body
+}
+
+// get answers navigator.credentials.get with the discoverable credential.
+func (a *softAuthenticator) get(t *testing.T, options any) []byte {
+	t.Helper()
+
+	opts := decodeOptions(t, options)
+	clientData := a.clientData("webauthn.get", opts.PublicKey.Challenge)
+
+	a.signCount++
+
+	// User present, user verified.
+	authData := a.authenticatorData(opts.PublicKey.RPID, 0x05, nil)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	assert.NoError(t, err)
+
+	body, _ := json.Marshal(map[string]any{
+		"id":    b64.EncodeToString(a.credentialID),
+		"rawId": b64.EncodeToString(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    b64.EncodeToString(clientData),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(a.userHandle),
+		},
+	})
+
+	return body
+}
+
+// memoryCache backs the cache mock with a map, storing values as JSON like the Redis implementation.
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newMemoryCache(mockRedis *redis.MockIRedisCache) *memoryCache {
+	c := &memoryCache{values: make(map[string][]byte)}
+
+	mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, key string, value any, _ int) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.values[key], _ = json.Marshal(value)
+
+			return nil
+		}).AnyTimes()
+	mockRedis.EXPECT().SaveNX(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, key string, value any, _ int) (bool, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			if _, ok := c.values[key]; ok {
+				return false, nil
+			}
+
+			c.values[key], _ = json.Marshal(value)
+
+			return true, nil
+		}).AnyTimes()
+	mockRedis.EXPECT().Get(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, key string, value any) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			raw, ok := c.values[key]
+			if !ok {
+				return redisPkg.ErrCacheMiss
+			}
+
+			return json.Unmarshal(raw, value)
+		}).AnyTimes()
+	mockRedis.EXPECT().Delete(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, key string) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			delete(c.values, key)
+
+			return nil
+		}).AnyTimes()
+	mockRedis.EXPECT().Exists(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, key string) (bool, error) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			_, ok := c.values[key]
+
+			return ok, nil
+		}).AnyTimes()
+
+	return c
+}
+
+// credentialStore backs the passkey queries of the querier mock.
+type credentialStore struct {
+	mu          sync.Mutex
+	users       map[pgtype.UUID]repository.User
+	credentials []repository.WebauthnCredential
+}
+
+func newCredentialStore(mockQuerier *mock.MockQuerier, users ...repository.User) *credentialStore {
+	s := &credentialStore{users: make(map[pgtype.UUID]repository.User)}
+	for _, u := range users {
+		s.users[u.ID] = u
+	}
+
+	mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ repository.DBTX, id pgtype.UUID) (repository.User, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			u, ok := s.users[id]
+			if !ok {
+				return repository.User{}, pgx.ErrNoRows
+			}
+
+			return u, nil
+		}).AnyTimes()
+	mockQuerier.EXPECT().ListWebAuthnCredentialsByUser(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ repository.DBTX, id pgtype.UUID) ([]repository.WebauthnCredential, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			var rows []repository.WebauthnCredential
+
+			for _, c := range s.credentials {
+				if c.UserID == id {
+					rows = append(rows, c)
+				}
+			}
+
+			return rows, nil
+		}).AnyTimes()
+	mockQuerier.EXPECT().CreateWebAuthnCredential(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateWebAuthnCredentialParams) (repository.WebauthnCredential, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			for _, c := range s.credentials {
+				if bytes.Equal(c.CredentialID, arg.CredentialID) {
+					return repository.WebauthnCredential{}, &pgconn.PgError{Code: postgres.UniqueViolation}
+				}
+			}
+
+			row := repository.WebauthnCredential{
+				ID:              pgtype.UUID{Bytes: uuid.New(), Valid: true},
+				UserID:          arg.UserID,
+				CredentialID:    arg.CredentialID,
+				PublicKey:       arg.PublicKey,
+				AttestationType: arg.AttestationType,
+				Transports:      arg.Transports,
+				Aaguid:          arg.Aaguid,
+				SignCount:       arg.SignCount,
+				BackupEligible:  arg.BackupEligible,
+				BackupState:     arg.BackupState,
+				CreatedAt:       pgtype.Timestamp{Time: time.Now(), Valid: true},
+			}
+			s.credentials = append(s.credentials, row)
+
+			return row, nil
+		}).AnyTimes()
+	mockQuerier.EXPECT().UpdateWebAuthnCredentialUsage(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.UpdateWebAuthnCredentialUsageParams) error {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			for i, c := range s.credentials {
+				if bytes.Equal(c.CredentialID, arg.CredentialID) {
+					s.credentials[i].SignCount = arg.SignCount
+					s.credentials[i].BackupState = arg.BackupState
+				}
+			}
+
+			return nil
+		}).AnyTimes()
+	mockQuerier.EXPECT().UpdateLastLogin(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ repository.DBTX, id pgtype.UUID) (pgtype.UUID, error) {
+			return id, nil
+		}).AnyTimes()
+
+	return s
+}
+
+func TestPasskeyService_EndToEnd(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	cfg := &config.Config{}
+
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Error(gomock.Any()).AnyTimes()
+	mockLogger.EXPECT().Warn(gomock.Any()).AnyTimes()
+
+	relyingParty, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Goth",
+		RPOrigins:     []string{testOrigin},
+	})
+	assert.NoError(t, err)
+
+	alice := repository.User{
+		ID:         pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email:      "alice@example.com",
+		FullName:   pgtype.Text{String: "Alice", Valid: true},
+		IsVerified: pgtype.Bool{Bool: true, Valid: true},
+	}
+	bob := repository.User{
+		ID:    pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email: "bob@example.com",
+	}
+
+	newMemoryCache(mockRedis)
+	store := newCredentialStore(mockQuerier, alice, bob)
+
+	issuer := newTestJWT(time.Now)
+	tokens := NewTokenService(issuer, issuer, mockPgx, mockQuerier, mockRedis, mockLogger)
+	mockQuerier.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockQuerier.EXPECT().GetDefaultOrganizationID(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(pgtype.UUID{}, pgx.ErrNoRows).AnyTimes()
+	service := NewPasskeyService(mockPgx, mockQuerier, tokens, relyingParty, mockRedis, cfg, mockLogger)
+
+	aliceClaims := &jwt.Claims{ID: alice.ID.String(), Email: alice.Email}
+	bobClaims := &jwt.Claims{ID: bob.ID.String(), Email: bob.Email}
+	authenticator := newSoftAuthenticator(t, testOrigin)
+
+	t.Run("success: passkey registered", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		creation, err := service.BeginRegistration(ctx, aliceClaims)
+		assert.NoError(t, err)
+
+		res, err := service.FinishRegistration(ctx, aliceClaims, authenticator.create(t, creation))
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.ID)
+		assert.Equal(t, []string{"internal"}, res.Transports)
+		assert.Len(t, store.credentials, 1)
+		assert.Equal(t, alice.ID, store.credentials[0].UserID)
+		assert.Equal(t, "none", store.credentials[0].AttestationType)
+	})
+
+	t.Run("error: registration answered for another user", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		creation, err := service.BeginRegistration(ctx, aliceClaims)
+		assert.NoError(t, err)
+
+		res, err := service.FinishRegistration(ctx, bobClaims, newSoftAuthenticator(t, testOrigin).create(t, creation))
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: registration from a foreign origin", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		creation, err := service.BeginRegistration(ctx, bobClaims)
+		assert.NoError(t, err)
+
+		res, err := service.FinishRegistration(ctx, bobClaims, newSoftAuthenticator(t, "https://evil.example").create(t, creation))
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: unknown challenge", func(t *testing.T) {
+		creation, err := service.BeginRegistration(ctx, bobClaims)
+		assert.NoError(t, err)
+
+		creation.Response.Challenge = []byte("not-the-challenge")
+
+		res, err := service.FinishRegistration(ctx, bobClaims, newSoftAuthenticator(t, testOrigin).create(t, creation))
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	var loginBody []byte
+
+	t.Run("success: signed in with the passkey", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		assertion, err := service.BeginLogin(ctx)
+		assert.NoError(t, err)
+
+		loginBody = authenticator.get(t, assertion)
+
+		res, err := service.FinishLogin(ctx, loginBody)
+		assert.NoError(t, err)
+
+		claims, err := issuer.ValidateAccessToken(res.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, alice.ID.String(), claims.ID)
+		assert.Equal(t, alice.Email, claims.Email)
+		assert.Equal(t, int64(1), store.credentials[0].SignCount)
+	})
+
+	t.Run("error: assertion replayed", func(t *testing.T) {
+		res, err := service.FinishLogin(ctx, loginBody)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: unregistered authenticator", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		stranger := newSoftAuthenticator(t, testOrigin)
+		stranger.userHandle = alice.ID.Bytes[:]
+
+		assertion, err := service.BeginLogin(ctx)
+		assert.NoError(t, err)
+
+		res, err := service.FinishLogin(ctx, stranger.get(t, assertion))
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: signature counter went backwards", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		clone := *authenticator
+		clone.signCount = 0
+
+		assertion, err := service.BeginLogin(ctx)
+		assert.NoError(t, err)
+
+		res, err := service.FinishLogin(ctx, clone.get(t, assertion))
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: passkey already registered", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		creation, err := service.BeginRegistration(ctx, bobClaims)
+		assert.NoError(t, err)
+
+		// The authenticator ignores the exclusion list and presents alice's credential ID again.
+		res, err := service.FinishRegistration(ctx, bobClaims, authenticator.create(t, creation))
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	assert.NoError(t, mockPgx.ExpectationsWereMet())
+}
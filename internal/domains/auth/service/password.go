@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/password"
+	"github.com/savioruz/goth/pkg/secret"
+)
+
+// CheckPassword checks a new password against the policy and reports every rule it breaks as an error
+// on field. personal holds details of the user, such as the email address and name.
+func CheckPassword(policy *password.Policy, field, pw string, personal ...string) error {
+	violations, err := policy.Check(pw, personal...)
+	if err != nil {
+		return failure.InternalError(err)
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fields := make([]failure.FieldError, len(violations))
+	for i, v := range violations {
+		fields[i] = failure.FieldError{
+			Field:   field,
+			Code:    v.Code,
+			Message: v.Message,
+		}
+	}
+
+	return failure.InvalidFields("password does not meet the password policy", fields...)
+}
+
+// ForgotPassword sends a password reset link to the given address. It succeeds whether or not the
+// address belongs to an account, so it cannot be used to probe for accounts. The link is handed to the
+// mailer queue, so the request does not wait on the mail server.
+func (s *authService) ForgotPassword(ctx context.Context, req dto.ForgotPasswordRequest) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("forgot password - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("forgot password - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.repo.GetUserByEmail(ctx, tx, req.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("forgot password - service - failed to get user by email: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if user.Email == "" {
+		s.logger.Error("forgot password - service - user not found")
+
+		return nil
+	}
+
+	if err = s.repo.InvalidatePasswordResets(ctx, tx, user.ID); err != nil {
+		s.logger.Error("forgot password - service - failed to invalidate password resets: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	token, hash, err := secret.NewToken()
+	if err != nil {
+		s.logger.Error("forgot password - service - failed to generate token: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	_, err = s.repo.CreatePasswordReset(ctx, tx, repository.CreatePasswordResetParams{
+		UserID: user.ID,
+		Token:  hash,
+	})
+	if err != nil {
+		s.logger.Error("forgot password - service - failed to create password reset: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("forgot password - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.notifier.SendPasswordReset(ctx, user, token); err != nil {
+		s.logger.Error("forgot password - service - failed to send password reset: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword consumes a password reset token, sets the new password and signs the user out everywhere.
+func (s *authService) ResetPassword(ctx context.Context, req dto.ResetPasswordRequest) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("reset password - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("reset password - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	reset, err := s.repo.GetPasswordResetByToken(ctx, tx, secret.Hash(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("reset password - service - reset token not found")
+
+		return failure.BadRequestFromString("invalid or expired reset token")
+	}
+
+	if err != nil {
+		s.logger.Error("reset password - service - failed to get password reset: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	user, err := s.repo.GetUserByID(ctx, tx, reset.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("reset password - service - user not found")
+
+		return failure.BadRequestFromString("invalid or expired reset token")
+	}
+
+	if err != nil {
+		s.logger.Error("reset password - service - failed to get user: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	// The token is only consumed for an acceptable password, so the user can try another one.
+	if err = CheckPassword(s.policy, "password", req.Password, user.Email, user.FullName.String); err != nil {
+		s.logger.Error("reset password - service - password rejected by policy: %w", err)
+
+		return err
+	}
+
+	_, err = s.repo.ConsumePasswordReset(ctx, tx, reset.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("reset password - service - reset token already used")
+
+		return failure.BadRequestFromString("invalid or expired reset token")
+	}
+
+	if err != nil {
+		s.logger.Error("reset password - service - failed to consume password reset: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	hash, err := s.hashers.Hash(req.Password)
+	if err != nil {
+		s.logger.Error("reset password - service - failed to generate password: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	user, err = s.repo.ResetPassword(ctx, tx, repository.ResetPasswordParams{
+		Password: pgtype.Text{
+			String: hash,
+			Valid:  true,
+		},
+		ID: reset.UserID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("reset password - service - user not found")
+
+		return failure.BadRequestFromString("invalid or expired reset token")
+	}
+
+	if err != nil {
+		s.logger.Error("reset password - service - failed to reset password: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.repo.InvalidatePasswordResets(ctx, tx, user.ID); err != nil {
+		s.logger.Error("reset password - service - failed to invalidate password resets: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.tokens.RevokeAll(ctx, user.ID.String()); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("reset password - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	jwtMock "github.com/savioruz/goth/pkg/jwt/mock"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/password"
+	"github.com/savioruz/goth/pkg/secret"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService_ForgotPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	req := dto.ForgotPasswordRequest{Email: "test@example.com"}
+	mockUser := repository.User{
+		ID:    pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email: "test@example.com",
+	}
+
+	t.Run("error: failure getting user by email", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, mockError)
+
+		err := service.ForgotPassword(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: unknown email is not revealed", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+
+		err := service.ForgotPassword(ctx, req)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: delivery failure is not revealed", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().InvalidatePasswordResets(gomock.Any(), gomock.Any(), mockUser.ID).Return(nil)
+		mockQuerier.EXPECT().
+			CreatePasswordReset(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.PasswordReset{}, nil)
+		mockNotifier.EXPECT().SendPasswordReset(gomock.Any(), mockUser, gomock.Any()).Return(mockError)
+
+		err := service.ForgotPassword(ctx, req)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: hashed token stored and plain token sent", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		var stored, sent string
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().InvalidatePasswordResets(gomock.Any(), gomock.Any(), mockUser.ID).Return(nil)
+		mockQuerier.EXPECT().
+			CreatePasswordReset(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreatePasswordResetParams) (repository.PasswordReset, error) {
+				assert.Equal(t, mockUser.ID, arg.UserID)
+				stored = arg.Token
+
+				return repository.PasswordReset{UserID: arg.UserID, Token: arg.Token}, nil
+			})
+		mockNotifier.EXPECT().
+			SendPasswordReset(gomock.Any(), mockUser, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.User, token string) error {
+				sent = token
+
+				return nil
+			})
+
+		err := service.ForgotPassword(ctx, req)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, sent)
+		assert.Equal(t, secret.Hash(sent), stored)
+	})
+}
+
+func TestAuthService_ResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	req := dto.ResetPasswordRequest{Token: "plain-token", Password: "new-password"}
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	reset := repository.PasswordReset{
+		ID:     pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		UserID: userID,
+		Token:  secret.Hash("plain-token"),
+	}
+	user := repository.User{
+		ID:       userID,
+		Email:    "jane.doe@example.com",
+		FullName: pgtype.Text{String: "Jane Doe", Valid: true},
+	}
+
+	t.Run("error: unknown or expired token", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetPasswordResetByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(repository.PasswordReset{}, pgx.ErrNoRows)
+
+		err := service.ResetPassword(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: password rejected by policy", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetPasswordResetByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(reset, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(user, nil)
+
+		err := service.ResetPassword(ctx, dto.ResetPasswordRequest{Token: "plain-token", Password: "JaneDoe!"})
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+		assert.Equal(t, []failure.FieldError{{
+			Field:   "password",
+			Code:    password.CodePersonalInfo,
+			Message: "must not contain your email address or name",
+		}}, failure.GetFields(err))
+	})
+
+	t.Run("error: token consumed concurrently", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetPasswordResetByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(reset, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(user, nil)
+		mockQuerier.EXPECT().
+			ConsumePasswordReset(gomock.Any(), gomock.Any(), reset.ID).
+			Return(repository.PasswordReset{}, pgx.ErrNoRows)
+
+		err := service.ResetPassword(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: failure revoking sessions", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetPasswordResetByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(reset, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(user, nil)
+		mockQuerier.EXPECT().
+			ConsumePasswordReset(gomock.Any(), gomock.Any(), reset.ID).
+			Return(reset, nil)
+		mockQuerier.EXPECT().
+			ResetPassword(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.User{ID: userID}, nil)
+		mockQuerier.EXPECT().InvalidatePasswordResets(gomock.Any(), gomock.Any(), userID).Return(nil)
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(failure.InternalError(mockError))
+
+		err := service.ResetPassword(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: password replaced and sessions revoked", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetPasswordResetByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(reset, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(user, nil)
+		mockQuerier.EXPECT().
+			ConsumePasswordReset(gomock.Any(), gomock.Any(), reset.ID).
+			Return(reset, nil)
+		mockQuerier.EXPECT().
+			ResetPassword(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.ResetPasswordParams) (repository.User, error) {
+				assert.Equal(t, userID, arg.ID)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(arg.Password.String), []byte("new-password")))
+
+				return repository.User{ID: userID, Password: arg.Password}, nil
+			})
+		mockQuerier.EXPECT().InvalidatePasswordResets(gomock.Any(), gomock.Any(), userID).Return(nil)
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(nil)
+
+		err := service.ResetPassword(ctx, req)
+
+		assert.NoError(t, err)
+	})
+}
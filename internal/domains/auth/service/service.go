@@ -3,8 +3,10 @@ package service
 import (
 	"context"
 	"errors"
+	"github.com/savioruz/goth/config"
 	"github.com/savioruz/goth/pkg/failure"
 	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/password"
 	"github.com/savioruz/goth/pkg/postgres"
 
 	"github.com/jackc/pgx/v5"
@@ -12,29 +14,77 @@ import (
 	"github.com/savioruz/goth/internal/domains/user/dto"
 	"github.com/savioruz/goth/internal/domains/user/repository"
 	"github.com/savioruz/goth/pkg/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthService interface {
 	Register(ctx context.Context, req dto.UserRegisterRequest) (res *dto.UserRegisterResponse, err error)
-	Login(ctx context.Context, req dto.UserLoginRequest) (*dto.UserLoginResponse, error)
+	RegisterInvited(ctx context.Context, tx pgx.Tx, req dto.UserRegisterRequest) (repository.User, error)
+	Login(ctx context.Context, req dto.UserLoginRequest, ip string) (*dto.UserLoginResponse, error)
+	Refresh(ctx context.Context, req dto.RefreshTokenRequest) (*dto.UserLoginResponse, error)
+	Logout(ctx context.Context, claims *jwt.Claims) error
+	LogoutAll(ctx context.Context, claims *jwt.Claims) error
+	ListSessions(ctx context.Context, claims *jwt.Claims) ([]*dto.SessionResponse, error)
+	RevokeSession(ctx context.Context, claims *jwt.Claims, id string) error
+	RevokeOtherSessions(ctx context.Context, claims *jwt.Claims) error
+	PublicKeys() jwt.JWKS
+	SendVerification(ctx context.Context, claims *jwt.Claims) error
+	ResendVerification(ctx context.Context, req dto.ResendVerificationRequest) error
+	ConfirmEmail(ctx context.Context, req dto.ConfirmEmailRequest) error
+	ForgotPassword(ctx context.Context, req dto.ForgotPasswordRequest) error
+	ResetPassword(ctx context.Context, req dto.ResetPasswordRequest) error
+	EnrollMFA(ctx context.Context, claims *jwt.Claims) (*dto.MFAEnrollResponse, error)
+	ConfirmMFA(ctx context.Context, claims *jwt.Claims, req dto.ConfirmMFARequest, ip string) (*dto.MFARecoveryCodesResponse, error)
+	DisableMFA(ctx context.Context, claims *jwt.Claims, req dto.DisableMFARequest, ip string) error
+	VerifyMFA(ctx context.Context, req dto.VerifyMFARequest) (*dto.UserLoginResponse, error)
+	UnlockUser(ctx context.Context, id string) error
 }
 
 type authService struct {
-	db     postgres.PgxIface
-	repo   repository.Querier
-	logger logger.Interface
+	db       postgres.PgxIface
+	repo     repository.Querier
+	tokens   TokenService
+	issuer   jwt.TokenIssuer
+	notifier Notifier
+	lockout  LockoutService
+	policy   *password.Policy
+	hashers  *password.Hashers
+	config   *config.Config
+	logger   logger.Interface
 }
 
-func New(db postgres.PgxIface, r repository.Querier, l logger.Interface) AuthService {
+func New(
+	db postgres.PgxIface,
+	r repository.Querier,
+	t TokenService,
+	i jwt.TokenIssuer,
+	n Notifier,
+	lo LockoutService,
+	p *password.Policy,
+	h *password.Hashers,
+	cfg *config.Config,
+	l logger.Interface,
+) AuthService {
 	return &authService{
-		db:     db,
-		repo:   r,
-		logger: l,
+		db:       db,
+		repo:     r,
+		tokens:   t,
+		issuer:   i,
+		notifier: n,
+		lockout:  lo,
+		policy:   p,
+		hashers:  h,
+		config:   cfg,
+		logger:   l,
 	}
 }
 
 func (s *authService) Register(ctx context.Context, req dto.UserRegisterRequest) (res *dto.UserRegisterResponse, err error) {
+	if err = CheckPassword(s.policy, "password", req.Password, req.Email, req.Name); err != nil {
+		s.logger.Error("register - service - password rejected by policy: %w", err)
+
+		return nil, err
+	}
+
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		s.logger.Error("register - service - failed to begin transaction: %w", err)
@@ -48,60 +98,126 @@ func (s *authService) Register(ctx context.Context, req dto.UserRegisterRequest)
 		}
 	}(tx, ctx)
 
+	newUser, err := s.createAccount(ctx, tx, req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.createVerification(ctx, tx, newUser)
+	if err != nil {
+		s.logger.Error("register - service - failed to create email verification: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("register - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	// The account exists at this point; a failed delivery can be retried through the resend endpoint.
+	if err = s.notifier.SendEmailVerification(ctx, newUser, token); err != nil {
+		s.logger.Error("register - service - failed to send email verification: %w", err)
+	}
+
+	res = new(dto.UserRegisterResponse).ToRegisterResponse(newUser)
+
+	return res, nil
+}
+
+// RegisterInvited registers an account in the transaction of the caller, for an address an emailed
+// invitation has proven. The account is verified right away, so no verification email is sent.
+func (s *authService) RegisterInvited(ctx context.Context, tx pgx.Tx, req dto.UserRegisterRequest) (repository.User, error) {
+	if err := CheckPassword(s.policy, "password", req.Password, req.Email, req.Name); err != nil {
+		s.logger.Error("register - service - password rejected by policy: %w", err)
+
+		return repository.User{}, err
+	}
+
+	return s.createAccount(ctx, tx, req, true)
+}
+
+// createAccount creates a user with a password and the default roles, unless the email is taken.
+func (s *authService) createAccount(
+	ctx context.Context,
+	tx pgx.Tx,
+	req dto.UserRegisterRequest,
+	verified bool,
+) (repository.User, error) {
 	exist, err := s.repo.GetUserByEmail(ctx, tx, req.Email)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		s.logger.Error("register - service - failed to get user by email: %w", err)
 
-		return nil, failure.InternalError(err)
+		return repository.User{}, failure.InternalError(err)
 	}
 
 	if exist.Email != "" {
 		s.logger.Error("register - service - user with email already exists")
 
-		return nil, failure.BadRequestFromString("user already exists")
+		return repository.User{}, failure.Conflict("email already in use")
 	}
 
-	password, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hash, err := s.hashers.Hash(req.Password)
 	if err != nil {
 		s.logger.Error("register - service - failed to generate password: %w", err)
 
-		return nil, failure.InternalError(err)
+		return repository.User{}, failure.InternalError(err)
 	}
 
-	newUser, err := s.repo.CreateUser(ctx, tx, repository.CreateUserParams{
+	user, err := s.repo.CreateUser(ctx, tx, repository.CreateUserParams{
 		Email: req.Email,
 		Password: pgtype.Text{
-			String: string(password),
+			String: hash,
 			Valid:  true,
 		},
-		Level: "1",
 		FullName: pgtype.Text{
 			String: req.Name,
 			Valid:  true,
 		},
 		IsVerified: pgtype.Bool{
-			Bool:  false,
+			Bool:  verified,
 			Valid: true,
 		},
 	})
+	// A deleted account keeps its email, so that it can be restored, and answers the same as a live one.
+	if postgres.IsUniqueViolation(err) {
+		s.logger.Error("register - service - email already in use")
+
+		return repository.User{}, failure.Conflict("email already in use")
+	}
+
 	if err != nil {
 		s.logger.Error("register - service - failed to create user: %w", err)
 
-		return nil, failure.InternalError(err)
+		return repository.User{}, failure.InternalError(err)
 	}
 
-	if err = tx.Commit(ctx); err != nil {
-		s.logger.Error("register - service - failed to commit transaction: %w", err)
+	if err = s.repo.AssignDefaultRoles(ctx, tx, user.ID); err != nil {
+		s.logger.Error("register - service - failed to assign default roles: %w", err)
+
+		return repository.User{}, failure.InternalError(err)
+	}
+
+	return user, nil
+}
+
+// Login signs a user in with email and password. Unknown emails, wrong passwords and lockouts share
+// one error response.
+func (s *authService) Login(ctx context.Context, req dto.UserLoginRequest, ip string) (*dto.UserLoginResponse, error) {
+	locked, err := s.lockout.Locked(ctx, req.Email, ip)
+	if err != nil {
+		s.logger.Error("login - service - failed to check lockout: %w", err)
 
 		return nil, failure.InternalError(err)
 	}
 
-	res = new(dto.UserRegisterResponse).ToRegisterResponse(newUser)
+	if locked {
+		s.logger.Error("login - service - locked out")
 
-	return res, nil
-}
+		return nil, failure.Unauthorized("invalid email or password")
+	}
 
-func (s *authService) Login(ctx context.Context, req dto.UserLoginRequest) (*dto.UserLoginResponse, error) {
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		s.logger.Error("login - service - failed to begin transaction: %w", err)
@@ -122,49 +238,152 @@ func (s *authService) Login(ctx context.Context, req dto.UserLoginRequest) (*dto
 		return nil, failure.InternalError(err)
 	}
 
-	if user.Email == "" {
+	// Accounts created through OAuth or a magic link have no password to sign in with.
+	if user.Email == "" || !user.Password.Valid {
+		s.hashers.VerifyDummy(req.Password)
+		s.lockout.Fail(ctx, req.Email, ip)
 		s.logger.Error("login - service - user not found")
 
-		return nil, failure.NotFound("user not found")
+		return nil, failure.Unauthorized("invalid email or password")
 	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(user.Password.String), []byte(req.Password)); err != nil {
-		s.logger.Error("login - service - unauthorized")
+	ok, rehash, err := s.hashers.Verify(req.Password, user.Password.String)
+	if err != nil {
+		s.logger.Error("login - service - failed to verify password: %w", err)
 
-		return nil, failure.Unauthorized("unauthorized")
+		return nil, failure.InternalError(err)
 	}
 
-	// TODO: check if user is verified
+	if !ok {
+		s.lockout.Fail(ctx, req.Email, ip)
+		s.logger.Error("login - service - wrong password")
 
-	_, err = s.repo.UpdateLastLogin(ctx, tx, user.ID)
-	if err != nil {
-		s.logger.Error("login - service - failed to update last login: %w", err)
+		return nil, failure.Unauthorized("invalid email or password")
+	}
+
+	s.lockout.Reset(ctx, req.Email)
+
+	if s.config.Auth.RequireVerifiedEmail && !user.IsVerified.Bool {
+		s.logger.Error("login - service - email not verified")
+
+		return nil, failure.Forbidden("email not verified")
+	}
+
+	if rehash {
+		if err = s.rehash(ctx, tx, user, req.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, tx, user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("login - service - failed to get mfa: %w", err)
 
 		return nil, failure.InternalError(err)
 	}
 
+	// The last login is recorded once the second factor has been verified.
+	if !mfa.EnabledAt.Valid {
+		if _, err = s.repo.UpdateLastLogin(ctx, tx, user.ID); err != nil {
+			s.logger.Error("login - service - failed to update last login: %w", err)
+
+			return nil, failure.InternalError(err)
+		}
+	}
+
 	if err = tx.Commit(ctx); err != nil {
 		s.logger.Error("login - service - failed to commit transaction: %w", err)
 
 		return nil, failure.InternalError(err)
 	}
 
-	accessToken, err := jwt.GenerateAccessToken(user.ID.String(), user.Email, user.Level)
+	if mfa.EnabledAt.Valid {
+		return s.tokens.Challenge(ctx, user)
+	}
+
+	return s.tokens.Issue(ctx, user)
+}
+
+// rehash replaces a hash made by an outdated hasher or with outdated parameters. It only applies while
+// the stored hash is unchanged, so that it never overwrites a concurrent password change.
+func (s *authService) rehash(ctx context.Context, db repository.DBTX, user repository.User, pw string) error {
+	hash, err := s.hashers.Hash(pw)
 	if err != nil {
-		s.logger.Error("login - service - failed to generate access token: %w", err)
+		s.logger.Error("login - service - failed to rehash password: %w", err)
 
-		return nil, failure.InternalError(err)
+		return failure.InternalError(err)
 	}
 
-	refreshToken, err := jwt.GenerateRefreshToken(user.ID.String(), user.Email, user.Level)
+	err = s.repo.RehashPassword(ctx, db, repository.RehashPasswordParams{
+		NewPassword: pgtype.Text{String: hash, Valid: true},
+		ID:          user.ID,
+		OldPassword: user.Password,
+	})
 	if err != nil {
-		s.logger.Error("login - service - failed to generate refresh token: %w", err)
+		s.logger.Error("login - service - failed to save rehashed password: %w", err)
 
-		return nil, failure.InternalError(err)
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+func (s *authService) Refresh(ctx context.Context, req dto.RefreshTokenRequest) (*dto.UserLoginResponse, error) {
+	return s.tokens.Rotate(ctx, req.RefreshToken)
+}
+
+func (s *authService) Logout(ctx context.Context, claims *jwt.Claims) error {
+	return s.tokens.Revoke(ctx, claims)
+}
+
+func (s *authService) LogoutAll(ctx context.Context, claims *jwt.Claims) error {
+	if err := s.tokens.RevokeAll(ctx, claims.ID); err != nil {
+		return err
+	}
+
+	return s.tokens.Revoke(ctx, claims)
+}
+
+func (s *authService) ListSessions(ctx context.Context, claims *jwt.Claims) ([]*dto.SessionResponse, error) {
+	return s.tokens.Sessions(ctx, claims.ID, claims.FamilyID)
+}
+
+func (s *authService) RevokeSession(ctx context.Context, claims *jwt.Claims, id string) error {
+	return s.tokens.RevokeSession(ctx, claims.ID, id)
+}
+
+// RevokeOtherSessions logs the user out of every device but the one making the request.
+func (s *authService) RevokeOtherSessions(ctx context.Context, claims *jwt.Claims) error {
+	return s.tokens.RevokeOtherSessions(ctx, claims.ID, claims.FamilyID)
+}
+
+func (s *authService) PublicKeys() jwt.JWKS {
+	return s.issuer.PublicKeys()
+}
+
+// UnlockUser lifts a lockout of the user's account and forgets its failed logins.
+func (s *authService) UnlockUser(ctx context.Context, id string) error {
+	var userID pgtype.UUID
+	if err := userID.Scan(id); err != nil {
+		return failure.BadRequestFromString("invalid user id")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, s.db, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("unlock user - service - user not found")
+
+		return failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("unlock user - service - failed to get user by id: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.lockout.Unlock(ctx, user.Email); err != nil {
+		return failure.InternalError(err)
 	}
 
-	return &dto.UserLoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	}, nil
+	return nil
 }
@@ -10,20 +10,38 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
 	"github.com/savioruz/goth/internal/domains/user/dto"
 	"github.com/savioruz/goth/internal/domains/user/mock"
 	"github.com/savioruz/goth/internal/domains/user/repository"
 	"github.com/savioruz/goth/pkg/failure"
 	"github.com/savioruz/goth/pkg/jwt"
+	jwtMock "github.com/savioruz/goth/pkg/jwt/mock"
 	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/password"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/secret"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 )
 
-func init() {
-	jwt.Initialize("test-app", "test-secret-key", time.Hour, time.Hour*24)
+func newTestJWT(now func() time.Time) *jwt.JWT {
+	key, _ := jwt.NewHMACKey("test-key", "HS512", "test-secret-key")
+	keys, _ := jwt.NewKeySet(key.ID, key)
+
+	j, _ := jwt.New("test-app", keys,
+		jwt.Audience("test-audience"),
+		jwt.AccessTokenExpiry(time.Hour),
+		jwt.RefreshTokenExpiry(time.Hour*24),
+		jwt.Clock(now),
+	)
+
+	return j
 }
 
 func TestAuthService_Register(t *testing.T) {
@@ -32,11 +50,17 @@ func TestAuthService_Register(t *testing.T) {
 
 	ctx := context.Background()
 	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
 	mockPgx, _ := pgxmock.NewPool()
 	mockLogger := log.NewMockInterface(ctrl)
 	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
 
-	service := New(mockPgx, mockQuerier, mockLogger)
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
 
 	registerReq := dto.UserRegisterRequest{
 		Email:    "test@example.com",
@@ -49,12 +73,28 @@ func TestAuthService_Register(t *testing.T) {
 		ID:         pgtype.UUID{Bytes: mockID, Valid: true},
 		Email:      "test@example.com",
 		Password:   pgtype.Text{String: "hashedpassword", Valid: true},
-		Level:      "1",
 		FullName:   pgtype.Text{String: "Test User", Valid: true},
 		IsVerified: pgtype.Bool{Bool: false, Valid: true},
 		CreatedAt:  pgtype.Timestamp{Time: time.Now(), Valid: true},
 	}
 
+	t.Run("error: password rejected by policy", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		strict := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout,
+			password.NewPolicy(password.MinLength(12), password.MinScore(2)), hashers, cfg, mockLogger)
+
+		res, err := strict.Register(ctx, registerReq)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+		assert.Equal(t, []failure.FieldError{
+			{Field: "password", Code: password.CodeTooShort, Message: "must be at least 12 characters long"},
+			{Field: "password", Code: password.CodeTooWeak, Message: "is too easy to guess"},
+		}, failure.GetFields(err))
+	})
+
 	t.Run("error: transaction begin failure", func(t *testing.T) {
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
 		mockPgx.ExpectBegin().WillReturnError(mockError)
@@ -97,7 +137,7 @@ func TestAuthService_Register(t *testing.T) {
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
-		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
 	})
 
 	t.Run("error: failure creating user", func(t *testing.T) {
@@ -121,6 +161,81 @@ func TestAuthService_Register(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
 	})
 
+	t.Run("error: email of a deleted account", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+
+		mockQuerier.EXPECT().
+			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.User{}, &pgconn.PgError{Code: postgres.UniqueViolation})
+
+		res, err := service.Register(ctx, registerReq)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("error: failure assigning default roles", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, nil)
+
+		mockQuerier.EXPECT().
+			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(mockUser, nil)
+
+		mockQuerier.EXPECT().
+			AssignDefaultRoles(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockError)
+
+		res, err := service.Register(ctx, registerReq)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: failure creating email verification", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, nil)
+
+		mockQuerier.EXPECT().
+			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(mockUser, nil)
+
+		mockQuerier.EXPECT().
+			AssignDefaultRoles(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(nil)
+
+		mockQuerier.EXPECT().
+			CreateEmailVerification(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.EmailVerification{}, mockError)
+
+		res, err := service.Register(ctx, registerReq)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
 	t.Run("success: user registered", func(t *testing.T) {
 		mockPgx.ExpectBegin()
 		mockPgx.ExpectCommit()
@@ -134,7 +249,28 @@ func TestAuthService_Register(t *testing.T) {
 			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
 			Return(mockUser, nil)
 
-		mockPgx.ExpectCommit()
+		mockQuerier.EXPECT().
+			AssignDefaultRoles(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(nil)
+
+		var token, stored string
+
+		mockQuerier.EXPECT().
+			CreateEmailVerification(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateEmailVerificationParams) (repository.EmailVerification, error) {
+				assert.Equal(t, mockUser.ID, arg.UserID)
+				stored = arg.Token
+
+				return repository.EmailVerification{UserID: arg.UserID, Token: arg.Token}, nil
+			})
+
+		mockNotifier.EXPECT().
+			SendEmailVerification(gomock.Any(), mockUser, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.User, t string) error {
+				token = t
+
+				return nil
+			})
 
 		res, err := service.Register(ctx, registerReq)
 
@@ -142,25 +278,103 @@ func TestAuthService_Register(t *testing.T) {
 		assert.NotNil(t, res)
 		assert.Equal(t, mockID.String(), res.ID)
 		assert.Equal(t, "test@example.com", res.Email)
+		assert.NotEmpty(t, token)
+		assert.Equal(t, secret.Hash(token), stored)
 	})
 }
 
+func TestAuthService_RegisterInvited(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.MinCost))
+
+	service := New(nil, mockQuerier, nil, nil, mockNotifier, nil, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	req := dto.UserRegisterRequest{Email: "bob@example.com", Password: "password123", Name: "Bob"}
+
+	t.Run("error: password rejected by policy", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		strict := New(nil, mockQuerier, nil, nil, mockNotifier, nil, password.NewPolicy(password.MinLength(12)), hashers,
+			&config.Config{}, mockLogger)
+
+		_, err := strict.RegisterInvited(ctx, nil, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: user already exists", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "bob@example.com").
+			Return(repository.User{Email: "bob@example.com"}, nil)
+
+		_, err := service.RegisterInvited(ctx, nil, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: verified account without a verification email", func(t *testing.T) {
+		mockPgx, _ := pgxmock.NewPool()
+		mockPgx.ExpectBegin()
+
+		tx, err := mockPgx.Begin(ctx)
+		assert.NoError(t, err)
+
+		id := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), tx, "bob@example.com").Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().CreateUser(gomock.Any(), tx, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateUserParams) (repository.User, error) {
+				assert.Equal(t, pgtype.Bool{Bool: true, Valid: true}, arg.IsVerified)
+				ok, _, err := hashers.Verify("password123", arg.Password.String)
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				return repository.User{ID: id, Email: arg.Email, IsVerified: arg.IsVerified}, nil
+			})
+		mockQuerier.EXPECT().AssignDefaultRoles(gomock.Any(), tx, id).Return(nil)
+
+		user, err := service.RegisterInvited(ctx, tx, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, id, user.ID)
+		assert.True(t, user.IsVerified.Bool)
+		assert.NoError(t, mockPgx.ExpectationsWereMet())
+	})
+}
 func TestAuthService_Login(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	ctx := context.Background()
 	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
 	mockPgx, _ := pgxmock.NewPool()
 	mockLogger := log.NewMockInterface(ctrl)
 	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
 
-	service := New(mockPgx, mockQuerier, mockLogger)
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
 
 	loginReq := dto.UserLoginRequest{
 		Email:    "test@example.com",
 		Password: "password123",
 	}
+	ip := "203.0.113.7"
+
+	mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", ip).Return(false, nil).AnyTimes()
+	mockLockout.EXPECT().Reset(gomock.Any(), "test@example.com").AnyTimes()
 
 	mockID := uuid.New()
 	mockUser := func(password string) repository.User {
@@ -168,7 +382,6 @@ func TestAuthService_Login(t *testing.T) {
 			ID:         pgtype.UUID{Bytes: mockID, Valid: true},
 			Email:      "test@example.com",
 			Password:   pgtype.Text{String: password, Valid: true},
-			Level:      "1",
 			FullName:   pgtype.Text{String: "Test User", Valid: true},
 			IsVerified: pgtype.Bool{Bool: false, Valid: true},
 			CreatedAt:  pgtype.Timestamp{Time: time.Now(), Valid: true},
@@ -177,12 +390,37 @@ func TestAuthService_Login(t *testing.T) {
 		}
 	}
 
+	t.Run("error: failure checking lockout", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "198.51.100.1").Return(false, mockError)
+
+		res, err := service.Login(ctx, loginReq, "198.51.100.1")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: locked out", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockLockout.EXPECT().Locked(gomock.Any(), "test@example.com", "198.51.100.2").Return(true, nil)
+
+		res, err := service.Login(ctx, loginReq, "198.51.100.2")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+		assert.Equal(t, "invalid email or password", err.Error())
+	})
+
 	t.Run("error: transaction begin failure", func(t *testing.T) {
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
 
 		mockPgx.ExpectBegin().WillReturnError(mockError)
 
-		res, err := service.Login(ctx, loginReq)
+		res, err := service.Login(ctx, loginReq, ip)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
@@ -199,7 +437,7 @@ func TestAuthService_Login(t *testing.T) {
 			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
 			Return(repository.User{}, mockError)
 
-		res, err := service.Login(ctx, loginReq)
+		res, err := service.Login(ctx, loginReq, ip)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
@@ -216,11 +454,14 @@ func TestAuthService_Login(t *testing.T) {
 			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
 			Return(repository.User{}, nil)
 
-		res, err := service.Login(ctx, loginReq)
+		mockLockout.EXPECT().Fail(gomock.Any(), "test@example.com", ip)
+
+		res, err := service.Login(ctx, loginReq, ip)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
-		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+		assert.Equal(t, "invalid email or password", err.Error())
 	})
 
 	t.Run("error: invalid password", func(t *testing.T) {
@@ -230,18 +471,190 @@ func TestAuthService_Login(t *testing.T) {
 		mockPgx.ExpectRollback()
 
 		// Create a user with a password that won't match
-		invalidPasswordUser := mockUser("hashedpassword")
-		_, _ = bcrypt.GenerateFromPassword([]byte("differentpassword"), bcrypt.DefaultCost)
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("differentpassword"), bcrypt.DefaultCost)
+		invalidPasswordUser := mockUser(string(hashedPassword))
 
 		mockQuerier.EXPECT().
 			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
 			Return(invalidPasswordUser, nil)
 
-		res, err := service.Login(ctx, loginReq)
+		mockLockout.EXPECT().Fail(gomock.Any(), "test@example.com", ip)
+
+		res, err := service.Login(ctx, loginReq, ip)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+		assert.Equal(t, "invalid email or password", err.Error())
+	})
+
+	t.Run("error: account without password", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		oauthUser := mockUser("")
+		oauthUser.Password = pgtype.Text{}
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(oauthUser, nil)
+
+		mockLockout.EXPECT().Fail(gomock.Any(), "test@example.com", ip)
+
+		res, err := service.Login(ctx, loginReq, ip)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+		assert.Equal(t, "invalid email or password", err.Error())
+	})
+
+	t.Run("error: failure saving rehashed password", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		outdatedUser := mockUser(string(hashedPassword))
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(outdatedUser, nil)
+
+		mockQuerier.EXPECT().
+			RehashPassword(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(mockError)
+
+		res, err := service.Login(ctx, loginReq, ip)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: outdated hash rehashed in the login transaction", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		outdatedUser := mockUser(string(hashedPassword))
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(outdatedUser, nil)
+
+		mockQuerier.EXPECT().
+			RehashPassword(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.RehashPasswordParams) error {
+				assert.Equal(t, outdatedUser.ID, arg.ID)
+				assert.Equal(t, outdatedUser.Password, arg.OldPassword)
+
+				cost, err := bcrypt.Cost([]byte(arg.NewPassword.String))
+				assert.NoError(t, err)
+				assert.Equal(t, bcrypt.DefaultCost, cost)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(arg.NewPassword.String), []byte("password123")))
+
+				return nil
+			})
+
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), outdatedUser.ID).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
+
+		mockQuerier.EXPECT().
+			UpdateLastLogin(gomock.Any(), gomock.Any(), outdatedUser.ID).
+			Return(pgtype.UUID{Bytes: mockID, Valid: true}, nil)
+
+		mockTokens.EXPECT().
+			Issue(gomock.Any(), outdatedUser).
+			Return(&dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil)
+
+		res, err := service.Login(ctx, loginReq, ip)
+
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("error: email not verified", func(t *testing.T) {
+		cfg.Auth.RequireVerifiedEmail = true
+		defer func() { cfg.Auth.RequireVerifiedEmail = false }()
+
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(mockUser(string(hashedPassword)), nil)
+
+		res, err := service.Login(ctx, loginReq, ip)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: failure getting mfa", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+		mockUserWithValidPassword := mockUser(string(hashedPassword))
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(mockUserWithValidPassword, nil)
+
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), mockUserWithValidPassword.ID).
+			Return(repository.UserMfa{}, mockError)
+
+		res, err := service.Login(ctx, loginReq, ip)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: mfa challenge instead of tokens", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+		mockUserWithValidPassword := mockUser(string(hashedPassword))
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(mockUserWithValidPassword, nil)
+
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), mockUserWithValidPassword.ID).
+			Return(repository.UserMfa{
+				UserID:    mockUserWithValidPassword.ID,
+				EnabledAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
+			}, nil)
+
+		mockTokens.EXPECT().
+			Challenge(gomock.Any(), mockUserWithValidPassword).
+			Return(&dto.UserLoginResponse{MFARequired: true, MFAToken: "mfa"}, nil)
+
+		res, err := service.Login(ctx, loginReq, ip)
+
+		assert.NoError(t, err)
+		assert.True(t, res.MFARequired)
+		assert.Equal(t, "mfa", res.MFAToken)
+		assert.Empty(t, res.AccessToken)
+		assert.Empty(t, res.RefreshToken)
 	})
 
 	t.Run("error: transaction commit failure", func(t *testing.T) {
@@ -257,13 +670,17 @@ func TestAuthService_Login(t *testing.T) {
 			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
 			Return(mockUserWithValidPassword, nil)
 
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), mockUserWithValidPassword.ID).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
+
 		mockQuerier.EXPECT().
 			UpdateLastLogin(gomock.Any(), gomock.Any(), mockUserWithValidPassword.ID).
 			Return(pgtype.UUID{Bytes: mockID, Valid: true}, nil)
 
 		mockPgx.ExpectCommit().WillReturnError(mockError)
 
-		res, err := service.Login(ctx, loginReq)
+		res, err := service.Login(ctx, loginReq, ip)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
@@ -272,7 +689,7 @@ func TestAuthService_Login(t *testing.T) {
 
 	t.Run("success: login", func(t *testing.T) {
 		mockPgx, _ = pgxmock.NewPool()
-		service = New(mockPgx, mockQuerier, mockLogger)
+		service = New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
 
 		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
 
@@ -284,6 +701,10 @@ func TestAuthService_Login(t *testing.T) {
 			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
 			Return(mockUserWithValidPassword, nil)
 
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), mockUserWithValidPassword.ID).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
+
 		mockQuerier.EXPECT().
 			UpdateLastLogin(gomock.Any(), gomock.Any(), mockUserWithValidPassword.ID).
 			Return(pgtype.UUID{Bytes: mockID, Valid: true}, nil)
@@ -291,7 +712,11 @@ func TestAuthService_Login(t *testing.T) {
 		mockPgx.ExpectCommit()
 		mockPgx.ExpectRollback()
 
-		res, err := service.Login(ctx, loginReq)
+		mockTokens.EXPECT().
+			Issue(gomock.Any(), mockUserWithValidPassword).
+			Return(&dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil)
+
+		res, err := service.Login(ctx, loginReq, ip)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
@@ -299,3 +724,198 @@ func TestAuthService_Login(t *testing.T) {
 		assert.NotEmpty(t, res.RefreshToken)
 	})
 }
+
+func TestAuthService_Refresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
+
+	refreshReq := dto.RefreshTokenRequest{RefreshToken: "refresh-token"}
+
+	t.Run("error: rotate failure", func(t *testing.T) {
+		mockTokens.EXPECT().
+			Rotate(gomock.Any(), "refresh-token").
+			Return(nil, failure.Unauthorized("refresh token reuse detected"))
+
+		res, err := service.Refresh(ctx, refreshReq)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("success: refresh", func(t *testing.T) {
+		mockTokens.EXPECT().
+			Rotate(gomock.Any(), "refresh-token").
+			Return(&dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil)
+
+		res, err := service.Refresh(ctx, refreshReq)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "access", res.AccessToken)
+		assert.Equal(t, "refresh", res.RefreshToken)
+	})
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
+
+	claims := &jwt.Claims{ID: uuid.NewString(), FamilyID: uuid.NewString()}
+
+	t.Run("success: logout current device", func(t *testing.T) {
+		mockTokens.EXPECT().Revoke(gomock.Any(), claims).Return(nil)
+
+		err := service.Logout(ctx, claims)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("error: logout all failure", func(t *testing.T) {
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), claims.ID).Return(failure.InternalError(mockError))
+
+		err := service.LogoutAll(ctx, claims)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: logout all devices", func(t *testing.T) {
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), claims.ID).Return(nil)
+		mockTokens.EXPECT().Revoke(gomock.Any(), claims).Return(nil)
+
+		err := service.LogoutAll(ctx, claims)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: sessions of the user", func(t *testing.T) {
+		sessions := []*dto.SessionResponse{{ID: claims.FamilyID, Current: true}}
+		mockTokens.EXPECT().Sessions(gomock.Any(), claims.ID, claims.FamilyID).Return(sessions, nil)
+
+		res, err := service.ListSessions(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.Equal(t, sessions, res)
+	})
+
+	t.Run("success: logout other devices", func(t *testing.T) {
+		mockTokens.EXPECT().RevokeOtherSessions(gomock.Any(), claims.ID, claims.FamilyID).Return(nil)
+
+		err := service.RevokeOtherSessions(ctx, claims)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthService_PublicKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	cfg := &config.Config{}
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, cfg, mockLogger)
+
+	t.Run("success: keys from issuer", func(t *testing.T) {
+		keys := jwt.JWKS{Keys: []jwt.JWK{{KeyType: "OKP", KeyID: "test-key"}}}
+		mockIssuer.EXPECT().PublicKeys().Return(keys)
+
+		res := service.PublicKeys()
+
+		assert.Equal(t, keys, res)
+	})
+}
+
+func TestAuthService_UnlockUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	mockUser := repository.User{
+		ID:    pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email: "test@example.com",
+	}
+
+	t.Run("error: invalid user id", func(t *testing.T) {
+		err := service.UnlockUser(ctx, "not-a-uuid")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: user not found", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(repository.User{}, pgx.ErrNoRows)
+
+		err := service.UnlockUser(ctx, mockUser.ID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: failure unlocking", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		mockLockout.EXPECT().Unlock(gomock.Any(), mockUser.Email).Return(mockError)
+
+		err := service.UnlockUser(ctx, mockUser.ID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: unlocked", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		mockLockout.EXPECT().Unlock(gomock.Any(), mockUser.Email).Return(nil)
+
+		err := service.UnlockUser(ctx, mockUser.ID.String())
+
+		assert.NoError(t, err)
+	})
+}
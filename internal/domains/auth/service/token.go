@@ -0,0 +1,590 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/device"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/redis"
+)
+
+// TokenService issues access/refresh token pairs and tracks refresh token families, each of which is
+// a session of the user on a device. Revoked tokens are kept on a denylist until they would have
+// expired anyway.
+type TokenService interface {
+	Issue(ctx context.Context, user repository.User) (*dto.UserLoginResponse, error)
+	Challenge(ctx context.Context, user repository.User) (*dto.UserLoginResponse, error)
+	ConsumeChallenge(ctx context.Context, mfaToken string) (*jwt.Claims, error)
+	MagicLink(ctx context.Context, email string) (string, error)
+	ConsumeMagicLink(ctx context.Context, token string) (*jwt.Claims, error)
+	Rotate(ctx context.Context, refreshToken string) (*dto.UserLoginResponse, error)
+	Switch(ctx context.Context, claims *jwt.Claims, orgID string) (*dto.UserLoginResponse, error)
+	Revoke(ctx context.Context, claims *jwt.Claims) error
+	RevokeAll(ctx context.Context, userID string) error
+	IsRevoked(ctx context.Context, claims *jwt.Claims) (bool, error)
+	Sessions(ctx context.Context, userID, currentID string) ([]*dto.SessionResponse, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID, keepID string) error
+}
+
+const (
+	refreshFamilyKey    = "auth:refresh_family:%s"
+	refreshTokenUsedKey = "auth:refresh_used:%s"
+	denylistTokenKey    = "auth:denylist:token:%s"
+	denylistUserKey     = "auth:denylist:user:%s"
+	mfaChallengeUsedKey = "auth:mfa_challenge_used:%s"
+	magicLinkUsedKey    = "auth:magic_link_used:%s"
+	sessionRevokedKey   = "auth:session_revoked:%s"
+)
+
+// sessionCacheTTL is how long the state of a session is cached. Revoking a session updates the cache
+// at once, so this only bounds how stale it gets when the database is changed directly.
+const sessionCacheTTL = 5 * time.Minute
+
+type tokenService struct {
+	issuer   jwt.TokenIssuer
+	verifier jwt.TokenVerifier
+	db       postgres.PgxIface
+	repo     repository.Querier
+	cache    redis.IRedisCache
+	logger   logger.Interface
+	now      func() time.Time
+}
+
+func NewTokenService(
+	issuer jwt.TokenIssuer,
+	verifier jwt.TokenVerifier,
+	db postgres.PgxIface,
+	repo repository.Querier,
+	cache redis.IRedisCache,
+	l logger.Interface,
+) TokenService {
+	return &tokenService{
+		issuer:   issuer,
+		verifier: verifier,
+		db:       db,
+		repo:     repo,
+		cache:    cache,
+		logger:   l,
+		now:      time.Now,
+	}
+}
+
+// Issue starts a new family for a login and records it as a session with the device of the request.
+// The pair acts in the organization the user joined first.
+func (s *tokenService) Issue(ctx context.Context, user repository.User) (*dto.UserLoginResponse, error) {
+	// The user is signing in, so the request is not scoped to them yet.
+	orgCtx := postgres.WithScope(ctx, postgres.Scope{UserID: user.ID.String()})
+
+	orgID, err := s.repo.GetDefaultOrganizationID(orgCtx, s.db, user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("token - service - failed to get default organization: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	familyID := uuid.NewString()
+
+	err = s.cache.Save(ctx, fmt.Sprintf(refreshFamilyKey, familyID), user.ID.String(), ttlSeconds(s.issuer.RefreshTokenExpiry()))
+	if err != nil {
+		s.logger.Error("token - service - failed to save refresh token family: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	info := device.FromContext(ctx)
+
+	err = s.repo.CreateSession(ctx, s.db, repository.CreateSessionParams{
+		ID:         pgtype.UUID{Bytes: uuid.MustParse(familyID), Valid: true},
+		UserID:     user.ID,
+		DeviceName: info.Name,
+		UserAgent:  info.UserAgent,
+		IpAddress:  info.IP,
+	})
+	if err != nil {
+		s.logger.Error("token - service - failed to create session: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	subject := jwt.Subject{
+		UserID:   user.ID.String(),
+		Email:    user.Email,
+		FamilyID: familyID,
+	}
+
+	if orgID.Valid {
+		subject.OrgID = orgID.String()
+	}
+
+	return s.generatePair(subject)
+}
+
+// Challenge issues the short-lived token an account with MFA gets instead of a pair.
+func (s *tokenService) Challenge(_ context.Context, user repository.User) (*dto.UserLoginResponse, error) {
+	mfaToken, err := s.issuer.GenerateMFAToken(jwt.Subject{
+		UserID: user.ID.String(),
+		Email:  user.Email,
+	})
+	if err != nil {
+		s.logger.Error("token - service - failed to generate mfa token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.UserLoginResponse).ToMFAChallengeResponse(mfaToken), nil
+}
+
+// ConsumeChallenge accepts a challenge once; a wrong second factor means starting over from the
+// password step.
+func (s *tokenService) ConsumeChallenge(ctx context.Context, mfaToken string) (*jwt.Claims, error) {
+	claims, err := s.verifier.ValidateMFAToken(mfaToken)
+	if err != nil {
+		s.logger.Error("token - service - invalid mfa token")
+
+		return nil, failure.Unauthorized("invalid mfa token")
+	}
+
+	first, err := s.cache.SaveNX(ctx, fmt.Sprintf(mfaChallengeUsedKey, claims.RegisteredClaims.ID), claims.ID,
+		ttlSeconds(claims.ExpiresAt.Sub(s.now())))
+	if err != nil {
+		s.logger.Error("token - service - failed to consume mfa token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !first {
+		s.logger.Error("token - service - mfa token already used")
+
+		return nil, failure.Unauthorized("invalid mfa token")
+	}
+
+	return claims, nil
+}
+
+// MagicLink issues a signed sign-in token for an email address.
+func (s *tokenService) MagicLink(_ context.Context, email string) (string, error) {
+	token, err := s.issuer.GenerateMagicLinkToken(jwt.Subject{Email: email})
+	if err != nil {
+		s.logger.Error("token - service - failed to generate magic link token: %w", err)
+
+		return "", failure.InternalError(err)
+	}
+
+	return token, nil
+}
+
+// ConsumeMagicLink accepts a magic link token once.
+func (s *tokenService) ConsumeMagicLink(ctx context.Context, token string) (*jwt.Claims, error) {
+	claims, err := s.verifier.ValidateMagicLinkToken(token)
+	if err != nil || claims.Email == "" {
+		s.logger.Error("token - service - invalid magic link token")
+
+		return nil, failure.BadRequestFromString("invalid or expired magic link")
+	}
+
+	first, err := s.cache.SaveNX(ctx, fmt.Sprintf(magicLinkUsedKey, claims.RegisteredClaims.ID), claims.Email,
+		ttlSeconds(claims.ExpiresAt.Sub(s.now())))
+	if err != nil {
+		s.logger.Error("token - service - failed to consume magic link token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !first {
+		s.logger.Error("token - service - magic link token already used")
+
+		return nil, failure.BadRequestFromString("invalid or expired magic link")
+	}
+
+	return claims, nil
+}
+
+// Rotate consumes the refresh token and issues a new pair within the same family. Presenting an
+// already consumed refresh token again revokes the whole family.
+func (s *tokenService) Rotate(ctx context.Context, refreshToken string) (*dto.UserLoginResponse, error) {
+	claims, err := s.verifier.ValidateRefreshToken(refreshToken)
+	if err != nil || claims.FamilyID == "" {
+		s.logger.Error("token - service - invalid refresh token")
+
+		return nil, failure.Unauthorized("invalid refresh token")
+	}
+
+	revoked, err := s.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, failure.InternalError(err)
+	}
+
+	if revoked {
+		s.logger.Error("token - service - refresh token revoked")
+
+		return nil, failure.Unauthorized("refresh token revoked")
+	}
+
+	familyKey := fmt.Sprintf(refreshFamilyKey, claims.FamilyID)
+
+	active, err := s.cache.Exists(ctx, familyKey)
+	if err != nil {
+		s.logger.Error("token - service - failed to check refresh token family: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !active {
+		s.logger.Error("token - service - refresh token family revoked")
+
+		return nil, failure.Unauthorized("refresh token revoked")
+	}
+
+	first, err := s.cache.SaveNX(ctx, fmt.Sprintf(refreshTokenUsedKey, claims.RegisteredClaims.ID), claims.FamilyID,
+		ttlSeconds(claims.ExpiresAt.Sub(s.now())))
+	if err != nil {
+		s.logger.Error("token - service - failed to consume refresh token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !first {
+		s.logger.Warn("token - service - refresh token reuse detected, revoking family %s", claims.FamilyID)
+
+		if err = s.endSession(ctx, claims.ID, claims.FamilyID); err != nil {
+			return nil, failure.InternalError(err)
+		}
+
+		return nil, failure.Unauthorized("refresh token reuse detected")
+	}
+
+	err = s.cache.Save(ctx, familyKey, claims.ID, ttlSeconds(s.issuer.RefreshTokenExpiry()))
+	if err != nil {
+		s.logger.Error("token - service - failed to extend refresh token family: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	info := device.FromContext(ctx)
+
+	err = s.repo.TouchSession(ctx, s.db, repository.TouchSessionParams{
+		ID:        sessionID(claims.FamilyID),
+		UserAgent: info.UserAgent,
+		IpAddress: info.IP,
+	})
+	if err != nil {
+		s.logger.Error("token - service - failed to touch session: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return s.generatePair(jwt.Subject{
+		UserID:   claims.ID,
+		Email:    claims.Email,
+		FamilyID: claims.FamilyID,
+		OrgID:    claims.OrgID,
+	})
+}
+
+// Switch issues a pair acting in another organization within the session of the claims. Whether the
+// user is a member of it is up to the caller.
+func (s *tokenService) Switch(ctx context.Context, claims *jwt.Claims, orgID string) (*dto.UserLoginResponse, error) {
+	if claims.FamilyID == "" {
+		return nil, failure.BadRequestFromString("token has no session")
+	}
+
+	active, err := s.cache.Exists(ctx, fmt.Sprintf(refreshFamilyKey, claims.FamilyID))
+	if err != nil {
+		s.logger.Error("token - service - failed to check refresh token family: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if !active {
+		return nil, failure.Unauthorized("session revoked")
+	}
+
+	return s.generatePair(jwt.Subject{
+		UserID:   claims.ID,
+		Email:    claims.Email,
+		FamilyID: claims.FamilyID,
+		OrgID:    orgID,
+	})
+}
+
+// Revoke denylists the given token and ends its refresh token family, logging out a single device.
+func (s *tokenService) Revoke(ctx context.Context, claims *jwt.Claims) error {
+	err := s.cache.Save(ctx, fmt.Sprintf(denylistTokenKey, claims.RegisteredClaims.ID), claims.ID,
+		ttlSeconds(claims.ExpiresAt.Sub(s.now())))
+	if err != nil {
+		s.logger.Error("token - service - failed to denylist token: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if claims.FamilyID == "" {
+		return nil
+	}
+
+	if err = s.endSession(ctx, claims.ID, claims.FamilyID); err != nil {
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// RevokeAll denylists every token issued to the user up to now, logging out all devices. Tokens
+// carry their issue time in whole seconds, so those of the current second are denylisted as well.
+func (s *tokenService) RevokeAll(ctx context.Context, userID string) error {
+	err := s.cache.Save(ctx, fmt.Sprintf(denylistUserKey, userID), s.now().Unix(), ttlSeconds(s.issuer.RefreshTokenExpiry()))
+	if err != nil {
+		s.logger.Error("token - service - failed to denylist user tokens: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	// The denylist already rejects the tokens of the sessions, they only need to be shown as ended.
+	var id pgtype.UUID
+	if err = id.Scan(userID); err != nil {
+		return nil
+	}
+
+	if err = s.repo.RevokeAllSessions(ctx, s.db, id); err != nil {
+		s.logger.Error("token - service - failed to revoke sessions: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// IsRevoked reports whether the token is denylisted, predates a logout everywhere, or belongs to an
+// ended session, which is checked through a short-lived cache.
+func (s *tokenService) IsRevoked(ctx context.Context, claims *jwt.Claims) (bool, error) {
+	denied, err := s.cache.Exists(ctx, fmt.Sprintf(denylistTokenKey, claims.RegisteredClaims.ID))
+	if err != nil {
+		s.logger.Error("token - service - failed to check token denylist: %w", err)
+
+		return false, err
+	}
+
+	if denied {
+		return true, nil
+	}
+
+	var revokedBefore int64
+
+	err = s.cache.Get(ctx, fmt.Sprintf(denylistUserKey, claims.ID), &revokedBefore)
+	if err != nil && !errors.Is(err, redis.ErrCacheMiss) {
+		s.logger.Error("token - service - failed to check user denylist: %w", err)
+
+		return false, err
+	}
+
+	if err == nil && (claims.IssuedAt == nil || claims.IssuedAt.Unix() <= revokedBefore) {
+		return true, nil
+	}
+
+	if claims.FamilyID == "" {
+		return false, nil
+	}
+
+	return s.sessionRevoked(ctx, claims.FamilyID)
+}
+
+// Sessions lists the sessions of the user that have not ended, most recently used first. currentID
+// is the session of the caller.
+func (s *tokenService) Sessions(ctx context.Context, userID, currentID string) ([]*dto.SessionResponse, error) {
+	var id pgtype.UUID
+	if err := id.Scan(userID); err != nil {
+		return nil, failure.Unauthorized("invalid token subject")
+	}
+
+	// A family expires when it has not been refreshed for as long as a refresh token lives.
+	sessions, err := s.repo.ListActiveSessions(ctx, s.db, repository.ListActiveSessionsParams{
+		UserID:    id,
+		SeenAfter: pgtype.Timestamp{Time: s.now().Add(-s.issuer.RefreshTokenExpiry()), Valid: true},
+	})
+	if err != nil {
+		s.logger.Error("token - service - failed to list sessions: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := make([]*dto.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		res = append(res, new(dto.SessionResponse).ToSessionResponse(session, currentID))
+	}
+
+	return res, nil
+}
+
+// RevokeSession ends a session of the user, logging out the device it belongs to.
+func (s *tokenService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	var uid, sid pgtype.UUID
+	if err := uid.Scan(userID); err != nil {
+		return failure.Unauthorized("invalid token subject")
+	}
+
+	if err := sid.Scan(sessionID); err != nil {
+		return failure.BadRequestFromString("invalid session id")
+	}
+
+	rows, err := s.repo.RevokeSession(ctx, s.db, repository.RevokeSessionParams{ID: sid, UserID: uid})
+	if err != nil {
+		s.logger.Error("token - service - failed to revoke session: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if rows == 0 {
+		return failure.NotFound("session not found")
+	}
+
+	if err = s.forgetSession(ctx, sessionID); err != nil {
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions ends every session of the user but keepID, logging out all other devices.
+func (s *tokenService) RevokeOtherSessions(ctx context.Context, userID, keepID string) error {
+	var uid, keep pgtype.UUID
+	if err := uid.Scan(userID); err != nil {
+		return failure.Unauthorized("invalid token subject")
+	}
+
+	if err := keep.Scan(keepID); err != nil {
+		return failure.BadRequestFromString("token has no session")
+	}
+
+	ids, err := s.repo.RevokeOtherSessions(ctx, s.db, repository.RevokeOtherSessionsParams{UserID: uid, KeepID: keep})
+	if err != nil {
+		s.logger.Error("token - service - failed to revoke sessions: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	for _, id := range ids {
+		if err = s.forgetSession(ctx, id.String()); err != nil {
+			return failure.InternalError(err)
+		}
+	}
+
+	return nil
+}
+
+// endSession records a session of the user as revoked and ends its family.
+func (s *tokenService) endSession(ctx context.Context, userID, familyID string) error {
+	var uid pgtype.UUID
+	if err := uid.Scan(userID); err != nil {
+		return err
+	}
+
+	_, err := s.repo.RevokeSession(ctx, s.db, repository.RevokeSessionParams{ID: sessionID(familyID), UserID: uid})
+	if err != nil {
+		s.logger.Error("token - service - failed to revoke session: %w", err)
+
+		return err
+	}
+
+	return s.forgetSession(ctx, familyID)
+}
+
+// forgetSession ends the family of a revoked session and caches that it is revoked, so that its access
+// tokens are rejected right away.
+func (s *tokenService) forgetSession(ctx context.Context, familyID string) error {
+	if err := s.cache.Delete(ctx, fmt.Sprintf(refreshFamilyKey, familyID)); err != nil {
+		s.logger.Error("token - service - failed to revoke refresh token family: %w", err)
+
+		return err
+	}
+
+	err := s.cache.Save(ctx, fmt.Sprintf(sessionRevokedKey, familyID), true, ttlSeconds(s.issuer.RefreshTokenExpiry()))
+	if err != nil {
+		s.logger.Error("token - service - failed to cache revoked session: %w", err)
+
+		return err
+	}
+
+	return nil
+}
+
+// sessionRevoked reports whether the session was revoked, asking the database only when the cache
+// does not know.
+func (s *tokenService) sessionRevoked(ctx context.Context, familyID string) (bool, error) {
+	key := fmt.Sprintf(sessionRevokedKey, familyID)
+
+	var revoked bool
+
+	err := s.cache.Get(ctx, key, &revoked)
+	if err == nil {
+		return revoked, nil
+	}
+
+	if !errors.Is(err, redis.ErrCacheMiss) {
+		s.logger.Error("token - service - failed to check session cache: %w", err)
+
+		return false, err
+	}
+
+	session, err := s.repo.GetSession(ctx, s.db, sessionID(familyID))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("token - service - failed to get session: %w", err)
+
+		return false, err
+	}
+
+	// Tokens issued before sessions were recorded have none, and stay valid until they expire.
+	revoked = session.RevokedAt.Valid
+
+	if err = s.cache.Save(ctx, key, revoked, ttlSeconds(sessionCacheTTL)); err != nil {
+		s.logger.Error("token - service - failed to cache session: %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (s *tokenService) generatePair(subject jwt.Subject) (*dto.UserLoginResponse, error) {
+	accessToken, err := s.issuer.GenerateAccessToken(subject)
+	if err != nil {
+		s.logger.Error("token - service - failed to generate access token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	refreshToken, err := s.issuer.GenerateRefreshToken(subject)
+	if err != nil {
+		s.logger.Error("token - service - failed to generate refresh token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.UserLoginResponse).ToLoginResponse(accessToken, refreshToken), nil
+}
+
+// sessionID returns the ID of the session of a refresh token family. Family IDs are UUIDs; anything
+// else matches no session.
+func sessionID(familyID string) pgtype.UUID {
+	var id pgtype.UUID
+	_ = id.Scan(familyID)
+
+	return id
+}
+
+// ttlSeconds converts a duration to the whole-second TTL expected by the cache, never less than one second.
+func ttlSeconds(d time.Duration) int {
+	if d < time.Second {
+		return 1
+	}
+
+	return int(d / time.Second)
+}
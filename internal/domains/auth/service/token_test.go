@@ -0,0 +1,908 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/device"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	redisPkg "github.com/savioruz/goth/pkg/redis"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestTokenService_Issue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	tokens := newTestJWT(time.Now)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger)
+
+	mockID := uuid.New()
+	mockUser := repository.User{
+		ID:    pgtype.UUID{Bytes: mockID, Valid: true},
+		Email: "test@example.com",
+	}
+
+	t.Run("error: failure getting default organization", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockQuerier.EXPECT().GetDefaultOrganizationID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(pgtype.UUID{}, mockError)
+
+		res, err := service.Issue(ctx, mockUser)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: failure saving family", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockQuerier.EXPECT().GetDefaultOrganizationID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(pgtype.UUID{}, pgx.ErrNoRows)
+		mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), mockID.String(), gomock.Any()).Return(mockError)
+
+		res, err := service.Issue(ctx, mockUser)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: failure creating session", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockQuerier.EXPECT().GetDefaultOrganizationID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(pgtype.UUID{}, pgx.ErrNoRows)
+		mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), mockID.String(), gomock.Any()).Return(nil)
+		mockQuerier.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(mockError)
+
+		res, err := service.Issue(ctx, mockUser)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: tokens share a new family", func(t *testing.T) {
+		var session repository.CreateSessionParams
+
+		ctx := device.NewContext(ctx, device.New("", "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0", "203.0.113.7"))
+
+		mockQuerier.EXPECT().GetDefaultOrganizationID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(pgtype.UUID{}, pgx.ErrNoRows)
+		mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), mockID.String(), gomock.Any()).Return(nil)
+		mockQuerier.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateSessionParams) error {
+				session = arg
+
+				return nil
+			})
+
+		res, err := service.Issue(ctx, mockUser)
+
+		assert.NoError(t, err)
+
+		access, err := tokens.ValidateAccessToken(res.AccessToken)
+		assert.NoError(t, err)
+
+		refresh, err := tokens.ValidateRefreshToken(res.RefreshToken)
+		assert.NoError(t, err)
+
+		assert.Equal(t, jwt.AccessTokenType, access.TokenType)
+		assert.Equal(t, jwt.RefreshTokenType, refresh.TokenType)
+		assert.NotEmpty(t, refresh.FamilyID)
+		assert.Equal(t, refresh.FamilyID, access.FamilyID)
+		assert.NotEqual(t, access.RegisteredClaims.ID, refresh.RegisteredClaims.ID)
+
+		assert.Equal(t, refresh.FamilyID, session.ID.String())
+		assert.Equal(t, mockUser.ID, session.UserID)
+		assert.Equal(t, "Firefox on Linux", session.DeviceName)
+		assert.Equal(t, "203.0.113.7", session.IpAddress)
+
+		assert.Empty(t, access.OrgID)
+
+		_, err = tokens.ValidateAccessToken(res.RefreshToken)
+		assert.ErrorIs(t, err, jwt.ErrWrongTokenType)
+
+		_, err = tokens.ValidateRefreshToken(res.AccessToken)
+		assert.ErrorIs(t, err, jwt.ErrWrongTokenType)
+	})
+
+	t.Run("success: tokens act in the default organization", func(t *testing.T) {
+		orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+		mockQuerier.EXPECT().GetDefaultOrganizationID(gomock.Any(), gomock.Any(), mockUser.ID).Return(orgID, nil)
+		mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), mockID.String(), gomock.Any()).Return(nil)
+		mockQuerier.EXPECT().CreateSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+		res, err := service.Issue(ctx, mockUser)
+
+		assert.NoError(t, err)
+
+		access, err := tokens.ValidateAccessToken(res.AccessToken)
+		assert.NoError(t, err)
+
+		refresh, err := tokens.ValidateRefreshToken(res.RefreshToken)
+		assert.NoError(t, err)
+
+		assert.Equal(t, orgID.String(), access.OrgID)
+		assert.Equal(t, orgID.String(), refresh.OrgID)
+	})
+}
+
+func TestTokenService_Challenge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	tokens := newTestJWT(time.Now)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger)
+
+	mockID := uuid.New()
+	mockUser := repository.User{
+		ID:    pgtype.UUID{Bytes: mockID, Valid: true},
+		Email: "test@example.com",
+	}
+
+	t.Run("success: challenge is not usable as an access token", func(t *testing.T) {
+		res, err := service.Challenge(ctx, mockUser)
+
+		assert.NoError(t, err)
+		assert.True(t, res.MFARequired)
+		assert.Empty(t, res.AccessToken)
+		assert.Empty(t, res.RefreshToken)
+
+		_, err = tokens.ValidateAccessToken(res.MFAToken)
+		assert.ErrorIs(t, err, jwt.ErrWrongTokenType)
+	})
+
+	t.Run("error: access token presented", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		access, _ := tokens.GenerateAccessToken(jwt.Subject{UserID: mockID.String()})
+
+		claims, err := service.ConsumeChallenge(ctx, access)
+
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: failure consuming challenge", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		res, _ := service.Challenge(ctx, mockUser)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), gomock.Any(), mockID.String(), gomock.Any()).Return(false, mockError)
+
+		claims, err := service.ConsumeChallenge(ctx, res.MFAToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: challenge already used", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		res, _ := service.Challenge(ctx, mockUser)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), gomock.Any(), mockID.String(), gomock.Any()).Return(false, nil)
+
+		claims, err := service.ConsumeChallenge(ctx, res.MFAToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("success: challenge consumed", func(t *testing.T) {
+		res, _ := service.Challenge(ctx, mockUser)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), gomock.Any(), mockID.String(), gomock.Any()).Return(true, nil)
+
+		claims, err := service.ConsumeChallenge(ctx, res.MFAToken)
+
+		assert.NoError(t, err)
+		assert.Equal(t, mockID.String(), claims.ID)
+		assert.Equal(t, jwt.MFATokenType, claims.TokenType)
+	})
+}
+
+func TestTokenService_MagicLink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	tokens := newTestJWT(time.Now)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger)
+
+	email := "test@example.com"
+
+	t.Run("success: magic link is not usable as an access token", func(t *testing.T) {
+		token, err := service.MagicLink(ctx, email)
+
+		assert.NoError(t, err)
+
+		_, err = tokens.ValidateAccessToken(token)
+		assert.ErrorIs(t, err, jwt.ErrWrongTokenType)
+	})
+
+	t.Run("error: mfa token presented", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mfaToken, _ := tokens.GenerateMFAToken(jwt.Subject{UserID: uuid.NewString(), Email: email})
+
+		claims, err := service.ConsumeMagicLink(ctx, mfaToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: failure consuming magic link", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		token, _ := service.MagicLink(ctx, email)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), gomock.Any(), email, gomock.Any()).Return(false, mockError)
+
+		claims, err := service.ConsumeMagicLink(ctx, token)
+
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: magic link already used", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		token, _ := service.MagicLink(ctx, email)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), gomock.Any(), email, gomock.Any()).Return(false, nil)
+
+		claims, err := service.ConsumeMagicLink(ctx, token)
+
+		assert.Error(t, err)
+		assert.Nil(t, claims)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success: magic link consumed", func(t *testing.T) {
+		token, _ := service.MagicLink(ctx, email)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), gomock.Any(), email, gomock.Any()).Return(true, nil)
+
+		claims, err := service.ConsumeMagicLink(ctx, token)
+
+		assert.NoError(t, err)
+		assert.Empty(t, claims.ID)
+		assert.Equal(t, email, claims.Email)
+		assert.Equal(t, jwt.MagicLinkTokenType, claims.TokenType)
+	})
+}
+
+func TestTokenService_Rotate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	tokens := newTestJWT(time.Now)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger)
+
+	userID := uuid.NewString()
+	userUUID := pgtype.UUID{Bytes: uuid.MustParse(userID), Valid: true}
+	familyID := uuid.NewString()
+	familyKey := "auth:refresh_family:" + familyID
+	orgID := uuid.NewString()
+
+	refreshToken, _ := tokens.GenerateRefreshToken(jwt.Subject{UserID: userID, Email: "test@example.com", FamilyID: familyID, OrgID: orgID})
+	accessToken, _ := tokens.GenerateAccessToken(jwt.Subject{UserID: userID, Email: "test@example.com", FamilyID: familyID})
+	refreshClaims, _ := tokens.ValidateRefreshToken(refreshToken)
+	usedKey := "auth:refresh_used:" + refreshClaims.RegisteredClaims.ID
+	denylistTokenKey := "auth:denylist:token:" + refreshClaims.RegisteredClaims.ID
+	denylistUserKey := "auth:denylist:user:" + userID
+	sessionKey := "auth:session_revoked:" + familyID
+	session := pgtype.UUID{Bytes: uuid.MustParse(familyID), Valid: true}
+
+	expectNotRevoked := func() {
+		mockRedis.EXPECT().Exists(gomock.Any(), denylistTokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), denylistUserKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).SetArg(2, false).Return(nil)
+	}
+
+	t.Run("error: malformed token", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		res, err := service.Rotate(ctx, "not-a-token")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: access token presented", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		res, err := service.Rotate(ctx, accessToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: user logged out everywhere", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockRedis.EXPECT().Exists(gomock.Any(), denylistTokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), denylistUserKey, gomock.Any()).
+			SetArg(2, time.Now().Add(time.Minute).Unix()).Return(nil)
+
+		res, err := service.Rotate(ctx, refreshToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: session revoked", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		mockRedis.EXPECT().Exists(gomock.Any(), denylistTokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), denylistUserKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).SetArg(2, true).Return(nil)
+
+		res, err := service.Rotate(ctx, refreshToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: family revoked", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+		expectNotRevoked()
+		mockRedis.EXPECT().Exists(gomock.Any(), familyKey).Return(false, nil)
+
+		res, err := service.Rotate(ctx, refreshToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: failure checking family", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		expectNotRevoked()
+		mockRedis.EXPECT().Exists(gomock.Any(), familyKey).Return(false, mockError)
+
+		res, err := service.Rotate(ctx, refreshToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("error: reuse revokes family", func(t *testing.T) {
+		mockLogger.EXPECT().Warn(gomock.Any(), gomock.Any())
+		expectNotRevoked()
+		mockRedis.EXPECT().Exists(gomock.Any(), familyKey).Return(true, nil)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), usedKey, familyID, gomock.Any()).Return(false, nil)
+		mockQuerier.EXPECT().
+			RevokeSession(gomock.Any(), gomock.Any(), repository.RevokeSessionParams{ID: session, UserID: userUUID}).
+			Return(int64(1), nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), familyKey).Return(nil)
+		mockRedis.EXPECT().Save(gomock.Any(), sessionKey, true, gomock.Any()).Return(nil)
+
+		res, err := service.Rotate(ctx, refreshToken)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("success: rotated within family", func(t *testing.T) {
+		expectNotRevoked()
+		mockRedis.EXPECT().Exists(gomock.Any(), familyKey).Return(true, nil)
+		mockRedis.EXPECT().SaveNX(gomock.Any(), usedKey, familyID, gomock.Any()).Return(true, nil)
+		mockRedis.EXPECT().Save(gomock.Any(), familyKey, userID, gomock.Any()).Return(nil)
+		mockQuerier.EXPECT().
+			TouchSession(gomock.Any(), gomock.Any(), repository.TouchSessionParams{ID: session, UserAgent: "curl/8.5.0", IpAddress: "198.51.100.2"}).
+			Return(nil)
+
+		ctx := device.NewContext(ctx, device.New("", "curl/8.5.0", "198.51.100.2"))
+
+		res, err := service.Rotate(ctx, refreshToken)
+
+		assert.NoError(t, err)
+		assert.NotEqual(t, refreshToken, res.RefreshToken)
+
+		claims, err := tokens.ValidateRefreshToken(res.RefreshToken)
+		assert.NoError(t, err)
+		assert.Equal(t, familyID, claims.FamilyID)
+		assert.Equal(t, userID, claims.ID)
+		assert.Equal(t, orgID, claims.OrgID)
+	})
+}
+
+func TestTokenService_Switch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	tokens := newTestJWT(time.Now)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger)
+
+	userID := uuid.NewString()
+	familyID := uuid.NewString()
+	familyKey := "auth:refresh_family:" + familyID
+	orgID := uuid.NewString()
+	claims := &jwt.Claims{ID: userID, Email: "test@example.com", FamilyID: familyID}
+
+	t.Run("error: token has no session", func(t *testing.T) {
+		res, err := service.Switch(ctx, &jwt.Claims{ID: userID}, orgID)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: session revoked", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), familyKey).Return(false, nil)
+
+		res, err := service.Switch(ctx, claims, orgID)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("success: pair acts in the organization", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), familyKey).Return(true, nil)
+
+		res, err := service.Switch(ctx, claims, orgID)
+
+		assert.NoError(t, err)
+
+		access, err := tokens.ValidateAccessToken(res.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, orgID, access.OrgID)
+		assert.Equal(t, familyID, access.FamilyID)
+
+		refresh, err := tokens.ValidateRefreshToken(res.RefreshToken)
+		assert.NoError(t, err)
+		assert.Equal(t, orgID, refresh.OrgID)
+	})
+}
+
+func TestTokenService_Revoke(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	tokens := newTestJWT(time.Now)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger)
+
+	userID := uuid.NewString()
+	userUUID := pgtype.UUID{Bytes: uuid.MustParse(userID), Valid: true}
+	familyID := uuid.NewString()
+	session := pgtype.UUID{Bytes: uuid.MustParse(familyID), Valid: true}
+	accessToken, _ := tokens.GenerateAccessToken(jwt.Subject{UserID: userID, Email: "test@example.com", FamilyID: familyID})
+	claims, _ := tokens.ValidateAccessToken(accessToken)
+
+	t.Run("error: failure saving denylist entry", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockRedis.EXPECT().
+			Save(gomock.Any(), "auth:denylist:token:"+claims.RegisteredClaims.ID, userID, gomock.Any()).
+			Return(mockError)
+
+		err := service.Revoke(ctx, claims)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: token denylisted and family ended", func(t *testing.T) {
+		mockRedis.EXPECT().
+			Save(gomock.Any(), "auth:denylist:token:"+claims.RegisteredClaims.ID, userID, gomock.Any()).
+			Return(nil)
+		mockQuerier.EXPECT().
+			RevokeSession(gomock.Any(), gomock.Any(), repository.RevokeSessionParams{ID: session, UserID: userUUID}).
+			Return(int64(1), nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "auth:refresh_family:"+familyID).Return(nil)
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:session_revoked:"+familyID, true, gomock.Any()).Return(nil)
+
+		err := service.Revoke(ctx, claims)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("error: failure revoking sessions", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:denylist:user:"+userID, gomock.Any(), gomock.Any()).Return(nil)
+		mockQuerier.EXPECT().RevokeAllSessions(gomock.Any(), gomock.Any(), userUUID).Return(mockError)
+
+		err := service.RevokeAll(ctx, userID)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: all user tokens denylisted", func(t *testing.T) {
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:denylist:user:"+userID, gomock.Any(), gomock.Any()).Return(nil)
+		mockQuerier.EXPECT().RevokeAllSessions(gomock.Any(), gomock.Any(), userUUID).Return(nil)
+
+		err := service.RevokeAll(ctx, userID)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestTokenService_IsRevoked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	tokens := newTestJWT(time.Now)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger)
+
+	userID := uuid.NewString()
+	familyID := uuid.NewString()
+	session := pgtype.UUID{Bytes: uuid.MustParse(familyID), Valid: true}
+	accessToken, _ := tokens.GenerateAccessToken(jwt.Subject{UserID: userID, Email: "test@example.com", FamilyID: familyID})
+	claims, _ := tokens.ValidateAccessToken(accessToken)
+	tokenKey := "auth:denylist:token:" + claims.RegisteredClaims.ID
+	userKey := "auth:denylist:user:" + userID
+	sessionKey := "auth:session_revoked:" + familyID
+
+	t.Run("error: failure checking denylist", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, mockError)
+
+		_, err := service.IsRevoked(ctx, claims)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("success: token denylisted", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(true, nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("success: issued before logout all", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), userKey, gomock.Any()).
+			SetArg(2, claims.IssuedAt.Unix()+1).Return(nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("success: issued after logout all", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), userKey, gomock.Any()).
+			SetArg(2, claims.IssuedAt.Unix()-1).Return(nil)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).SetArg(2, false).Return(nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("success: session revoked", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), userKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).SetArg(2, true).Return(nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("error: failure getting session", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), userKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockQuerier.EXPECT().GetSession(gomock.Any(), gomock.Any(), session).Return(repository.UserSession{}, mockError)
+
+		_, err := service.IsRevoked(ctx, claims)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("success: revoked session cached", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), userKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockQuerier.EXPECT().GetSession(gomock.Any(), gomock.Any(), session).
+			Return(repository.UserSession{ID: session, RevokedAt: pgtype.Timestamp{Time: time.Now(), Valid: true}}, nil)
+		mockRedis.EXPECT().Save(gomock.Any(), sessionKey, true, 5*60).Return(nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("success: token predates sessions", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), userKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockQuerier.EXPECT().GetSession(gomock.Any(), gomock.Any(), session).Return(repository.UserSession{}, pgx.ErrNoRows)
+		mockRedis.EXPECT().Save(gomock.Any(), sessionKey, false, 5*60).Return(nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("success: not revoked", func(t *testing.T) {
+		mockRedis.EXPECT().Exists(gomock.Any(), tokenKey).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), userKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockRedis.EXPECT().Get(gomock.Any(), sessionKey, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockQuerier.EXPECT().GetSession(gomock.Any(), gomock.Any(), session).Return(repository.UserSession{ID: session}, nil)
+		mockRedis.EXPECT().Save(gomock.Any(), sessionKey, false, 5*60).Return(nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	})
+}
+
+func TestTokenService_Clock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+
+	issuedAt := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	now := issuedAt
+
+	tokens := newTestJWT(func() time.Time { return now })
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger).(*tokenService)
+	service.now = func() time.Time { return now }
+
+	userID := uuid.NewString()
+	subject := jwt.Subject{UserID: userID, Email: "test@example.com", FamilyID: uuid.NewString()}
+	accessToken, _ := tokens.GenerateAccessToken(subject)
+
+	t.Run("success: valid until expiry", func(t *testing.T) {
+		now = issuedAt.Add(time.Hour - time.Second)
+
+		claims, err := tokens.ValidateAccessToken(accessToken)
+
+		assert.NoError(t, err)
+		assert.Equal(t, issuedAt.Unix(), claims.IssuedAt.Unix())
+	})
+
+	t.Run("error: expired", func(t *testing.T) {
+		now = issuedAt.Add(time.Hour + time.Second)
+
+		_, err := tokens.ValidateAccessToken(accessToken)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+	})
+
+	t.Run("error: not yet valid", func(t *testing.T) {
+		now = issuedAt.Add(-time.Minute)
+
+		_, err := tokens.ValidateAccessToken(accessToken)
+
+		assert.ErrorIs(t, err, jwt.ErrTokenNotYetValid)
+	})
+
+	t.Run("success: denylist entry lives until expiry", func(t *testing.T) {
+		now = issuedAt
+		claims, _ := tokens.ValidateAccessToken(accessToken)
+
+		now = issuedAt.Add(15 * time.Minute)
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:denylist:token:"+claims.RegisteredClaims.ID, userID, 45*60).Return(nil)
+		mockQuerier.EXPECT().RevokeSession(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(1), nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "auth:refresh_family:"+subject.FamilyID).Return(nil)
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:session_revoked:"+subject.FamilyID, true, 24*60*60).Return(nil)
+
+		err := service.Revoke(ctx, claims)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: logout all cutoff is the current time", func(t *testing.T) {
+		now = issuedAt.Add(time.Minute)
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:denylist:user:"+userID, now.Unix(), 24*60*60).Return(nil)
+		mockQuerier.EXPECT().RevokeAllSessions(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+		err := service.RevokeAll(ctx, userID)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: token of the second of logout all is revoked", func(t *testing.T) {
+		now = issuedAt
+		claims, _ := tokens.ValidateAccessToken(accessToken)
+
+		var cutoff int64
+
+		now = issuedAt.Add(900 * time.Millisecond)
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:denylist:user:"+userID, gomock.Any(), 24*60*60).
+			DoAndReturn(func(_ context.Context, _ string, value any, _ int) error {
+				cutoff = value.(int64)
+
+				return nil
+			})
+		mockQuerier.EXPECT().RevokeAllSessions(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+		assert.NoError(t, service.RevokeAll(ctx, userID))
+
+		mockRedis.EXPECT().Exists(gomock.Any(), "auth:denylist:token:"+claims.RegisteredClaims.ID).Return(false, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), "auth:denylist:user:"+userID, gomock.Any()).SetArg(2, cutoff).Return(nil)
+
+		revoked, err := service.IsRevoked(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+}
+
+func TestTokenService_Sessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	now := time.Now()
+	tokens := newTestJWT(time.Now)
+	service := NewTokenService(tokens, tokens, mockPgx, mockQuerier, mockRedis, mockLogger).(*tokenService)
+	service.now = func() time.Time { return now }
+
+	userID := uuid.NewString()
+	userUUID := pgtype.UUID{Bytes: uuid.MustParse(userID), Valid: true}
+	current := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	other := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	t.Run("error: failure listing sessions", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockQuerier.EXPECT().ListActiveSessions(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, mockError)
+
+		res, err := service.Sessions(ctx, userID, current.String())
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: current session marked", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			ListActiveSessions(gomock.Any(), gomock.Any(), repository.ListActiveSessionsParams{
+				UserID:    userUUID,
+				SeenAfter: pgtype.Timestamp{Time: now.Add(-24 * time.Hour), Valid: true},
+			}).
+			Return([]repository.UserSession{
+				{ID: current, UserID: userUUID, DeviceName: "Firefox on Linux"},
+				{ID: other, UserID: userUUID, DeviceName: "Safari on iPhone"},
+			}, nil)
+
+		res, err := service.Sessions(ctx, userID, current.String())
+
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+		assert.True(t, res[0].Current)
+		assert.Equal(t, "Firefox on Linux", res[0].DeviceName)
+		assert.False(t, res[1].Current)
+		assert.Equal(t, other.String(), res[1].ID)
+	})
+
+	t.Run("error: invalid session id", func(t *testing.T) {
+		err := service.RevokeSession(ctx, userID, "invalid")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: session of another user", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			RevokeSession(gomock.Any(), gomock.Any(), repository.RevokeSessionParams{ID: other, UserID: userUUID}).
+			Return(int64(0), nil)
+
+		err := service.RevokeSession(ctx, userID, other.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: session revoked", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			RevokeSession(gomock.Any(), gomock.Any(), repository.RevokeSessionParams{ID: other, UserID: userUUID}).
+			Return(int64(1), nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "auth:refresh_family:"+other.String()).Return(nil)
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:session_revoked:"+other.String(), true, 24*60*60).Return(nil)
+
+		err := service.RevokeSession(ctx, userID, other.String())
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("error: token has no session", func(t *testing.T) {
+		err := service.RevokeOtherSessions(ctx, userID, "")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success: other sessions revoked", func(t *testing.T) {
+		mockQuerier.EXPECT().
+			RevokeOtherSessions(gomock.Any(), gomock.Any(), repository.RevokeOtherSessionsParams{UserID: userUUID, KeepID: current}).
+			Return([]pgtype.UUID{other}, nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "auth:refresh_family:"+other.String()).Return(nil)
+		mockRedis.EXPECT().Save(gomock.Any(), "auth:session_revoked:"+other.String(), true, 24*60*60).Return(nil)
+
+		err := service.RevokeOtherSessions(ctx, userID, current.String())
+
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/secret"
+)
+
+// SendVerification sends a new verification email to the signed in user.
+func (s *authService) SendVerification(ctx context.Context, claims *jwt.Claims) error {
+	return s.sendVerification(ctx, claims.Email, false)
+}
+
+// ResendVerification sends a new verification email to the given address; unknown addresses succeed silently.
+func (s *authService) ResendVerification(ctx context.Context, req dto.ResendVerificationRequest) error {
+	return s.sendVerification(ctx, req.Email, true)
+}
+
+func (s *authService) sendVerification(ctx context.Context, email string, silent bool) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("verification - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("verification - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.repo.GetUserByEmail(ctx, tx, email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("verification - service - failed to get user by email: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if user.Email == "" {
+		s.logger.Error("verification - service - user not found")
+
+		if silent {
+			return nil
+		}
+
+		return failure.NotFound("user not found")
+	}
+
+	if user.IsVerified.Bool {
+		s.logger.Error("verification - service - email already verified")
+
+		if silent {
+			return nil
+		}
+
+		return failure.BadRequestFromString("email already verified")
+	}
+
+	if err = s.repo.InvalidateEmailVerifications(ctx, tx, user.ID); err != nil {
+		s.logger.Error("verification - service - failed to invalidate email verifications: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	token, err := s.createVerification(ctx, tx, user)
+	if err != nil {
+		s.logger.Error("verification - service - failed to create email verification: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("verification - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.notifier.SendEmailVerification(ctx, user, token); err != nil {
+		s.logger.Error("verification - service - failed to send email verification: %w", err)
+
+		if silent {
+			return nil
+		}
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// ConfirmEmail consumes a verification token and marks the email address of its user as verified.
+func (s *authService) ConfirmEmail(ctx context.Context, req dto.ConfirmEmailRequest) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("confirm email - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("confirm email - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	verification, err := s.repo.GetEmailVerificationByToken(ctx, tx, secret.Hash(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("confirm email - service - verification token not found")
+
+		return failure.BadRequestFromString("invalid or expired verification token")
+	}
+
+	if err != nil {
+		s.logger.Error("confirm email - service - failed to get email verification: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	_, err = s.repo.ConsumeEmailVerification(ctx, tx, verification.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("confirm email - service - verification token already used")
+
+		return failure.BadRequestFromString("invalid or expired verification token")
+	}
+
+	if err != nil {
+		s.logger.Error("confirm email - service - failed to consume email verification: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	_, err = s.repo.VerifyEmail(ctx, tx, verification.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("confirm email - service - user not found")
+
+		return failure.BadRequestFromString("invalid or expired verification token")
+	}
+
+	if err != nil {
+		s.logger.Error("confirm email - service - failed to verify email: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("confirm email - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// createVerification stores a new hashed verification token for the user and returns the plain token.
+func (s *authService) createVerification(ctx context.Context, db repository.DBTX, user repository.User) (string, error) {
+	token, hash, err := secret.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.repo.CreateEmailVerification(ctx, db, repository.CreateEmailVerificationParams{
+		UserID: user.ID,
+		Token:  hash,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	jwtMock "github.com/savioruz/goth/pkg/jwt/mock"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/password"
+	"github.com/savioruz/goth/pkg/secret"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService_SendVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	claims := &jwt.Claims{ID: uuid.NewString(), Email: "test@example.com"}
+	mockUser := repository.User{
+		ID:         pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email:      "test@example.com",
+		IsVerified: pgtype.Bool{Bool: false, Valid: true},
+	}
+
+	t.Run("error: user not found", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+
+		err := service.SendVerification(ctx, claims)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: already verified", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		verified := mockUser
+		verified.IsVerified = pgtype.Bool{Bool: true, Valid: true}
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(verified, nil)
+
+		err := service.SendVerification(ctx, claims)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: failure sending email", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().InvalidateEmailVerifications(gomock.Any(), gomock.Any(), mockUser.ID).Return(nil)
+		mockQuerier.EXPECT().
+			CreateEmailVerification(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.EmailVerification{}, nil)
+		mockNotifier.EXPECT().SendEmailVerification(gomock.Any(), mockUser, gomock.Any()).Return(mockError)
+
+		err := service.SendVerification(ctx, claims)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: earlier tokens invalidated and new one sent", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().InvalidateEmailVerifications(gomock.Any(), gomock.Any(), mockUser.ID).Return(nil)
+		mockQuerier.EXPECT().
+			CreateEmailVerification(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.EmailVerification{}, nil)
+		mockNotifier.EXPECT().SendEmailVerification(gomock.Any(), mockUser, gomock.Any()).Return(nil)
+
+		err := service.SendVerification(ctx, claims)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthService_ResendVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	req := dto.ResendVerificationRequest{Email: "test@example.com"}
+
+	t.Run("error: failure getting user by email", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, mockError)
+
+		err := service.ResendVerification(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: unknown email is not revealed", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+
+		err := service.ResendVerification(ctx, req)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: verified email is not revealed", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+			Return(repository.User{Email: "test@example.com", IsVerified: pgtype.Bool{Bool: true, Valid: true}}, nil)
+
+		err := service.ResendVerification(ctx, req)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestAuthService_ConfirmEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockIssuer := jwtMock.NewMockTokenIssuer(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLockout := authMock.NewMockLockoutService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockTokens, mockIssuer, mockNotifier, mockLockout, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	req := dto.ConfirmEmailRequest{Token: "plain-token"}
+	verification := repository.EmailVerification{
+		ID:     pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		UserID: pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Token:  secret.Hash("plain-token"),
+	}
+
+	t.Run("error: unknown or expired token", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetEmailVerificationByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(repository.EmailVerification{}, pgx.ErrNoRows)
+
+		err := service.ConfirmEmail(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: token consumed concurrently", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetEmailVerificationByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(verification, nil)
+		mockQuerier.EXPECT().
+			ConsumeEmailVerification(gomock.Any(), gomock.Any(), verification.ID).
+			Return(repository.EmailVerification{}, pgx.ErrNoRows)
+
+		err := service.ConfirmEmail(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: failure verifying email", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetEmailVerificationByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(verification, nil)
+		mockQuerier.EXPECT().
+			ConsumeEmailVerification(gomock.Any(), gomock.Any(), verification.ID).
+			Return(verification, nil)
+		mockQuerier.EXPECT().
+			VerifyEmail(gomock.Any(), gomock.Any(), verification.UserID).
+			Return(repository.User{}, mockError)
+
+		err := service.ConfirmEmail(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: email verified", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetEmailVerificationByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(verification, nil)
+		mockQuerier.EXPECT().
+			ConsumeEmailVerification(gomock.Any(), gomock.Any(), verification.ID).
+			Return(verification, nil)
+		mockQuerier.EXPECT().
+			VerifyEmail(gomock.Any(), gomock.Any(), verification.UserID).
+			Return(repository.User{ID: verification.UserID, IsVerified: pgtype.Bool{Bool: true, Valid: true}}, nil)
+
+		err := service.ConfirmEmail(ctx, req)
+
+		assert.NoError(t, err)
+	})
+}
@@ -2,55 +2,92 @@ package handler
 
 import (
 	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/config"
 	"github.com/savioruz/goth/internal/delivery/http/response"
 	"github.com/savioruz/goth/internal/domains/oauth/service"
-
-	// Register dto for swagger docs
-	_ "github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/logger"
+	"github.com/valyala/fasthttp"
 )
 
-var (
-	ErrGoogleLoginCode = errors.New("oauth: google login code required")
-)
+// stateCookie binds a login attempt to the browser that started it.
+const stateCookie = "oauth_state"
+
+var ErrClaimsNil = errors.New("claims is nil")
 
 type Handler struct {
 	service   service.OAuthService
+	config    *config.Config
 	logger    logger.Interface
 	validator *validator.Validate
 }
 
-func New(s service.OAuthService, l logger.Interface, v *validator.Validate) *Handler {
+func New(s service.OAuthService, cfg *config.Config, l logger.Interface, v *validator.Validate) *Handler {
 	return &Handler{
 		service:   s,
+		config:    cfg,
 		logger:    l,
 		validator: v,
 	}
 }
 
-func (h *Handler) RegisterRoutes(r fiber.Router) {
+func (h *Handler) RegisterRoutes(r fiber.Router, requireAuth fiber.Handler) {
 	auth := r.Group("/oauth")
 
-	auth.Get("/google/login", h.GoogleLogin)
-	auth.Get("/google/callback", h.GoogleCallback)
+	auth.Get("/:provider/login", h.Login)
+	auth.Get("/:provider/callback", h.Callback)
+	auth.Post("/:provider/link", requireAuth, h.Link)
+
+	r.Get("/users/me/identities", requireAuth, h.ListIdentities)
+	r.Delete("/users/me/identities/:provider", requireAuth, h.UnlinkIdentity)
 }
 
-// GoogleLogin godoc
-// @Summary Login with Google
-// @Description Redirects to Google OAuth consent screen
+// Login godoc
+// @Summary Login with an OAuth provider
+// @Description Redirects to the consent screen of the provider, e.g. google or github as configured. The login is bound to the browser through the oauth_state cookie. With a whitelisted redirect_uri, the callback returns the tokens to that page in the URL fragment instead of answering with JSON.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Success 302 {string} string "Redirect to Google"
+// @Param provider path string true "Name of the provider"
+// @Param redirect_uri query string false "Whitelisted page to return the tokens to"
+// @Success 302 {string} string "Redirect to the provider"
+// @Failure 400 {object} response.Error
+// @Failure 404 {object} response.Error
 // @Failure 500 {object} response.Error
-// @Router /oauth/google/login [get]
-func (h *Handler) GoogleLogin(ctx *fiber.Ctx) error {
-	url := h.service.GetGoogleAuthURL()
+// @Router /oauth/{provider}/login [get]
+func (h *Handler) Login(ctx *fiber.Ctx) error {
+	var req dto.OAuthLoginRequest
+	if err := ctx.QueryParser(&req); err != nil {
+		h.logger.Error("http - v1 - auth - oauth login - parse query error: %w", err)
+
+		return response.WithError(ctx, failure.BadRequest(err))
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - v1 - auth - oauth login - validation error: %w", err)
+
+		return response.WithError(ctx, failure.BadRequest(err))
+	}
+
+	auth, err := h.service.AuthURL(ctx.UserContext(), ctx.Params("provider"), req)
+	if err != nil {
+		h.logger.Error("http - v1 - auth - oauth login - failed to start login: %w", err)
+
+		return response.WithError(ctx, err)
+	}
+
+	h.setStateCookie(ctx, auth.State, time.Now().Add(jwt.ParseDuration(h.config.OAuth.StateExpiry)))
 
-	if err := ctx.Redirect(url); err != nil {
-		h.logger.Error("http - v1 - auth - google login - redirect error: %w", err)
+	if err = ctx.Redirect(auth.URL); err != nil {
+		h.logger.Error("http - v1 - auth - oauth login - redirect error: %w", err)
 
 		return response.WithError(ctx, err)
 	}
@@ -58,36 +95,209 @@ func (h *Handler) GoogleLogin(ctx *fiber.Ctx) error {
 	return nil
 }
 
-// GoogleCallback godoc
-// @Summary Google OAuth callback
-// @Description Handle the Google OAuth callback and return JWT tokens
+// Callback godoc
+// @Summary OAuth provider callback
+// @Description Handle the callback of the provider and return JWT tokens. The state must match the oauth_state cookie of the browser that started the login and can only be used once. When the login was started with a redirect_uri, redirects there with the tokens in the URL fragment. An identity the provider has not verified the email of is not linked to an existing account with that email; the owner has to sign in and link it. Nor is a new account created for it.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param code query string true "Authorization code from Google"
+// @Param provider path string true "Name of the provider"
+// @Param code query string true "Authorization code from the provider"
+// @Param state query string true "State of the login attempt"
 // @Success 200 {object} response.Data[dto.UserLoginResponse]
+// @Success 302 {string} string "Redirect to the redirect_uri of the login"
 // @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /oauth/{provider}/callback [get]
+func (h *Handler) Callback(ctx *fiber.Ctx) error {
+	var req dto.OAuthCallbackRequest
+	if err := ctx.QueryParser(&req); err != nil {
+		h.logger.Error("http - v1 - auth - oauth callback - parse query error: %w", err)
+
+		return response.WithError(ctx, failure.BadRequest(err))
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - v1 - auth - oauth callback - validation error: %w", err)
+
+		return response.WithError(ctx, failure.BadRequest(err))
+	}
+
+	binding := ctx.Cookies(stateCookie)
+
+	// The state is single use, so the cookie is cleared whatever the outcome.
+	h.setStateCookie(ctx, "", fasthttp.CookieExpireDelete)
+
+	data, redirectURI, err := h.service.HandleCallback(ctx.UserContext(), ctx.Params("provider"), req, binding)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - auth - oauth callback - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if redirectURI != "" {
+		return ctx.Redirect(redirectURI + "#" + fragment(data))
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// Link godoc
+// @Summary Link an OAuth provider
+// @Description Start linking the provider to the signed in account. Send the browser to the returned URL; the oauth_state cookie set by this response binds the attempt to it. The callback links the identity and signs in like a login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param provider path string true "Name of the provider"
+// @Param redirect_uri query string false "Whitelisted page to return the tokens to"
+// @Success 200 {object} response.Data[dto.OAuthLinkResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /oauth/{provider}/link [post]
+// @Security BearerAuth
+func (h *Handler) Link(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - auth - oauth link - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	var req dto.OAuthLoginRequest
+	if err := ctx.QueryParser(&req); err != nil {
+		h.logger.Error("http - v1 - auth - oauth link - parse query error: %w", err)
+
+		return response.WithError(ctx, failure.BadRequest(err))
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - v1 - auth - oauth link - validation error: %w", err)
+
+		return response.WithError(ctx, failure.BadRequest(err))
+	}
+
+	auth, err := h.service.LinkURL(ctx.UserContext(), ctx.Params("provider"), claims, req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - auth - oauth link - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	h.setStateCookie(ctx, auth.State, time.Now().Add(jwt.ParseDuration(h.config.OAuth.StateExpiry)))
+
+	return response.WithJSON(ctx, fiber.StatusOK, dto.OAuthLinkResponse{URL: auth.URL})
+}
+
+// ListIdentities godoc
+// @Summary List linked identities
+// @Description List the OAuth provider identities linked to the signed in account
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.IdentityResponse]
+// @Failure 401 {object} response.Error
 // @Failure 500 {object} response.Error
-// @Router /oauth/google/callback [get]
-func (h *Handler) GoogleCallback(ctx *fiber.Ctx) error {
-	code := ctx.Query("code")
-	if code == "" {
-		h.logger.Error("http - v1 - auth - google callback - code is empty")
+// @Router /users/me/identities [get]
+// @Security BearerAuth
+func (h *Handler) ListIdentities(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - user - list identities - claims is nil")
 
-		return response.WithError(ctx, ErrGoogleLoginCode)
+		return response.WithError(ctx, ErrClaimsNil)
 	}
 
-	data, err := h.service.HandleGoogleCallback(ctx.Context(), code)
+	data, err := h.service.ListIdentities(ctx.UserContext(), claims)
 	if err != nil {
 		reqID := "unknown"
 		if id, ok := ctx.Locals("request_id").(string); ok {
 			reqID = id
 		}
 
-		h.logger.Error("http - v1 - auth - google callback - request_id: " + reqID + " - " + err.Error())
+		h.logger.Error("http - v1 - user - list identities - request_id: " + reqID + " - " + err.Error())
 
 		return response.WithError(ctx, err)
 	}
 
 	return response.WithJSON(ctx, fiber.StatusOK, data)
 }
+
+// UnlinkIdentity godoc
+// @Summary Unlink an identity
+// @Description Unlink the identity of the provider from the signed in account. The last identity of an account without a password or passkey cannot be unlinked.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param provider path string true "Name of the provider"
+// @Success 204
+// @Failure 401 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/identities/{provider} [delete]
+// @Security BearerAuth
+func (h *Handler) UnlinkIdentity(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - user - unlink identity - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.UnlinkIdentity(ctx.UserContext(), claims, ctx.Params("provider")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - user - unlink identity - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) setStateCookie(ctx *fiber.Ctx, value string, expires time.Time) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     stateCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   h.config.OAuth.CookieSecure,
+		HTTPOnly: true,
+		// Lax, since the callback is a top-level navigation from the provider.
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// fragment encodes a login response for the URL fragment, which browsers do not send to servers.
+func fragment(data *dto.UserLoginResponse) string {
+	values := url.Values{}
+
+	if data.MFARequired {
+		values.Set("mfa_required", strconv.FormatBool(true))
+		values.Set("mfa_token", data.MFAToken)
+	} else {
+		values.Set("access_token", data.AccessToken)
+		values.Set("refresh_token", data.RefreshToken)
+	}
+
+	return values.Encode()
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/savioruz/goth/pkg/oauth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub is a GitHub Enterprise Server that approves every authorization request.
+type fakeGitHub struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	challenge string
+	user      map[string]any
+	emails    []map[string]any
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	t.Helper()
+
+	f := &fakeGitHub{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		f.mu.Lock()
+		f.challenge = q.Get("code_challenge")
+		f.mu.Unlock()
+
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=fake-code&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		clientID, clientSecret, _ := r.BasicAuth()
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+		if r.PostFormValue("code") != "fake-code" || clientID != fakeClientID || clientSecret != "secret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"bad_verification_code"}`))
+
+			return
+		}
+
+		writeJSON(w, map[string]any{"access_token": "gh-token", "token_type": "bearer", "scope": "read:user,user:email"})
+	})
+	mux.HandleFunc("/api/v3/user", f.api(func() (any, bool) { return f.user, f.user != nil }))
+	mux.HandleFunc("/api/v3/user/emails", f.api(func() (any, bool) { return f.emails, f.emails != nil }))
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// api serves the value of get to requests with the access token, or an error when it has none.
+func (f *fakeGitHub) api(get func() (any, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gh-token" {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		v, ok := get()
+		if !ok {
+			http.Error(w, `{"message":"Server Error"}`, http.StatusInternalServerError)
+
+			return
+		}
+
+		writeJSON(w, v)
+	}
+}
+
+func (f *fakeGitHub) set(user map[string]any, emails []map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.user, f.emails = user, emails
+}
+
+func TestGitHubProvider(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeGitHub(t)
+
+	provider := oauth.NewGitHubProvider("github", server.URL+"/", fakeClientID, "secret",
+		"http://localhost:3000/v1/oauth/github/callback")
+
+	// login goes through the consent screen and returns the code of the callback.
+	login := func(t *testing.T, verifier string) string {
+		t.Helper()
+
+		auth, err := url.Parse(provider.AuthURL("state", verifier, "nonce"))
+		require.NoError(t, err)
+		assert.Equal(t, server.URL+"/login/oauth/authorize", auth.Scheme+"://"+auth.Host+auth.Path)
+		assert.Equal(t, "read:user user:email", auth.Query().Get("scope"))
+		assert.Empty(t, auth.Query().Get("nonce"))
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+
+		resp, err := client.Get(auth.String())
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+
+		return callback.Query().Get("code")
+	}
+
+	user := map[string]any{"id": 583231, "login": "octocat", "name": "The Octocat", "avatar_url": "https://example.com/octocat.png"}
+
+	tests := []struct {
+		name    string
+		user    map[string]any
+		emails  []map[string]any
+		want    *oauth.UserInfo
+		wantErr error
+	}{
+		{
+			name: "success: primary verified address",
+			user: user,
+			emails: []map[string]any{
+				{"email": "octocat@users.noreply.github.com", "primary": false, "verified": true},
+				{"email": "octocat@example.com", "primary": true, "verified": true},
+			},
+			want: &oauth.UserInfo{
+				Subject:       "583231",
+				Email:         "octocat@example.com",
+				EmailVerified: true,
+				Name:          "The Octocat",
+				Picture:       "https://example.com/octocat.png",
+			},
+		},
+		{
+			name:   "success: primary address not verified",
+			user:   map[string]any{"id": 583231, "login": "octocat"},
+			emails: []map[string]any{{"email": "octocat@example.com", "primary": true, "verified": false}},
+			want:   &oauth.UserInfo{Subject: "583231", Email: "octocat@example.com", Name: "octocat"},
+		},
+		{
+			name:    "error: no primary address",
+			user:    user,
+			emails:  []map[string]any{{"email": "octocat@example.com", "primary": false, "verified": true}},
+			wantErr: oauth.ErrNoEmail,
+		},
+		{
+			name:   "error: emails unavailable",
+			user:   user,
+			emails: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.set(tt.user, tt.emails)
+
+			code := login(t, "verifier")
+
+			info, err := provider.Exchange(ctx, code, "verifier", "nonce")
+
+			switch {
+			case tt.want != nil:
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, info)
+			case tt.wantErr != nil:
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, info)
+			default:
+				assert.ErrorContains(t, err, "failed to get emails")
+				assert.Nil(t, info)
+			}
+		})
+	}
+
+	t.Run("error: code redeemed without the verifier of the login", func(t *testing.T) {
+		server.set(user, tests[0].emails)
+
+		code := login(t, "verifier")
+
+		info, err := provider.Exchange(ctx, code, "other-verifier", "nonce")
+
+		assert.Error(t, err)
+		assert.Nil(t, info)
+	})
+
+	t.Run("success: github.com by default", func(t *testing.T) {
+		auth, err := url.Parse(oauth.NewGitHubProvider("github", "", fakeClientID, "secret", "").AuthURL("state", "verifier", ""))
+
+		require.NoError(t, err)
+		assert.Equal(t, "https://github.com/login/oauth/authorize", auth.Scheme+"://"+auth.Host+auth.Path)
+	})
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/oauth"
+	"github.com/savioruz/goth/pkg/postgres"
+)
+
+func (s *oauthService) ListIdentities(ctx context.Context, claims *jwt.Claims) ([]*dto.IdentityResponse, error) {
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.repo.ListUserIdentities(ctx, s.db, userID)
+	if err != nil {
+		s.logger.Error("list identities - service - failed to list identities: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := make([]*dto.IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		res = append(res, new(dto.IdentityResponse).ToIdentityResponse(identity))
+	}
+
+	return res, nil
+}
+
+// UnlinkIdentity removes the identity of the named provider from the signed in account. The last
+// identity of an account without a password or passkey cannot be removed, since nothing would be
+// left to sign in with.
+func (s *oauthService) UnlinkIdentity(ctx context.Context, claims *jwt.Claims, provider string) error {
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("unlink identity - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("unlink identity - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.repo.GetUserByID(ctx, tx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("unlink identity - service - failed to get user: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	identities, err := s.repo.ListUserIdentities(ctx, tx, userID)
+	if err != nil {
+		s.logger.Error("unlink identity - service - failed to list identities: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	linked := false
+	for _, identity := range identities {
+		linked = linked || identity.Provider == provider
+	}
+
+	if !linked {
+		return failure.NotFound("identity not found")
+	}
+
+	if len(identities) == 1 && (!user.Password.Valid || user.Password.String == "") {
+		passkeys, err := s.repo.ListWebAuthnCredentialsByUser(ctx, tx, userID)
+		if err != nil {
+			s.logger.Error("unlink identity - service - failed to list passkeys: %w", err)
+
+			return failure.InternalError(err)
+		}
+
+		if len(passkeys) == 0 {
+			return failure.Conflict("cannot unlink the only way to sign in, set a password first")
+		}
+	}
+
+	_, err = s.repo.DeleteUserIdentity(ctx, tx, repository.DeleteUserIdentityParams{
+		UserID:   userID,
+		Provider: provider,
+	})
+	if err != nil {
+		s.logger.Error("unlink identity - service - failed to delete identity: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("unlink identity - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// resolveUser returns the account the provider identity signs in to. A known identity signs in to the
+// account it is linked to. An unknown one is linked to linkTo when the owner of that account asked
+// for it, and otherwise to the account with the same email, which is created if there is none.
+// Linking by email needs both sides to prove the address: an email the provider has not verified may
+// belong to someone else, and an unverified account may have been registered by someone else to take
+// over the identity of the real owner later. Otherwise the owner has to sign in and link it. For the
+// same reason no account is created for an email the provider has not verified.
+func (s *oauthService) resolveUser(
+	ctx context.Context,
+	tx pgx.Tx,
+	provider string,
+	info *oauth.UserInfo,
+	linkTo string,
+) (repository.User, error) {
+	identity, err := s.repo.GetUserIdentity(ctx, tx, repository.GetUserIdentityParams{
+		Provider: provider,
+		Subject:  info.Subject,
+	})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("oauth callback - service - failed to get identity: %w", err)
+
+		return repository.User{}, failure.InternalError(err)
+	}
+
+	if err == nil {
+		if linkTo != "" && identity.UserID.String() != linkTo {
+			return repository.User{}, failure.Conflict("this identity is already linked to another account")
+		}
+
+		return s.identityUser(ctx, tx, identity.UserID)
+	}
+
+	var user repository.User
+
+	if linkTo != "" {
+		var userID pgtype.UUID
+		if err = userID.Scan(linkTo); err != nil {
+			return repository.User{}, failure.Unauthorized("invalid token subject")
+		}
+
+		user, err = s.identityUser(ctx, tx, userID)
+		if err != nil {
+			return repository.User{}, err
+		}
+
+		return user, s.link(ctx, tx, user, provider, info)
+	}
+
+	user, err = s.repo.GetUserByEmail(ctx, tx, info.Email)
+
+	switch {
+	case err == nil:
+		if !info.EmailVerified {
+			s.logger.Error("oauth callback - service - %s did not verify the email of an existing account", provider)
+
+			return repository.User{}, failure.Conflict(
+				"an account with this email already exists, sign in to it and link " + provider + " from there")
+		}
+
+		if !user.IsVerified.Bool {
+			s.logger.Error("oauth callback - service - existing account with the email of %s is not verified", provider)
+
+			return repository.User{}, failure.Conflict("an account with this email already exists but is not " +
+				"verified, sign in to it or reset its password, then link " + provider + " from there")
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		if !info.EmailVerified {
+			s.logger.Error("oauth callback - service - %s did not verify the email of a new account", provider)
+
+			return repository.User{}, failure.Forbidden(provider + " has not verified this email, verify it there first")
+		}
+
+		user, err = s.repo.CreateUser(ctx, tx, repository.CreateUserParams{
+			Email:        info.Email,
+			FullName:     pgtype.Text{String: info.Name, Valid: true},
+			IsVerified:   pgtype.Bool{Bool: true, Valid: true},
+			ProfileImage: pgtype.Text{String: info.Picture, Valid: true},
+		})
+		if postgres.IsUniqueViolation(err) {
+			s.logger.Error("oauth callback - service - email already in use")
+
+			return repository.User{}, failure.Conflict("email already in use")
+		}
+
+		if err != nil {
+			s.logger.Error("oauth callback - service - failed to create user: %w", err)
+
+			return repository.User{}, failure.InternalError(err)
+		}
+
+		if err = s.repo.AssignDefaultRoles(ctx, tx, user.ID); err != nil {
+			s.logger.Error("oauth callback - service - failed to assign default roles: %w", err)
+
+			return repository.User{}, failure.InternalError(err)
+		}
+	default:
+		s.logger.Error("oauth callback - service - failed to get user: %w", err)
+
+		return repository.User{}, failure.InternalError(err)
+	}
+
+	return user, s.link(ctx, tx, user, provider, info)
+}
+
+// identityUser returns the account an identity belongs to. Deleted accounts cannot sign in.
+func (s *oauthService) identityUser(ctx context.Context, tx pgx.Tx, userID pgtype.UUID) (repository.User, error) {
+	user, err := s.repo.GetUserByID(ctx, tx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.User{}, failure.Unauthorized("oauth login failed")
+	}
+
+	if err != nil {
+		s.logger.Error("oauth callback - service - failed to get user: %w", err)
+
+		return repository.User{}, failure.InternalError(err)
+	}
+
+	return user, nil
+}
+
+func (s *oauthService) link(
+	ctx context.Context,
+	tx pgx.Tx,
+	user repository.User,
+	provider string,
+	info *oauth.UserInfo,
+) error {
+	_, err := s.repo.CreateUserIdentity(ctx, tx, repository.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  info.Subject,
+		Email:    info.Email,
+	})
+
+	// Either the account has another identity of the provider, or a concurrent login has just linked
+	// the identity to another account.
+	if postgres.IsUniqueViolation(err) {
+		s.logger.Error("oauth callback - service - %s identity already linked", provider)
+
+		return failure.Conflict(provider + " identity already linked")
+	}
+
+	if err != nil {
+		s.logger.Error("oauth callback - service - failed to link identity: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+func parseUserID(claims *jwt.Claims) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	if err := id.Scan(claims.ID); err != nil {
+		return pgtype.UUID{}, failure.Unauthorized("invalid token subject")
+	}
+
+	return id, nil
+}
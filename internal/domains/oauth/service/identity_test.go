@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/oauth"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestOauthService_ListIdentities(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+
+	service := New(mockPgx, mockQuerier, oauth.NewRegistry(), mockTokens, mockRedis, &config.Config{}, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String()}
+
+	t.Run("error: failure listing identities", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockQuerier.EXPECT().
+			ListUserIdentities(gomock.Any(), gomock.Any(), userID).
+			Return(nil, errors.New("error"))
+
+		res, err := service.ListIdentities(ctx, claims)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		linkedAt := time.Now()
+
+		mockQuerier.EXPECT().
+			ListUserIdentities(gomock.Any(), gomock.Any(), userID).
+			Return([]repository.UserIdentity{{
+				UserID:   userID,
+				Provider: "github",
+				Subject:  "42",
+				Email:    "test@example.com",
+				LinkedAt: pgtype.Timestamp{Time: linkedAt, Valid: true},
+			}}, nil)
+
+		res, err := service.ListIdentities(ctx, claims)
+
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+		assert.Equal(t, "github", res[0].Provider)
+		assert.Equal(t, "test@example.com", res[0].Email)
+		assert.Equal(t, linkedAt, res[0].LinkedAt)
+	})
+}
+
+func TestOauthService_UnlinkIdentity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String()}
+	withPassword := repository.User{ID: userID, Password: pgtype.Text{String: "hash", Valid: true}}
+	withoutPassword := repository.User{ID: userID}
+	google := repository.UserIdentity{UserID: userID, Provider: "google"}
+	github := repository.UserIdentity{UserID: userID, Provider: "github"}
+	deleteParams := repository.DeleteUserIdentityParams{UserID: userID, Provider: "google"}
+
+	newService := func() (OAuthService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, oauth.NewRegistry(), mockTokens, mockRedis, &config.Config{}, mockLogger), mockPgx
+	}
+
+	t.Run("error: invalid token subject", func(t *testing.T) {
+		service, _ := newService()
+
+		err := service.UnlinkIdentity(ctx, &jwt.Claims{ID: "invalid"}, "google")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: identity not linked", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(withPassword, nil)
+		mockQuerier.EXPECT().
+			ListUserIdentities(gomock.Any(), gomock.Any(), userID).
+			Return([]repository.UserIdentity{github}, nil)
+		mockPgx.ExpectRollback()
+
+		err := service.UnlinkIdentity(ctx, claims, "google")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: only way to sign in", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(withoutPassword, nil)
+		mockQuerier.EXPECT().
+			ListUserIdentities(gomock.Any(), gomock.Any(), userID).
+			Return([]repository.UserIdentity{google}, nil)
+		mockQuerier.EXPECT().
+			ListWebAuthnCredentialsByUser(gomock.Any(), gomock.Any(), userID).
+			Return(nil, nil)
+		mockPgx.ExpectRollback()
+
+		err := service.UnlinkIdentity(ctx, claims, "google")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: account keeps a passkey", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(withoutPassword, nil)
+		mockQuerier.EXPECT().
+			ListUserIdentities(gomock.Any(), gomock.Any(), userID).
+			Return([]repository.UserIdentity{google}, nil)
+		mockQuerier.EXPECT().
+			ListWebAuthnCredentialsByUser(gomock.Any(), gomock.Any(), userID).
+			Return([]repository.WebauthnCredential{{UserID: userID}}, nil)
+		mockQuerier.EXPECT().DeleteUserIdentity(gomock.Any(), gomock.Any(), deleteParams).Return(int64(1), nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.UnlinkIdentity(ctx, claims, "google")
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: account keeps another identity", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(withoutPassword, nil)
+		mockQuerier.EXPECT().
+			ListUserIdentities(gomock.Any(), gomock.Any(), userID).
+			Return([]repository.UserIdentity{google, github}, nil)
+		mockQuerier.EXPECT().DeleteUserIdentity(gomock.Any(), gomock.Any(), deleteParams).Return(int64(1), nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.UnlinkIdentity(ctx, claims, "google")
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("success: account keeps its password", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(withPassword, nil)
+		mockQuerier.EXPECT().
+			ListUserIdentities(gomock.Any(), gomock.Any(), userID).
+			Return([]repository.UserIdentity{google}, nil)
+		mockQuerier.EXPECT().DeleteUserIdentity(gomock.Any(), gomock.Any(), deleteParams).Return(int64(1), nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.UnlinkIdentity(ctx, claims, "google")
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("error: user not found", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		err := service.UnlinkIdentity(ctx, claims, "google")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/oauth"
+	redisCache "github.com/savioruz/goth/pkg/redis"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+const (
+	fakeClientID   = "goth-client"
+	fakeKeyID      = "key-1"
+	fakeOtherKeyID = "key-2"
+)
+
+// fakeIssuer is an OpenID Connect issuer that approves every authorization request. How its ID tokens
+// are made can be changed per test to check that the provider refuses bad ones.
+type fakeIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// other is published next to key but signs nothing by default.
+	other *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	nonce     string
+	// idToken changes the claims and signing key of the next ID token.
+	idToken func(claims gojwt.MapClaims) *rsa.PrivateKey
+	// noKeyID leaves the key ID out of the header of ID tokens.
+	noKeyID bool
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	f := &fakeIssuer{key: key, other: other}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"userinfo_endpoint":      f.URL + "/userinfo",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", f.authorize)
+	mux.HandleFunc("/token", f.token)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, jwt.JWKS{Keys: []jwt.JWK{rsaJWK(fakeOtherKeyID, other), rsaJWK(fakeKeyID, key)}})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jwt.JWK {
+	return jwt.JWK{
+		KeyType:   "RSA",
+		KeyID:     kid,
+		Use:       "sig",
+		Algorithm: "RS256",
+		N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func (f *fakeIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f.mu.Lock()
+	f.challenge, f.nonce = q.Get("code_challenge"), q.Get("nonce")
+	f.mu.Unlock()
+
+	http.Redirect(w, r, q.Get("redirect_uri")+"?code=fake-code&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if r.PostFormValue("code") != "fake-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+
+		return
+	}
+
+	now := time.Now()
+	claims := gojwt.MapClaims{
+		"iss":            f.URL,
+		"sub":            "fake-subject",
+		"aud":            fakeClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+		"nonce":          f.nonce,
+		"email":          "test@example.com",
+		"email_verified": "true",
+		"name":           "Test User",
+	}
+
+	key := f.key
+	if f.idToken != nil {
+		key = f.idToken(claims)
+	}
+
+	token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, claims)
+	if !f.noKeyID {
+		token.Header["kid"] = fakeKeyID
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": "fake-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func (f *fakeIssuer) setIDToken(idToken func(claims gojwt.MapClaims) *rsa.PrivateKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.idToken = idToken
+}
+
+func (f *fakeIssuer) setNoKeyID(noKeyID bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.noKeyID = noKeyID
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOauthService_OIDCProvider(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	issuer := newFakeIssuer(t)
+
+	provider, err := oauth.NewOIDCProvider(ctx, "fake", issuer.URL, fakeClientID, "secret",
+		"http://localhost:3000/v1/oauth/fake/callback")
+	require.NoError(t, err)
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+	// The state store of a single login attempt.
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	stored := map[string][]byte{}
+	mockRedis.EXPECT().
+		Save(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, key string, value any, _ int) error {
+			stored[key], _ = json.Marshal(value)
+
+			return nil
+		}).AnyTimes()
+	mockRedis.EXPECT().
+		Take(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, key string, value any) error {
+			data, ok := stored[key]
+			if !ok {
+				return redisCache.ErrCacheMiss
+			}
+
+			delete(stored, key)
+
+			return json.Unmarshal(data, value)
+		}).AnyTimes()
+
+	cfg := &config.Config{}
+	cfg.OAuth.StateExpiry = "10m"
+
+	mockUser := repository.User{
+		ID:         pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email:      "test@example.com",
+		IsVerified: pgtype.Bool{Bool: true, Valid: true},
+	}
+	mockTokenPair := &dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}
+
+	// login goes through the consent screen of the fake issuer and returns the callback it redirects to.
+	login := func(t *testing.T, service OAuthService) dto.OAuthCallbackRequest {
+		t.Helper()
+
+		auth, err := service.AuthURL(ctx, "fake", dto.OAuthLoginRequest{})
+		require.NoError(t, err)
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+
+		resp, err := client.Get(auth.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		assert.Equal(t, auth.State, callback.Query().Get("state"))
+
+		return dto.OAuthCallbackRequest{Code: callback.Query().Get("code"), State: callback.Query().Get("state")}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		idToken func(claims gojwt.MapClaims) *rsa.PrivateKey
+	}{
+		{
+			name: "nonce of another login",
+			idToken: func(claims gojwt.MapClaims) *rsa.PrivateKey {
+				claims["nonce"] = "other-nonce"
+
+				return issuer.key
+			},
+		},
+		{
+			name: "audience of another client",
+			idToken: func(claims gojwt.MapClaims) *rsa.PrivateKey {
+				claims["aud"] = "other-client"
+
+				return issuer.key
+			},
+		},
+		{
+			name: "expired",
+			idToken: func(claims gojwt.MapClaims) *rsa.PrivateKey {
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+				return issuer.key
+			},
+		},
+		{
+			name: "signed by another key",
+			idToken: func(gojwt.MapClaims) *rsa.PrivateKey {
+				key, err := rsa.GenerateKey(rand.Reader, 2048)
+				require.NoError(t, err)
+
+				return key
+			},
+		},
+	} {
+		t.Run("error: id token "+tc.name, func(t *testing.T) {
+			mockPgx, _ := pgxmock.NewPool()
+			service := New(mockPgx, mockQuerier, oauth.NewRegistry(provider), mockTokens, mockRedis, cfg, mockLogger)
+
+			issuer.setIDToken(tc.idToken)
+			defer issuer.setIDToken(nil)
+
+			req := login(t, service)
+
+			res, _, err := service.HandleCallback(ctx, "fake", req, req.State)
+
+			assert.Error(t, err)
+			assert.Nil(t, res)
+			assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+		})
+	}
+
+	t.Run("error: code redeemed without the verifier of the login", func(t *testing.T) {
+		mockPgx, _ := pgxmock.NewPool()
+		service := New(mockPgx, mockQuerier, oauth.NewRegistry(provider), mockTokens, mockRedis, cfg, mockLogger)
+
+		req := login(t, service)
+
+		// Another login attempt of the attacker, whose state and verifier get paired with the stolen code.
+		other, err := service.AuthURL(ctx, "fake", dto.OAuthLoginRequest{})
+		require.NoError(t, err)
+
+		res, _, err := service.HandleCallback(ctx, "fake",
+			dto.OAuthCallbackRequest{Code: req.Code, State: other.State}, other.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	for _, tc := range []struct {
+		name    string
+		noKeyID bool
+	}{
+		{name: "with key id"},
+		// Every published key that fits the algorithm is tried.
+		{name: "without key id", noKeyID: true},
+	} {
+		t.Run("success: user signed in from the id token "+tc.name, func(t *testing.T) {
+			issuer.setNoKeyID(tc.noKeyID)
+			defer issuer.setNoKeyID(false)
+
+			mockPgx, _ := pgxmock.NewPool()
+			service := New(mockPgx, mockQuerier, oauth.NewRegistry(provider), mockTokens, mockRedis, cfg, mockLogger)
+
+			req := login(t, service)
+
+			mockPgx.ExpectBegin()
+			mockQuerier.EXPECT().
+				GetUserIdentity(gomock.Any(), gomock.Any(), repository.GetUserIdentityParams{
+					Provider: "fake",
+					Subject:  "fake-subject",
+				}).
+				Return(repository.UserIdentity{}, pgx.ErrNoRows)
+			mockQuerier.EXPECT().
+				GetUserByEmail(gomock.Any(), gomock.Any(), "test@example.com").
+				Return(mockUser, nil)
+			mockQuerier.EXPECT().
+				CreateUserIdentity(gomock.Any(), gomock.Any(), repository.CreateUserIdentityParams{
+					UserID:   mockUser.ID,
+					Provider: "fake",
+					Subject:  "fake-subject",
+					Email:    "test@example.com",
+				}).
+				Return(repository.UserIdentity{}, nil)
+			mockQuerier.EXPECT().
+				GetUserMFA(gomock.Any(), gomock.Any(), mockUser.ID).
+				Return(repository.UserMfa{}, pgx.ErrNoRows)
+			mockPgx.ExpectCommit()
+			mockPgx.ExpectRollback()
+			mockTokens.EXPECT().Issue(gomock.Any(), mockUser).Return(mockTokenPair, nil)
+
+			res, _, err := service.HandleCallback(ctx, "fake", req, req.State)
+
+			assert.NoError(t, err)
+			assert.Equal(t, mockTokenPair, res)
+		})
+	}
+}
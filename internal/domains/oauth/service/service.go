@@ -2,62 +2,247 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
 	"github.com/jackc/pgx/v5"
+	"github.com/savioruz/goth/config"
 	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/logger"
 	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/redis"
+	"github.com/savioruz/goth/pkg/secret"
+	"golang.org/x/oauth2"
 
-	"github.com/jackc/pgx/v5/pgtype"
+	authService "github.com/savioruz/goth/internal/domains/auth/service"
 	"github.com/savioruz/goth/internal/domains/user/dto"
 	"github.com/savioruz/goth/internal/domains/user/repository"
-	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/oauth"
 )
 
+// OAuthService signs users in through the configured identity providers. Every login attempt gets a
+// random state, PKCE verifier and nonce that are kept in Redis until the callback, which may use them
+// only once. The state is also set in a cookie by the handler, so that a callback only succeeds in
+// the browser that started the login.
+//
+// A provider identity is tied to one account. It is linked on first login when the provider has
+// verified the email of an existing account, or explicitly by the signed in owner of the account.
 type OAuthService interface {
-	GetGoogleAuthURL() string
-	HandleGoogleCallback(ctx context.Context, code string) (res *dto.UserLoginResponse, err error)
+	AuthURL(ctx context.Context, provider string, req dto.OAuthLoginRequest) (*dto.OAuthAuthorization, error)
+	LinkURL(
+		ctx context.Context,
+		provider string,
+		claims *jwt.Claims,
+		req dto.OAuthLoginRequest,
+	) (*dto.OAuthAuthorization, error)
+	HandleCallback(
+		ctx context.Context,
+		provider string,
+		req dto.OAuthCallbackRequest,
+		binding string,
+	) (res *dto.UserLoginResponse, redirectURI string, err error)
+	ListIdentities(ctx context.Context, claims *jwt.Claims) ([]*dto.IdentityResponse, error)
+	UnlinkIdentity(ctx context.Context, claims *jwt.Claims, provider string) error
+}
+
+const oauthStateKey = "oauth:state:%s"
+
+// oauthState is what a login attempt needs to be completed, stored under the hash of its state.
+type oauthState struct {
+	Provider    string `json:"provider"`
+	Verifier    string `json:"verifier"`
+	Nonce       string `json:"nonce"`
+	RedirectURI string `json:"redirect_uri,omitempty"`
+	// UserID is the account to link the identity to, empty for a login.
+	UserID string `json:"user_id,omitempty"`
 }
 
 type oauthService struct {
-	db             postgres.PgxIface
-	repo           repository.Querier
-	googleProvider oauth.GoogleProviderIface
-	logger         logger.Interface
+	db        postgres.PgxIface
+	repo      repository.Querier
+	providers *oauth.Registry
+	tokens    authService.TokenService
+	cache     redis.IRedisCache
+	config    *config.Config
+	logger    logger.Interface
 }
 
-func New(db postgres.PgxIface, repo repository.Querier, googleProvider oauth.GoogleProviderIface, l logger.Interface) OAuthService {
+func New(
+	db postgres.PgxIface,
+	repo repository.Querier,
+	providers *oauth.Registry,
+	tokens authService.TokenService,
+	c redis.IRedisCache,
+	cfg *config.Config,
+	l logger.Interface,
+) OAuthService {
 	return &oauthService{
-		db:             db,
-		repo:           repo,
-		googleProvider: googleProvider,
-		logger:         l,
+		db:        db,
+		repo:      repo,
+		providers: providers,
+		tokens:    tokens,
+		cache:     c,
+		config:    cfg,
+		logger:    l,
 	}
 }
 
-func (s *oauthService) GetGoogleAuthURL() string {
-	return s.googleProvider.GetAuthURL()
+// AuthURL starts a login attempt with the named provider. The optional redirect URI must be on the
+// whitelist; the callback then returns the tokens to it instead of answering with JSON.
+func (s *oauthService) AuthURL(
+	ctx context.Context,
+	provider string,
+	req dto.OAuthLoginRequest,
+) (*dto.OAuthAuthorization, error) {
+	return s.authorize(ctx, provider, "", req)
+}
+
+// LinkURL starts linking the named provider to the signed in account. The callback links the identity
+// and then signs in like a login.
+func (s *oauthService) LinkURL(
+	ctx context.Context,
+	provider string,
+	claims *jwt.Claims,
+	req dto.OAuthLoginRequest,
+) (*dto.OAuthAuthorization, error) {
+	userID, err := parseUserID(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authorize(ctx, provider, userID.String(), req)
 }
 
-func (s *oauthService) HandleGoogleCallback(ctx context.Context, code string) (res *dto.UserLoginResponse, err error) {
-	token, err := s.googleProvider.Exchange(code)
+func (s *oauthService) authorize(
+	ctx context.Context,
+	provider, userID string,
+	req dto.OAuthLoginRequest,
+) (*dto.OAuthAuthorization, error) {
+	p, ok := s.providers.Get(provider)
+	if !ok {
+		s.logger.Error("oauth login - service - unknown provider: %s", provider)
+
+		return nil, failure.NotFound("oauth provider not found")
+	}
+
+	if req.RedirectURI != "" && !s.allowedRedirect(req.RedirectURI) {
+		s.logger.Error("oauth login - service - redirect uri not allowed: %s", req.RedirectURI)
+
+		return nil, failure.BadRequestFromString("redirect_uri is not allowed")
+	}
+
+	state, hash, err := secret.NewToken()
 	if err != nil {
-		s.logger.Error("google callback - service - failed to exchange code: %w", err)
+		s.logger.Error("oauth login - service - failed to generate state: %w", err)
 
 		return nil, failure.InternalError(err)
 	}
 
-	userInfo, err := s.googleProvider.GetUserInfo(token)
+	nonce, _, err := secret.NewToken()
 	if err != nil {
-		s.logger.Error("google callback - service - failed to get user info: %w", err)
+		s.logger.Error("oauth login - service - failed to generate nonce: %w", err)
 
 		return nil, failure.InternalError(err)
 	}
 
+	verifier := oauth2.GenerateVerifier()
+
+	err = s.cache.Save(ctx, fmt.Sprintf(oauthStateKey, hash), oauthState{
+		Provider:    p.Name(),
+		Verifier:    verifier,
+		Nonce:       nonce,
+		RedirectURI: req.RedirectURI,
+		UserID:      userID,
+	}, s.stateTTL())
+	if err != nil {
+		s.logger.Error("oauth login - service - failed to save state: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return &dto.OAuthAuthorization{
+		URL:   p.AuthURL(state, verifier, nonce),
+		State: state,
+	}, nil
+}
+
+// HandleCallback completes a login attempt with the named provider. binding is the state from the
+// cookie of the browser; it must match the state the provider echoed back, and the state must not
+// have been used before nor been issued for another provider.
+func (s *oauthService) HandleCallback(
+	ctx context.Context,
+	provider string,
+	req dto.OAuthCallbackRequest,
+	binding string,
+) (res *dto.UserLoginResponse, redirectURI string, err error) {
+	p, ok := s.providers.Get(provider)
+	if !ok {
+		s.logger.Error("oauth callback - service - unknown provider: %s", provider)
+
+		return nil, "", failure.NotFound("oauth provider not found")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(req.State)) != 1 {
+		s.logger.Error("oauth callback - service - state does not match the browser")
+
+		return nil, "", failure.BadRequestFromString("invalid oauth state")
+	}
+
+	var state oauthState
+
+	err = s.cache.Take(ctx, fmt.Sprintf(oauthStateKey, secret.Hash(req.State)), &state)
+	if errors.Is(err, redis.ErrCacheMiss) {
+		s.logger.Error("oauth callback - service - state unknown, expired or already used")
+
+		return nil, "", failure.BadRequestFromString("invalid oauth state")
+	}
+
+	if err != nil {
+		s.logger.Error("oauth callback - service - failed to take state: %w", err)
+
+		return nil, "", failure.InternalError(err)
+	}
+
+	if state.Provider != p.Name() {
+		s.logger.Error("oauth callback - service - state was issued for provider %s", state.Provider)
+
+		return nil, "", failure.BadRequestFromString("invalid oauth state")
+	}
+
+	res, err = s.login(ctx, p, req.Code, state)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return res, state.RedirectURI, nil
+}
+
+func (s *oauthService) login(
+	ctx context.Context,
+	p oauth.Provider,
+	code string,
+	state oauthState,
+) (*dto.UserLoginResponse, error) {
+	userInfo, err := p.Exchange(ctx, code, state.Verifier, state.Nonce)
+	if errors.Is(err, oauth.ErrNoEmail) {
+		s.logger.Error("oauth callback - service - %s returned no email", p.Name())
+
+		return nil, failure.BadRequestFromString("the provider did not share an email address")
+	}
+
+	if err != nil {
+		s.logger.Error("oauth callback - service - failed to exchange code: %w", err)
+
+		return nil, failure.Unauthorized("oauth login failed")
+	}
+
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
-		s.logger.Error("google callback - service - failed to begin transaction: %w", err)
+		s.logger.Error("oauth callback - service - failed to begin transaction: %w", err)
 
 		return nil, failure.InternalError(err)
 	}
@@ -65,50 +250,58 @@ func (s *oauthService) HandleGoogleCallback(ctx context.Context, code string) (r
 	defer func(tx pgx.Tx, ctx context.Context) {
 		err := tx.Rollback(ctx)
 		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
-			s.logger.Error("google callback - service - failed to rollback transaction: %w", err)
+			s.logger.Error("oauth callback - service - failed to rollback transaction: %w", err)
 		}
 	}(tx, ctx)
 
-	// Check if a user exists
-	user, err := s.repo.GetUserByEmail(ctx, tx, userInfo.Email)
+	user, err := s.resolveUser(ctx, tx, p.Name(), userInfo, state.UserID)
 	if err != nil {
-		params := repository.CreateUserParams{
-			Email:        userInfo.Email,
-			FullName:     pgtype.Text{String: userInfo.Name, Valid: true},
-			IsVerified:   pgtype.Bool{Bool: userInfo.VerifiedEmail, Valid: true},
-			Level:        "1",
-			ProfileImage: pgtype.Text{String: userInfo.Picture, Valid: true},
-		}
+		return nil, err
+	}
 
-		user, err = s.repo.CreateUser(ctx, tx, params)
-		if err != nil {
-			s.logger.Error("google callback - service - failed to create user: %w", err)
+	mfa, err := s.repo.GetUserMFA(ctx, tx, user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("oauth callback - service - failed to get mfa: %w", err)
 
-			return nil, failure.InternalError(err)
-		}
+		return nil, failure.InternalError(err)
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		s.logger.Error("google callback - service - failed to commit transaction: %w", err)
+		s.logger.Error("oauth callback - service - failed to commit transaction: %w", err)
 
 		return nil, failure.InternalError(err)
 	}
 
-	accessToken, err := jwt.GenerateAccessToken(user.ID.String(), user.Email, user.Level)
-	if err != nil {
-		s.logger.Error("google callback - service - failed to generate access token: %w", err)
+	if mfa.EnabledAt.Valid {
+		return s.tokens.Challenge(ctx, user)
+	}
 
-		return nil, failure.InternalError(err)
+	return s.tokens.Issue(ctx, user)
+}
+
+// allowedRedirect reports whether the redirect URI has the scheme, host and path of a whitelisted one.
+// The query is up to the front end; credentials and fragments are refused, since the tokens are
+// passed in the fragment.
+func (s *oauthService) allowedRedirect(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil || u.Fragment != "" || strings.HasSuffix(raw, "#") {
+		return false
 	}
 
-	refreshToken, err := jwt.GenerateRefreshToken(user.ID.String(), user.Email, user.Level)
-	if err != nil {
-		s.logger.Error("google callback - service - failed to generate refresh token: %w", err)
+	for _, allowed := range s.config.OAuth.RedirectURIs {
+		a, err := url.Parse(allowed)
+		if err != nil {
+			continue
+		}
 
-		return nil, failure.InternalError(err)
+		if u.Scheme == a.Scheme && strings.EqualFold(u.Host, a.Host) && u.Path == a.Path {
+			return true
+		}
 	}
 
-	res = new(dto.UserLoginResponse).ToLoginResponse(accessToken, refreshToken)
+	return false
+}
 
-	return res, nil
+func (s *oauthService) stateTTL() int {
+	return int(jwt.ParseDuration(s.config.OAuth.StateExpiry).Seconds())
 }
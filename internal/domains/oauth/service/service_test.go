@@ -8,8 +8,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
 	"github.com/savioruz/goth/internal/domains/user/mock"
 	"github.com/savioruz/goth/internal/domains/user/repository"
 	"github.com/savioruz/goth/pkg/failure"
@@ -17,60 +22,188 @@ import (
 	log "github.com/savioruz/goth/pkg/logger/mock"
 	"github.com/savioruz/goth/pkg/oauth"
 	mockOAuth "github.com/savioruz/goth/pkg/oauth/mock"
+	"github.com/savioruz/goth/pkg/postgres"
+	redisCache "github.com/savioruz/goth/pkg/redis"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/savioruz/goth/pkg/secret"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
-	"golang.org/x/oauth2"
 )
 
-func init() {
-	jwt.Initialize("test-app", "test-secret-key", time.Hour, time.Hour*24)
-}
-
-func TestOauthService_GetGoogleAuthURL(t *testing.T) {
+func TestOauthService_AuthURL(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	mockGoogleProvider := mockOAuth.NewMockGoogleProviderIface(ctrl)
+	ctx := context.Background()
+	mockProvider := mockOAuth.NewMockProvider(ctrl)
+	mockProvider.EXPECT().Name().Return("google").AnyTimes()
+	providers := oauth.NewRegistry(mockProvider)
 	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
 	mockPgx, _ := pgxmock.NewPool()
 	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	cfg := &config.Config{}
+	cfg.OAuth.StateExpiry = "10m"
+	cfg.OAuth.RedirectURIs = []string{"https://app.example.com/auth/callback"}
+
+	service := New(mockPgx, mockQuerier, providers, mockTokens, mockRedis, cfg, mockLogger)
+
+	for _, uri := range []string{
+		"https://evil.example.com/auth/callback",
+		"https://app.example.com/auth/callback/../admin",
+		"https://app.example.com.evil.com/auth/callback",
+		"http://app.example.com/auth/callback",
+		"https://user@app.example.com/auth/callback",
+		"https://app.example.com/auth/callback#fragment",
+	} {
+		t.Run("error: redirect uri not allowed: "+uri, func(t *testing.T) {
+			mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+			res, err := service.AuthURL(ctx, "google", dto.OAuthLoginRequest{RedirectURI: uri})
+
+			assert.Error(t, err)
+			assert.Nil(t, res)
+			assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+		})
+	}
+
+	t.Run("error: failure saving state", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any(), 600).Return(mockError)
+
+		res, err := service.AuthURL(ctx, "google", dto.OAuthLoginRequest{})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
 
-	service := New(mockPgx, mockQuerier, mockGoogleProvider, mockLogger)
+	t.Run("error: unknown provider", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		res, err := service.AuthURL(ctx, "unknown", dto.OAuthLoginRequest{})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: state, verifier and nonce saved under the state hash", func(t *testing.T) {
+		redirectURI := "https://app.example.com/auth/callback?next=%2Fsettings"
+
+		var (
+			key   string
+			saved oauthState
+		)
+
+		mockRedis.EXPECT().
+			Save(gomock.Any(), gomock.Any(), gomock.Any(), 600).
+			DoAndReturn(func(_ context.Context, k string, value any, _ int) error {
+				key = k
+				saved = value.(oauthState)
+
+				return nil
+			})
+		mockProvider.EXPECT().
+			AuthURL(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(state, verifier, nonce string) string {
+				assert.Equal(t, saved.Verifier, verifier)
+				assert.Equal(t, saved.Nonce, nonce)
+
+				return "https://accounts.google.com/o/oauth2/auth?state=" + state
+			})
+
+		res, err := service.AuthURL(ctx, "google", dto.OAuthLoginRequest{RedirectURI: redirectURI})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.State)
+		assert.Equal(t, "https://accounts.google.com/o/oauth2/auth?state="+res.State, res.URL)
+		assert.Equal(t, "oauth:state:"+secret.Hash(res.State), key)
+		assert.Equal(t, "google", saved.Provider)
+		assert.NotEmpty(t, saved.Verifier)
+		assert.NotEmpty(t, saved.Nonce)
+		assert.Equal(t, redirectURI, saved.RedirectURI)
+		assert.Empty(t, saved.UserID)
+	})
 
-	expectedURL := "https://accounts.google.com/o/oauth2/auth?client_id=test&redirect_uri=test&response_type=code&scope=openid+profile+email"
-	mockGoogleProvider.EXPECT().GetAuthURL().Return(expectedURL)
+	t.Run("error: link with an invalid token subject", func(t *testing.T) {
+		res, err := service.LinkURL(ctx, "google", &jwt.Claims{ID: "invalid"}, dto.OAuthLoginRequest{})
 
-	url := service.GetGoogleAuthURL()
-	assert.Equal(t, expectedURL, url)
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("success: link state carries the signed in user", func(t *testing.T) {
+		userID := uuid.NewString()
+
+		var saved oauthState
+
+		mockRedis.EXPECT().
+			Save(gomock.Any(), gomock.Any(), gomock.Any(), 600).
+			DoAndReturn(func(_ context.Context, _ string, value any, _ int) error {
+				saved = value.(oauthState)
+
+				return nil
+			})
+		mockProvider.EXPECT().AuthURL(gomock.Any(), gomock.Any(), gomock.Any()).Return("https://accounts.google.com")
+
+		res, err := service.LinkURL(ctx, "google", &jwt.Claims{ID: userID}, dto.OAuthLoginRequest{})
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, res.State)
+		assert.Equal(t, "google", saved.Provider)
+		assert.Equal(t, userID, saved.UserID)
+	})
 }
 
-func TestOauthService_HandleGoogleCallback(t *testing.T) {
+func TestOauthService_HandleCallback(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	ctx := context.Background()
-	mockGoogleProvider := mockOAuth.NewMockGoogleProviderIface(ctrl)
+	mockProvider := mockOAuth.NewMockProvider(ctrl)
+	mockProvider.EXPECT().Name().Return("google").AnyTimes()
+	providers := oauth.NewRegistry(mockProvider)
 	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
 	mockPgx, _ := pgxmock.NewPool()
 	mockLogger := log.NewMockInterface(ctrl)
 	mockError := errors.New("error")
+	cfg := &config.Config{}
 
-	service := New(mockPgx, mockQuerier, mockGoogleProvider, mockLogger)
+	service := New(mockPgx, mockQuerier, providers, mockTokens, mockRedis, cfg, mockLogger)
 
 	mockCode := "test-auth-code"
-	mockToken := &oauth2.Token{AccessToken: "test-access-token"}
-	mockUserInfo := &oauth.GoogleUserInfo{
+	req := dto.OAuthCallbackRequest{Code: mockCode, State: "test-state"}
+	stateKey := "oauth:state:" + secret.Hash("test-state")
+	expectState := func() {
+		mockRedis.EXPECT().
+			Take(gomock.Any(), stateKey, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, value any) error {
+				*value.(*oauthState) = oauthState{Provider: "google", Verifier: "verifier", Nonce: "nonce"}
+
+				return nil
+			})
+	}
+	mockUserInfo := &oauth.UserInfo{
+		Subject:       "1234567890",
 		Email:         "test@example.com",
+		EmailVerified: true,
 		Name:          "Test User",
 		Picture:       "https://example.com/profile.jpg",
-		VerifiedEmail: true,
 	}
 
 	mockID := uuid.New()
+	mockTokenPair := &dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}
 	mockUser := repository.User{
 		ID:           pgtype.UUID{Bytes: mockID, Valid: true},
 		Email:        "test@example.com",
-		Level:        "1",
 		FullName:     pgtype.Text{String: "Test User", Valid: true},
 		IsVerified:   pgtype.Bool{Bool: true, Valid: true},
 		ProfileImage: pgtype.Text{String: "https://example.com/profile.jpg", Valid: true},
@@ -78,53 +211,190 @@ func TestOauthService_HandleGoogleCallback(t *testing.T) {
 		UpdatedAt:    pgtype.Timestamp{Time: time.Now(), Valid: true},
 	}
 
-	t.Run("error: exchange code failure", func(t *testing.T) {
+	t.Run("error: state does not match the browser", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		res, _, err := service.HandleCallback(ctx, "google", req, "other-state")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: no state cookie", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		res, _, err := service.HandleCallback(ctx, "google", req, "")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: replayed or expired state", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockRedis.EXPECT().Take(gomock.Any(), stateKey, gomock.Any()).Return(redisCache.ErrCacheMiss)
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: failure taking state", func(t *testing.T) {
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
-		mockGoogleProvider.EXPECT().Exchange(mockCode).Return(nil, mockError)
 
-		res, err := service.HandleGoogleCallback(ctx, mockCode)
+		mockRedis.EXPECT().Take(gomock.Any(), stateKey, gomock.Any()).Return(mockError)
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
 	})
 
-	t.Run("error: get user info failure", func(t *testing.T) {
+	t.Run("error: unknown provider", func(t *testing.T) {
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
-		mockGoogleProvider.EXPECT().Exchange(mockCode).Return(mockToken, nil)
-		mockGoogleProvider.EXPECT().GetUserInfo(mockToken).Return(nil, mockError)
 
-		res, err := service.HandleGoogleCallback(ctx, mockCode)
+		res, _, err := service.HandleCallback(ctx, "unknown", req, req.State)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
-		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: state issued for another provider", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockRedis.EXPECT().
+			Take(gomock.Any(), stateKey, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, value any) error {
+				*value.(*oauthState) = oauthState{Provider: "github", Verifier: "verifier", Nonce: "nonce"}
+
+				return nil
+			})
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: exchange code failure", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(nil, mockError)
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: provider returned no email", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(nil, oauth.ErrNoEmail)
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
 	})
 
 	t.Run("error: transaction begin failure", func(t *testing.T) {
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
-		mockGoogleProvider.EXPECT().Exchange(mockCode).Return(mockToken, nil)
-		mockGoogleProvider.EXPECT().GetUserInfo(mockToken).Return(mockUserInfo, nil)
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
 		mockPgx.ExpectBegin().WillReturnError(mockError)
 
-		res, err := service.HandleGoogleCallback(ctx, mockCode)
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
 	})
 
-	t.Run("success: existing user", func(t *testing.T) {
-		mockGoogleProvider.EXPECT().Exchange(mockCode).Return(mockToken, nil)
-		mockGoogleProvider.EXPECT().GetUserInfo(mockToken).Return(mockUserInfo, nil)
+	identityParams := repository.GetUserIdentityParams{Provider: "google", Subject: mockUserInfo.Subject}
+	linkParams := repository.CreateUserIdentityParams{
+		UserID:   mockUser.ID,
+		Provider: "google",
+		Subject:  mockUserInfo.Subject,
+		Email:    mockUserInfo.Email,
+	}
+	expectLogin := func() {
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+		mockTokens.EXPECT().Issue(gomock.Any(), mockUser).Return(mockTokenPair, nil)
+	}
+	reset := func() {
+		mockPgx, _ = pgxmock.NewPool()
+		service = New(mockPgx, mockQuerier, providers, mockTokens, mockRedis, cfg, mockLogger)
+	}
+
+	t.Run("success: linked identity", func(t *testing.T) {
+		reset()
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
 		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{UserID: mockUser.ID, Provider: "google", Subject: mockUserInfo.Subject}, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		expectLogin()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.NoError(t, err)
+		assert.Equal(t, mockTokenPair, res)
+	})
+
+	t.Run("error: linked identity of a deleted user", func(t *testing.T) {
+		reset()
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{UserID: mockUser.ID, Provider: "google", Subject: mockUserInfo.Subject}, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(repository.User{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("success: verified email auto-linked to the existing user", func(t *testing.T) {
+		reset()
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
 		mockQuerier.EXPECT().
 			GetUserByEmail(gomock.Any(), gomock.Any(), mockUserInfo.Email).
 			Return(mockUser, nil)
-		mockPgx.ExpectCommit()
-		mockPgx.ExpectRollback()
+		mockQuerier.EXPECT().
+			CreateUserIdentity(gomock.Any(), gomock.Any(), linkParams).
+			Return(repository.UserIdentity{}, nil)
+		expectLogin()
 
-		res, err := service.HandleGoogleCallback(ctx, mockCode)
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
@@ -132,25 +402,211 @@ func TestOauthService_HandleGoogleCallback(t *testing.T) {
 		assert.NotEmpty(t, res.RefreshToken)
 	})
 
-	t.Run("success: new user", func(t *testing.T) {
-		mockPgx, _ = pgxmock.NewPool()
-		service = New(mockPgx, mockQuerier, mockGoogleProvider, mockLogger)
+	t.Run("error: unverified email of an existing user", func(t *testing.T) {
+		reset()
 
-		mockGoogleProvider.EXPECT().Exchange(mockCode).Return(mockToken, nil)
-		mockGoogleProvider.EXPECT().GetUserInfo(mockToken).Return(mockUserInfo, nil)
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		unverified := *mockUserInfo
+		unverified.EmailVerified = false
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(&unverified, nil)
 		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
 		mockQuerier.EXPECT().
 			GetUserByEmail(gomock.Any(), gomock.Any(), mockUserInfo.Email).
-			Return(repository.User{}, errors.New("user not found"))
+			Return(mockUser, nil)
+		mockPgx.ExpectRollback()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
 
+	t.Run("error: verified email of an unverified existing user", func(t *testing.T) {
+		reset()
+
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		// Registered with the victim's email and a password of the attacker, never verified.
+		squatted := mockUser
+		squatted.IsVerified = pgtype.Bool{Bool: false, Valid: true}
+		squatted.Password = pgtype.Text{String: "attacker-hash", Valid: true}
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
 		mockQuerier.EXPECT().
-			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
-			Return(mockUser, nil)
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), mockUserInfo.Email).
+			Return(squatted, nil)
+		mockPgx.ExpectRollback()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: identity linked to the signed in user", func(t *testing.T) {
+		reset()
+
+		mockRedis.EXPECT().
+			Take(gomock.Any(), stateKey, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, value any) error {
+				*value.(*oauthState) = oauthState{
+					Provider: "google",
+					Verifier: "verifier",
+					Nonce:    "nonce",
+					UserID:   mockUser.ID.String(),
+				}
+
+				return nil
+			})
+
+		// The email differs from the account, and is not verified: linking does not depend on it.
+		other := *mockUserInfo
+		other.Email, other.EmailVerified = "other@example.com", false
+
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(&other, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			CreateUserIdentity(gomock.Any(), gomock.Any(), repository.CreateUserIdentityParams{
+				UserID:   mockUser.ID,
+				Provider: "google",
+				Subject:  mockUserInfo.Subject,
+				Email:    "other@example.com",
+			}).
+			Return(repository.UserIdentity{}, nil)
+		expectLogin()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.NoError(t, err)
+		assert.Equal(t, mockTokenPair, res)
+	})
+
+	t.Run("error: identity linked to another user", func(t *testing.T) {
+		reset()
+
+		mockRedis.EXPECT().
+			Take(gomock.Any(), stateKey, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, value any) error {
+				*value.(*oauthState) = oauthState{
+					Provider: "google",
+					Verifier: "verifier",
+					Nonce:    "nonce",
+					UserID:   mockUser.ID.String(),
+				}
+
+				return nil
+			})
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{UserID: pgtype.UUID{Bytes: uuid.New(), Valid: true}}, nil)
+		mockPgx.ExpectRollback()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: tokens for the redirect uri of the login", func(t *testing.T) {
+		reset()
+
+		mockRedis.EXPECT().
+			Take(gomock.Any(), stateKey, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, value any) error {
+				*value.(*oauthState) = oauthState{
+					Provider:    "google",
+					Verifier:    "verifier",
+					Nonce:       "nonce",
+					RedirectURI: "https://app.example.com/auth/callback",
+				}
+
+				return nil
+			})
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{UserID: mockUser.ID}, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		expectLogin()
+
+		res, redirectURI, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.NoError(t, err)
+		assert.Equal(t, mockTokenPair, res)
+		assert.Equal(t, "https://app.example.com/auth/callback", redirectURI)
+	})
 
+	t.Run("success: mfa challenge", func(t *testing.T) {
+		reset()
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{UserID: mockUser.ID}, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(repository.UserMfa{UserID: mockUser.ID, EnabledAt: pgtype.Timestamp{Time: time.Now(), Valid: true}}, nil)
 		mockPgx.ExpectCommit()
 		mockPgx.ExpectRollback()
+		mockTokens.EXPECT().
+			Challenge(gomock.Any(), mockUser).
+			Return(&dto.UserLoginResponse{MFARequired: true, MFAToken: "mfa"}, nil)
 
-		res, err := service.HandleGoogleCallback(ctx, mockCode)
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.NoError(t, err)
+		assert.True(t, res.MFARequired)
+		assert.Empty(t, res.AccessToken)
+	})
+
+	t.Run("success: new user", func(t *testing.T) {
+		reset()
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), mockUserInfo.Email).
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().
+			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			AssignDefaultRoles(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(nil)
+		mockQuerier.EXPECT().
+			CreateUserIdentity(gomock.Any(), gomock.Any(), linkParams).
+			Return(repository.UserIdentity{}, nil)
+		expectLogin()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, res)
@@ -158,47 +614,103 @@ func TestOauthService_HandleGoogleCallback(t *testing.T) {
 		assert.NotEmpty(t, res.RefreshToken)
 	})
 
-	t.Run("error: create user failure", func(t *testing.T) {
-		mockPgx, _ = pgxmock.NewPool()
-		service = New(mockPgx, mockQuerier, mockGoogleProvider, mockLogger)
+	t.Run("error: unverified email of a new user", func(t *testing.T) {
+		reset()
 
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		unverified := *mockUserInfo
+		unverified.EmailVerified = false
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(&unverified, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), mockUserInfo.Email).
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: create user failure", func(t *testing.T) {
+		reset()
+
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
 
-		mockGoogleProvider.EXPECT().Exchange(mockCode).Return(mockToken, nil)
-		mockGoogleProvider.EXPECT().GetUserInfo(mockToken).Return(mockUserInfo, nil)
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
 		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
 		mockQuerier.EXPECT().
 			GetUserByEmail(gomock.Any(), gomock.Any(), mockUserInfo.Email).
-			Return(repository.User{}, errors.New("user not found"))
+			Return(repository.User{}, pgx.ErrNoRows)
 		mockQuerier.EXPECT().
 			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
 			Return(repository.User{}, mockError)
 		mockPgx.ExpectRollback()
 
-		res, err := service.HandleGoogleCallback(ctx, mockCode)
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
 		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
 	})
 
-	t.Run("error: transaction commit failure", func(t *testing.T) {
-		mockPgx, _ = pgxmock.NewPool()
-		service = New(mockPgx, mockQuerier, mockGoogleProvider, mockLogger)
+	t.Run("error: email of a deleted account", func(t *testing.T) {
+		reset()
 
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
 
-		mockGoogleProvider.EXPECT().Exchange(mockCode).Return(mockToken, nil)
-		mockGoogleProvider.EXPECT().GetUserInfo(mockToken).Return(mockUserInfo, nil)
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
 		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{}, pgx.ErrNoRows)
 		mockQuerier.EXPECT().
 			GetUserByEmail(gomock.Any(), gomock.Any(), mockUserInfo.Email).
-			Return(mockUser, nil)
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().
+			CreateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.User{}, &pgconn.PgError{Code: postgres.UniqueViolation})
+		mockPgx.ExpectRollback()
+
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("error: transaction commit failure", func(t *testing.T) {
+		reset()
+
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
+
+		expectState()
+		mockProvider.EXPECT().Exchange(gomock.Any(), mockCode, "verifier", "nonce").Return(mockUserInfo, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().
+			GetUserIdentity(gomock.Any(), gomock.Any(), identityParams).
+			Return(repository.UserIdentity{UserID: mockUser.ID}, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			GetUserMFA(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(repository.UserMfa{}, pgx.ErrNoRows)
 		mockPgx.ExpectCommit().WillReturnError(mockError)
 		mockPgx.ExpectRollback()
 
-		res, err := service.HandleGoogleCallback(ctx, mockCode)
+		res, _, err := service.HandleCallback(ctx, "google", req, req.State)
 
 		assert.Error(t, err)
 		assert.Nil(t, res)
@@ -0,0 +1,553 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/internal/delivery/http/response"
+	"github.com/savioruz/goth/internal/domains/org/service"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/logger"
+)
+
+var (
+	ErrClaimsNil = errors.New("claims is nil")
+)
+
+type Handler struct {
+	service   service.OrgService
+	logger    logger.Interface
+	validator *validator.Validate
+}
+
+func New(s service.OrgService, l logger.Interface, v *validator.Validate) *Handler {
+	return &Handler{
+		service:   s,
+		logger:    l,
+		validator: v,
+	}
+}
+
+// RegisterRoutes registers the organization routes. requireTenant guards the routes that act in the
+// active organization of the token, and must come after requireAuth.
+func (h *Handler) RegisterRoutes(r fiber.Router, requireAuth, requireTenant fiber.Handler) {
+	r.Post("/organizations", requireAuth, h.CreateOrganization)
+	r.Get("/organizations", requireAuth, h.ListOrganizations)
+	r.Post("/organizations/:id/switch", requireAuth, h.SwitchOrganization)
+
+	current := r.Group("/organizations/current", requireAuth, requireTenant)
+	current.Get("/members", h.ListMembers)
+	current.Patch("/members/:id", h.UpdateMember)
+	current.Delete("/members/:id", h.RemoveMember)
+	current.Post("/invitations", h.Invite)
+	current.Get("/invitations", h.ListInvitations)
+	current.Post("/invitations/:id/resend", h.ResendInvitation)
+	current.Delete("/invitations/:id", h.RevokeInvitation)
+
+	r.Post("/organizations/invitations/accept", h.AcceptInvitationByToken)
+
+	r.Get("/users/me/invitations", requireAuth, h.MyInvitations)
+	r.Post("/users/me/invitations/:id/accept", requireAuth, h.AcceptInvitation)
+	r.Delete("/users/me/invitations/:id", requireAuth, h.DeclineInvitation)
+}
+
+// CreateOrganization godoc
+// @Summary Create organization
+// @Description Create an organization owned by the signed in user
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param organization body dto.CreateOrganizationRequest true "Create organization request"
+// @Success 201 {object} response.Data[dto.OrganizationResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations [post]
+// @Security BearerAuth
+func (h *Handler) CreateOrganization(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - organization - create - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	var req dto.CreateOrganizationRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - v1 - organization - create - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - v1 - organization - create - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.CreateOrganization(ctx.UserContext(), claims, req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - create - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusCreated, data)
+}
+
+// ListOrganizations godoc
+// @Summary List my organizations
+// @Description List the organizations the signed in user is a member of, marking the one the token acts in
+// @Tags organizations
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.OrganizationResponse]
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations [get]
+// @Security BearerAuth
+func (h *Handler) ListOrganizations(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - organization - list - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.service.ListOrganizations(ctx.UserContext(), claims)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - list - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// SwitchOrganization godoc
+// @Summary Switch organization
+// @Description Issue a token pair acting in another organization of the signed in user, within the same session
+// @Tags organizations
+// @Produce json
+// @Param id path string true "Organization ID"
+// @Success 200 {object} response.Data[dto.UserLoginResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/{id}/switch [post]
+// @Security BearerAuth
+func (h *Handler) SwitchOrganization(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - organization - switch - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.service.Switch(ctx.UserContext(), claims, ctx.Params("id"))
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - switch - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// ListMembers godoc
+// @Summary List members
+// @Description List the members of the active organization
+// @Tags organizations
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.MemberResponse]
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/current/members [get]
+// @Security BearerAuth
+func (h *Handler) ListMembers(ctx *fiber.Ctx) error {
+	data, err := h.service.Members(ctx.UserContext())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - list members - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// UpdateMember godoc
+// @Summary Update member
+// @Description Change the role of a member of the active organization. Requires the owner or admin role; only owners make or unmake owners.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param member body dto.UpdateMemberRequest true "Update member request"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/current/members/{id} [patch]
+// @Security BearerAuth
+func (h *Handler) UpdateMember(ctx *fiber.Ctx) error {
+	var req dto.UpdateMemberRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - v1 - organization - update member - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - v1 - organization - update member - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.UpdateMember(ctx.UserContext(), ctx.Params("id"), req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - update member - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// RemoveMember godoc
+// @Summary Remove member
+// @Description Remove a member from the active organization. Requires the owner or admin role, except for leaving it yourself. The last owner cannot leave.
+// @Tags organizations
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/current/members/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) RemoveMember(ctx *fiber.Ctx) error {
+	if err := h.service.RemoveMember(ctx.UserContext(), ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - remove member - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// Invite godoc
+// @Summary Invite member
+// @Description Invite an email address to the active organization and email it a link to accept. Inviting it again replaces the invitation. Requires the owner or admin role.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param invitation body dto.InviteMemberRequest true "Invite member request"
+// @Success 201 {object} response.Data[dto.InvitationResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/current/invitations [post]
+// @Security BearerAuth
+func (h *Handler) Invite(ctx *fiber.Ctx) error {
+	var req dto.InviteMemberRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - v1 - organization - invite - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - v1 - organization - invite - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.Invite(ctx.UserContext(), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - invite - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusCreated, data)
+}
+
+// ListInvitations godoc
+// @Summary List invitations
+// @Description List the invitations of the active organization with their status. Requires the owner or admin role.
+// @Tags organizations
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.InvitationResponse]
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/current/invitations [get]
+// @Security BearerAuth
+func (h *Handler) ListInvitations(ctx *fiber.Ctx) error {
+	data, err := h.service.Invitations(ctx.UserContext())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - list invitations - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// ResendInvitation godoc
+// @Summary Resend invitation
+// @Description Email a pending invitation of the active organization again. Links sent before stop working and the expiry starts over. Requires the owner or admin role.
+// @Tags organizations
+// @Produce json
+// @Param id path string true "Invitation ID"
+// @Success 200 {object} response.Data[dto.InvitationResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/current/invitations/{id}/resend [post]
+// @Security BearerAuth
+func (h *Handler) ResendInvitation(ctx *fiber.Ctx) error {
+	data, err := h.service.ResendInvitation(ctx.UserContext(), ctx.Params("id"))
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - resend invitation - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// RevokeInvitation godoc
+// @Summary Revoke invitation
+// @Description Withdraw a pending invitation of the active organization. Requires the owner or admin role.
+// @Tags organizations
+// @Produce json
+// @Param id path string true "Invitation ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/current/invitations/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) RevokeInvitation(ctx *fiber.Ctx) error {
+	if err := h.service.RevokeInvitation(ctx.UserContext(), ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - revoke invitation - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// AcceptInvitationByToken godoc
+// @Summary Accept invitation by token
+// @Description Accept an invitation with the token from its email. The invited address joins with its account, or with a new one created from name and password when it has none. The address is marked as verified.
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param invitation body dto.AcceptInvitationRequest true "Accept invitation request"
+// @Success 200 {object} response.Data[dto.AcceptInvitationResponse]
+// @Failure 400 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /organizations/invitations/accept [post]
+func (h *Handler) AcceptInvitationByToken(ctx *fiber.Ctx) error {
+	var req dto.AcceptInvitationRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - v1 - organization - accept invitation by token - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - v1 - organization - accept invitation by token - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.AcceptInvitationByToken(ctx.UserContext(), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - accept invitation by token - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// MyInvitations godoc
+// @Summary List my invitations
+// @Description List the invitations to the email address of the signed in user
+// @Tags users
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.InvitationResponse]
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/invitations [get]
+// @Security BearerAuth
+func (h *Handler) MyInvitations(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - organization - my invitations - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.service.MyInvitations(ctx.UserContext(), claims)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - my invitations - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// AcceptInvitation godoc
+// @Summary Accept invitation
+// @Description Join the organization that invited the email address of the signed in user. The address must be verified.
+// @Tags users
+// @Produce json
+// @Param id path string true "Invitation ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/invitations/{id}/accept [post]
+// @Security BearerAuth
+func (h *Handler) AcceptInvitation(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - organization - accept invitation - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.AcceptInvitation(ctx.UserContext(), claims, ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - accept invitation - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// DeclineInvitation godoc
+// @Summary Decline invitation
+// @Description Decline an invitation to the email address of the signed in user
+// @Tags users
+// @Produce json
+// @Param id path string true "Invitation ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/invitations/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) DeclineInvitation(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - organization - decline invitation - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.DeclineInvitation(ctx.UserContext(), claims, ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - organization - decline invitation - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
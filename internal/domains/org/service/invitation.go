@@ -0,0 +1,595 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/authz"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/secret"
+	"github.com/savioruz/goth/pkg/tenant"
+)
+
+const (
+	invitationPending  = "pending"
+	invitationAccepted = "accepted"
+	invitationDeclined = "declined"
+
+	auditInvitationCreated  = "invitation.created"
+	auditInvitationResent   = "invitation.resent"
+	auditInvitationRevoked  = "invitation.revoked"
+	auditInvitationAccepted = "invitation.accepted"
+	auditInvitationDeclined = "invitation.declined"
+)
+
+// Invite invites an email address to join the organization with a role, and emails it a link to accept
+// the invitation. Inviting an address again replaces its invitation.
+func (s *orgService) Invite(ctx context.Context, req dto.InviteMemberRequest) (*dto.InvitationResponse, error) {
+	t, orgID, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authorize(ctx, t, "org:invite", authz.Resource{
+		Type:       "organization",
+		ID:         t.OrgID,
+		Attributes: map[string]any{"role": req.Role, "member_role": ""},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.repo.GetMemberByEmail(ctx, s.db, repository.GetMemberByEmailParams{OrgID: orgID, Email: req.Email})
+	if err == nil {
+		return nil, failure.Conflict("already a member")
+	}
+
+	if !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("invite - service - failed to get member: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	token, hash, err := secret.NewToken()
+	if err != nil {
+		s.logger.Error("invite - service - failed to generate token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	inviter, _ := parseID(t.UserID)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("invite - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("invite - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	org, err := s.repo.GetOrganization(ctx, tx, orgID)
+	if err != nil {
+		s.logger.Error("invite - service - failed to get organization: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	invitation, err := s.repo.CreateInvitation(ctx, tx, repository.CreateInvitationParams{
+		OrgID:     orgID,
+		Email:     req.Email,
+		Role:      req.Role,
+		InvitedBy: inviter,
+		TokenHash: hash,
+		Expiry:    s.expiry,
+	})
+	if err != nil {
+		s.logger.Error("invite - service - failed to create invitation: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.record(ctx, tx, auditInvitationCreated, inviter, invitation); err != nil {
+		s.logger.Error("invite - service - failed to record audit log: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("invite - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	// The invitation exists at this point; a failed delivery can be retried through the resend endpoint.
+	if err = s.notifier.SendInvitation(ctx, invitation.Email, org.Name, token); err != nil {
+		s.logger.Error("invite - service - failed to send invitation: %w", err)
+	}
+
+	return new(dto.InvitationResponse).ToInvitationResponse(invitation), nil
+}
+
+func (s *orgService) Invitations(ctx context.Context) ([]*dto.InvitationResponse, error) {
+	t, orgID, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authorize(ctx, t, "org:invitations:read", authz.Resource{Type: "organization", ID: t.OrgID})
+	if err != nil {
+		return nil, err
+	}
+
+	invitations, err := s.repo.ListInvitations(ctx, s.db, orgID)
+	if err != nil {
+		s.logger.Error("invitations - service - failed to list invitations: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := make([]*dto.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		res = append(res, new(dto.InvitationResponse).ToInvitationResponse(invitation))
+	}
+
+	return res, nil
+}
+
+// ResendInvitation emails a pending invitation again with a new token, so that earlier links stop
+// working, and starts its expiry over.
+func (s *orgService) ResendInvitation(ctx context.Context, invitationID string) (*dto.InvitationResponse, error) {
+	t, orgID, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(invitationID)
+	if err != nil {
+		return nil, failure.BadRequestFromString("invalid invitation id")
+	}
+
+	token, hash, err := secret.NewToken()
+	if err != nil {
+		s.logger.Error("resend invitation - service - failed to generate token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("resend invitation - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("resend invitation - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	if _, err = s.pendingInvitation(ctx, tx, t, "org:invitations:resend", orgID, id); err != nil {
+		return nil, err
+	}
+
+	org, err := s.repo.GetOrganization(ctx, tx, orgID)
+	if err != nil {
+		s.logger.Error("resend invitation - service - failed to get organization: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	invitation, err := s.repo.RenewInvitation(ctx, tx, repository.RenewInvitationParams{
+		ID:        id,
+		TokenHash: hash,
+		Expiry:    s.expiry,
+	})
+	if err != nil {
+		s.logger.Error("resend invitation - service - failed to renew invitation: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	actor, _ := parseID(t.UserID)
+
+	if err = s.record(ctx, tx, auditInvitationResent, actor, invitation); err != nil {
+		s.logger.Error("resend invitation - service - failed to record audit log: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("resend invitation - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.notifier.SendInvitation(ctx, invitation.Email, org.Name, token); err != nil {
+		s.logger.Error("resend invitation - service - failed to send invitation: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.InvitationResponse).ToInvitationResponse(invitation), nil
+}
+
+// RevokeInvitation withdraws a pending invitation, so that it can no longer be accepted.
+func (s *orgService) RevokeInvitation(ctx context.Context, invitationID string) error {
+	t, orgID, err := current(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseID(invitationID)
+	if err != nil {
+		return failure.BadRequestFromString("invalid invitation id")
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("revoke invitation - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("revoke invitation - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	invitation, err := s.pendingInvitation(ctx, tx, t, "org:invitations:revoke", orgID, id)
+	if err != nil {
+		return err
+	}
+
+	if err = s.repo.RevokeInvitation(ctx, tx, id); err != nil {
+		s.logger.Error("revoke invitation - service - failed to revoke invitation: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	actor, _ := parseID(t.UserID)
+
+	if err = s.record(ctx, tx, auditInvitationRevoked, actor, invitation); err != nil {
+		s.logger.Error("revoke invitation - service - failed to record audit log: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("revoke invitation - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// MyInvitations lists the pending invitations to the email address of the user.
+func (s *orgService) MyInvitations(ctx context.Context, claims *jwt.Claims) ([]*dto.InvitationResponse, error) {
+	// Invitations belong to the organizations that made them, not to the invitee.
+	invitations, err := s.repo.ListUserInvitations(postgres.CrossTenant(ctx), s.db, claims.Email)
+	if err != nil {
+		s.logger.Error("my invitations - service - failed to list invitations: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := make([]*dto.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		res = append(res, new(dto.InvitationResponse).ToUserInvitationResponse(invitation))
+	}
+
+	return res, nil
+}
+
+// AcceptInvitation makes the user a member of the organization that invited their email address.
+// Only the verified owner of the address may accept.
+func (s *orgService) AcceptInvitation(ctx context.Context, claims *jwt.Claims, invitationID string) error {
+	id, err := parseID(invitationID)
+	if err != nil {
+		return failure.BadRequestFromString("invalid invitation id")
+	}
+
+	userID, err := parseID(claims.ID)
+	if err != nil {
+		return failure.Unauthorized("invalid token subject")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, s.db, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return failure.Unauthorized("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("accept invitation - service - failed to get user: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if !user.IsVerified.Bool {
+		return failure.Forbidden("verify your email address first")
+	}
+
+	// The user is not a member of the organization yet, so the transaction is cross-tenant.
+	tx, err := s.db.Begin(postgres.CrossTenant(ctx))
+	if err != nil {
+		s.logger.Error("accept invitation - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("accept invitation - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	if _, err = s.join(ctx, tx, user, id); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("accept invitation - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// AcceptInvitationByToken accepts an emailed invitation. The invited address joins with its account,
+// or with one registered from the name and password of the request when it has none yet. Following
+// the emailed link proves ownership of the address, so it is marked as verified. A new account is
+// only kept when it joins.
+func (s *orgService) AcceptInvitationByToken(
+	ctx context.Context,
+	req dto.AcceptInvitationRequest,
+) (*dto.AcceptInvitationResponse, error) {
+	tx, err := s.db.Begin(postgres.CrossTenant(ctx))
+	if err != nil {
+		s.logger.Error("accept invitation - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("accept invitation - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	invitation, err := s.repo.GetInvitationByToken(ctx, tx, secret.Hash(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.BadRequestFromString("invalid or expired invitation")
+	}
+
+	if err != nil {
+		s.logger.Error("accept invitation - service - failed to get invitation by token: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, tx, invitation.Email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("accept invitation - service - failed to get user by email: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	created := user.Email == ""
+	if created {
+		if req.Name == "" || req.Password == "" {
+			return nil, failure.BadRequestFromString("name and password are required to create an account")
+		}
+
+		user, err = s.auth.RegisterInvited(ctx, tx, dto.UserRegisterRequest{
+			Email:    invitation.Email,
+			Password: req.Password,
+			Name:     req.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	invitation, err = s.join(ctx, tx, user, invitation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("accept invitation - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return &dto.AcceptInvitationResponse{
+		OrgID:          invitation.OrgID.String(),
+		UserID:         user.ID.String(),
+		AccountCreated: created,
+	}, nil
+}
+
+func (s *orgService) DeclineInvitation(ctx context.Context, claims *jwt.Claims, invitationID string) error {
+	id, err := parseID(invitationID)
+	if err != nil {
+		return failure.BadRequestFromString("invalid invitation id")
+	}
+
+	userID, err := parseID(claims.ID)
+	if err != nil {
+		return failure.Unauthorized("invalid token subject")
+	}
+
+	tx, err := s.db.Begin(postgres.CrossTenant(ctx))
+	if err != nil {
+		s.logger.Error("decline invitation - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("decline invitation - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	invitation, err := s.repo.RespondToInvitation(ctx, tx, repository.RespondToInvitationParams{
+		ID:     id,
+		Email:  claims.Email,
+		Status: invitationDeclined,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return failure.NotFound("invitation not found")
+	}
+
+	if err != nil {
+		s.logger.Error("decline invitation - service - failed to decline invitation: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.record(ctx, tx, auditInvitationDeclined, userID, invitation); err != nil {
+		s.logger.Error("decline invitation - service - failed to record audit log: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("decline invitation - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// join accepts a pending invitation to the email address of the user in the transaction and makes
+// them a member with the invited role. The address is marked as verified if it is not yet.
+func (s *orgService) join(
+	ctx context.Context,
+	tx pgx.Tx,
+	user repository.User,
+	invitationID pgtype.UUID,
+) (repository.OrganizationInvitation, error) {
+	invitation, err := s.repo.RespondToInvitation(ctx, tx, repository.RespondToInvitationParams{
+		ID:     invitationID,
+		Email:  user.Email,
+		Status: invitationAccepted,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.OrganizationInvitation{}, failure.NotFound("invitation not found")
+	}
+
+	if err != nil {
+		s.logger.Error("accept invitation - service - failed to accept invitation: %w", err)
+
+		return repository.OrganizationInvitation{}, failure.InternalError(err)
+	}
+
+	err = s.repo.AddMember(ctx, tx, repository.AddMemberParams{
+		OrgID:  invitation.OrgID,
+		UserID: user.ID,
+		Role:   invitation.Role,
+	})
+	if err != nil {
+		s.logger.Error("accept invitation - service - failed to add member: %w", err)
+
+		return repository.OrganizationInvitation{}, failure.InternalError(err)
+	}
+
+	if !user.IsVerified.Bool {
+		if _, err = s.repo.VerifyEmail(ctx, tx, user.ID); err != nil {
+			s.logger.Error("accept invitation - service - failed to verify email: %w", err)
+
+			return repository.OrganizationInvitation{}, failure.InternalError(err)
+		}
+	}
+
+	if err = s.record(ctx, tx, auditInvitationAccepted, user.ID, invitation); err != nil {
+		s.logger.Error("accept invitation - service - failed to record audit log: %w", err)
+
+		return repository.OrganizationInvitation{}, failure.InternalError(err)
+	}
+
+	return invitation, nil
+}
+
+// pendingInvitation locks an invitation of the tenant for the rest of the transaction, once the
+// member may perform the action on it. Only pending invitations, expired or not, can be changed.
+func (s *orgService) pendingInvitation(
+	ctx context.Context,
+	db repository.DBTX,
+	t tenant.Tenant,
+	action string,
+	orgID, id pgtype.UUID,
+) (repository.OrganizationInvitation, error) {
+	invitation, err := s.repo.GetInvitationForUpdate(ctx, db, repository.GetInvitationForUpdateParams{ID: id, OrgID: orgID})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.OrganizationInvitation{}, failure.NotFound("invitation not found")
+	}
+
+	if err != nil {
+		s.logger.Error("invitation - service - failed to get invitation: %w", err)
+
+		return repository.OrganizationInvitation{}, failure.InternalError(err)
+	}
+
+	err = s.authorize(ctx, t, action, authz.Resource{
+		Type:       "invitation",
+		ID:         invitation.ID.String(),
+		Attributes: map[string]any{"role": invitation.Role, "member_role": ""},
+	})
+	if err != nil {
+		return repository.OrganizationInvitation{}, err
+	}
+
+	if invitation.Status != invitationPending {
+		return repository.OrganizationInvitation{}, failure.Conflict("invitation is " + invitation.Status)
+	}
+
+	return invitation, nil
+}
+
+// record adds an entry about a change of the invitation to the audit log. It is written in the
+// transaction of the change, so that neither is kept without the other.
+func (s *orgService) record(
+	ctx context.Context,
+	db repository.DBTX,
+	action string,
+	actor pgtype.UUID,
+	invitation repository.OrganizationInvitation,
+) error {
+	metadata, err := json.Marshal(map[string]string{"email": invitation.Email, "role": invitation.Role})
+	if err != nil {
+		return err
+	}
+
+	return s.repo.CreateAuditLog(ctx, db, repository.CreateAuditLogParams{
+		OrgID:      invitation.OrgID,
+		ActorID:    actor,
+		Action:     action,
+		TargetType: "invitation",
+		TargetID:   invitation.ID,
+		Metadata:   metadata,
+	})
+}
@@ -0,0 +1,553 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/secret"
+	"github.com/savioruz/goth/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// audited expects an audit entry of the action about the invitation.
+func audited(mockQuerier *mock.MockQuerier, action string, actor, invitationID pgtype.UUID) {
+	mockQuerier.EXPECT().CreateAuditLog(gomock.Any(), gomock.Any(), gomock.Cond(func(arg repository.CreateAuditLogParams) bool {
+		return arg.Action == action && arg.ActorID == actor && arg.TargetType == "invitation" && arg.TargetID == invitationID
+	})).Return(nil)
+}
+
+func TestOrgService_Invite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	actor := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	req := dto.InviteMemberRequest{Email: "bob@example.com", Role: RoleMember}
+	byEmail := repository.GetMemberByEmailParams{OrgID: orgID, Email: "bob@example.com"}
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, nil, mockNotifier, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	as := func(role string) context.Context {
+		return tenant.NewContext(context.Background(), tenant.Tenant{OrgID: orgID.String(), UserID: actor.String(), Role: role})
+	}
+
+	t.Run("error: members cannot invite", func(t *testing.T) {
+		service, _ := newService()
+
+		res, err := service.Invite(as(RoleMember), req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: already a member", func(t *testing.T) {
+		service, _ := newService()
+
+		mockQuerier.EXPECT().GetMemberByEmail(gomock.Any(), gomock.Any(), byEmail).
+			Return(repository.OrganizationMember{OrgID: orgID}, nil)
+
+		res, err := service.Invite(as(RoleAdmin), req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: hashed token is emailed and the invitation audited", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		var params repository.CreateInvitationParams
+
+		invitation := repository.OrganizationInvitation{
+			ID:     pgtype.UUID{Bytes: uuid.New(), Valid: true},
+			OrgID:  orgID,
+			Email:  "bob@example.com",
+			Role:   RoleMember,
+			Status: invitationPending,
+		}
+
+		mockQuerier.EXPECT().GetMemberByEmail(gomock.Any(), gomock.Any(), byEmail).
+			Return(repository.OrganizationMember{}, pgx.ErrNoRows)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetOrganization(gomock.Any(), gomock.Any(), orgID).
+			Return(repository.Organization{ID: orgID, Name: "Acme"}, nil)
+		mockQuerier.EXPECT().CreateInvitation(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateInvitationParams) (repository.OrganizationInvitation, error) {
+				params = arg
+
+				return invitation, nil
+			})
+		audited(mockQuerier, auditInvitationCreated, actor, invitation.ID)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+		mockNotifier.EXPECT().SendInvitation(gomock.Any(), "bob@example.com", "Acme", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _, _, token string) error {
+				assert.Equal(t, secret.Hash(token), params.TokenHash)
+
+				return nil
+			})
+
+		res, err := service.Invite(as(RoleAdmin), req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, invitation.ID.String(), res.ID)
+		assert.Equal(t, actor, params.InvitedBy)
+		assert.Equal(t, RoleMember, params.Role)
+		assert.Equal(t, int64(7*24*60*60*1000000), params.Expiry.Microseconds)
+	})
+}
+
+func TestOrgService_ResendInvitation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	actor := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	invitation := repository.OrganizationInvitation{
+		ID:        pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		OrgID:     orgID,
+		Email:     "bob@example.com",
+		Role:      RoleMember,
+		TokenHash: "old",
+		Status:    invitationPending,
+	}
+	lock := repository.GetInvitationForUpdateParams{ID: invitation.ID, OrgID: orgID}
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, nil, mockNotifier, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	as := func(role string) context.Context {
+		return tenant.NewContext(context.Background(), tenant.Tenant{OrgID: orgID.String(), UserID: actor.String(), Role: role})
+	}
+
+	t.Run("error: members cannot resend", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationForUpdate(gomock.Any(), gomock.Any(), lock).Return(invitation, nil)
+		mockPgx.ExpectRollback()
+
+		res, err := service.ResendInvitation(as(RoleMember), invitation.ID.String())
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: invitation of another organization is not found", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationForUpdate(gomock.Any(), gomock.Any(), lock).
+			Return(repository.OrganizationInvitation{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		res, err := service.ResendInvitation(as(RoleAdmin), invitation.ID.String())
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: accepted invitation", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		accepted := invitation
+		accepted.Status = invitationAccepted
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationForUpdate(gomock.Any(), gomock.Any(), lock).Return(accepted, nil)
+		mockPgx.ExpectRollback()
+
+		res, err := service.ResendInvitation(as(RoleAdmin), invitation.ID.String())
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: new token is emailed", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		var params repository.RenewInvitationParams
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationForUpdate(gomock.Any(), gomock.Any(), lock).Return(invitation, nil)
+		mockQuerier.EXPECT().GetOrganization(gomock.Any(), gomock.Any(), orgID).
+			Return(repository.Organization{ID: orgID, Name: "Acme"}, nil)
+		mockQuerier.EXPECT().RenewInvitation(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.RenewInvitationParams) (repository.OrganizationInvitation, error) {
+				params = arg
+
+				return invitation, nil
+			})
+		audited(mockQuerier, auditInvitationResent, actor, invitation.ID)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+		mockNotifier.EXPECT().SendInvitation(gomock.Any(), "bob@example.com", "Acme", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _, _, token string) error {
+				assert.Equal(t, secret.Hash(token), params.TokenHash)
+
+				return nil
+			})
+
+		res, err := service.ResendInvitation(as(RoleAdmin), invitation.ID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, invitation.ID.String(), res.ID)
+		assert.Equal(t, invitation.ID, params.ID)
+		assert.NotEqual(t, "old", params.TokenHash)
+	})
+}
+
+func TestOrgService_RevokeInvitation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	actor := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	invitation := repository.OrganizationInvitation{
+		ID:     pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		OrgID:  orgID,
+		Email:  "bob@example.com",
+		Role:   RoleOwner,
+		Status: invitationPending,
+	}
+	lock := repository.GetInvitationForUpdateParams{ID: invitation.ID, OrgID: orgID}
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, nil, nil, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	as := func(role string) context.Context {
+		return tenant.NewContext(context.Background(), tenant.Tenant{OrgID: orgID.String(), UserID: actor.String(), Role: role})
+	}
+
+	t.Run("error: admins cannot revoke owner invitations", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationForUpdate(gomock.Any(), gomock.Any(), lock).Return(invitation, nil)
+		mockPgx.ExpectRollback()
+
+		err := service.RevokeInvitation(as(RoleAdmin), invitation.ID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("success: revocation is audited", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationForUpdate(gomock.Any(), gomock.Any(), lock).Return(invitation, nil)
+		mockQuerier.EXPECT().RevokeInvitation(gomock.Any(), gomock.Any(), invitation.ID).Return(nil)
+		mockQuerier.EXPECT().CreateAuditLog(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateAuditLogParams) error {
+				var metadata map[string]string
+				assert.NoError(t, json.Unmarshal(arg.Metadata, &metadata))
+				assert.Equal(t, auditInvitationRevoked, arg.Action)
+				assert.Equal(t, orgID, arg.OrgID)
+				assert.Equal(t, map[string]string{"email": "bob@example.com", "role": RoleOwner}, metadata)
+
+				return nil
+			})
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.RevokeInvitation(as(RoleOwner), invitation.ID.String())
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestOrgService_AcceptInvitation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), Email: "bob@example.com"}
+	verified := repository.User{ID: userID, Email: "bob@example.com", IsVerified: pgtype.Bool{Bool: true, Valid: true}}
+	invitation := repository.OrganizationInvitation{
+		ID:    pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		OrgID: pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email: "bob@example.com",
+		Role:  RoleAdmin,
+	}
+	accept := repository.RespondToInvitationParams{ID: invitation.ID, Email: "bob@example.com", Status: invitationAccepted}
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, nil, nil, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	t.Run("error: email not verified", func(t *testing.T) {
+		service, _ := newService()
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).
+			Return(repository.User{ID: userID, Email: "bob@example.com"}, nil)
+
+		err := service.AcceptInvitation(ctx, claims, invitation.ID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: invitation to someone else", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(verified, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().RespondToInvitation(gomock.Any(), gomock.Any(), accept).
+			Return(repository.OrganizationInvitation{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		err := service.AcceptInvitation(ctx, claims, invitation.ID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: joined with the invited role", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(verified, nil)
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().RespondToInvitation(gomock.Any(), gomock.Any(), accept).Return(invitation, nil)
+		mockQuerier.EXPECT().
+			AddMember(gomock.Any(), gomock.Any(), repository.AddMemberParams{OrgID: invitation.OrgID, UserID: userID, Role: RoleAdmin}).
+			Return(nil)
+		audited(mockQuerier, auditInvitationAccepted, userID, invitation.ID)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.AcceptInvitation(ctx, claims, invitation.ID.String())
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestOrgService_AcceptInvitationByToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockAuth := authMock.NewMockAuthService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	invitation := repository.OrganizationInvitation{
+		ID:     pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		OrgID:  pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email:  "bob@example.com",
+		Role:   RoleMember,
+		Status: invitationPending,
+	}
+	accept := repository.RespondToInvitationParams{ID: invitation.ID, Email: "bob@example.com", Status: invitationAccepted}
+	member := repository.AddMemberParams{OrgID: invitation.OrgID, UserID: userID, Role: RoleMember}
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, mockAuth, nil, nil, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	t.Run("error: invalid or expired token", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationByToken(gomock.Any(), gomock.Any(), secret.Hash("token")).
+			Return(repository.OrganizationInvitation{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		res, err := service.AcceptInvitationByToken(ctx, dto.AcceptInvitationRequest{Token: "token"})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+		assert.NoError(t, mockPgx.ExpectationsWereMet())
+	})
+
+	t.Run("error: new account needs a password", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationByToken(gomock.Any(), gomock.Any(), secret.Hash("token")).Return(invitation, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "bob@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		res, err := service.AcceptInvitationByToken(ctx, dto.AcceptInvitationRequest{Token: "token", Name: "Bob"})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success: existing account joins", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		user := repository.User{ID: userID, Email: "bob@example.com", IsVerified: pgtype.Bool{Bool: true, Valid: true}}
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationByToken(gomock.Any(), gomock.Any(), secret.Hash("token")).Return(invitation, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "bob@example.com").Return(user, nil)
+		mockQuerier.EXPECT().RespondToInvitation(gomock.Any(), gomock.Any(), accept).Return(invitation, nil)
+		mockQuerier.EXPECT().AddMember(gomock.Any(), gomock.Any(), member).Return(nil)
+		audited(mockQuerier, auditInvitationAccepted, userID, invitation.ID)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		res, err := service.AcceptInvitationByToken(ctx, dto.AcceptInvitationRequest{Token: "token"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, invitation.OrgID.String(), res.OrgID)
+		assert.Equal(t, userID.String(), res.UserID)
+		assert.False(t, res.AccountCreated)
+	})
+
+	register := dto.UserRegisterRequest{
+		Email:    "bob@example.com",
+		Password: "correct horse battery staple",
+		Name:     "Bob",
+	}
+	accepted := dto.AcceptInvitationRequest{Token: "token", Name: "Bob", Password: "correct horse battery staple"}
+
+	t.Run("error: rejected registration leaves nothing behind", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationByToken(gomock.Any(), gomock.Any(), secret.Hash("token")).Return(invitation, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "bob@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockAuth.EXPECT().RegisterInvited(gomock.Any(), gomock.Any(), register).
+			Return(repository.User{}, failure.BadRequestFromString("password does not meet the password policy"))
+		mockPgx.ExpectRollback()
+
+		res, err := service.AcceptInvitationByToken(ctx, accepted)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+		assert.NoError(t, mockPgx.ExpectationsWereMet())
+	})
+
+	t.Run("error: account is not kept when joining fails", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationByToken(gomock.Any(), gomock.Any(), secret.Hash("token")).Return(invitation, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "bob@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockAuth.EXPECT().RegisterInvited(gomock.Any(), gomock.Any(), register).
+			Return(repository.User{ID: userID, Email: "bob@example.com", IsVerified: pgtype.Bool{Bool: true, Valid: true}}, nil)
+		mockQuerier.EXPECT().RespondToInvitation(gomock.Any(), gomock.Any(), accept).
+			Return(repository.OrganizationInvitation{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		res, err := service.AcceptInvitationByToken(ctx, accepted)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+		assert.NoError(t, mockPgx.ExpectationsWereMet())
+	})
+
+	t.Run("success: account is registered verified in the same transaction", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().GetInvitationByToken(gomock.Any(), gomock.Any(), secret.Hash("token")).Return(invitation, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), "bob@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockAuth.EXPECT().RegisterInvited(gomock.Any(), gomock.Any(), register).
+			Return(repository.User{ID: userID, Email: "bob@example.com", IsVerified: pgtype.Bool{Bool: true, Valid: true}}, nil)
+		mockQuerier.EXPECT().RespondToInvitation(gomock.Any(), gomock.Any(), accept).Return(invitation, nil)
+		mockQuerier.EXPECT().AddMember(gomock.Any(), gomock.Any(), member).Return(nil)
+		audited(mockQuerier, auditInvitationAccepted, userID, invitation.ID)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		res, err := service.AcceptInvitationByToken(ctx, accepted)
+
+		assert.NoError(t, err)
+		assert.Equal(t, userID.String(), res.UserID)
+		assert.True(t, res.AccountCreated)
+		assert.NoError(t, mockPgx.ExpectationsWereMet())
+	})
+}
+
+func TestOrgService_DeclineInvitation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), Email: "bob@example.com"}
+	invitation := repository.OrganizationInvitation{
+		ID:    pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		OrgID: pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		Email: "bob@example.com",
+		Role:  RoleMember,
+	}
+	decline := repository.RespondToInvitationParams{ID: invitation.ID, Email: "bob@example.com", Status: invitationDeclined}
+
+	mockPgx, _ := pgxmock.NewPool()
+	service := New(mockPgx, mockQuerier, nil, nil, nil, newEnforcer(t), newConfig(), mockLogger)
+
+	t.Run("success: decline is audited", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().RespondToInvitation(gomock.Any(), gomock.Any(), decline).Return(invitation, nil)
+		audited(mockQuerier, auditInvitationDeclined, userID, invitation.ID)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.DeclineInvitation(ctx, claims, invitation.ID.String())
+
+		assert.NoError(t, err)
+	})
+}
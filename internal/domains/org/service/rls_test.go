@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRowLevelSecurity runs the migrations against the database of TEST_DATABASE_URL, in a schema of
+// its own, and connects to it as an ordinary role the way the application does. It shows that a
+// scoped query, in a transaction or not, cannot see or join another organization, and that nothing is
+// visible without a scope. The user of the URL must be a superuser, since the migrations create a
+// role with BYPASSRLS.
+func TestRowLevelSecurity(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	suffix := strings.ReplaceAll(uuid.NewString(), "-", "")
+	schema, role := "rls_"+suffix, "rls_"+suffix
+
+	config, err := pgxpool.ParseConfig(dsn)
+	require.NoError(t, err)
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+
+	admin, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	t.Cleanup(admin.Close)
+
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema+"; CREATE ROLE "+role+" LOGIN PASSWORD '"+suffix+"'")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE; DROP ROLE "+role)
+	})
+
+	migrate(t, admin)
+
+	_, err = admin.Exec(ctx, "GRANT USAGE ON SCHEMA "+schema+" TO "+role+
+		"; GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA "+schema+" TO "+role+
+		"; GRANT "+postgres.CrossTenantRole+" TO "+role)
+	require.NoError(t, err)
+
+	appConfig := config.Copy()
+	appConfig.ConnConfig.User = role
+	appConfig.ConnConfig.Password = suffix
+
+	pool, err := pgxpool.NewWithConfig(ctx, appConfig)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	repo := repository.New()
+	alice, bob := createUser(t, admin, "alice@a.example"), createUser(t, admin, "bob@b.example")
+	orgA, orgB := createOrganization(t, admin, "a", alice), createOrganization(t, admin, "b", bob)
+
+	_, err = repo.CreateInvitation(ctx, admin, repository.CreateInvitationParams{
+		OrgID:     orgB,
+		Email:     "carol@b.example",
+		Role:      RoleMember,
+		TokenHash: "hash",
+		Expiry:    pgtype.Interval{Days: 7, Valid: true},
+	})
+	require.NoError(t, err)
+
+	db := postgres.Scoped(pool)
+	inA := postgres.WithScope(ctx, postgres.Scope{UserID: alice.String(), TenantID: orgA.String()})
+
+	// begin starts a transaction of the scope, for the queries the application runs in one.
+	begin := func(t *testing.T, ctx context.Context) pgx.Tx {
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = tx.Rollback(context.Background()) })
+
+		return tx
+	}
+
+	t.Run("success: own tenant is visible", func(t *testing.T) {
+		members, err := repo.ListMembers(inA, db, orgA)
+		assert.NoError(t, err)
+		assert.Len(t, members, 1)
+
+		members, err = repo.ListMembers(inA, begin(t, inA), orgA)
+		assert.NoError(t, err)
+		assert.Len(t, members, 1)
+	})
+
+	for name, dbtx := range map[string]func(t *testing.T) repository.DBTX{
+		"outside of a transaction": func(*testing.T) repository.DBTX { return db },
+		"in a transaction":         func(t *testing.T) repository.DBTX { return begin(t, inA) },
+	} {
+		t.Run("error: another tenant cannot be read "+name, func(t *testing.T) {
+			db := dbtx(t)
+
+			members, err := repo.ListMembers(inA, db, orgB)
+			assert.NoError(t, err)
+			assert.Empty(t, members)
+
+			_, err = repo.GetMember(inA, db, repository.GetMemberParams{OrgID: orgB, UserID: bob})
+			assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+			_, err = repo.GetOrganization(inA, db, orgB)
+			assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+			invitations, err := repo.ListInvitations(inA, db, orgB)
+			assert.NoError(t, err)
+			assert.Empty(t, invitations)
+		})
+	}
+
+	t.Run("error: another tenant cannot be joined", func(t *testing.T) {
+		err := repo.AddMember(inA, begin(t, inA), repository.AddMemberParams{OrgID: orgB, UserID: alice, Role: RoleOwner})
+
+		var pgErr *pgconn.PgError
+		assert.True(t, errors.As(err, &pgErr))
+		assert.Equal(t, "42501", pgErr.Code)
+	})
+
+	t.Run("error: nothing is visible without a scope", func(t *testing.T) {
+		members, err := repo.ListMembers(ctx, db, orgA)
+		assert.NoError(t, err)
+		assert.Empty(t, members)
+
+		_, err = repo.GetOrganization(ctx, db, orgA)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+
+		invitations, err := repo.ListInvitations(ctx, db, orgB)
+		assert.NoError(t, err)
+		assert.Empty(t, invitations)
+	})
+
+	t.Run("success: a user sees their own organizations", func(t *testing.T) {
+		ctx := postgres.WithScope(ctx, postgres.Scope{UserID: alice.String()})
+
+		orgs, err := repo.ListUserOrganizations(ctx, db, alice)
+		assert.NoError(t, err)
+		assert.Len(t, orgs, 1)
+
+		_, err = repo.GetMember(ctx, db, repository.GetMemberParams{OrgID: orgB, UserID: bob})
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	t.Run("success: cross-tenant queries see every organization", func(t *testing.T) {
+		ctx := postgres.CrossTenant(ctx)
+
+		invitation, err := repo.GetInvitationByToken(ctx, db, "hash")
+		assert.NoError(t, err)
+		assert.Equal(t, orgB, invitation.OrgID)
+
+		err = repo.AddMember(ctx, begin(t, ctx), repository.AddMemberParams{OrgID: orgB, UserID: alice, Role: RoleMember})
+		assert.NoError(t, err)
+	})
+}
+
+func migrate(t *testing.T, pool *pgxpool.Pool) {
+	t.Helper()
+
+	files, err := filepath.Glob("../../../../database/postgres/migrations/*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		require.NoError(t, err)
+
+		_, err = pool.Exec(context.Background(), string(sql))
+		require.NoError(t, err, file)
+	}
+}
+
+func createUser(t *testing.T, pool *pgxpool.Pool, email string) pgtype.UUID {
+	t.Helper()
+
+	var id pgtype.UUID
+	err := pool.QueryRow(context.Background(), "INSERT INTO users (email) VALUES ($1) RETURNING id", email).Scan(&id)
+	require.NoError(t, err)
+
+	return id
+}
+
+func createOrganization(t *testing.T, pool *pgxpool.Pool, slug string, owner pgtype.UUID) pgtype.UUID {
+	t.Helper()
+
+	repo := repository.New()
+
+	org, err := repo.CreateOrganization(context.Background(), pool, repository.CreateOrganizationParams{Name: slug, Slug: slug})
+	require.NoError(t, err)
+
+	err = repo.AddMember(context.Background(), pool, repository.AddMemberParams{OrgID: org.ID, UserID: owner, Role: RoleOwner})
+	require.NoError(t, err)
+
+	return org.ID
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/config"
+	authService "github.com/savioruz/goth/internal/domains/auth/service"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/authz"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/tenant"
+)
+
+// OrgService manages organizations, the tenants of the application. Users are members of
+// organizations with the role owner, admin or member, and join them by accepting an invitation.
+// Every change of an invitation is recorded in the audit log.
+//
+// Methods without claims act in the tenant of the context and scope every query to it, so that
+// nothing of another organization can be read or changed through them. What members may do is up to
+// the "org:" policies of the enforcer.
+type OrgService interface {
+	CreateOrganization(ctx context.Context, claims *jwt.Claims, req dto.CreateOrganizationRequest) (*dto.OrganizationResponse, error)
+	ListOrganizations(ctx context.Context, claims *jwt.Claims) ([]*dto.OrganizationResponse, error)
+	Switch(ctx context.Context, claims *jwt.Claims, orgID string) (*dto.UserLoginResponse, error)
+	Membership(ctx context.Context, orgID, userID string) (tenant.Tenant, error)
+	Members(ctx context.Context) ([]*dto.MemberResponse, error)
+	UpdateMember(ctx context.Context, userID string, req dto.UpdateMemberRequest) error
+	RemoveMember(ctx context.Context, userID string) error
+	Invite(ctx context.Context, req dto.InviteMemberRequest) (*dto.InvitationResponse, error)
+	Invitations(ctx context.Context) ([]*dto.InvitationResponse, error)
+	ResendInvitation(ctx context.Context, invitationID string) (*dto.InvitationResponse, error)
+	RevokeInvitation(ctx context.Context, invitationID string) error
+	MyInvitations(ctx context.Context, claims *jwt.Claims) ([]*dto.InvitationResponse, error)
+	AcceptInvitation(ctx context.Context, claims *jwt.Claims, invitationID string) error
+	AcceptInvitationByToken(ctx context.Context, req dto.AcceptInvitationRequest) (*dto.AcceptInvitationResponse, error)
+	DeclineInvitation(ctx context.Context, claims *jwt.Claims, invitationID string) error
+}
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+type orgService struct {
+	db       postgres.PgxIface
+	repo     repository.Querier
+	auth     authService.AuthService
+	tokens   authService.TokenService
+	notifier authService.Notifier
+	enforcer authz.Enforcer
+	expiry   pgtype.Interval
+	logger   logger.Interface
+}
+
+func New(
+	db postgres.PgxIface,
+	repo repository.Querier,
+	auth authService.AuthService,
+	tokens authService.TokenService,
+	notifier authService.Notifier,
+	enforcer authz.Enforcer,
+	cfg *config.Config,
+	l logger.Interface,
+) OrgService {
+	return &orgService{
+		db:       db,
+		repo:     repo,
+		auth:     auth,
+		tokens:   tokens,
+		notifier: notifier,
+		enforcer: enforcer,
+		expiry: pgtype.Interval{
+			Microseconds: jwt.ParseDuration(cfg.Org.InvitationExpiry).Microseconds(),
+			Valid:        true,
+		},
+		logger: l,
+	}
+}
+
+// CreateOrganization creates an organization owned by the user.
+func (s *orgService) CreateOrganization(
+	ctx context.Context,
+	claims *jwt.Claims,
+	req dto.CreateOrganizationRequest,
+) (*dto.OrganizationResponse, error) {
+	userID, err := parseID(claims.ID)
+	if err != nil {
+		return nil, failure.Unauthorized("invalid token subject")
+	}
+
+	// The organization does not exist yet, so it cannot be the tenant of the transaction.
+	tx, err := s.db.Begin(postgres.CrossTenant(ctx))
+	if err != nil {
+		s.logger.Error("create organization - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("create organization - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	org, err := s.repo.CreateOrganization(ctx, tx, repository.CreateOrganizationParams{Name: req.Name, Slug: req.Slug})
+
+	if postgres.IsUniqueViolation(err) {
+		return nil, failure.Conflict("slug already taken")
+	}
+
+	if err != nil {
+		s.logger.Error("create organization - service - failed to create organization: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	err = s.repo.AddMember(ctx, tx, repository.AddMemberParams{OrgID: org.ID, UserID: userID, Role: RoleOwner})
+	if err != nil {
+		s.logger.Error("create organization - service - failed to add owner: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("create organization - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.OrganizationResponse).ToOrganizationResponse(repository.ListUserOrganizationsRow{
+		ID:       org.ID,
+		Name:     org.Name,
+		Slug:     org.Slug,
+		Role:     RoleOwner,
+		JoinedAt: org.CreatedAt,
+	}, claims.OrgID), nil
+}
+
+func (s *orgService) ListOrganizations(ctx context.Context, claims *jwt.Claims) ([]*dto.OrganizationResponse, error) {
+	userID, err := parseID(claims.ID)
+	if err != nil {
+		return nil, failure.Unauthorized("invalid token subject")
+	}
+
+	orgs, err := s.repo.ListUserOrganizations(ctx, s.db, userID)
+	if err != nil {
+		s.logger.Error("list organizations - service - failed to list organizations: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := make([]*dto.OrganizationResponse, 0, len(orgs))
+	for _, org := range orgs {
+		res = append(res, new(dto.OrganizationResponse).ToOrganizationResponse(org, claims.OrgID))
+	}
+
+	return res, nil
+}
+
+// Switch issues tokens acting in another organization of the user. Organizations the user is not a
+// member of are not found, so that their existence is not given away.
+func (s *orgService) Switch(ctx context.Context, claims *jwt.Claims, orgID string) (*dto.UserLoginResponse, error) {
+	org, err := parseID(orgID)
+	if err != nil {
+		return nil, failure.NotFound("organization not found")
+	}
+
+	user, err := parseID(claims.ID)
+	if err != nil {
+		return nil, failure.Unauthorized("invalid token subject")
+	}
+
+	_, err = s.repo.GetMember(ctx, s.db, repository.GetMemberParams{OrgID: org, UserID: user})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.NotFound("organization not found")
+	}
+
+	if err != nil {
+		s.logger.Error("switch - service - failed to get member: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return s.tokens.Switch(ctx, claims, orgID)
+}
+
+// Membership returns the tenant of a member of an organization, and forbids anyone else.
+func (s *orgService) Membership(ctx context.Context, orgID, userID string) (tenant.Tenant, error) {
+	org, err := parseID(orgID)
+	if err != nil {
+		return tenant.Tenant{}, failure.Forbidden("not a member of the organization")
+	}
+
+	user, err := parseID(userID)
+	if err != nil {
+		return tenant.Tenant{}, failure.Forbidden("not a member of the organization")
+	}
+
+	member, err := s.repo.GetMember(ctx, s.db, repository.GetMemberParams{OrgID: org, UserID: user})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return tenant.Tenant{}, failure.Forbidden("not a member of the organization")
+	}
+
+	if err != nil {
+		s.logger.Error("membership - service - failed to get member: %w", err)
+
+		return tenant.Tenant{}, failure.InternalError(err)
+	}
+
+	return tenant.Tenant{OrgID: orgID, UserID: userID, Role: member.Role}, nil
+}
+
+func (s *orgService) Members(ctx context.Context) ([]*dto.MemberResponse, error) {
+	_, orgID, err := current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.repo.ListMembers(ctx, s.db, orgID)
+	if err != nil {
+		s.logger.Error("members - service - failed to list members: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := make([]*dto.MemberResponse, 0, len(members))
+	for _, member := range members {
+		res = append(res, new(dto.MemberResponse).ToMemberResponse(member))
+	}
+
+	return res, nil
+}
+
+// UpdateMember changes the role of a member. An organization always keeps an owner.
+func (s *orgService) UpdateMember(ctx context.Context, userID string, req dto.UpdateMemberRequest) error {
+	return s.changeMember(ctx, "org:members:update", userID, req.Role)
+}
+
+// RemoveMember takes a member out of the organization; members may remove themselves to leave it.
+// An organization always keeps an owner.
+func (s *orgService) RemoveMember(ctx context.Context, userID string) error {
+	return s.changeMember(ctx, "org:members:remove", userID, "")
+}
+
+// changeMember gives a member of the tenant a new role, or removes them when role is empty. The
+// organization is locked meanwhile, so that concurrent changes cannot leave it without an owner.
+func (s *orgService) changeMember(ctx context.Context, action, userID, role string) error {
+	t, orgID, err := current(ctx)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseID(userID)
+	if err != nil {
+		return failure.BadRequestFromString("invalid user id")
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("change member - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("change member - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	if err = s.repo.LockOrganization(ctx, tx, orgID); err != nil {
+		s.logger.Error("change member - service - failed to lock organization: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	member, err := s.repo.GetMember(ctx, tx, repository.GetMemberParams{OrgID: orgID, UserID: id})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return failure.NotFound("member not found")
+	}
+
+	if err != nil {
+		s.logger.Error("change member - service - failed to get member: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	err = s.authorize(ctx, t, action, authz.Resource{
+		Type:       "member",
+		ID:         userID,
+		Attributes: map[string]any{"role": role, "member_role": member.Role},
+	})
+	if err != nil {
+		return err
+	}
+
+	if member.Role == RoleOwner && role != RoleOwner {
+		owners, err := s.repo.CountOwners(ctx, tx, orgID)
+		if err != nil {
+			s.logger.Error("change member - service - failed to count owners: %w", err)
+
+			return failure.InternalError(err)
+		}
+
+		if owners <= 1 {
+			return failure.Conflict("an organization needs an owner")
+		}
+	}
+
+	if role == "" {
+		_, err = s.repo.RemoveMember(ctx, tx, repository.RemoveMemberParams{OrgID: orgID, UserID: id})
+	} else {
+		_, err = s.repo.UpdateMemberRole(ctx, tx, repository.UpdateMemberRoleParams{OrgID: orgID, UserID: id, Role: role})
+	}
+
+	if err != nil {
+		s.logger.Error("change member - service - failed to change member: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("change member - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// authorize asks the enforcer whether the member of the tenant may perform the action.
+func (s *orgService) authorize(ctx context.Context, t tenant.Tenant, action string, resource authz.Resource) error {
+	err := s.enforcer.Authorize(ctx, authz.Request{
+		Subject:           &jwt.Claims{ID: t.UserID},
+		SubjectAttributes: map[string]any{"org_id": t.OrgID, "org_role": t.Role},
+		Action:            action,
+		Resource:          resource,
+		Environment:       authz.EnvironmentFromContext(ctx),
+	})
+	if errors.Is(err, authz.ErrDenied) {
+		return failure.Forbidden("not allowed in this organization")
+	}
+
+	return err
+}
+
+// current returns the tenant of the context and the ID of its organization.
+func current(ctx context.Context) (tenant.Tenant, pgtype.UUID, error) {
+	t, ok := tenant.FromContext(ctx)
+	if !ok {
+		return tenant.Tenant{}, pgtype.UUID{}, failure.Forbidden("no active organization")
+	}
+
+	id, err := parseID(t.OrgID)
+	if err != nil {
+		return tenant.Tenant{}, pgtype.UUID{}, failure.Forbidden("no active organization")
+	}
+
+	return t, id, nil
+}
+
+func parseID(s string) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	err := id.Scan(s)
+
+	return id, err
+}
@@ -0,0 +1,433 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/authz"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestOrgService_CreateOrganization(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), Email: "alice@example.com"}
+	org := repository.Organization{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Name: "Acme", Slug: "acme"}
+	req := dto.CreateOrganizationRequest{Name: "Acme", Slug: "acme"}
+	params := repository.CreateOrganizationParams{Name: "Acme", Slug: "acme"}
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, mockTokens, nil, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	t.Run("error: slug already taken", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().CreateOrganization(gomock.Any(), gomock.Any(), params).
+			Return(repository.Organization{}, &pgconn.PgError{Code: postgres.UniqueViolation})
+		mockPgx.ExpectRollback()
+
+		res, err := service.CreateOrganization(ctx, claims, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: creator is the owner", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().CreateOrganization(gomock.Any(), gomock.Any(), params).Return(org, nil)
+		mockQuerier.EXPECT().
+			AddMember(gomock.Any(), gomock.Any(), repository.AddMemberParams{OrgID: org.ID, UserID: userID, Role: RoleOwner}).
+			Return(nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		res, err := service.CreateOrganization(ctx, claims, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, org.ID.String(), res.ID)
+		assert.Equal(t, RoleOwner, res.Role)
+		assert.False(t, res.Active)
+	})
+}
+
+func TestOrgService_Switch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+
+	service := New(mockPgx, mockQuerier, nil, mockTokens, nil, newEnforcer(t), newConfig(), mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	claims := &jwt.Claims{ID: userID.String(), FamilyID: uuid.NewString()}
+	member := repository.GetMemberParams{OrgID: orgID, UserID: userID}
+
+	t.Run("error: invalid organization id", func(t *testing.T) {
+		res, err := service.Switch(ctx, claims, "invalid")
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: not a member", func(t *testing.T) {
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{}, pgx.ErrNoRows)
+
+		res, err := service.Switch(ctx, claims, orgID.String())
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		pair := &dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}
+
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: userID, Role: RoleMember}, nil)
+		mockTokens.EXPECT().Switch(gomock.Any(), claims, orgID.String()).Return(pair, nil)
+
+		res, err := service.Switch(ctx, claims, orgID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, pair, res)
+	})
+}
+
+func TestOrgService_Membership(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+
+	service := New(mockPgx, mockQuerier, nil, mockTokens, nil, newEnforcer(t), newConfig(), mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	member := repository.GetMemberParams{OrgID: orgID, UserID: userID}
+
+	t.Run("error: invalid organization id", func(t *testing.T) {
+		_, err := service.Membership(ctx, "invalid", userID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: not a member", func(t *testing.T) {
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{}, pgx.ErrNoRows)
+
+		_, err := service.Membership(ctx, orgID.String(), userID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: userID, Role: RoleAdmin}, nil)
+
+		res, err := service.Membership(ctx, orgID.String(), userID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, tenant.Tenant{OrgID: orgID.String(), UserID: userID.String(), Role: RoleAdmin}, res)
+	})
+}
+
+// TestOrgService_Isolation shows that tenant-scoped methods only ever query the organization of the
+// tenant in the context, whatever the request names.
+func TestOrgService_Isolation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	orgA := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	adminA := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	memberOfB := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	ctx := tenant.NewContext(context.Background(), tenant.Tenant{
+		OrgID:  orgA.String(),
+		UserID: adminA.String(),
+		Role:   RoleOwner,
+	})
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, mockTokens, nil, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	t.Run("error: no tenant", func(t *testing.T) {
+		service, _ := newService()
+
+		_, err := service.Members(context.Background())
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+
+		_, err = service.Invitations(context.Background())
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+
+		_, err = service.Invite(context.Background(), dto.InviteMemberRequest{Email: "bob@example.com", Role: RoleMember})
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+
+		err = service.RemoveMember(context.Background(), memberOfB.String())
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("success: members of the tenant only", func(t *testing.T) {
+		service, _ := newService()
+
+		mockQuerier.EXPECT().ListMembers(gomock.Any(), gomock.Any(), orgA).
+			Return([]repository.ListMembersRow{{UserID: adminA, Email: "admin@a.example", Role: RoleOwner}}, nil)
+
+		res, err := service.Members(ctx)
+
+		assert.NoError(t, err)
+		assert.Len(t, res, 1)
+		assert.Equal(t, adminA.String(), res[0].UserID)
+	})
+
+	t.Run("success: invitations of the tenant only", func(t *testing.T) {
+		service, _ := newService()
+
+		mockQuerier.EXPECT().ListInvitations(gomock.Any(), gomock.Any(), orgA).Return(nil, nil)
+
+		res, err := service.Invitations(ctx)
+
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("error: member of another organization is not found", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgA).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), repository.GetMemberParams{OrgID: orgA, UserID: memberOfB}).
+			Return(repository.OrganizationMember{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		err := service.UpdateMember(ctx, memberOfB.String(), dto.UpdateMemberRequest{Role: RoleAdmin})
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: member of another organization is not removed", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgA).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), repository.GetMemberParams{OrgID: orgA, UserID: memberOfB}).
+			Return(repository.OrganizationMember{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		err := service.RemoveMember(ctx, memberOfB.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+}
+
+func TestOrgService_UpdateMember(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	actor := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	member := repository.GetMemberParams{OrgID: orgID, UserID: userID}
+
+	as := func(role string) context.Context {
+		return tenant.NewContext(context.Background(), tenant.Tenant{OrgID: orgID.String(), UserID: actor.String(), Role: role})
+	}
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, mockTokens, nil, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	t.Run("error: members cannot change roles", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgID).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: userID, Role: RoleMember}, nil)
+		mockPgx.ExpectRollback()
+
+		err := service.UpdateMember(as(RoleMember), userID.String(), dto.UpdateMemberRequest{Role: RoleAdmin})
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: admins cannot make owners", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgID).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: userID, Role: RoleMember}, nil)
+		mockPgx.ExpectRollback()
+
+		err := service.UpdateMember(as(RoleAdmin), userID.String(), dto.UpdateMemberRequest{Role: RoleOwner})
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: last owner", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgID).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: userID, Role: RoleOwner}, nil)
+		mockQuerier.EXPECT().CountOwners(gomock.Any(), gomock.Any(), orgID).Return(int64(1), nil)
+		mockPgx.ExpectRollback()
+
+		err := service.UpdateMember(as(RoleOwner), userID.String(), dto.UpdateMemberRequest{Role: RoleAdmin})
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgID).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), member).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: userID, Role: RoleMember}, nil)
+		mockQuerier.EXPECT().
+			UpdateMemberRole(gomock.Any(), gomock.Any(), repository.UpdateMemberRoleParams{OrgID: orgID, UserID: userID, Role: RoleAdmin}).
+			Return(int64(1), nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.UpdateMember(as(RoleAdmin), userID.String(), dto.UpdateMemberRequest{Role: RoleAdmin})
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestOrgService_RemoveMember(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	orgID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	actor := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	other := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	ctx := tenant.NewContext(context.Background(), tenant.Tenant{OrgID: orgID.String(), UserID: actor.String(), Role: RoleMember})
+
+	newService := func() (OrgService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, nil, mockTokens, nil, newEnforcer(t), newConfig(), mockLogger), mockPgx
+	}
+
+	t.Run("error: members cannot remove others", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgID).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), repository.GetMemberParams{OrgID: orgID, UserID: other}).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: other, Role: RoleMember}, nil)
+		mockPgx.ExpectRollback()
+
+		err := service.RemoveMember(ctx, other.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("success: member leaves", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().LockOrganization(gomock.Any(), gomock.Any(), orgID).Return(nil)
+		mockQuerier.EXPECT().GetMember(gomock.Any(), gomock.Any(), repository.GetMemberParams{OrgID: orgID, UserID: actor}).
+			Return(repository.OrganizationMember{OrgID: orgID, UserID: actor, Role: RoleMember}, nil)
+		mockQuerier.EXPECT().RemoveMember(gomock.Any(), gomock.Any(), repository.RemoveMemberParams{OrgID: orgID, UserID: actor}).
+			Return(int64(1), nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		err := service.RemoveMember(ctx, actor.String())
+
+		assert.NoError(t, err)
+	})
+}
+
+// newEnforcer enforces the policies the application ships with.
+func newEnforcer(t *testing.T) authz.Enforcer {
+	t.Helper()
+
+	policies, err := authz.Load("../../../../config/policies")
+	require.NoError(t, err)
+
+	enforcer, err := authz.New(policies)
+	require.NoError(t, err)
+
+	return enforcer
+}
+
+func newConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Org.InvitationExpiry = "7d"
+
+	return cfg
+}
@@ -0,0 +1,375 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/savioruz/goth/internal/delivery/http/response"
+	"github.com/savioruz/goth/internal/domains/rbac/service"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/logger"
+)
+
+var (
+	ErrClaimsNil = errors.New("claims is nil")
+)
+
+type Handler struct {
+	service   service.RBACService
+	logger    logger.Interface
+	validator *validator.Validate
+}
+
+func New(s service.RBACService, l logger.Interface, v *validator.Validate) *Handler {
+	return &Handler{
+		service:   s,
+		logger:    l,
+		validator: v,
+	}
+}
+
+func (h *Handler) RegisterRoutes(r fiber.Router, requireAuth fiber.Handler) {
+	r.Get("/users/me/permissions", requireAuth, h.MyPermissions)
+}
+
+// RegisterAdminRoutes registers routes on a group of signed in users. require guards a route with
+// the permissions it needs.
+func (h *Handler) RegisterAdminRoutes(r fiber.Router, require func(permissions ...string) fiber.Handler) {
+	r.Get("/roles", require("roles:read"), h.ListRoles)
+	r.Post("/roles", require("roles:write"), h.CreateRole)
+	r.Put("/roles/:name", require("roles:write"), h.UpdateRole)
+	r.Delete("/roles/:name", require("roles:write"), h.DeleteRole)
+	r.Get("/permissions", require("roles:read"), h.ListPermissions)
+	r.Get("/users/:id/roles", require("roles:read"), h.UserRoles)
+	r.Post("/users/:id/roles", require("roles:write"), h.AssignRole)
+	r.Delete("/users/:id/roles/:name", require("roles:write"), h.UnassignRole)
+}
+
+// MyPermissions godoc
+// @Summary List my permissions
+// @Description List the permissions the signed in user holds through their roles
+// @Tags users
+// @Produce json
+// @Success 200 {object} response.Data[[]string]
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/permissions [get]
+// @Security BearerAuth
+func (h *Handler) MyPermissions(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - v1 - user - permissions - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	data, err := h.service.Permissions(ctx.UserContext(), claims.ID)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - v1 - user - permissions - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if data == nil {
+		data = []string{}
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List every role with its permissions. Requires roles:read.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.RoleResponse]
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/roles [get]
+// @Security BearerAuth
+func (h *Handler) ListRoles(ctx *fiber.Ctx) error {
+	data, err := h.service.ListRoles(ctx.UserContext())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - list roles - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// CreateRole godoc
+// @Summary Create role
+// @Description Create a role with the given permissions. Default roles are assigned to every new account. Requires roles:write.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param role body dto.CreateRoleRequest true "Create role request"
+// @Success 201 {object} response.Data[dto.RoleResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/roles [post]
+// @Security BearerAuth
+func (h *Handler) CreateRole(ctx *fiber.Ctx) error {
+	var req dto.CreateRoleRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - admin - create role - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - admin - create role - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.CreateRole(ctx.UserContext(), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - create role - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusCreated, data)
+}
+
+// UpdateRole godoc
+// @Summary Update role
+// @Description Replace the description and permissions of a role. Its users gain or lose permissions right away. Requires roles:write.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param name path string true "Role name"
+// @Param role body dto.UpdateRoleRequest true "Update role request"
+// @Success 200 {object} response.Data[dto.RoleResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/roles/{name} [put]
+// @Security BearerAuth
+func (h *Handler) UpdateRole(ctx *fiber.Ctx) error {
+	var req dto.UpdateRoleRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - admin - update role - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - admin - update role - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.UpdateRole(ctx.UserContext(), ctx.Params("name"), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - update role - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// DeleteRole godoc
+// @Summary Delete role
+// @Description Delete a role and take it away from its users. The built-in user and admin roles cannot be deleted. Requires roles:write.
+// @Tags admin
+// @Produce json
+// @Param name path string true "Role name"
+// @Success 204
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/roles/{name} [delete]
+// @Security BearerAuth
+func (h *Handler) DeleteRole(ctx *fiber.Ctx) error {
+	if err := h.service.DeleteRole(ctx.UserContext(), ctx.Params("name")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - delete role - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ListPermissions godoc
+// @Summary List permissions
+// @Description List every permission that can be granted to a role. Requires roles:read.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} response.Data[[]dto.PermissionResponse]
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/permissions [get]
+// @Security BearerAuth
+func (h *Handler) ListPermissions(ctx *fiber.Ctx) error {
+	data, err := h.service.ListPermissions(ctx.UserContext())
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - list permissions - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// UserRoles godoc
+// @Summary List roles of a user
+// @Description List the roles assigned to the user. Requires roles:read.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} response.Data[[]dto.RoleResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id}/roles [get]
+// @Security BearerAuth
+func (h *Handler) UserRoles(ctx *fiber.Ctx) error {
+	data, err := h.service.UserRoles(ctx.UserContext(), ctx.Params("id"))
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - user roles - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// AssignRole godoc
+// @Summary Assign role
+// @Description Assign a role to the user. Assigning a role the user already has does nothing. Requires roles:write, and users cannot change their own roles.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param role body dto.AssignRoleRequest true "Assign role request"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id}/roles [post]
+// @Security BearerAuth
+func (h *Handler) AssignRole(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - admin - assign role - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	var req dto.AssignRoleRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - admin - assign role - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - admin - assign role - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.AssignRole(ctx.UserContext(), claims, ctx.Params("id"), req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - assign role - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// UnassignRole godoc
+// @Summary Unassign role
+// @Description Take a role away from the user. Requires roles:write, and users cannot change their own roles.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Param name path string true "Role name"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id}/roles/{name} [delete]
+// @Security BearerAuth
+func (h *Handler) UnassignRole(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - admin - unassign role - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	if err := h.service.UnassignRole(ctx.UserContext(), claims, ctx.Params("id"), ctx.Params("name")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - unassign role - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,468 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/authz"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/redis"
+)
+
+// RBACService grants permissions through roles. A user holds the permissions of every role assigned
+// to them, and new accounts are assigned the default roles.
+//
+// Permissions are looked up on every guarded request, so they are cached per user. The cache of a
+// user is dropped whenever their roles, or the permissions of one of their roles, change.
+//
+// Who may assign roles to whom is decided by the "roles:assign" and "roles:unassign" policies of
+// the enforcer, on a resource of type "user" with the role as its "role" attribute.
+type RBACService interface {
+	Permissions(ctx context.Context, userID string) ([]string, error)
+	ListRoles(ctx context.Context) ([]*dto.RoleResponse, error)
+	ListPermissions(ctx context.Context) ([]*dto.PermissionResponse, error)
+	CreateRole(ctx context.Context, req dto.CreateRoleRequest) (*dto.RoleResponse, error)
+	UpdateRole(ctx context.Context, name string, req dto.UpdateRoleRequest) (*dto.RoleResponse, error)
+	DeleteRole(ctx context.Context, name string) error
+	UserRoles(ctx context.Context, userID string) ([]*dto.RoleResponse, error)
+	AssignRole(ctx context.Context, claims *jwt.Claims, userID string, req dto.AssignRoleRequest) error
+	UnassignRole(ctx context.Context, claims *jwt.Claims, userID, role string) error
+}
+
+const (
+	permissionsKey      = "rbac:permissions:%s"
+	permissionsCacheTTL = 5 * time.Minute
+)
+
+type rbacService struct {
+	db       postgres.PgxIface
+	repo     repository.Querier
+	cache    redis.IRedisCache
+	enforcer authz.Enforcer
+	logger   logger.Interface
+}
+
+func New(
+	db postgres.PgxIface,
+	repo repository.Querier,
+	cache redis.IRedisCache,
+	enforcer authz.Enforcer,
+	l logger.Interface,
+) RBACService {
+	return &rbacService{
+		db:       db,
+		repo:     repo,
+		cache:    cache,
+		enforcer: enforcer,
+		logger:   l,
+	}
+}
+
+// Permissions returns the names of the permissions the user holds.
+func (s *rbacService) Permissions(ctx context.Context, userID string) ([]string, error) {
+	key := fmt.Sprintf(permissionsKey, userID)
+
+	var permissions []string
+	if err := s.cache.Get(ctx, key, &permissions); err == nil {
+		return permissions, nil
+	}
+
+	id, err := parseUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err = s.repo.ListUserPermissions(ctx, s.db, id)
+	if err != nil {
+		s.logger.Error("permissions - service - failed to list permissions: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.cache.Save(ctx, key, permissions, int(permissionsCacheTTL.Seconds())); err != nil {
+		s.logger.Error("permissions - service - failed to cache permissions: %w", err)
+	}
+
+	return permissions, nil
+}
+
+func (s *rbacService) ListRoles(ctx context.Context) ([]*dto.RoleResponse, error) {
+	roles, err := s.repo.ListRoles(ctx, s.db)
+	if err != nil {
+		s.logger.Error("list roles - service - failed to list roles: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return s.toRoleResponses(ctx, roles)
+}
+
+func (s *rbacService) ListPermissions(ctx context.Context) ([]*dto.PermissionResponse, error) {
+	permissions, err := s.repo.ListPermissions(ctx, s.db)
+	if err != nil {
+		s.logger.Error("list permissions - service - failed to list permissions: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := make([]*dto.PermissionResponse, 0, len(permissions))
+	for _, permission := range permissions {
+		res = append(res, new(dto.PermissionResponse).ToPermissionResponse(permission))
+	}
+
+	return res, nil
+}
+
+func (s *rbacService) CreateRole(ctx context.Context, req dto.CreateRoleRequest) (*dto.RoleResponse, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("create role - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("create role - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	role, err := s.repo.CreateRole(ctx, tx, repository.CreateRoleParams{
+		Name:        req.Name,
+		Description: req.Description,
+		IsDefault:   req.IsDefault,
+	})
+
+	if postgres.IsUniqueViolation(err) {
+		return nil, failure.Conflict("role already exists")
+	}
+
+	if err != nil {
+		s.logger.Error("create role - service - failed to create role: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	permissions, err := s.grant(ctx, tx, role.ID, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("create role - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.RoleResponse).ToRoleResponse(role, permissions), nil
+}
+
+// UpdateRole replaces the description and permissions of a role. Users of the role gain or lose the
+// permissions right away.
+func (s *rbacService) UpdateRole(ctx context.Context, name string, req dto.UpdateRoleRequest) (*dto.RoleResponse, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("update role - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("update role - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	role, err := s.repo.UpdateRole(ctx, tx, repository.UpdateRoleParams{
+		Name:        name,
+		Description: req.Description,
+		IsDefault:   req.IsDefault,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.NotFound("role not found")
+	}
+
+	if err != nil {
+		s.logger.Error("update role - service - failed to update role: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.repo.DeleteRolePermissions(ctx, tx, role.ID); err != nil {
+		s.logger.Error("update role - service - failed to delete permissions: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	permissions, err := s.grant(ctx, tx, role.ID, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.repo.ListRoleUserIDs(ctx, tx, role.ID)
+	if err != nil {
+		s.logger.Error("update role - service - failed to list users: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("update role - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.forget(ctx, users...); err != nil {
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.RoleResponse).ToRoleResponse(role, permissions), nil
+}
+
+// DeleteRole deletes a role, taking it away from its users. The built-in roles cannot be deleted.
+func (s *rbacService) DeleteRole(ctx context.Context, name string) error {
+	role, err := s.role(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if role.Builtin {
+		return failure.Conflict("built-in roles cannot be deleted")
+	}
+
+	users, err := s.repo.ListRoleUserIDs(ctx, s.db, role.ID)
+	if err != nil {
+		s.logger.Error("delete role - service - failed to list users: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if _, err = s.repo.DeleteRole(ctx, s.db, role.ID); err != nil {
+		s.logger.Error("delete role - service - failed to delete role: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.forget(ctx, users...); err != nil {
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+func (s *rbacService) UserRoles(ctx context.Context, userID string) ([]*dto.RoleResponse, error) {
+	id, err := s.user(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.repo.ListUserRoles(ctx, s.db, id)
+	if err != nil {
+		s.logger.Error("user roles - service - failed to list roles: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return s.toRoleResponses(ctx, roles)
+}
+
+func (s *rbacService) AssignRole(ctx context.Context, claims *jwt.Claims, userID string, req dto.AssignRoleRequest) error {
+	id, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = s.authorize(ctx, claims, "roles:assign", userID, req.Role); err != nil {
+		return err
+	}
+
+	role, err := s.role(ctx, req.Role)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.AssignRole(ctx, s.db, repository.AssignRoleParams{UserID: id, RoleID: role.ID})
+	if err != nil {
+		s.logger.Error("assign role - service - failed to assign role: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.forget(ctx, id); err != nil {
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+func (s *rbacService) UnassignRole(ctx context.Context, claims *jwt.Claims, userID, name string) error {
+	id, err := parseUserID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err = s.authorize(ctx, claims, "roles:unassign", userID, name); err != nil {
+		return err
+	}
+
+	role, err := s.role(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.repo.UnassignRole(ctx, s.db, repository.UnassignRoleParams{UserID: id, RoleID: role.ID})
+	if err != nil {
+		s.logger.Error("unassign role - service - failed to unassign role: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if rows == 0 {
+		return failure.NotFound("role not assigned")
+	}
+
+	if err = s.forget(ctx, id); err != nil {
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// authorize asks the enforcer whether the subject may perform the action on the roles of the user.
+func (s *rbacService) authorize(ctx context.Context, claims *jwt.Claims, action, userID, role string) error {
+	permissions, err := s.Permissions(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.enforcer.Authorize(ctx, authz.Request{
+		Subject:           claims,
+		SubjectAttributes: map[string]any{"permissions": permissions},
+		Action:            action,
+		Resource: authz.Resource{
+			Type:       "user",
+			ID:         userID,
+			Attributes: map[string]any{"role": role},
+		},
+		Environment: authz.EnvironmentFromContext(ctx),
+	})
+	if errors.Is(err, authz.ErrDenied) {
+		return failure.Forbidden("not allowed to change the roles of this user")
+	}
+
+	return err
+}
+
+// grant gives the role the named permissions, which must all exist. It returns them sorted.
+func (s *rbacService) grant(ctx context.Context, tx pgx.Tx, roleID pgtype.UUID, permissions []string) ([]string, error) {
+	permissions = slices.Clone(permissions)
+	slices.Sort(permissions)
+	permissions = slices.Compact(permissions)
+
+	if len(permissions) == 0 {
+		return permissions, nil
+	}
+
+	rows, err := s.repo.AddRolePermissions(ctx, tx, repository.AddRolePermissionsParams{
+		RoleID:      roleID,
+		Permissions: permissions,
+	})
+	if err != nil {
+		s.logger.Error("grant permissions - service - failed to add permissions: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if rows != int64(len(permissions)) {
+		return nil, failure.BadRequestFromString("unknown permission")
+	}
+
+	return permissions, nil
+}
+
+// forget drops the cached permissions of the users.
+func (s *rbacService) forget(ctx context.Context, users ...pgtype.UUID) error {
+	for _, user := range users {
+		if err := s.cache.Delete(ctx, fmt.Sprintf(permissionsKey, user.String())); err != nil {
+			s.logger.Error("rbac - service - failed to drop cached permissions: %w", err)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *rbacService) role(ctx context.Context, name string) (repository.Role, error) {
+	role, err := s.repo.GetRoleByName(ctx, s.db, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.Role{}, failure.NotFound("role not found")
+	}
+
+	if err != nil {
+		s.logger.Error("rbac - service - failed to get role: %w", err)
+
+		return repository.Role{}, failure.InternalError(err)
+	}
+
+	return role, nil
+}
+
+// user returns the ID of an existing user.
+func (s *rbacService) user(ctx context.Context, userID string) (pgtype.UUID, error) {
+	id, err := parseUserID(userID)
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+
+	_, err = s.repo.GetUserByID(ctx, s.db, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pgtype.UUID{}, failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("rbac - service - failed to get user: %w", err)
+
+		return pgtype.UUID{}, failure.InternalError(err)
+	}
+
+	return id, nil
+}
+
+func (s *rbacService) toRoleResponses(ctx context.Context, roles []repository.Role) ([]*dto.RoleResponse, error) {
+	res := make([]*dto.RoleResponse, 0, len(roles))
+
+	for _, role := range roles {
+		permissions, err := s.repo.ListRolePermissions(ctx, s.db, role.ID)
+		if err != nil {
+			s.logger.Error("rbac - service - failed to list role permissions: %w", err)
+
+			return nil, failure.InternalError(err)
+		}
+
+		res = append(res, new(dto.RoleResponse).ToRoleResponse(role, permissions))
+	}
+
+	return res, nil
+}
+
+func parseUserID(userID string) (pgtype.UUID, error) {
+	var id pgtype.UUID
+	if err := id.Scan(userID); err != nil {
+		return pgtype.UUID{}, failure.BadRequestFromString("invalid user id")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,372 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/authz"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/postgres"
+	redisPkg "github.com/savioruz/goth/pkg/redis"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRBACService_Permissions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+
+	service := New(mockPgx, mockQuerier, mockRedis, newEnforcer(t), mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	key := "rbac:permissions:" + userID.String()
+
+	t.Run("success: cached", func(t *testing.T) {
+		mockRedis.EXPECT().Get(gomock.Any(), key, gomock.Any()).SetArg(2, []string{"users:read"}).Return(nil)
+
+		res, err := service.Permissions(ctx, userID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"users:read"}, res)
+	})
+
+	t.Run("error: failure listing permissions", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+		mockRedis.EXPECT().Get(gomock.Any(), key, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockQuerier.EXPECT().ListUserPermissions(gomock.Any(), gomock.Any(), userID).Return(nil, mockError)
+
+		res, err := service.Permissions(ctx, userID.String())
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: looked up and cached", func(t *testing.T) {
+		permissions := []string{"roles:read", "users:read"}
+
+		mockRedis.EXPECT().Get(gomock.Any(), key, gomock.Any()).Return(redisPkg.ErrCacheMiss)
+		mockQuerier.EXPECT().ListUserPermissions(gomock.Any(), gomock.Any(), userID).Return(permissions, nil)
+		mockRedis.EXPECT().Save(gomock.Any(), key, permissions, 5*60).Return(nil)
+
+		res, err := service.Permissions(ctx, userID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, permissions, res)
+	})
+}
+
+func TestRBACService_CreateRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	role := repository.Role{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Name: "support"}
+	req := dto.CreateRoleRequest{Name: "support", Permissions: []string{"users:read", "roles:read", "users:read"}}
+	params := repository.CreateRoleParams{Name: "support"}
+	grant := repository.AddRolePermissionsParams{RoleID: role.ID, Permissions: []string{"roles:read", "users:read"}}
+
+	newService := func() (RBACService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, mockRedis, newEnforcer(t), mockLogger), mockPgx
+	}
+
+	t.Run("error: role already exists", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().CreateRole(gomock.Any(), gomock.Any(), params).
+			Return(repository.Role{}, &pgconn.PgError{Code: postgres.UniqueViolation})
+		mockPgx.ExpectRollback()
+
+		res, err := service.CreateRole(ctx, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("error: unknown permission", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().CreateRole(gomock.Any(), gomock.Any(), params).Return(role, nil)
+		mockQuerier.EXPECT().AddRolePermissions(gomock.Any(), gomock.Any(), grant).Return(int64(1), nil)
+		mockPgx.ExpectRollback()
+
+		res, err := service.CreateRole(ctx, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().CreateRole(gomock.Any(), gomock.Any(), params).Return(role, nil)
+		mockQuerier.EXPECT().AddRolePermissions(gomock.Any(), gomock.Any(), grant).Return(int64(2), nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		res, err := service.CreateRole(ctx, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "support", res.Name)
+		assert.Equal(t, []string{"roles:read", "users:read"}, res.Permissions)
+	})
+}
+
+func TestRBACService_UpdateRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+
+	role := repository.Role{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Name: "support"}
+	member := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	req := dto.UpdateRoleRequest{Description: "Support staff"}
+	params := repository.UpdateRoleParams{Name: "support", Description: "Support staff"}
+
+	newService := func() (RBACService, pgxmock.PgxPoolIface) {
+		mockPgx, _ := pgxmock.NewPool()
+
+		return New(mockPgx, mockQuerier, mockRedis, newEnforcer(t), mockLogger), mockPgx
+	}
+
+	t.Run("error: role not found", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().UpdateRole(gomock.Any(), gomock.Any(), params).Return(repository.Role{}, pgx.ErrNoRows)
+		mockPgx.ExpectRollback()
+
+		res, err := service.UpdateRole(ctx, "support", req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: members lose the permissions", func(t *testing.T) {
+		service, mockPgx := newService()
+
+		mockPgx.ExpectBegin()
+		mockQuerier.EXPECT().UpdateRole(gomock.Any(), gomock.Any(), params).Return(role, nil)
+		mockQuerier.EXPECT().DeleteRolePermissions(gomock.Any(), gomock.Any(), role.ID).Return(nil)
+		mockQuerier.EXPECT().ListRoleUserIDs(gomock.Any(), gomock.Any(), role.ID).Return([]pgtype.UUID{member}, nil)
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+		mockRedis.EXPECT().Delete(gomock.Any(), "rbac:permissions:"+member.String()).Return(nil)
+
+		res, err := service.UpdateRole(ctx, "support", req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "support", res.Name)
+		assert.Empty(t, res.Permissions)
+	})
+}
+
+func TestRBACService_DeleteRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+
+	service := New(mockPgx, mockQuerier, mockRedis, newEnforcer(t), mockLogger)
+
+	role := repository.Role{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Name: "support"}
+	member := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	t.Run("error: role not found", func(t *testing.T) {
+		mockQuerier.EXPECT().GetRoleByName(gomock.Any(), gomock.Any(), "support").Return(repository.Role{}, pgx.ErrNoRows)
+
+		err := service.DeleteRole(ctx, "support")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: built-in role", func(t *testing.T) {
+		mockQuerier.EXPECT().GetRoleByName(gomock.Any(), gomock.Any(), "admin").
+			Return(repository.Role{Name: "admin", Builtin: true}, nil)
+
+		err := service.DeleteRole(ctx, "admin")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		mockQuerier.EXPECT().GetRoleByName(gomock.Any(), gomock.Any(), "support").Return(role, nil)
+		mockQuerier.EXPECT().ListRoleUserIDs(gomock.Any(), gomock.Any(), role.ID).Return([]pgtype.UUID{member}, nil)
+		mockQuerier.EXPECT().DeleteRole(gomock.Any(), gomock.Any(), role.ID).Return(int64(1), nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "rbac:permissions:"+member.String()).Return(nil)
+
+		err := service.DeleteRole(ctx, "support")
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestRBACService_AssignRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+
+	service := New(mockPgx, mockQuerier, mockRedis, newEnforcer(t), mockLogger)
+
+	adminID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	admin := &jwt.Claims{ID: adminID.String(), Email: "admin@example.com"}
+	adminKey := "rbac:permissions:" + adminID.String()
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	role := repository.Role{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Name: "admin", Builtin: true}
+	req := dto.AssignRoleRequest{Role: "admin"}
+	assign := repository.AssignRoleParams{UserID: userID, RoleID: role.ID}
+
+	t.Run("error: invalid user id", func(t *testing.T) {
+		err := service.AssignRole(ctx, admin, "invalid", req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: user not found", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{}, pgx.ErrNoRows)
+
+		err := service.AssignRole(ctx, admin, userID.String(), req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: subject lacks roles:write", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{ID: userID}, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), adminKey, gomock.Any()).SetArg(2, []string{"roles:read"}).Return(nil)
+
+		err := service.AssignRole(ctx, admin, userID.String(), req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: own roles", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), adminID).Return(repository.User{ID: adminID}, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), adminKey, gomock.Any()).SetArg(2, []string{"roles:write"}).Return(nil)
+
+		err := service.AssignRole(ctx, admin, adminID.String(), req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: role not found", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{ID: userID}, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), adminKey, gomock.Any()).SetArg(2, []string{"roles:write"}).Return(nil)
+		mockQuerier.EXPECT().GetRoleByName(gomock.Any(), gomock.Any(), "admin").Return(repository.Role{}, pgx.ErrNoRows)
+
+		err := service.AssignRole(ctx, admin, userID.String(), req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: assigned", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{ID: userID}, nil)
+		mockRedis.EXPECT().Get(gomock.Any(), adminKey, gomock.Any()).SetArg(2, []string{"roles:write"}).Return(nil)
+		mockQuerier.EXPECT().GetRoleByName(gomock.Any(), gomock.Any(), "admin").Return(role, nil)
+		mockQuerier.EXPECT().AssignRole(gomock.Any(), gomock.Any(), assign).Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "rbac:permissions:"+userID.String()).Return(nil)
+
+		err := service.AssignRole(ctx, admin, userID.String(), req)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("error: unassign own roles", func(t *testing.T) {
+		mockRedis.EXPECT().Get(gomock.Any(), adminKey, gomock.Any()).SetArg(2, []string{"roles:write"}).Return(nil)
+
+		err := service.UnassignRole(ctx, admin, adminID.String(), "admin")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, failure.GetCode(err))
+	})
+
+	t.Run("error: role not assigned", func(t *testing.T) {
+		mockRedis.EXPECT().Get(gomock.Any(), adminKey, gomock.Any()).SetArg(2, []string{"roles:write"}).Return(nil)
+		mockQuerier.EXPECT().GetRoleByName(gomock.Any(), gomock.Any(), "admin").Return(role, nil)
+		mockQuerier.EXPECT().
+			UnassignRole(gomock.Any(), gomock.Any(), repository.UnassignRoleParams(assign)).
+			Return(int64(0), nil)
+
+		err := service.UnassignRole(ctx, admin, userID.String(), "admin")
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: unassigned", func(t *testing.T) {
+		mockRedis.EXPECT().Get(gomock.Any(), adminKey, gomock.Any()).SetArg(2, []string{"roles:write"}).Return(nil)
+		mockQuerier.EXPECT().GetRoleByName(gomock.Any(), gomock.Any(), "admin").Return(role, nil)
+		mockQuerier.EXPECT().
+			UnassignRole(gomock.Any(), gomock.Any(), repository.UnassignRoleParams(assign)).
+			Return(int64(1), nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "rbac:permissions:"+userID.String()).Return(nil)
+
+		err := service.UnassignRole(ctx, admin, userID.String(), "admin")
+
+		assert.NoError(t, err)
+	})
+}
+
+// newEnforcer enforces the policies the application ships with.
+func newEnforcer(t *testing.T) authz.Enforcer {
+	t.Helper()
+
+	policies, err := authz.Load("../../../../config/policies")
+	require.NoError(t, err)
+
+	enforcer, err := authz.New(policies)
+	require.NoError(t, err)
+
+	return enforcer
+}
@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+// LockoutEvent describes an account or client IP being locked out of password login.
+type LockoutEvent struct {
+	Scope    string
+	Subject  string
+	Failures int64
+	Until    time.Time
+}
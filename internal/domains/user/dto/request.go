@@ -2,11 +2,137 @@ package dto
 
 type UserRegisterRequest struct {
 	Email    string `example:"string@gmail.com" json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required"`
 	Name     string `json:"name" validate:"required"`
 }
 
 type UserLoginRequest struct {
 	Email    string `example:"string@gmail.com" json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `example:"string@gmail.com" json:"email" validate:"required,email"`
+}
+
+type ConfirmEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `example:"string@gmail.com" json:"email" validate:"required,email"`
+}
+
+type MagicLinkRequest struct {
+	Email string `example:"string@gmail.com" json:"email" validate:"required,email"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,nefield=CurrentPassword"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `example:"string@gmail.com" json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ConfirmMFARequest struct {
+	Code string `example:"123456" json:"code" validate:"required,numeric,len=6"`
+}
+
+type DisableMFARequest struct {
+	Code string `example:"123456" json:"code" validate:"required"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `example:"123456" json:"code" validate:"required"`
+}
+
+type OAuthLoginRequest struct {
+	RedirectURI string `query:"redirect_uri" validate:"omitempty,url"`
+}
+
+type OAuthCallbackRequest struct {
+	Code  string `query:"code" validate:"required"`
+	State string `query:"state" validate:"required"`
+}
+
+type CreateRoleRequest struct {
+	Name        string   `example:"support" json:"name" validate:"required,max=64,lowercase,excludesall= "`
+	Description string   `json:"description" validate:"max=255"`
+	IsDefault   bool     `json:"is_default"`
+	Permissions []string `example:"users:read" json:"permissions" validate:"dive,required"`
+}
+
+type UpdateRoleRequest struct {
+	Description string   `json:"description" validate:"max=255"`
+	IsDefault   bool     `json:"is_default"`
+	Permissions []string `example:"users:read" json:"permissions" validate:"dive,required"`
+}
+
+type AssignRoleRequest struct {
+	Role string `example:"admin" json:"role" validate:"required"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `example:"Acme" json:"name" validate:"required,max=255"`
+	Slug string `example:"acme" json:"slug" validate:"required,max=64,lowercase,excludesall= /"`
+}
+
+type InviteMemberRequest struct {
+	Email string `example:"bob@example.com" json:"email" validate:"required,email"`
+	Role  string `example:"member" json:"role" validate:"required,oneof=owner admin member"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `example:"admin" json:"role" validate:"required,oneof=owner admin member"`
+}
+
+// AcceptInvitationRequest accepts an emailed invitation. Name and Password create an account for the
+// invited address when it has none yet.
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// ListUsersRequest filters a page of users. Levels have been replaced by roles, so Role filters by the
+// name of a role the users have. Deleted users are excluded by default, and Sort defaults to
+// -created_at. Cursor is the next_cursor of the previous page and only continues the same sort.
+type ListUsersRequest struct {
+	EmailPrefix string `query:"email_prefix" validate:"max=255"`
+	Verified    string `query:"verified" validate:"omitempty,oneof=true false"`
+	Role        string `query:"role" validate:"max=64"`
+	CreatedFrom string `example:"2025-01-01T00:00:00Z" query:"created_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedTo   string `example:"2026-01-01T00:00:00Z" query:"created_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Deleted     string `query:"deleted" validate:"omitempty,oneof=exclude include only"`
+	Sort        string `query:"sort" validate:"omitempty,oneof=created_at -created_at email -email"`
+	Limit       int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Cursor      string `query:"cursor"`
+}
+
+// UpdateUserRequest changes the account of a user. Fields left out are kept.
+type UpdateUserRequest struct {
+	Email        *string `example:"bob@example.com" json:"email" validate:"omitempty,email"`
+	FullName     *string `json:"full_name" validate:"omitempty,max=255"`
+	ProfileImage *string `json:"profile_image" validate:"omitempty,url"`
 }
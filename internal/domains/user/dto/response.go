@@ -1,15 +1,23 @@
 package dto
 
-import "github.com/savioruz/goth/internal/domains/user/repository"
+import (
+	"time"
+
+	"github.com/savioruz/goth/internal/domains/user/repository"
+)
 
 type UserRegisterResponse struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
 }
 
+// UserLoginResponse carries either a token pair or, when the account has MFA enabled, a challenge
+// token to exchange for the pair together with a second factor.
 type UserLoginResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
 
 type UserProfileResponse struct {
@@ -18,6 +26,113 @@ type UserProfileResponse struct {
 	ProfileImage string `json:"profile_image"`
 }
 
+type PasskeyResponse struct {
+	ID         string    `json:"id"`
+	Transports []string  `json:"transports"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type MFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// OAuthAuthorization starts an OAuth login: the browser is sent to URL, and State is stored in a
+// cookie to bind the login to that browser.
+type OAuthAuthorization struct {
+	URL   string
+	State string
+}
+
+// OAuthLinkResponse starts linking a provider to the signed in account: the browser is sent to URL.
+type OAuthLinkResponse struct {
+	URL string `json:"url"`
+}
+
+type IdentityResponse struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
+type RoleResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	IsDefault   bool     `json:"is_default"`
+	Builtin     bool     `json:"builtin"`
+	Permissions []string `json:"permissions"`
+}
+
+type PermissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type OrganizationResponse struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Slug     string    `json:"slug"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	Active   bool      `json:"active"`
+}
+
+type MemberResponse struct {
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email"`
+	FullName string    `json:"full_name"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type InvitationResponse struct {
+	ID        string    `json:"id"`
+	OrgID     string    `json:"org_id"`
+	OrgName   string    `json:"org_name,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Role      string    `json:"role"`
+	Status    string    `json:"status,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AcceptInvitationResponse struct {
+	OrgID          string `json:"org_id"`
+	UserID         string `json:"user_id"`
+	AccountCreated bool   `json:"account_created"`
+}
+
+type UserResponse struct {
+	ID           string     `json:"id"`
+	Email        string     `json:"email"`
+	FullName     string     `json:"full_name"`
+	ProfileImage string     `json:"profile_image"`
+	IsVerified   bool       `json:"is_verified"`
+	LastLogin    *time.Time `json:"last_login"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at"`
+}
+
+type UserListResponse struct {
+	Users      []*UserResponse `json:"users"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
 func (u *UserRegisterResponse) ToRegisterResponse(user repository.User) *UserRegisterResponse {
 	return &UserRegisterResponse{
 		ID:    user.ID.String(),
@@ -32,6 +147,62 @@ func (u *UserLoginResponse) ToLoginResponse(accessToken, refreshToken string) *U
 	}
 }
 
+func (u *UserLoginResponse) ToMFAChallengeResponse(mfaToken string) *UserLoginResponse {
+	return &UserLoginResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	}
+}
+
+func (p *PasskeyResponse) ToPasskeyResponse(credential repository.WebauthnCredential) *PasskeyResponse {
+	return &PasskeyResponse{
+		ID:         credential.ID.String(),
+		Transports: credential.Transports,
+		CreatedAt:  credential.CreatedAt.Time,
+	}
+}
+
+func (i *IdentityResponse) ToIdentityResponse(identity repository.UserIdentity) *IdentityResponse {
+	return &IdentityResponse{
+		Provider: identity.Provider,
+		Email:    identity.Email,
+		LinkedAt: identity.LinkedAt.Time,
+	}
+}
+
+func (r *SessionResponse) ToSessionResponse(session repository.UserSession, currentID string) *SessionResponse {
+	return &SessionResponse{
+		ID:         session.ID.String(),
+		DeviceName: session.DeviceName,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IpAddress,
+		CreatedAt:  session.CreatedAt.Time,
+		LastSeenAt: session.LastSeenAt.Time,
+		Current:    session.ID.String() == currentID,
+	}
+}
+
+func (r *RoleResponse) ToRoleResponse(role repository.Role, permissions []string) *RoleResponse {
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	return &RoleResponse{
+		Name:        role.Name,
+		Description: role.Description,
+		IsDefault:   role.IsDefault,
+		Builtin:     role.Builtin,
+		Permissions: permissions,
+	}
+}
+
+func (p *PermissionResponse) ToPermissionResponse(permission repository.Permission) *PermissionResponse {
+	return &PermissionResponse{
+		Name:        permission.Name,
+		Description: permission.Description,
+	}
+}
+
 func (u UserProfileResponse) ToProfileResponse(user repository.User) UserProfileResponse {
 	var name, profileImage string
 	if user.FullName.Valid {
@@ -48,3 +219,69 @@ func (u UserProfileResponse) ToProfileResponse(user repository.User) UserProfile
 		ProfileImage: profileImage,
 	}
 }
+
+func (r *OrganizationResponse) ToOrganizationResponse(org repository.ListUserOrganizationsRow, activeID string) *OrganizationResponse {
+	return &OrganizationResponse{
+		ID:       org.ID.String(),
+		Name:     org.Name,
+		Slug:     org.Slug,
+		Role:     org.Role,
+		JoinedAt: org.JoinedAt.Time,
+		Active:   org.ID.String() == activeID,
+	}
+}
+
+func (r *MemberResponse) ToMemberResponse(member repository.ListMembersRow) *MemberResponse {
+	return &MemberResponse{
+		UserID:   member.UserID.String(),
+		Email:    member.Email,
+		FullName: member.FullName.String,
+		Role:     member.Role,
+		JoinedAt: member.JoinedAt.Time,
+	}
+}
+
+func (r *InvitationResponse) ToInvitationResponse(invitation repository.OrganizationInvitation) *InvitationResponse {
+	return &InvitationResponse{
+		ID:        invitation.ID.String(),
+		OrgID:     invitation.OrgID.String(),
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		Status:    invitation.Status,
+		ExpiresAt: invitation.ExpiresAt.Time,
+		CreatedAt: invitation.CreatedAt.Time,
+	}
+}
+
+func (r *InvitationResponse) ToUserInvitationResponse(invitation repository.ListUserInvitationsRow) *InvitationResponse {
+	return &InvitationResponse{
+		ID:        invitation.ID.String(),
+		OrgID:     invitation.OrgID.String(),
+		OrgName:   invitation.OrgName,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt.Time,
+		CreatedAt: invitation.CreatedAt.Time,
+	}
+}
+
+func (r *UserResponse) ToUserResponse(user repository.User) *UserResponse {
+	res := &UserResponse{
+		ID:           user.ID.String(),
+		Email:        user.Email,
+		FullName:     user.FullName.String,
+		ProfileImage: user.ProfileImage.String,
+		IsVerified:   user.IsVerified.Bool,
+		CreatedAt:    user.CreatedAt.Time,
+		UpdatedAt:    user.UpdatedAt.Time,
+	}
+
+	if user.LastLogin.Valid {
+		res.LastLogin = &user.LastLogin.Time
+	}
+
+	if user.DeletedAt.Valid {
+		res.DeletedAt = &user.DeletedAt.Time
+	}
+
+	return res
+}
@@ -2,37 +2,56 @@ package handler
 
 import (
 	"errors"
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/savioruz/goth/internal/delivery/http/middleware"
 	"github.com/savioruz/goth/internal/delivery/http/response"
 
-	// Register the swagger docs
-	_ "github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/dto"
 	"github.com/savioruz/goth/internal/domains/user/service"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/logger"
 )
 
 var (
 	ErrEmailNil       = errors.New("email is nil")
 	ErrEmailNotString = errors.New("email is not string")
+	ErrClaimsNil      = errors.New("claims is nil")
 )
 
 type Handler struct {
-	service service.UserService
-	logger  logger.Interface
+	service   service.UserService
+	logger    logger.Interface
+	validator *validator.Validate
 }
 
-func New(s service.UserService, l logger.Interface) *Handler {
+func New(s service.UserService, l logger.Interface, v *validator.Validate) *Handler {
 	return &Handler{
-		service: s,
-		logger:  l,
+		service:   s,
+		logger:    l,
+		validator: v,
 	}
 }
 
-func (h *Handler) RegisterRoutes(r fiber.Router) {
+func (h *Handler) RegisterRoutes(r fiber.Router, requireAuth fiber.Handler) {
 	auth := r.Group("/users")
 
-	auth.Get("/profile", middleware.Jwt(), h.Profile)
+	auth.Get("/profile", requireAuth, h.Profile)
+	auth.Put("/me/password", requireAuth, h.ChangePassword)
+	auth.Post("/me/email", requireAuth, h.ChangeEmail)
+	auth.Post("/me/email/confirm", h.ConfirmEmailChange)
+}
+
+// RegisterAdminRoutes registers routes on a group of signed in users. require guards a route with
+// the permissions it needs.
+func (h *Handler) RegisterAdminRoutes(r fiber.Router, require func(permissions ...string) fiber.Handler) {
+	r.Get("/users", require("users:read"), h.ListUsers)
+	r.Get("/users/:id", require("users:read"), h.GetUser)
+	r.Patch("/users/:id", require("users:write"), h.UpdateUser)
+	r.Delete("/users/:id", require("users:write"), h.DeleteUser)
+	r.Post("/users/:id/restore", require("users:write"), h.RestoreUser)
+	r.Post("/users/:id/verify", require("users:write"), h.VerifyUser)
+	r.Post("/users/:id/logout", require("users:write"), h.LogoutUser)
 }
 
 // Profile godoc
@@ -74,3 +93,385 @@ func (h *Handler) Profile(ctx *fiber.Ctx) error {
 
 	return response.WithJSON(ctx, fiber.StatusOK, data)
 }
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the password of the current user. The new password must meet the password policy; broken rules are listed in fields. Every other session is signed out and a new token pair is returned.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param password body dto.ChangePasswordRequest true "Change password request"
+// @Success 200 {object} response.Data[dto.UserLoginResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/password [put]
+// @Security BearerAuth
+func (h *Handler) ChangePassword(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - user - change password - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	var req dto.ChangePasswordRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - user - change password - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - user - change password - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.ChangePassword(ctx.UserContext(), claims, req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - user - change password - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// ChangeEmail godoc
+// @Summary Change email
+// @Description Send a confirmation link to the new email address. The address changes once the link is confirmed.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param email body dto.ChangeEmailRequest true "Change email request"
+// @Success 202
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/email [post]
+// @Security BearerAuth
+func (h *Handler) ChangeEmail(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*jwt.Claims)
+	if !ok {
+		h.logger.Error("http - user - change email - claims is nil")
+
+		return response.WithError(ctx, ErrClaimsNil)
+	}
+
+	var req dto.ChangeEmailRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - user - change email - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - user - change email - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.ChangeEmail(ctx.UserContext(), claims, req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - user - change email - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusAccepted)
+}
+
+// ConfirmEmailChange godoc
+// @Summary Confirm email change
+// @Description Consume an email change token and move the account to the new address. Every session is signed out.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param confirm body dto.ConfirmEmailChangeRequest true "Confirm email change request"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /users/me/email/confirm [post]
+func (h *Handler) ConfirmEmailChange(ctx *fiber.Ctx) error {
+	var req dto.ConfirmEmailChangeRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - user - confirm email change - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - user - confirm email change - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.service.ConfirmEmailChange(ctx.UserContext(), req); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - user - confirm email change - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List users, newest first by default, filtered by email prefix, verified flag, role, created range and deletion. Pages are keyset paginated: pass next_cursor as cursor to get the next page. Requires users:read.
+// @Tags admin
+// @Produce json
+// @Param email_prefix query string false "Email address prefix"
+// @Param verified query bool false "Verified email address"
+// @Param role query string false "Name of a role of the users"
+// @Param created_from query string false "Created at or after, RFC 3339"
+// @Param created_to query string false "Created before, RFC 3339"
+// @Param deleted query string false "Deleted users" Enums(exclude, include, only) default(exclude)
+// @Param sort query string false "Sort order" Enums(created_at, -created_at, email, -email) default(-created_at)
+// @Param limit query int false "Page size" minimum(1) maximum(100) default(20)
+// @Param cursor query string false "Cursor of the next page"
+// @Success 200 {object} response.Data[dto.UserListResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users [get]
+// @Security BearerAuth
+func (h *Handler) ListUsers(ctx *fiber.Ctx) error {
+	var req dto.ListUsersRequest
+	if err := ctx.QueryParser(&req); err != nil {
+		h.logger.Error("http - admin - list users - parse query error: " + err.Error())
+
+		return response.WithError(ctx, failure.BadRequest(err))
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - admin - list users - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.ListUsers(ctx.UserContext(), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - list users - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// GetUser godoc
+// @Summary Get user
+// @Description Get a user, deleted or not. Requires users:read.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} response.Data[dto.UserResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id} [get]
+// @Security BearerAuth
+func (h *Handler) GetUser(ctx *fiber.Ctx) error {
+	data, err := h.service.GetUser(ctx.UserContext(), ctx.Params("id"))
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - get user - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// UpdateUser godoc
+// @Summary Update user
+// @Description Change the email address, name or profile image of a user; fields left out are kept. A new email address is unverified and signs the user out everywhere. Requires users:write.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param user body dto.UpdateUserRequest true "Update user request"
+// @Success 200 {object} response.Data[dto.UserResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 409 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id} [patch]
+// @Security BearerAuth
+func (h *Handler) UpdateUser(ctx *fiber.Ctx) error {
+	var req dto.UpdateUserRequest
+	if err := ctx.BodyParser(&req); err != nil {
+		h.logger.Error("http - admin - update user - body parsing error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		h.logger.Error("http - admin - update user - validate error: " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	data, err := h.service.UpdateUser(ctx.UserContext(), ctx.Params("id"), req)
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - update user - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// DeleteUser godoc
+// @Summary Delete user
+// @Description Soft delete a user and sign them out everywhere. The user can be restored. Requires users:write.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) DeleteUser(ctx *fiber.Ctx) error {
+	if err := h.service.DeleteUser(ctx.UserContext(), ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - delete user - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// RestoreUser godoc
+// @Summary Restore user
+// @Description Restore a deleted user. Requires users:write.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} response.Data[dto.UserResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id}/restore [post]
+// @Security BearerAuth
+func (h *Handler) RestoreUser(ctx *fiber.Ctx) error {
+	data, err := h.service.RestoreUser(ctx.UserContext(), ctx.Params("id"))
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - restore user - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// VerifyUser godoc
+// @Summary Verify user
+// @Description Mark the email address of a user as verified without a verification link. Requires users:write.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 200 {object} response.Data[dto.UserResponse]
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id}/verify [post]
+// @Security BearerAuth
+func (h *Handler) VerifyUser(ctx *fiber.Ctx) error {
+	data, err := h.service.VerifyUser(ctx.UserContext(), ctx.Params("id"))
+	if err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - verify user - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return response.WithJSON(ctx, fiber.StatusOK, data)
+}
+
+// LogoutUser godoc
+// @Summary Log out user
+// @Description Sign a user out of every device. Requires users:write.
+// @Tags admin
+// @Produce json
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} response.Error
+// @Failure 401 {object} response.Error
+// @Failure 403 {object} response.Error
+// @Failure 404 {object} response.Error
+// @Failure 500 {object} response.Error
+// @Router /admin/users/{id}/logout [post]
+// @Security BearerAuth
+func (h *Handler) LogoutUser(ctx *fiber.Ctx) error {
+	if err := h.service.LogoutUser(ctx.UserContext(), ctx.Params("id")); err != nil {
+		reqID := "unknown"
+		if id, ok := ctx.Locals("request_id").(string); ok {
+			reqID = id
+		}
+
+		h.logger.Error("http - admin - logout user - request_id: " + reqID + " - " + err.Error())
+
+		return response.WithError(ctx, err)
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
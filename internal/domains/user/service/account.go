@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	authService "github.com/savioruz/goth/internal/domains/auth/service"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	"github.com/savioruz/goth/pkg/postgres"
+	"github.com/savioruz/goth/pkg/secret"
+)
+
+// ChangePassword replaces the password of the signed in user after checking the current one. Every other
+// session is signed out; the caller gets a fresh token pair to stay signed in.
+func (s *userService) ChangePassword(
+	ctx context.Context,
+	claims *jwt.Claims,
+	req dto.ChangePasswordRequest,
+) (*dto.UserLoginResponse, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("change password - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("change password - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.currentUser(ctx, tx, claims)
+	if err != nil {
+		s.logger.Error("change password - service - failed to get user: %w", err)
+
+		return nil, err
+	}
+
+	if err = s.checkPassword(user, req.CurrentPassword); err != nil {
+		s.logger.Error("change password - service - invalid current password")
+
+		return nil, err
+	}
+
+	err = authService.CheckPassword(s.policy, "new_password", req.NewPassword, user.Email, user.FullName.String)
+	if err != nil {
+		s.logger.Error("change password - service - password rejected by policy: %w", err)
+
+		return nil, err
+	}
+
+	hash, err := s.hashers.Hash(req.NewPassword)
+	if err != nil {
+		s.logger.Error("change password - service - failed to generate password: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	params := updateUserParams(user)
+	params.Password = pgtype.Text{String: hash, Valid: true}
+
+	user, err = s.repo.UpdateUser(ctx, tx, params)
+	if err != nil {
+		s.logger.Error("change password - service - failed to update user: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	// Other sessions are signed out before the commit; new tokens are issued below.
+	if err = s.tokens.RevokeAll(ctx, user.ID.String()); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("change password - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	s.invalidateCache(ctx, user.Email)
+
+	return s.tokens.Issue(ctx, user)
+}
+
+// ChangeEmail sends a confirmation link to the new address. The address only changes once the link is
+// opened, see ConfirmEmailChange.
+func (s *userService) ChangeEmail(ctx context.Context, claims *jwt.Claims, req dto.ChangeEmailRequest) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("change email - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("change email - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.currentUser(ctx, tx, claims)
+	if err != nil {
+		s.logger.Error("change email - service - failed to get user: %w", err)
+
+		return err
+	}
+
+	if err = s.checkPassword(user, req.Password); err != nil {
+		s.logger.Error("change email - service - invalid password")
+
+		return err
+	}
+
+	if strings.EqualFold(user.Email, req.Email) {
+		s.logger.Error("change email - service - email unchanged")
+
+		return failure.BadRequestFromString("email unchanged")
+	}
+
+	if err = s.checkEmailAvailable(ctx, tx, req.Email); err != nil {
+		s.logger.Error("change email - service - email not available: %w", err)
+
+		return err
+	}
+
+	if err = s.repo.InvalidateEmailChanges(ctx, tx, user.ID); err != nil {
+		s.logger.Error("change email - service - failed to invalidate email changes: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	token, hash, err := secret.NewToken()
+	if err != nil {
+		s.logger.Error("change email - service - failed to generate token: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	_, err = s.repo.CreateEmailChange(ctx, tx, repository.CreateEmailChangeParams{
+		UserID:   user.ID,
+		NewEmail: req.Email,
+		Token:    hash,
+	})
+	if err != nil {
+		s.logger.Error("change email - service - failed to create email change: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("change email - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.notifier.SendEmailChange(ctx, user, req.Email, token); err != nil {
+		s.logger.Error("change email - service - failed to send email change: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange consumes an email change token and moves the account to the new, now verified, address.
+// Issued tokens still carry the old address, so every session is signed out.
+func (s *userService) ConfirmEmailChange(ctx context.Context, req dto.ConfirmEmailChangeRequest) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("confirm email change - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("confirm email change - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	change, err := s.repo.GetEmailChangeByToken(ctx, tx, secret.Hash(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("confirm email change - service - change token not found")
+
+		return failure.BadRequestFromString("invalid or expired email change token")
+	}
+
+	if err != nil {
+		s.logger.Error("confirm email change - service - failed to get email change: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	_, err = s.repo.ConsumeEmailChange(ctx, tx, change.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("confirm email change - service - change token already used")
+
+		return failure.BadRequestFromString("invalid or expired email change token")
+	}
+
+	if err != nil {
+		s.logger.Error("confirm email change - service - failed to consume email change: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	user, err := s.repo.GetUserByID(ctx, tx, change.UserID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.logger.Error("confirm email change - service - user not found")
+
+		return failure.BadRequestFromString("invalid or expired email change token")
+	}
+
+	if err != nil {
+		s.logger.Error("confirm email change - service - failed to get user: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.checkEmailAvailable(ctx, tx, change.NewEmail); err != nil {
+		s.logger.Error("confirm email change - service - email not available: %w", err)
+
+		return err
+	}
+
+	params := updateUserParams(user)
+	params.Email = change.NewEmail
+	params.IsVerified = pgtype.Bool{Bool: true, Valid: true}
+
+	updated, err := s.repo.UpdateUser(ctx, tx, params)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			s.logger.Error("confirm email change - service - email already in use")
+
+			return failure.Conflict("email already in use")
+		}
+
+		s.logger.Error("confirm email change - service - failed to update user: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.tokens.RevokeAll(ctx, user.ID.String()); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("confirm email change - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	s.invalidateCache(ctx, user.Email)
+	s.invalidateCache(ctx, updated.Email)
+
+	return nil
+}
+
+func (s *userService) currentUser(ctx context.Context, db repository.DBTX, claims *jwt.Claims) (repository.User, error) {
+	var id pgtype.UUID
+	if err := id.Scan(claims.ID); err != nil {
+		return repository.User{}, failure.Unauthorized("invalid token subject")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, db, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repository.User{}, failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		return repository.User{}, failure.InternalError(err)
+	}
+
+	return user, nil
+}
+
+// checkPassword compares against the stored hash. Accounts created through OAuth have no password
+// and have to set one with the password reset flow first.
+func (s *userService) checkPassword(user repository.User, password string) error {
+	if !user.Password.Valid || user.Password.String == "" {
+		return failure.BadRequestFromString("password not set")
+	}
+
+	ok, _, err := s.hashers.Verify(password, user.Password.String)
+	if err != nil {
+		s.logger.Error("user - service - failed to verify password: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if !ok {
+		return failure.Unauthorized("invalid password")
+	}
+
+	return nil
+}
+
+func (s *userService) checkEmailAvailable(ctx context.Context, db repository.DBTX, email string) error {
+	exist, err := s.repo.GetUserByEmail(ctx, db, email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return failure.InternalError(err)
+	}
+
+	if exist.Email != "" {
+		return failure.Conflict("email already in use")
+	}
+
+	return nil
+}
+
+func (s *userService) invalidateCache(ctx context.Context, email string) {
+	if err := s.cache.Delete(ctx, fmt.Sprintf(cacheGetUserKey, email)); err != nil {
+		s.logger.Error("service - user - failed to invalidate cache: %w", err)
+	}
+}
+
+func updateUserParams(user repository.User) repository.UpdateUserParams {
+	return repository.UpdateUserParams{
+		Email:        user.Email,
+		Password:     user.Password,
+		FullName:     user.FullName,
+		ProfileImage: user.ProfileImage,
+		IsVerified:   user.IsVerified,
+		ID:           user.ID,
+	}
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/password"
+	"github.com/savioruz/goth/pkg/postgres"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/savioruz/goth/pkg/secret"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserService_ChangePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockRedis, mockTokens, mockNotifier, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("current-password"), bcrypt.MinCost)
+	userID := uuid.New()
+	mockUser := repository.User{
+		ID:       pgtype.UUID{Bytes: userID, Valid: true},
+		Email:    "test@example.com",
+		Password: pgtype.Text{String: string(hashed), Valid: true},
+	}
+	claims := &jwt.Claims{ID: userID.String(), Email: "test@example.com"}
+	req := dto.ChangePasswordRequest{CurrentPassword: "current-password", NewPassword: "new-password"}
+
+	t.Run("error: user not found", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(repository.User{}, pgx.ErrNoRows)
+
+		res, err := service.ChangePassword(ctx, claims, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: wrong current password", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockUser, nil)
+
+		res, err := service.ChangePassword(ctx, claims, dto.ChangePasswordRequest{
+			CurrentPassword: "wrong-password",
+			NewPassword:     "new-password",
+		})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusUnauthorized, failure.GetCode(err))
+	})
+
+	t.Run("error: password not set", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		oauthUser := mockUser
+		oauthUser.Password = pgtype.Text{}
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(oauthUser, nil)
+
+		res, err := service.ChangePassword(ctx, claims, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: new password rejected by policy", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockUser, nil)
+
+		res, err := service.ChangePassword(ctx, claims, dto.ChangePasswordRequest{
+			CurrentPassword: "current-password",
+			NewPassword:     "test1234",
+		})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+		assert.Equal(t, []failure.FieldError{{
+			Field:   "new_password",
+			Code:    password.CodePersonalInfo,
+			Message: "must not contain your email address or name",
+		}}, failure.GetFields(err))
+	})
+
+	t.Run("error: failure revoking sessions", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			UpdateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(mockUser, nil)
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(failure.InternalError(mockError))
+
+		res, err := service.ChangePassword(ctx, claims, req)
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusInternalServerError, failure.GetCode(err))
+	})
+
+	t.Run("success: password changed and other sessions revoked", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			UpdateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.UpdateUserParams) (repository.User, error) {
+				assert.Equal(t, mockUser.ID, arg.ID)
+				assert.Equal(t, mockUser.Email, arg.Email)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(arg.Password.String), []byte("new-password")))
+
+				updated := mockUser
+				updated.Password = arg.Password
+
+				return updated, nil
+			})
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "cache:get_user:test@example.com").Return(nil)
+		mockTokens.EXPECT().
+			Issue(gomock.Any(), gomock.Any()).
+			Return(&dto.UserLoginResponse{AccessToken: "access", RefreshToken: "refresh"}, nil)
+
+		res, err := service.ChangePassword(ctx, claims, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "access", res.AccessToken)
+	})
+}
+
+func TestUserService_ChangeEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockRedis, mockTokens, mockNotifier, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	hashed, _ := bcrypt.GenerateFromPassword([]byte("current-password"), bcrypt.MinCost)
+	userID := uuid.New()
+	mockUser := repository.User{
+		ID:       pgtype.UUID{Bytes: userID, Valid: true},
+		Email:    "test@example.com",
+		Password: pgtype.Text{String: string(hashed), Valid: true},
+	}
+	claims := &jwt.Claims{ID: userID.String(), Email: "test@example.com"}
+	req := dto.ChangeEmailRequest{Email: "new@example.com", Password: "current-password"}
+
+	t.Run("error: email unchanged", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockUser, nil)
+
+		err := service.ChangeEmail(ctx, claims, dto.ChangeEmailRequest{Email: "Test@Example.com", Password: "current-password"})
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: email already in use", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "new@example.com").
+			Return(repository.User{Email: "new@example.com"}, nil)
+
+		err := service.ChangeEmail(ctx, claims, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: confirmation sent to the new address", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		var stored, sent string
+
+		mockQuerier.EXPECT().
+			GetUserByID(gomock.Any(), gomock.Any(), mockUser.ID).
+			Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "new@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().InvalidateEmailChanges(gomock.Any(), gomock.Any(), mockUser.ID).Return(nil)
+		mockQuerier.EXPECT().
+			CreateEmailChange(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.CreateEmailChangeParams) (repository.EmailChange, error) {
+				assert.Equal(t, "new@example.com", arg.NewEmail)
+				stored = arg.Token
+
+				return repository.EmailChange{}, nil
+			})
+		mockNotifier.EXPECT().
+			SendEmailChange(gomock.Any(), mockUser, "new@example.com", gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.User, _, token string) error {
+				sent = token
+
+				return nil
+			})
+
+		err := service.ChangeEmail(ctx, claims, req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, secret.Hash(sent), stored)
+	})
+}
+
+func TestUserService_ConfirmEmailChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockRedis, mockTokens, mockNotifier, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	mockUser := repository.User{
+		ID:         userID,
+		Email:      "test@example.com",
+		IsVerified: pgtype.Bool{Bool: false, Valid: true},
+	}
+	change := repository.EmailChange{
+		ID:       pgtype.UUID{Bytes: uuid.New(), Valid: true},
+		UserID:   userID,
+		NewEmail: "new@example.com",
+		Token:    secret.Hash("plain-token"),
+	}
+	req := dto.ConfirmEmailChangeRequest{Token: "plain-token"}
+
+	t.Run("error: unknown or expired token", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetEmailChangeByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(repository.EmailChange{}, pgx.ErrNoRows)
+
+		err := service.ConfirmEmailChange(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: email taken in the meantime", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetEmailChangeByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(change, nil)
+		mockQuerier.EXPECT().ConsumeEmailChange(gomock.Any(), gomock.Any(), change.ID).Return(change, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "new@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().
+			UpdateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(repository.User{}, &pgconn.PgError{Code: postgres.UniqueViolation})
+
+		err := service.ConfirmEmailChange(ctx, req)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: email changed and sessions revoked", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().
+			GetEmailChangeByToken(gomock.Any(), gomock.Any(), secret.Hash("plain-token")).
+			Return(change, nil)
+		mockQuerier.EXPECT().ConsumeEmailChange(gomock.Any(), gomock.Any(), change.ID).Return(change, nil)
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().
+			GetUserByEmail(gomock.Any(), gomock.Any(), "new@example.com").
+			Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().
+			UpdateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.UpdateUserParams) (repository.User, error) {
+				assert.Equal(t, "new@example.com", arg.Email)
+				assert.True(t, arg.IsVerified.Bool)
+
+				return repository.User{ID: userID, Email: arg.Email, IsVerified: arg.IsVerified}, nil
+			})
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "cache:get_user:test@example.com").Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "cache:get_user:new@example.com").Return(nil)
+
+		err := service.ConfirmEmailChange(ctx, req)
+
+		assert.NoError(t, err)
+	})
+}
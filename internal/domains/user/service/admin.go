@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/postgres"
+)
+
+const (
+	defaultUserSort  = "-created_at"
+	defaultUserLimit = 20
+)
+
+// likeEscaper escapes the wildcards of LIKE patterns, so that an email prefix only matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// userCursor marks the last user of a page by its sort value and ID. It is handed out opaque, and
+// only continues the sort it was made for.
+type userCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// ListUsers returns a page of users matching the filters of the request, and a cursor to the next page
+// if there is one. Pages are keyset paginated, so that users created meanwhile neither shift nor
+// repeat them.
+func (s *userService) ListUsers(ctx context.Context, req dto.ListUsersRequest) (*dto.UserListResponse, error) {
+	params, limit, err := listUsersParams(req)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := s.repo.ListUsers(ctx, s.db, params)
+	if err != nil {
+		s.logger.Error("list users - service - failed to list users: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	res := &dto.UserListResponse{Users: make([]*dto.UserResponse, 0, min(len(users), limit))}
+
+	if len(users) > limit {
+		users = users[:limit]
+		res.NextCursor = encodeUserCursor(params.Sort, users[len(users)-1])
+	}
+
+	for _, user := range users {
+		res.Users = append(res.Users, new(dto.UserResponse).ToUserResponse(user))
+	}
+
+	return res, nil
+}
+
+// GetUser returns a user, deleted or not.
+func (s *userService) GetUser(ctx context.Context, id string) (*dto.UserResponse, error) {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByIDWithDeleted(ctx, s.db, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("get user - service - failed to get user by id: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.UserResponse).ToUserResponse(user), nil
+}
+
+// UpdateUser changes the account of a user. A new email address is unverified and signs the user out
+// everywhere, as when users change it themselves. Deleted users have to be restored first.
+func (s *userService) UpdateUser(ctx context.Context, id string, req dto.UpdateUserRequest) (*dto.UserResponse, error) {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("update user - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("update user - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.repo.GetUserByID(ctx, tx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("update user - service - failed to get user by id: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	params := updateUserParams(user)
+	emailChanged := req.Email != nil && *req.Email != user.Email
+
+	if emailChanged {
+		if err = s.checkEmailAvailable(ctx, tx, *req.Email); err != nil {
+			s.logger.Error("update user - service - email not available: %w", err)
+
+			return nil, err
+		}
+
+		params.Email = *req.Email
+		params.IsVerified = pgtype.Bool{Bool: false, Valid: true}
+	}
+
+	if req.FullName != nil {
+		params.FullName = pgtype.Text{String: *req.FullName, Valid: true}
+	}
+
+	if req.ProfileImage != nil {
+		params.ProfileImage = pgtype.Text{String: *req.ProfileImage, Valid: true}
+	}
+
+	updated, err := s.repo.UpdateUser(ctx, tx, params)
+	if err != nil {
+		if postgres.IsUniqueViolation(err) {
+			s.logger.Error("update user - service - email already in use")
+
+			return nil, failure.Conflict("email already in use")
+		}
+
+		s.logger.Error("update user - service - failed to update user: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if emailChanged {
+		if err = s.tokens.RevokeAll(ctx, user.ID.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("update user - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	s.invalidateCache(ctx, user.Email)
+
+	if emailChanged {
+		s.invalidateCache(ctx, updated.Email)
+	}
+
+	return new(dto.UserResponse).ToUserResponse(updated), nil
+}
+
+// DeleteUser soft deletes a user and signs them out everywhere. The account keeps its email address
+// and can be restored.
+func (s *userService) DeleteUser(ctx context.Context, id string) error {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("delete user - service - failed to begin transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("delete user - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.repo.DeleteUser(ctx, tx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("delete user - service - failed to delete user: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	if err = s.tokens.RevokeAll(ctx, user.ID.String()); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("delete user - service - failed to commit transaction: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	s.invalidateCache(ctx, user.Email)
+
+	return nil
+}
+
+// RestoreUser undoes the deletion of a user. They sign in again like before.
+func (s *userService) RestoreUser(ctx context.Context, id string) (*dto.UserResponse, error) {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.RestoreUser(ctx, s.db, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.NotFound("deleted user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("restore user - service - failed to restore user: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.UserResponse).ToUserResponse(user), nil
+}
+
+// VerifyUser marks the email address of a user as verified without a verification link, and voids the
+// links sent before.
+func (s *userService) VerifyUser(ctx context.Context, id string) (*dto.UserResponse, error) {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error("verify user - service - failed to begin transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+	defer func(tx pgx.Tx, ctx context.Context) {
+		err := tx.Rollback(ctx)
+		if err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			s.logger.Error("verify user - service - failed to rollback transaction: %w", err)
+		}
+	}(tx, ctx)
+
+	user, err := s.repo.VerifyEmail(ctx, tx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("verify user - service - failed to verify email: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = s.repo.InvalidateEmailVerifications(ctx, tx, userID); err != nil {
+		s.logger.Error("verify user - service - failed to invalidate email verifications: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.Error("verify user - service - failed to commit transaction: %w", err)
+
+		return nil, failure.InternalError(err)
+	}
+
+	return new(dto.UserResponse).ToUserResponse(user), nil
+}
+
+// LogoutUser signs a user out of every device.
+func (s *userService) LogoutUser(ctx context.Context, id string) error {
+	userID, err := parseUserID(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.GetUserByID(ctx, s.db, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return failure.NotFound("user not found")
+	}
+
+	if err != nil {
+		s.logger.Error("logout user - service - failed to get user by id: %w", err)
+
+		return failure.InternalError(err)
+	}
+
+	return s.tokens.RevokeAll(ctx, id)
+}
+
+// listUsersParams turns the request into the query parameters, fetching one user more than the limit
+// to tell whether there is a next page.
+func listUsersParams(req dto.ListUsersRequest) (repository.ListUsersParams, int, error) {
+	params := repository.ListUsersParams{Sort: req.Sort}
+	if params.Sort == "" {
+		params.Sort = defaultUserSort
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultUserLimit
+	}
+
+	params.PageSize = int32(limit + 1) //nolint:gosec // the limit is validated to at most 100
+
+	if req.EmailPrefix != "" {
+		params.EmailPrefix = pgtype.Text{String: likeEscaper.Replace(req.EmailPrefix), Valid: true}
+	}
+
+	if req.Verified != "" {
+		params.IsVerified = pgtype.Bool{Bool: req.Verified == "true", Valid: true}
+	}
+
+	if req.Role != "" {
+		params.Role = pgtype.Text{String: req.Role, Valid: true}
+	}
+
+	switch req.Deleted {
+	case "include":
+	case "only":
+		params.Deleted = pgtype.Bool{Bool: true, Valid: true}
+	default:
+		params.Deleted = pgtype.Bool{Bool: false, Valid: true}
+	}
+
+	var err error
+	if params.CreatedFrom, err = parseTimestamp(req.CreatedFrom); err != nil {
+		return repository.ListUsersParams{}, 0, failure.BadRequestFromString("invalid created_from")
+	}
+
+	if params.CreatedTo, err = parseTimestamp(req.CreatedTo); err != nil {
+		return repository.ListUsersParams{}, 0, failure.BadRequestFromString("invalid created_to")
+	}
+
+	if req.Cursor != "" {
+		if err = decodeUserCursor(req.Cursor, &params); err != nil {
+			return repository.ListUsersParams{}, 0, failure.BadRequestFromString("invalid cursor")
+		}
+	}
+
+	return params, limit, nil
+}
+
+func encodeUserCursor(sort string, user repository.User) string {
+	c := userCursor{Sort: sort, Value: user.Email, ID: user.ID.String()}
+	if strings.TrimPrefix(sort, "-") == "created_at" {
+		c.Value = user.CreatedAt.Time.Format(time.RFC3339Nano)
+	}
+
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeUserCursor sets the cursor of params, which must be for the sort of params.
+func decodeUserCursor(s string, params *repository.ListUsersParams) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	var c userCursor
+	if err = json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	if c.Sort != params.Sort {
+		return errors.New("cursor of another sort")
+	}
+
+	if err = params.CursorID.Scan(c.ID); err != nil {
+		return err
+	}
+
+	if strings.TrimPrefix(c.Sort, "-") == "email" {
+		params.CursorEmail = pgtype.Text{String: c.Value, Valid: true}
+
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return err
+	}
+
+	params.CursorCreatedAt = pgtype.Timestamp{Time: t, Valid: true}
+
+	return nil
+}
+
+// parseTimestamp parses an RFC 3339 time, which is unset when empty.
+func parseTimestamp(s string) (pgtype.Timestamp, error) {
+	if s == "" {
+		return pgtype.Timestamp{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return pgtype.Timestamp{}, err
+	}
+
+	return pgtype.Timestamp{Time: t.UTC(), Valid: true}, nil
+}
+
+func parseUserID(id string) (pgtype.UUID, error) {
+	var userID pgtype.UUID
+	if err := userID.Scan(id); err != nil {
+		return pgtype.UUID{}, failure.BadRequestFromString("invalid user id")
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
+	"github.com/savioruz/goth/internal/domains/user/dto"
+	"github.com/savioruz/goth/internal/domains/user/mock"
+	"github.com/savioruz/goth/internal/domains/user/repository"
+	"github.com/savioruz/goth/pkg/failure"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/password"
+	redis "github.com/savioruz/goth/pkg/redis/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserService_ListUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, nil, nil, nil, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	users := []repository.User{
+		{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Email: "a@example.com", CreatedAt: pgtype.Timestamp{Time: created, Valid: true}},
+		{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Email: "b@example.com", CreatedAt: pgtype.Timestamp{Time: created, Valid: true}},
+		{ID: pgtype.UUID{Bytes: uuid.New(), Valid: true}, Email: "c@example.com", CreatedAt: pgtype.Timestamp{Time: created, Valid: true}},
+	}
+
+	t.Run("error: invalid cursor", func(t *testing.T) {
+		res, err := service.ListUsers(ctx, dto.ListUsersRequest{Cursor: "not a cursor"})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("success: filters become parameters", func(t *testing.T) {
+		mockQuerier.EXPECT().ListUsers(gomock.Any(), gomock.Any(), repository.ListUsersParams{
+			EmailPrefix: pgtype.Text{String: `a\_b\%`, Valid: true},
+			IsVerified:  pgtype.Bool{Bool: true, Valid: true},
+			Role:        pgtype.Text{String: "admin", Valid: true},
+			CreatedFrom: pgtype.Timestamp{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+			CreatedTo:   pgtype.Timestamp{Time: time.Date(2025, 12, 31, 17, 0, 0, 0, time.UTC), Valid: true},
+			Deleted:     pgtype.Bool{Bool: true, Valid: true},
+			Sort:        "email",
+			PageSize:    11,
+		}).Return(nil, nil)
+
+		res, err := service.ListUsers(ctx, dto.ListUsersRequest{
+			EmailPrefix: "a_b%",
+			Verified:    "true",
+			Role:        "admin",
+			CreatedFrom: "2025-01-01T00:00:00Z",
+			CreatedTo:   "2026-01-01T00:00:00+07:00",
+			Deleted:     "only",
+			Sort:        "email",
+			Limit:       10,
+		})
+
+		assert.NoError(t, err)
+		assert.Empty(t, res.Users)
+		assert.Empty(t, res.NextCursor)
+	})
+
+	t.Run("success: cursor continues after the last user", func(t *testing.T) {
+		mockQuerier.EXPECT().ListUsers(gomock.Any(), gomock.Any(), repository.ListUsersParams{
+			Deleted:  pgtype.Bool{Bool: false, Valid: true},
+			Sort:     defaultUserSort,
+			PageSize: 3,
+		}).Return(users, nil)
+
+		res, err := service.ListUsers(ctx, dto.ListUsersRequest{Limit: 2})
+
+		assert.NoError(t, err)
+		assert.Len(t, res.Users, 2)
+		assert.NotEmpty(t, res.NextCursor)
+
+		mockQuerier.EXPECT().ListUsers(gomock.Any(), gomock.Any(), repository.ListUsersParams{
+			Deleted:         pgtype.Bool{Bool: false, Valid: true},
+			CursorID:        users[1].ID,
+			Sort:            defaultUserSort,
+			CursorCreatedAt: pgtype.Timestamp{Time: created, Valid: true},
+			PageSize:        3,
+		}).Return(users[2:], nil)
+
+		res, err = service.ListUsers(ctx, dto.ListUsersRequest{Limit: 2, Cursor: res.NextCursor})
+
+		assert.NoError(t, err)
+		assert.Len(t, res.Users, 1)
+		assert.Equal(t, users[2].ID.String(), res.Users[0].ID)
+		assert.Empty(t, res.NextCursor)
+	})
+
+	t.Run("error: cursor of another sort", func(t *testing.T) {
+		mockQuerier.EXPECT().ListUsers(gomock.Any(), gomock.Any(), gomock.Any()).Return(users, nil)
+
+		res, err := service.ListUsers(ctx, dto.ListUsersRequest{Limit: 1})
+		assert.NoError(t, err)
+
+		res, err = service.ListUsers(ctx, dto.ListUsersRequest{Limit: 1, Sort: "email", Cursor: res.NextCursor})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+}
+
+func TestUserService_UpdateUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockRedis, mockTokens, nil, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	mockUser := repository.User{
+		ID:         userID,
+		Email:      "test@example.com",
+		FullName:   pgtype.Text{String: "Test User", Valid: true},
+		IsVerified: pgtype.Bool{Bool: true, Valid: true},
+	}
+	email := "new@example.com"
+	name := "New Name"
+
+	t.Run("error: invalid user id", func(t *testing.T) {
+		res, err := service.UpdateUser(ctx, "invalid", dto.UpdateUserRequest{FullName: &name})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusBadRequest, failure.GetCode(err))
+	})
+
+	t.Run("error: deleted user is not found", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{}, pgx.ErrNoRows)
+
+		res, err := service.UpdateUser(ctx, userID.String(), dto.UpdateUserRequest{FullName: &name})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("error: email already in use", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any())
+
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), email).
+			Return(repository.User{Email: email}, nil)
+
+		res, err := service.UpdateUser(ctx, userID.String(), dto.UpdateUserRequest{Email: &email})
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusConflict, failure.GetCode(err))
+	})
+
+	t.Run("success: name changed", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().UpdateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.UpdateUserParams) (repository.User, error) {
+				assert.Equal(t, "test@example.com", arg.Email)
+				assert.Equal(t, name, arg.FullName.String)
+				assert.True(t, arg.IsVerified.Bool)
+
+				return repository.User{ID: userID, Email: arg.Email, FullName: arg.FullName}, nil
+			})
+		mockRedis.EXPECT().Delete(gomock.Any(), "cache:get_user:test@example.com").Return(nil)
+
+		res, err := service.UpdateUser(ctx, userID.String(), dto.UpdateUserRequest{FullName: &name})
+
+		assert.NoError(t, err)
+		assert.Equal(t, name, res.FullName)
+	})
+
+	t.Run("success: new email is unverified and signs out", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(mockUser, nil)
+		mockQuerier.EXPECT().GetUserByEmail(gomock.Any(), gomock.Any(), email).Return(repository.User{}, pgx.ErrNoRows)
+		mockQuerier.EXPECT().UpdateUser(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ repository.DBTX, arg repository.UpdateUserParams) (repository.User, error) {
+				assert.Equal(t, email, arg.Email)
+				assert.False(t, arg.IsVerified.Bool)
+
+				return repository.User{ID: userID, Email: arg.Email, IsVerified: arg.IsVerified}, nil
+			})
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "cache:get_user:test@example.com").Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "cache:get_user:new@example.com").Return(nil)
+
+		res, err := service.UpdateUser(ctx, userID.String(), dto.UpdateUserRequest{Email: &email})
+
+		assert.NoError(t, err)
+		assert.Equal(t, email, res.Email)
+		assert.False(t, res.IsVerified)
+	})
+}
+
+func TestUserService_DeleteUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, mockRedis, mockTokens, nil, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	t.Run("error: already deleted", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().DeleteUser(gomock.Any(), gomock.Any(), userID).Return(repository.User{}, pgx.ErrNoRows)
+
+		err := service.DeleteUser(ctx, userID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: deleted and signed out", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().DeleteUser(gomock.Any(), gomock.Any(), userID).
+			Return(repository.User{ID: userID, Email: "test@example.com"}, nil)
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(nil)
+		mockRedis.EXPECT().Delete(gomock.Any(), "cache:get_user:test@example.com").Return(nil)
+
+		err := service.DeleteUser(ctx, userID.String())
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestUserService_RestoreUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, nil, nil, nil, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	t.Run("error: user is not deleted", func(t *testing.T) {
+		mockQuerier.EXPECT().RestoreUser(gomock.Any(), gomock.Any(), userID).Return(repository.User{}, pgx.ErrNoRows)
+
+		res, err := service.RestoreUser(ctx, userID.String())
+
+		assert.Error(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success", func(t *testing.T) {
+		mockQuerier.EXPECT().RestoreUser(gomock.Any(), gomock.Any(), userID).
+			Return(repository.User{ID: userID, Email: "test@example.com"}, nil)
+
+		res, err := service.RestoreUser(ctx, userID.String())
+
+		assert.NoError(t, err)
+		assert.Equal(t, userID.String(), res.ID)
+		assert.Nil(t, res.DeletedAt)
+	})
+}
+
+func TestUserService_VerifyUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, nil, nil, nil, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	t.Run("success: verified and links voided", func(t *testing.T) {
+		mockPgx.ExpectBegin()
+		mockPgx.ExpectCommit()
+		mockPgx.ExpectRollback()
+
+		mockQuerier.EXPECT().VerifyEmail(gomock.Any(), gomock.Any(), userID).
+			Return(repository.User{ID: userID, IsVerified: pgtype.Bool{Bool: true, Valid: true}}, nil)
+		mockQuerier.EXPECT().InvalidateEmailVerifications(gomock.Any(), gomock.Any(), userID).Return(nil)
+
+		res, err := service.VerifyUser(ctx, userID.String())
+
+		assert.NoError(t, err)
+		assert.True(t, res.IsVerified)
+	})
+}
+
+func TestUserService_LogoutUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockQuerier := mock.NewMockQuerier(ctrl)
+	mockPgx, _ := pgxmock.NewPool()
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockLogger := log.NewMockInterface(ctrl)
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
+
+	service := New(mockPgx, mockQuerier, nil, mockTokens, nil, password.NewPolicy(), hashers, &config.Config{}, mockLogger)
+
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	t.Run("error: user not found", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{}, pgx.ErrNoRows)
+
+		err := service.LogoutUser(ctx, userID.String())
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, failure.GetCode(err))
+	})
+
+	t.Run("success: every session revoked", func(t *testing.T) {
+		mockQuerier.EXPECT().GetUserByID(gomock.Any(), gomock.Any(), userID).Return(repository.User{ID: userID}, nil)
+		mockTokens.EXPECT().RevokeAll(gomock.Any(), userID.String()).Return(nil)
+
+		err := service.LogoutUser(ctx, userID.String())
+
+		assert.NoError(t, err)
+	})
+}
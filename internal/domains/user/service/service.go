@@ -6,16 +6,29 @@ import (
 	"time"
 
 	"github.com/savioruz/goth/config"
+	authService "github.com/savioruz/goth/internal/domains/auth/service"
 	"github.com/savioruz/goth/internal/domains/user/dto"
 	"github.com/savioruz/goth/internal/domains/user/repository"
 	"github.com/savioruz/goth/pkg/failure"
+	"github.com/savioruz/goth/pkg/jwt"
 	"github.com/savioruz/goth/pkg/logger"
+	"github.com/savioruz/goth/pkg/password"
 	"github.com/savioruz/goth/pkg/postgres"
 	"github.com/savioruz/goth/pkg/redis"
 )
 
 type UserService interface {
 	Profile(ctx context.Context, email string) (res dto.UserProfileResponse, err error)
+	ChangePassword(ctx context.Context, claims *jwt.Claims, req dto.ChangePasswordRequest) (*dto.UserLoginResponse, error)
+	ChangeEmail(ctx context.Context, claims *jwt.Claims, req dto.ChangeEmailRequest) error
+	ConfirmEmailChange(ctx context.Context, req dto.ConfirmEmailChangeRequest) error
+	ListUsers(ctx context.Context, req dto.ListUsersRequest) (*dto.UserListResponse, error)
+	GetUser(ctx context.Context, id string) (*dto.UserResponse, error)
+	UpdateUser(ctx context.Context, id string, req dto.UpdateUserRequest) (*dto.UserResponse, error)
+	DeleteUser(ctx context.Context, id string) error
+	RestoreUser(ctx context.Context, id string) (*dto.UserResponse, error)
+	VerifyUser(ctx context.Context, id string) (*dto.UserResponse, error)
+	LogoutUser(ctx context.Context, id string) error
 }
 
 const (
@@ -24,20 +37,38 @@ const (
 )
 
 type userService struct {
-	db     postgres.PgxIface
-	repo   repository.Querier
-	cache  redis.IRedisCache
-	config *config.Config
-	logger logger.Interface
+	db       postgres.PgxIface
+	repo     repository.Querier
+	cache    redis.IRedisCache
+	tokens   authService.TokenService
+	notifier authService.Notifier
+	policy   *password.Policy
+	hashers  *password.Hashers
+	config   *config.Config
+	logger   logger.Interface
 }
 
-func New(db postgres.PgxIface, repo repository.Querier, cache redis.IRedisCache, cfg *config.Config, l logger.Interface) UserService {
+func New(
+	db postgres.PgxIface,
+	repo repository.Querier,
+	cache redis.IRedisCache,
+	tokens authService.TokenService,
+	notifier authService.Notifier,
+	policy *password.Policy,
+	hashers *password.Hashers,
+	cfg *config.Config,
+	l logger.Interface,
+) UserService {
 	return &userService{
-		db:     db,
-		repo:   repo,
-		cache:  cache,
-		config: cfg,
-		logger: l,
+		db:       db,
+		repo:     repo,
+		cache:    cache,
+		tokens:   tokens,
+		notifier: notifier,
+		policy:   policy,
+		hashers:  hashers,
+		config:   cfg,
+		logger:   l,
 	}
 }
 
@@ -11,14 +11,17 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/pashagolub/pgxmock/v4"
 	"github.com/savioruz/goth/config"
+	authMock "github.com/savioruz/goth/internal/domains/auth/mock"
 	"github.com/savioruz/goth/internal/domains/user/dto"
 	"github.com/savioruz/goth/internal/domains/user/mock"
 	"github.com/savioruz/goth/internal/domains/user/repository"
 	"github.com/savioruz/goth/pkg/failure"
 	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/savioruz/goth/pkg/password"
 	redis "github.com/savioruz/goth/pkg/redis/mock"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserService_Profile(t *testing.T) {
@@ -34,18 +37,19 @@ func TestUserService_Profile(t *testing.T) {
 	mockQuerier := mock.NewMockQuerier(ctrl)
 	mockPgx, _ := pgxmock.NewPool()
 	mockRedis := redis.NewMockIRedisCache(ctrl)
+	mockTokens := authMock.NewMockTokenService(ctrl)
+	mockNotifier := authMock.NewMockNotifier(ctrl)
 	mockLogger := log.NewMockInterface(ctrl)
 	mockError := errors.New("error")
+	hashers := password.NewHashers(password.NewBcrypt(bcrypt.DefaultCost))
 
-	service := New(mockPgx, mockQuerier, mockRedis, cfg, mockLogger)
+	service := New(mockPgx, mockQuerier, mockRedis, mockTokens, mockNotifier, password.NewPolicy(), hashers, cfg, mockLogger)
 
 	mockID := uuid.New()
 	profileMock := repository.User{
 		ID:           pgtype.UUID{Bytes: mockID, Valid: true},
 		Email:        "string@gmail.com",
 		Password:     pgtype.Text{String: "strongpassword", Valid: true},
-		Level:        "user",
-		GoogleID:     pgtype.Text{String: "google123", Valid: true},
 		FullName:     pgtype.Text{String: "Test User", Valid: true},
 		ProfileImage: pgtype.Text{String: "https://example.com/profile.jpg", Valid: true},
 		IsVerified:   pgtype.Bool{Bool: true, Valid: true},
@@ -92,7 +96,11 @@ func TestUserService_Profile(t *testing.T) {
 		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any()).AnyTimes()
 		mockLogger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
 
-		mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		// The profile is cached in the background, wait for it before the controller checks the calls.
+		saved := make(chan struct{})
+		mockRedis.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Do(func(context.Context, string, any, int) { close(saved) }).
+			Return(nil)
 
 		mockQuerier.EXPECT().
 			GetUserByEmail(gomock.Any(), gomock.Any(), "string@gmail.com").
@@ -101,6 +109,12 @@ func TestUserService_Profile(t *testing.T) {
 
 		res, err := service.Profile(ctx, "string@gmail.com")
 
+		select {
+		case <-saved:
+		case <-time.After(time.Second):
+			t.Error("profile was not cached")
+		}
+
 		assert.NoError(t, err)
 		assert.Equal(t, "string@gmail.com", res.Email)
 		assert.Equal(t, "Test User", res.Name)
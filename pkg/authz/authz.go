@@ -0,0 +1,206 @@
+// Package authz decides whether a subject may perform an action on a resource. Decisions are made
+// by policies whose conditions are CEL expressions (https://cel.dev) over the subject, the action,
+// the resource and the environment of the request, so that rules such as "users may only change
+// their own profile unless they are support staff" can be written without code.
+package authz
+
+//go:generate go run go.uber.org/mock/mockgen -source=authz.go -destination=mock/authz_mock.go -package=mock github.com/savioruz/goth/pkg/authz Enforcer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/savioruz/goth/pkg/device"
+	"github.com/savioruz/goth/pkg/jwt"
+)
+
+// ErrDenied is returned by Authorize when the request is not allowed.
+var ErrDenied = errors.New("authz: denied")
+
+// Enforcer decides requests. Authorize returns ErrDenied for a request that is not allowed.
+type Enforcer interface {
+	Evaluate(ctx context.Context, req Request) Decision
+	Authorize(ctx context.Context, req Request) error
+}
+
+// Request asks whether Subject may perform Action on Resource.
+type Request struct {
+	// Subject is whom the request is made by, nil for an anonymous request.
+	Subject *jwt.Claims
+	// SubjectAttributes describe the subject beyond its claims, e.g. its "permissions".
+	SubjectAttributes map[string]any
+	Action            string
+	Resource          Resource
+	Environment       Environment
+}
+
+// Resource is what an action is performed on. Attributes are available to conditions next to the
+// type and ID.
+type Resource struct {
+	Type       string
+	ID         string
+	Attributes map[string]any
+}
+
+// Environment describes the circumstances of a request. A zero Time means now.
+type Environment struct {
+	IP   string
+	Time time.Time
+}
+
+// EnvironmentFromContext describes the circumstances of the request the context belongs to.
+func EnvironmentFromContext(ctx context.Context) Environment {
+	return Environment{IP: device.FromContext(ctx).IP}
+}
+
+// Decision is the outcome of evaluating a request.
+//
+// Policies in dry run do not take part in the decision. DryRunAllowed and DryRunPolicy are what the
+// decision would be if they did, so that a new policy can be watched before it is enforced.
+type Decision struct {
+	Allowed bool
+	// Policy is the name of the policy that decided, empty when none applied.
+	Policy        string
+	DryRunAllowed bool
+	DryRunPolicy  string
+	// Errors are the conditions that could not be evaluated. A failed condition counts as met for a
+	// deny policy and as unmet for an allow policy.
+	Errors []error
+}
+
+// Engine evaluates policies. A request is denied when a deny policy applies to it, allowed when an
+// allow policy applies to it, and denied when no policy applies.
+type Engine struct {
+	policies []*compiled
+	logger   DecisionLogger
+	now      func() time.Time
+}
+
+type compiled struct {
+	Policy
+	program cel.Program
+}
+
+type match struct {
+	policy *compiled
+	met    bool
+	err    error
+}
+
+func New(policies []Policy, opts ...Option) (*Engine, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, fmt.Errorf("authz: %w", err)
+	}
+
+	e := &Engine{
+		logger: nopLogger{},
+		now:    time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	seen := make(map[string]bool, len(policies))
+
+	for _, p := range policies {
+		if err = p.validate(); err != nil {
+			return nil, err
+		}
+
+		if seen[p.Name] {
+			return nil, fmt.Errorf("authz: policy %q is defined twice", p.Name)
+		}
+
+		seen[p.Name] = true
+
+		c := &compiled{Policy: p}
+
+		if p.Condition != "" {
+			c.program, err = compile(env, p.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("authz: policy %q: %w", p.Name, err)
+			}
+		}
+
+		e.policies = append(e.policies, c)
+	}
+
+	return e, nil
+}
+
+// Evaluate decides the request and logs the decision.
+func (e *Engine) Evaluate(ctx context.Context, req Request) Decision {
+	if req.Environment.Time.IsZero() {
+		req.Environment.Time = e.now()
+	}
+
+	vars := activation(req)
+
+	var (
+		d       Decision
+		matches []match
+	)
+
+	for _, p := range e.policies {
+		if !p.applies(req) {
+			continue
+		}
+
+		m := match{policy: p, met: true}
+
+		if p.program != nil {
+			m.met, m.err = eval(ctx, p.program, vars)
+			if m.err != nil {
+				m.err = fmt.Errorf("policy %q: %w", p.Name, m.err)
+				m.met = p.Effect == Deny
+				d.Errors = append(d.Errors, m.err)
+			}
+		}
+
+		matches = append(matches, m)
+	}
+
+	d.Allowed, d.Policy = decide(matches, false)
+	d.DryRunAllowed, d.DryRunPolicy = decide(matches, true)
+
+	e.logger.LogDecision(ctx, req, d)
+
+	return d
+}
+
+// Authorize returns ErrDenied unless the request is allowed. Policies are rolled out with their own
+// dry_run flag; there is no way to stop enforcing all of them at once.
+func (e *Engine) Authorize(ctx context.Context, req Request) error {
+	d := e.Evaluate(ctx, req)
+	if d.Allowed {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrDenied, req.Action)
+}
+
+// decide lets a met deny policy override any allow policy, and denies when no policy is met.
+func decide(matches []match, dryRun bool) (bool, string) {
+	allowedBy := ""
+
+	for _, m := range matches {
+		if !m.met || (m.policy.DryRun && !dryRun) {
+			continue
+		}
+
+		if m.policy.Effect == Deny {
+			return false, m.policy.Name
+		}
+
+		if allowedBy == "" {
+			allowedBy = m.policy.Name
+		}
+	}
+
+	return allowedBy != "", allowedBy
+}
@@ -0,0 +1,333 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/savioruz/goth/pkg/jwt"
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// recorder keeps the decisions it is given.
+type recorder struct {
+	decisions []Decision
+}
+
+func (r *recorder) LogDecision(_ context.Context, _ Request, d Decision) {
+	r.decisions = append(r.decisions, d)
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		policies []Policy
+		req      Request
+		want     Decision
+		errors   int
+	}{
+		{
+			name: "no policy applies",
+			policies: []Policy{
+				{Name: "read", Effect: Allow, Actions: []string{"users:read"}},
+			},
+			req:  Request{Action: "users:write"},
+			want: Decision{},
+		},
+		{
+			name: "allow without condition",
+			policies: []Policy{
+				{Name: "read", Effect: Allow, Actions: []string{"users:read"}},
+			},
+			req:  Request{Action: "users:read"},
+			want: Decision{Allowed: true, Policy: "read", DryRunAllowed: true, DryRunPolicy: "read"},
+		},
+		{
+			name: "wildcard action",
+			policies: []Policy{
+				{Name: "users", Effect: Allow, Actions: []string{"users:*"}},
+			},
+			req:  Request{Action: "users:sessions:revoke"},
+			want: Decision{Allowed: true, Policy: "users", DryRunAllowed: true, DryRunPolicy: "users"},
+		},
+		{
+			name: "wildcard does not match another prefix",
+			policies: []Policy{
+				{Name: "users", Effect: Allow, Actions: []string{"users:*"}},
+			},
+			req:  Request{Action: "roles:assign"},
+			want: Decision{},
+		},
+		{
+			name: "resource type must match",
+			policies: []Policy{
+				{Name: "users", Effect: Allow, Actions: []string{"read"}, Resource: "user"},
+			},
+			req:  Request{Action: "read", Resource: Resource{Type: "organization"}},
+			want: Decision{},
+		},
+		{
+			name: "deny overrides allow",
+			policies: []Policy{
+				{Name: "allow", Effect: Allow, Actions: []string{"roles:assign"}},
+				{Name: "deny", Effect: Deny, Actions: []string{"roles:assign"}, Condition: "resource.id == subject.id"},
+			},
+			req: Request{
+				Subject:  &jwt.Claims{ID: "u1"},
+				Action:   "roles:assign",
+				Resource: Resource{Type: "user", ID: "u1"},
+			},
+			want: Decision{Policy: "deny", DryRunPolicy: "deny"},
+		},
+		{
+			name: "unmet deny",
+			policies: []Policy{
+				{Name: "allow", Effect: Allow, Actions: []string{"roles:assign"}},
+				{Name: "deny", Effect: Deny, Actions: []string{"roles:assign"}, Condition: "resource.id == subject.id"},
+			},
+			req: Request{
+				Subject:  &jwt.Claims{ID: "u1"},
+				Action:   "roles:assign",
+				Resource: Resource{Type: "user", ID: "u2"},
+			},
+			want: Decision{Allowed: true, Policy: "allow", DryRunAllowed: true, DryRunPolicy: "allow"},
+		},
+		{
+			name: "failed deny condition counts as met",
+			policies: []Policy{
+				{Name: "allow", Effect: Allow, Actions: []string{"org:invite"}},
+				{Name: "deny", Effect: Deny, Actions: []string{"org:invite"}, Condition: "subject.org_role != 'owner'"},
+			},
+			req:    Request{Action: "org:invite"},
+			want:   Decision{Policy: "deny", DryRunPolicy: "deny"},
+			errors: 1,
+		},
+		{
+			name: "failed allow condition counts as unmet",
+			policies: []Policy{
+				{Name: "allow", Effect: Allow, Actions: []string{"org:invite"}, Condition: "subject.org_role == 'owner'"},
+			},
+			req:    Request{Action: "org:invite"},
+			want:   Decision{},
+			errors: 1,
+		},
+		{
+			name: "subject attributes",
+			policies: []Policy{
+				{Name: "write", Effect: Allow, Actions: []string{"roles:assign"}, Condition: `"roles:write" in subject.permissions`},
+			},
+			req: Request{
+				Action:            "roles:assign",
+				SubjectAttributes: map[string]any{"permissions": []string{"roles:read", "roles:write"}},
+			},
+			want: Decision{Allowed: true, Policy: "write", DryRunAllowed: true, DryRunPolicy: "write"},
+		},
+		{
+			name: "policy in dry run only changes the dry run decision",
+			policies: []Policy{
+				{Name: "allow", Effect: Allow, Actions: []string{"users:delete"}},
+				{Name: "new-deny", Effect: Deny, Actions: []string{"users:delete"}, DryRun: true},
+			},
+			req:  Request{Action: "users:delete"},
+			want: Decision{Allowed: true, Policy: "allow", DryRunPolicy: "new-deny"},
+		},
+		{
+			name: "allow policy in dry run",
+			policies: []Policy{
+				{Name: "new-allow", Effect: Allow, Actions: []string{"users:delete"}, DryRun: true},
+			},
+			req:  Request{Action: "users:delete"},
+			want: Decision{DryRunAllowed: true, DryRunPolicy: "new-allow"},
+		},
+		{
+			name: "network of the request",
+			policies: []Policy{
+				{Name: "office", Effect: Allow, Actions: []string{"admin:*"}, Condition: `inCIDR(env.ip, "10.0.0.0/8")`},
+			},
+			req:  Request{Action: "admin:users", Environment: Environment{IP: "10.1.2.3"}},
+			want: Decision{Allowed: true, Policy: "office", DryRunAllowed: true, DryRunPolicy: "office"},
+		},
+		{
+			name: "time of the request",
+			policies: []Policy{
+				{Name: "weekdays", Effect: Deny, Actions: []string{"*"}, Condition: `env.time.getDayOfWeek("UTC") == 0`},
+				{Name: "any", Effect: Allow, Actions: []string{"*"}},
+			},
+			req:  Request{Action: "users:read"},
+			want: Decision{Policy: "weekdays", DryRunPolicy: "weekdays"},
+		},
+	}
+
+	// A Sunday, the time of requests without one.
+	sunday := func() time.Time { return time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+
+			engine, err := New(tt.policies, Logger(rec), Clock(sunday))
+			require.NoError(t, err)
+
+			d := engine.Evaluate(ctx, tt.req)
+
+			assert.Len(t, d.Errors, tt.errors)
+			d.Errors = nil
+			assert.Equal(t, tt.want, d)
+
+			require.Len(t, rec.decisions, 1)
+			assert.Equal(t, tt.want.Allowed, rec.decisions[0].Allowed)
+		})
+	}
+}
+
+func TestEngine_Authorize(t *testing.T) {
+	ctx := context.Background()
+
+	engine, err := New([]Policy{
+		{Name: "allow", Effect: Allow, Actions: []string{"users:read"}},
+		{Name: "new-deny", Effect: Deny, Actions: []string{"users:read"}, DryRun: true},
+		{Name: "new-allow", Effect: Allow, Actions: []string{"users:write"}, DryRun: true},
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, engine.Authorize(ctx, Request{Action: "users:read"}))
+	assert.ErrorIs(t, engine.Authorize(ctx, Request{Action: "users:write"}), ErrDenied)
+	assert.ErrorIs(t, engine.Authorize(ctx, Request{Action: "users:delete"}), ErrDenied)
+}
+
+func TestInCIDR(t *testing.T) {
+	tests := []struct {
+		ip   string
+		cidr string
+		want bool
+		err  bool
+	}{
+		{ip: "10.1.2.3", cidr: "10.0.0.0/8", want: true},
+		{ip: "11.1.2.3", cidr: "10.0.0.0/8", want: false},
+		{ip: "::ffff:10.1.2.3", cidr: "10.0.0.0/8", want: true},
+		{ip: "2001:db8::1", cidr: "2001:db8::/32", want: true},
+		{ip: "", cidr: "10.0.0.0/8", want: false},
+		{ip: "not an ip", cidr: "10.0.0.0/8", want: false},
+		{ip: "10.1.2.3", cidr: "10.0.0.0", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip+" in "+tt.cidr, func(t *testing.T) {
+			engine, err := New([]Policy{
+				{Name: "network", Effect: Allow, Actions: []string{"read"}, Condition: `inCIDR(env.ip, "` + tt.cidr + `")`},
+			})
+			require.NoError(t, err)
+
+			d := engine.Evaluate(context.Background(), Request{Action: "read", Environment: Environment{IP: tt.ip}})
+
+			assert.Equal(t, tt.want, d.Allowed)
+			assert.Equal(t, tt.err, len(d.Errors) > 0)
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []Policy
+	}{
+		{name: "no name", policies: []Policy{{Effect: Allow, Actions: []string{"read"}}}},
+		{name: "unknown effect", policies: []Policy{{Name: "p", Effect: "maybe", Actions: []string{"read"}}}},
+		{name: "no actions", policies: []Policy{{Name: "p", Effect: Allow}}},
+		{name: "defined twice", policies: []Policy{
+			{Name: "p", Effect: Allow, Actions: []string{"read"}},
+			{Name: "p", Effect: Deny, Actions: []string{"write"}},
+		}},
+		{name: "invalid condition", policies: []Policy{{Name: "p", Effect: Allow, Actions: []string{"read"}, Condition: "subject.id =="}}},
+		{name: "condition is not a bool", policies: []Policy{{Name: "p", Effect: Allow, Actions: []string{"read"}, Condition: "subject.id"}}},
+		{name: "unknown variable", policies: []Policy{{Name: "p", Effect: Allow, Actions: []string{"read"}, Condition: "user.id == ''"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run("error: "+tt.name, func(t *testing.T) {
+			engine, err := New(tt.policies)
+
+			assert.Error(t, err)
+			assert.Nil(t, engine)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	write("b.yml", "policies:\n  - name: second\n    effect: deny\n    actions: [\"write\"]\n")
+	write("a.yaml", "policies:\n  - name: first\n    effect: allow\n    actions: [\"read\"]\n    dry_run: true\n")
+	write("notes.txt", "not a policy")
+
+	policies, err := Load(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Policy{
+		{Name: "first", Effect: Allow, Actions: []string{"read"}, DryRun: true},
+		{Name: "second", Effect: Deny, Actions: []string{"write"}},
+	}, policies)
+
+	t.Run("error: missing path", func(t *testing.T) {
+		_, err := Load(filepath.Join(dir, "missing"))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("error: invalid yaml", func(t *testing.T) {
+		write("c.yaml", "policies: [")
+
+		_, err := Load(filepath.Join(dir, "c.yaml"))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("shipped policies compile", func(t *testing.T) {
+		policies, err := Load("../../config/policies")
+		require.NoError(t, err)
+
+		_, err = New(policies)
+		assert.NoError(t, err)
+	})
+}
+
+func TestLogDecisionLogger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockLogger := log.NewMockInterface(ctrl)
+	logger := NewLogDecisionLogger(mockLogger)
+
+	req := Request{Subject: &jwt.Claims{ID: "u1"}, Action: "users:read", Resource: Resource{Type: "user", ID: "u2"}}
+
+	t.Run("decision", func(t *testing.T) {
+		mockLogger.EXPECT().Info(gomock.Any(), "users:read", "u1", "user", "u2", true, "allow")
+
+		logger.LogDecision(ctx, req, Decision{Allowed: true, Policy: "allow", DryRunAllowed: true, DryRunPolicy: "allow"})
+	})
+
+	t.Run("anonymous decision with errors", func(t *testing.T) {
+		mockLogger.EXPECT().Info(gomock.Any(), "users:read", "", "", "", false, "", gomock.Any())
+
+		logger.LogDecision(ctx, Request{Action: "users:read"}, Decision{Errors: []error{errors.New("no such key")}})
+	})
+
+	t.Run("decision changed by a policy in dry run", func(t *testing.T) {
+		mockLogger.EXPECT().Warn(gomock.Any(), "users:read", "u1", "user", "u2", true, "allow", false, "new-deny")
+
+		logger.LogDecision(ctx, req, Decision{Allowed: true, Policy: "allow", DryRunPolicy: "new-deny"})
+	})
+}
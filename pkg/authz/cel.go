@@ -0,0 +1,104 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/netip"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Conditions see these variables:
+//
+//	subject   map   claims of the subject (id, email, token_type) and its other attributes
+//	action    string
+//	resource  map   type, id and the attributes of the resource
+//	env       map   ip and time of the request
+//
+// On top of the standard CEL functions, inCIDR(ip, cidr) reports whether an IP address is in a
+// network, e.g. inCIDR(env.ip, "10.0.0.0/8").
+func newEnv() (*cel.Env, error) {
+	attributes := cel.MapType(cel.StringType, cel.DynType)
+
+	return cel.NewEnv(
+		cel.Variable("subject", attributes),
+		cel.Variable("action", cel.StringType),
+		cel.Variable("resource", attributes),
+		cel.Variable("env", attributes),
+		cel.Function("inCIDR",
+			cel.Overload("inCIDR_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(inCIDR),
+			),
+		),
+	)
+}
+
+func compile(env *cel.Env, condition string) (cel.Program, error) {
+	ast, issues := env.Compile(condition)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("condition must be a bool, not %s", ast.OutputType())
+	}
+
+	return env.Program(ast)
+}
+
+func eval(ctx context.Context, program cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := program.ContextEval(ctx, vars)
+	if err != nil {
+		return false, err
+	}
+
+	met, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition returned %s", out.Type())
+	}
+
+	return met, nil
+}
+
+func activation(req Request) map[string]any {
+	subject := make(map[string]any, len(req.SubjectAttributes)+4)
+	maps.Copy(subject, req.SubjectAttributes)
+
+	if req.Subject != nil {
+		subject["id"] = req.Subject.ID
+		subject["email"] = req.Subject.Email
+		subject["token_type"] = req.Subject.TokenType
+	}
+
+	resource := make(map[string]any, len(req.Resource.Attributes)+2)
+	maps.Copy(resource, req.Resource.Attributes)
+	resource["type"] = req.Resource.Type
+	resource["id"] = req.Resource.ID
+
+	return map[string]any{
+		"subject":  subject,
+		"action":   req.Action,
+		"resource": resource,
+		"env": map[string]any{
+			"ip":   req.Environment.IP,
+			"time": req.Environment.Time,
+		},
+	}
+}
+
+func inCIDR(ip, cidr ref.Val) ref.Val {
+	addr, err := netip.ParseAddr(fmt.Sprint(ip.Value()))
+	if err != nil {
+		return types.False
+	}
+
+	prefix, err := netip.ParsePrefix(fmt.Sprint(cidr.Value()))
+	if err != nil {
+		return types.NewErr("inCIDR: %v", err)
+	}
+
+	return types.Bool(prefix.Contains(addr.Unmap()))
+}
@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"context"
+	"errors"
+
+	"github.com/savioruz/goth/pkg/logger"
+)
+
+// DecisionLogger records decisions.
+type DecisionLogger interface {
+	LogDecision(ctx context.Context, req Request, d Decision)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) LogDecision(context.Context, Request, Decision) {}
+
+type logDecisionLogger struct {
+	logger logger.Interface
+}
+
+// NewLogDecisionLogger logs every decision. Decisions that policies in dry run would change are
+// logged as warnings, so that they stand out while a policy is rolled out.
+func NewLogDecisionLogger(l logger.Interface) DecisionLogger {
+	return &logDecisionLogger{logger: l}
+}
+
+func (l *logDecisionLogger) LogDecision(_ context.Context, req Request, d Decision) {
+	subject := ""
+	if req.Subject != nil {
+		subject = req.Subject.ID
+	}
+
+	format := "authz - decision - action: %s - subject: %s - resource: %s/%s - allowed: %t - policy: %s"
+	args := []any{req.Action, subject, req.Resource.Type, req.Resource.ID, d.Allowed, d.Policy}
+
+	if len(d.Errors) > 0 {
+		format += " - errors: %v"
+		args = append(args, errors.Join(d.Errors...))
+	}
+
+	if d.DryRunAllowed != d.Allowed || d.DryRunPolicy != d.Policy {
+		format += " - dry run allowed: %t - dry run policy: %s"
+		args = append(args, d.DryRunAllowed, d.DryRunPolicy)
+
+		l.logger.Warn(format, args...)
+
+		return
+	}
+
+	l.logger.Info(format, args...)
+}
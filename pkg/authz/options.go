@@ -0,0 +1,19 @@
+package authz
+
+import "time"
+
+type Option func(*Engine)
+
+// Logger sets where decisions are logged. By default they are not.
+func Logger(logger DecisionLogger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// Clock sets the source of the current time, the time of requests that do not have one.
+func Clock(now func() time.Time) Option {
+	return func(e *Engine) {
+		e.now = now
+	}
+}
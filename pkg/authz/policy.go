@@ -0,0 +1,128 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Effect is what a policy decides when it applies.
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Policy allows or denies actions on a type of resource when its condition is met. Actions may end
+// in "*" to match every action with that prefix, e.g. "users:*". An empty resource matches every
+// type and an empty condition is always met.
+//
+// A policy in dry run is evaluated and logged but does not take part in decisions.
+type Policy struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Effect      Effect   `yaml:"effect"`
+	Actions     []string `yaml:"actions"`
+	Resource    string   `yaml:"resource"`
+	Condition   string   `yaml:"condition"`
+	DryRun      bool     `yaml:"dry_run"`
+}
+
+type file struct {
+	Policies []Policy `yaml:"policies"`
+}
+
+// Load reads the policies of YAML files. A directory stands for the .yaml and .yml files in it, read
+// in name order.
+func Load(paths ...string) ([]Policy, error) {
+	var policies []Policy
+
+	for _, path := range paths {
+		files, err := policyFiles(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range files {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				return nil, fmt.Errorf("authz: %w", err)
+			}
+
+			var f file
+			if err = yaml.Unmarshal(data, &f); err != nil {
+				return nil, fmt.Errorf("authz: %s: %w", name, err)
+			}
+
+			policies = append(policies, f.Policies...)
+		}
+	}
+
+	return policies, nil
+}
+
+func policyFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("authz: %w", err)
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("authz: %w", err)
+	}
+
+	var files []string
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	slices.Sort(files)
+
+	return files, nil
+}
+
+func (p Policy) validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("authz: policy without a name")
+	case p.Effect != Allow && p.Effect != Deny:
+		return fmt.Errorf("authz: policy %q: effect must be %q or %q", p.Name, Allow, Deny)
+	case len(p.Actions) == 0:
+		return fmt.Errorf("authz: policy %q: no actions", p.Name)
+	}
+
+	return nil
+}
+
+func (p Policy) applies(req Request) bool {
+	if p.Resource != "" && p.Resource != req.Resource.Type {
+		return false
+	}
+
+	for _, action := range p.Actions {
+		if action == req.Action {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(action, "*"); ok && strings.HasPrefix(req.Action, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package device
+
+import (
+	"context"
+	"strings"
+)
+
+// _maxLength bounds what is kept of client supplied values.
+const _maxLength = 255
+
+// Info describes the device a request comes from.
+type Info struct {
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+type ctxKey struct{}
+
+// New describes a device from its user agent and IP address. name is what the client calls itself,
+// e.g. "Alice's phone"; without it, a name is made up from the user agent.
+func New(name, userAgent, ip string) Info {
+	userAgent = truncate(userAgent)
+
+	name = truncate(strings.TrimSpace(name))
+	if name == "" {
+		name = Name(userAgent)
+	}
+
+	return Info{
+		Name:      name,
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+}
+
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, ctxKey{}, info)
+}
+
+// FromContext returns the device of the request, empty outside of one.
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(ctxKey{}).(Info)
+
+	return info
+}
+
+// Name makes a readable name such as "Firefox on Windows" from a user agent.
+func Name(userAgent string) string {
+	browser, os := browserName(userAgent), osName(userAgent)
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	default:
+		return "Unknown device"
+	}
+}
+
+// browserName looks for the browser in the user agent. Most browsers also claim to be the browsers
+// they derive from, so the order matters.
+func browserName(ua string) string {
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+	} {
+		if strings.Contains(ua, b.token) {
+			return b.name
+		}
+	}
+
+	return ""
+}
+
+func osName(ua string) string {
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			return o.name
+		}
+	}
+
+	return ""
+}
+
+func truncate(s string) string {
+	if len(s) <= _maxLength {
+		return s
+	}
+
+	// Cut at a rune boundary.
+	s = s[:_maxLength]
+	for len(s) > 0 && s[len(s)-1]&0xC0 == 0x80 {
+		s = s[:len(s)-1]
+	}
+
+	if len(s) > 0 && s[len(s)-1] >= 0xC0 {
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
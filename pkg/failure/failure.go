@@ -6,7 +6,15 @@ import (
 )
 
 type Failure struct {
-	Code    int    `json:"code"`
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why the value of a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
@@ -35,6 +43,15 @@ func BadRequestFromString(msg string) error {
 	}
 }
 
+// InvalidFields returns a new Failure with code for bad requests that lists the rejected fields.
+func InvalidFields(msg string, fields ...FieldError) error {
+	return &Failure{
+		Code:    http.StatusBadRequest,
+		Message: msg,
+		Fields:  fields,
+	}
+}
+
 // Unauthorized returns a new Failure with code for unauthorized requests.
 func Unauthorized(msg string) error {
 	return &Failure{
@@ -86,6 +103,14 @@ func Forbidden(msg string) error {
 	}
 }
 
+// TooManyRequests returns a new Failure with code for throttled requests.
+func TooManyRequests(msg string) error {
+	return &Failure{
+		Code:    http.StatusTooManyRequests,
+		Message: msg,
+	}
+}
+
 // GetCode returns the error code of an error interface.
 func GetCode(err error) int {
 	var f *Failure
@@ -95,3 +120,13 @@ func GetCode(err error) int {
 
 	return http.StatusInternalServerError
 }
+
+// GetFields returns the rejected fields of an error interface, if any.
+func GetFields(err error) []FieldError {
+	var f *Failure
+	if errors.As(err, &f) {
+		return f.Fields
+	}
+
+	return nil
+}
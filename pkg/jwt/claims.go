@@ -7,7 +7,8 @@ import (
 type Claims struct {
 	ID        string `json:"id"`
 	Email     string `json:"email"`
-	Level     string `json:"level"`
 	TokenType string `json:"token_type"`
+	FamilyID  string `json:"family_id,omitempty"`
+	OrgID     string `json:"org_id,omitempty"`
 	jwt.RegisteredClaims
 }
@@ -3,87 +3,229 @@ package jwt
 import (
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-var (
-	instance *JWT
-	once     sync.Once
+//go:generate go run go.uber.org/mock/mockgen -source=jwt.go -destination=mock/jwt_mock.go -package=mock github.com/savioruz/goth/pkg/jwt Interface
+
+const (
+	AccessTokenType    = "access_token"
+	RefreshTokenType   = "refresh_token"
+	MFATokenType       = "mfa_pending"
+	MagicLinkTokenType = "magic_link"
+
+	_defaultAccessTokenExpiry    = 24 * time.Hour
+	_defaultRefreshTokenExpiry   = 7 * 24 * time.Hour
+	_defaultMFATokenExpiry       = 5 * time.Minute
+	_defaultMagicLinkTokenExpiry = 15 * time.Minute
+)
 
-	ErrJWTNotInitialized = errors.New("jwt: instance not initialized")
-	ErrInvalidToken      = errors.New("jwt: invalid token")
+var (
+	ErrNoKeySet         = errors.New("jwt: key set required")
+	ErrInvalidToken     = errors.New("jwt: invalid token")
+	ErrTokenExpired     = errors.New("jwt: token expired")
+	ErrTokenNotYetValid = errors.New("jwt: token not yet valid")
+	ErrWrongTokenType   = errors.New("jwt: wrong token type")
+	ErrInvalidSignature = errors.New("jwt: invalid token signature")
+	ErrInvalidAudience  = errors.New("jwt: invalid token audience")
+	ErrInvalidIssuer    = errors.New("jwt: invalid token issuer")
 )
 
+// Subject identifies whom a token is issued to. OrgID is the organization the tokens act in, empty
+// for none.
+type Subject struct {
+	UserID   string
+	Email    string
+	FamilyID string
+	OrgID    string
+}
+
+// TokenIssuer mints signed tokens. Every token carries a unique jti; refresh tokens belong to
+// the token family of the subject so that each one can be consumed exactly once. MFA tokens
+// prove that the first factor was passed and are exchanged for a token pair with a second factor.
+// Magic link tokens are emailed to an address and exchanged for a token pair by its owner.
+type TokenIssuer interface {
+	GenerateAccessToken(subject Subject) (string, error)
+	GenerateRefreshToken(subject Subject) (string, error)
+	GenerateMFAToken(subject Subject) (string, error)
+	GenerateMagicLinkToken(subject Subject) (string, error)
+	RefreshTokenExpiry() time.Duration
+	PublicKeys() JWKS
+}
+
+// TokenVerifier parses tokens and verifies their signature, lifetime, issuer, audience and
+// token type. Errors are one of the package sentinel errors.
+type TokenVerifier interface {
+	ValidateAccessToken(tokenString string) (*Claims, error)
+	ValidateRefreshToken(tokenString string) (*Claims, error)
+	ValidateMFAToken(tokenString string) (*Claims, error)
+	ValidateMagicLinkToken(tokenString string) (*Claims, error)
+}
+
 type JWT struct {
-	appName            string
-	secretKey          string
-	accessTokenExpiry  time.Duration
-	refreshTokenExpiry time.Duration
-}
-
-func Initialize(appName string, secretKey string, accessExpiry, refreshExpiry time.Duration) {
-	once.Do(func() {
-		instance = &JWT{
-			appName:            appName,
-			secretKey:          secretKey,
-			accessTokenExpiry:  accessExpiry,
-			refreshTokenExpiry: refreshExpiry,
-		}
-	})
-}
-
-func GetInstance() *JWT {
-	if instance == nil {
-		_ = ErrJWTNotInitialized
+	issuer               string
+	audience             string
+	keys                 *KeySet
+	accessTokenExpiry    time.Duration
+	refreshTokenExpiry   time.Duration
+	mfaTokenExpiry       time.Duration
+	magicLinkTokenExpiry time.Duration
+	now                  func() time.Time
+}
+
+var (
+	_ TokenIssuer   = (*JWT)(nil)
+	_ TokenVerifier = (*JWT)(nil)
+)
+
+// New returns a token issuer and verifier for tokens issued by issuer and signed with keys.
+// The audience defaults to the issuer.
+func New(issuer string, keys *KeySet, opts ...Option) (*JWT, error) {
+	if keys == nil {
+		return nil, ErrNoKeySet
+	}
+
+	j := &JWT{
+		issuer:               issuer,
+		audience:             issuer,
+		keys:                 keys,
+		accessTokenExpiry:    _defaultAccessTokenExpiry,
+		refreshTokenExpiry:   _defaultRefreshTokenExpiry,
+		mfaTokenExpiry:       _defaultMFATokenExpiry,
+		magicLinkTokenExpiry: _defaultMagicLinkTokenExpiry,
+		now:                  time.Now,
 	}
 
-	return instance
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	return j, nil
+}
+
+func (j *JWT) GenerateAccessToken(subject Subject) (string, error) {
+	return j.generateToken(subject, j.accessTokenExpiry, AccessTokenType)
+}
+
+func (j *JWT) GenerateRefreshToken(subject Subject) (string, error) {
+	return j.generateToken(subject, j.refreshTokenExpiry, RefreshTokenType)
 }
 
-func GenerateAccessToken(userID, email, level string) (string, error) {
-	return GetInstance().generateToken(userID, email, level, GetInstance().accessTokenExpiry, "access_token")
+func (j *JWT) GenerateMFAToken(subject Subject) (string, error) {
+	return j.generateToken(subject, j.mfaTokenExpiry, MFATokenType)
 }
 
-func GenerateRefreshToken(userID, email, level string) (string, error) {
-	return GetInstance().generateToken(userID, email, level, GetInstance().refreshTokenExpiry, "refresh_token")
+func (j *JWT) GenerateMagicLinkToken(subject Subject) (string, error) {
+	return j.generateToken(subject, j.magicLinkTokenExpiry, MagicLinkTokenType)
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(_ *jwt.Token) (interface{}, error) {
-		return []byte(GetInstance().secretKey), nil
-	})
+func (j *JWT) RefreshTokenExpiry() time.Duration {
+	return j.refreshTokenExpiry
+}
+
+// PublicKeys returns the JSON Web Key Set of the currently accepted asymmetric keys.
+func (j *JWT) PublicKeys() JWKS {
+	return j.keys.JWKS(j.now(), j.maxTokenExpiry())
+}
+
+func (j *JWT) ValidateAccessToken(tokenString string) (*Claims, error) {
+	return j.validateToken(tokenString, AccessTokenType)
+}
+
+func (j *JWT) ValidateRefreshToken(tokenString string) (*Claims, error) {
+	return j.validateToken(tokenString, RefreshTokenType)
+}
+
+func (j *JWT) ValidateMFAToken(tokenString string) (*Claims, error) {
+	return j.validateToken(tokenString, MFATokenType)
+}
+
+func (j *JWT) ValidateMagicLinkToken(tokenString string) (*Claims, error) {
+	return j.validateToken(tokenString, MagicLinkTokenType)
+}
+
+// maxTokenExpiry is the longest lifetime of any token type, i.e. how long a retired key can still
+// have valid tokens outstanding.
+func (j *JWT) maxTokenExpiry() time.Duration {
+	return max(j.accessTokenExpiry, j.refreshTokenExpiry, j.mfaTokenExpiry, j.magicLinkTokenExpiry)
+}
+
+func (j *JWT) validateToken(tokenString, tokenType string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return j.keys.verificationKey(token, j.now(), j.maxTokenExpiry())
+	},
+		jwt.WithValidMethods(j.keys.algorithms()),
+		jwt.WithIssuer(j.issuer),
+		jwt.WithAudience(j.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(j.now),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token: %w", err)
+		return nil, mapValidationError(err)
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	if claims.TokenType != tokenType {
+		return nil, ErrWrongTokenType
 	}
 
-	return nil, ErrInvalidToken
+	return claims, nil
 }
 
-func (j *JWT) generateToken(userID, email, level string, expiry time.Duration, tokenType string) (string, error) {
+func mapValidationError(err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable),
+		errors.Is(err, ErrUnknownKey), errors.Is(err, ErrKeyRetired):
+		return ErrInvalidSignature
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrInvalidIssuer
+	default:
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+}
+
+func (j *JWT) generateToken(subject Subject, expiry time.Duration, tokenType string) (string, error) {
+	now := j.now()
+
 	claims := &Claims{
-		ID:        userID,
-		Email:     email,
-		Level:     level,
+		ID:        subject.UserID,
+		Email:     subject.Email,
 		TokenType: tokenType,
+		FamilyID:  subject.FamilyID,
+		OrgID:     subject.OrgID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    j.appName,
-			Subject:   userID,
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{j.audience},
+			Subject:   subject.UserID,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	key, err := j.keys.signingKey(now)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
 
-	signedString, err := token.SignedString([]byte(j.secretKey))
+	signedString, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", fmt.Errorf("jwt: failed to sign token: %w", err)
 	}
@@ -0,0 +1,232 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const defaultKeyID = "default"
+
+var (
+	ErrNoSigningKey       = errors.New("jwt: no active signing key")
+	ErrUnknownKey         = errors.New("jwt: unknown key id")
+	ErrKeyRetired         = errors.New("jwt: key retired")
+	ErrUnsupportedKey     = errors.New("jwt: unsupported key")
+	ErrUnsupportedAlg     = errors.New("jwt: unsupported signing algorithm")
+	ErrDuplicateKey       = errors.New("jwt: duplicate key id")
+	ErrAmbiguousSigningID = errors.New("jwt: signing key id required when several private keys are configured")
+)
+
+// Key is a signing or verification key identified by its kid.
+// Keys without a private part can only verify tokens.
+type Key struct {
+	ID       string
+	Method   jwt.SigningMethod
+	Private  any
+	Public   any
+	RetireAt time.Time
+}
+
+// Active reports whether the key may still sign tokens at the given time.
+// A zero RetireAt means the key never retires.
+func (k *Key) Active(now time.Time) bool {
+	return k.RetireAt.IsZero() || now.Before(k.RetireAt)
+}
+
+// Verifies reports whether tokens signed with the key are still accepted at the given time. A retired
+// key keeps verifying for grace, the longest token lifetime, so its tokens expire on their own.
+func (k *Key) Verifies(now time.Time, grace time.Duration) bool {
+	return k.RetireAt.IsZero() || now.Before(k.RetireAt.Add(grace))
+}
+
+// NewHMACKey returns a symmetric key. It signs and verifies with the same secret and is never published.
+func NewHMACKey(id, algorithm, secret string) (*Key, error) {
+	method := jwt.GetSigningMethod(algorithm)
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, algorithm)
+	}
+
+	if secret == "" {
+		return nil, fmt.Errorf("%w: empty secret", ErrUnsupportedKey)
+	}
+
+	if id == "" {
+		id = defaultKeyID
+	}
+
+	return &Key{
+		ID:      id,
+		Method:  method,
+		Private: []byte(secret),
+		Public:  []byte(secret),
+	}, nil
+}
+
+// LoadPEMKey reads an RSA, ECDSA or Ed25519 key from a PEM file. A private key file gives a
+// signing key, a public key file gives a verification-only key.
+func LoadPEMKey(id, algorithm, path string, retireAt time.Time) (*Key, error) {
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, algorithm)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: failed to read key %s: %w", id, err)
+	}
+
+	key := &Key{
+		ID:       id,
+		Method:   method,
+		RetireAt: retireAt,
+	}
+
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.Private, key.Public = private, &private.PublicKey
+		} else if key.Public, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrUnsupportedKey, id, err)
+		}
+	case *jwt.SigningMethodECDSA:
+		if private, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+			key.Private, key.Public = private, &private.PublicKey
+		} else if key.Public, err = jwt.ParseECPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrUnsupportedKey, id, err)
+		}
+	case *jwt.SigningMethodEd25519:
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			signer, ok := private.(ed25519.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnsupportedKey, id)
+			}
+
+			key.Private, key.Public = signer, signer.Public()
+		} else if key.Public, err = jwt.ParseEdPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrUnsupportedKey, id, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s requires a secret, not a PEM file", ErrUnsupportedAlg, algorithm)
+	}
+
+	return key, nil
+}
+
+// KeySet holds every key the server accepts. New tokens are signed with the preferred signing key
+// while it is active, then with the next active private key in kid order.
+type KeySet struct {
+	keys         map[string]*Key
+	ids          []string
+	signingKeyID string
+}
+
+func NewKeySet(signingKeyID string, keys ...*Key) (*KeySet, error) {
+	set := &KeySet{
+		keys:         make(map[string]*Key, len(keys)),
+		signingKeyID: signingKeyID,
+	}
+
+	var private []string
+
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateKey, key.ID)
+		}
+
+		set.keys[key.ID] = key
+		set.ids = append(set.ids, key.ID)
+
+		if key.Private != nil {
+			private = append(private, key.ID)
+		}
+	}
+
+	sort.Strings(set.ids)
+
+	switch {
+	case len(private) == 0:
+		return nil, ErrNoSigningKey
+	case signingKeyID == "" && len(private) > 1:
+		return nil, ErrAmbiguousSigningID
+	case signingKeyID == "":
+		set.signingKeyID = private[0]
+	}
+
+	if key, ok := set.keys[set.signingKeyID]; !ok || key.Private == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoSigningKey, set.signingKeyID)
+	}
+
+	return set, nil
+}
+
+func (s *KeySet) signingKey(now time.Time) (*Key, error) {
+	if key := s.keys[s.signingKeyID]; key.Active(now) {
+		return key, nil
+	}
+
+	for _, id := range s.ids {
+		if key := s.keys[id]; key.Private != nil && key.Active(now) {
+			return key, nil
+		}
+	}
+
+	return nil, ErrNoSigningKey
+}
+
+// verificationKey resolves the key for a token header. Tokens without a kid are only accepted
+// when the set holds a single key, which keeps tokens issued before key ids were introduced valid.
+func (s *KeySet) verificationKey(token *jwt.Token, now time.Time, grace time.Duration) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(s.ids) == 1 {
+		kid = s.ids[0]
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+
+	if !key.Verifies(now, grace) {
+		return nil, fmt.Errorf("%w: %q", ErrKeyRetired, kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("%w: %s for key %q", ErrUnsupportedAlg, token.Method.Alg(), kid)
+	}
+
+	return key.Public, nil
+}
+
+// algorithms lists every algorithm used by the set, for parser method whitelisting.
+func (s *KeySet) algorithms() []string {
+	seen := make(map[string]bool, len(s.ids))
+	algs := make([]string, 0, len(s.ids))
+
+	for _, id := range s.ids {
+		alg := s.keys[id].Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+
+	return algs
+}
+
+func isAsymmetric(public any) bool {
+	switch public.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySet_Rotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	retireAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := &Key{ID: "old", Method: jwt.SigningMethodRS256, Private: rsaKey, Public: &rsaKey.PublicKey, RetireAt: retireAt}
+	next := &Key{ID: "next", Method: jwt.SigningMethodEdDSA, Private: edPrivate, Public: edPublic}
+
+	keys, err := NewKeySet("old", old, next)
+	require.NoError(t, err)
+
+	now := retireAt.Add(-time.Hour)
+	issuer, err := New("goth", keys,
+		AccessTokenExpiry(time.Hour),
+		RefreshTokenExpiry(7*24*time.Hour),
+		Clock(func() time.Time { return now }),
+	)
+	require.NoError(t, err)
+
+	refresh, err := issuer.GenerateRefreshToken(Subject{UserID: "user"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		signer  string
+		wantErr error
+		jwks    []string
+	}{
+		{name: "before retirement", now: now, signer: "old", jwks: []string{"next", "old"}},
+		{name: "retired key verifies within grace", now: retireAt.Add(6 * 24 * time.Hour), signer: "next", jwks: []string{"next", "old"}},
+		{name: "retired key rejected after grace", now: retireAt.Add(7*24*time.Hour + time.Second), signer: "next", wantErr: ErrInvalidSignature, jwks: []string{"next"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = tt.now
+
+			key, err := keys.signingKey(now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.signer, key.ID)
+
+			var ids []string
+			for _, jwk := range issuer.PublicKeys().Keys {
+				ids = append(ids, jwk.KeyID)
+			}
+
+			assert.Equal(t, tt.jwks, ids)
+
+			public, err := issuer.keys.verificationKey(&jwt.Token{Header: map[string]any{"kid": "old"}, Method: jwt.SigningMethodRS256}, now, issuer.maxTokenExpiry())
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, mapValidationError(err), tt.wantErr)
+				assert.Nil(t, public)
+
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("token of retired key", func(t *testing.T) {
+		now = retireAt.Add(24 * time.Hour)
+
+		claims, err := issuer.ValidateRefreshToken(refresh)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "user", claims.ID)
+	})
+
+	t.Run("algorithm must match the key", func(t *testing.T) {
+		now = retireAt.Add(-time.Hour)
+
+		_, err := keys.verificationKey(&jwt.Token{Header: map[string]any{"kid": "next"}, Method: jwt.SigningMethodRS256}, now, 0)
+
+		assert.ErrorIs(t, err, ErrUnsupportedAlg)
+	})
+}
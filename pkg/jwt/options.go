@@ -9,6 +9,52 @@ const (
 	hoursInDay = 24
 )
 
+type Option func(*JWT)
+
+// Audience sets the audience tokens are issued for and verified against. Empty keeps the issuer.
+func Audience(audience string) Option {
+	return func(j *JWT) {
+		if audience != "" {
+			j.audience = audience
+		}
+	}
+}
+
+// AccessTokenExpiry sets the lifetime of access tokens.
+func AccessTokenExpiry(expiry time.Duration) Option {
+	return func(j *JWT) {
+		j.accessTokenExpiry = expiry
+	}
+}
+
+// RefreshTokenExpiry sets the lifetime of refresh tokens.
+func RefreshTokenExpiry(expiry time.Duration) Option {
+	return func(j *JWT) {
+		j.refreshTokenExpiry = expiry
+	}
+}
+
+// MFATokenExpiry sets the lifetime of MFA challenge tokens.
+func MFATokenExpiry(expiry time.Duration) Option {
+	return func(j *JWT) {
+		j.mfaTokenExpiry = expiry
+	}
+}
+
+// MagicLinkTokenExpiry sets the lifetime of magic link tokens.
+func MagicLinkTokenExpiry(expiry time.Duration) Option {
+	return func(j *JWT) {
+		j.magicLinkTokenExpiry = expiry
+	}
+}
+
+// Clock sets the time source used to issue and verify tokens.
+func Clock(now func() time.Time) Option {
+	return func(j *JWT) {
+		j.now = now
+	}
+}
+
 func ParseDuration(s string) time.Duration {
 	if strings.HasSuffix(s, "d") {
 		days := strings.TrimSuffix(s, "d")
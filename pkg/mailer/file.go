@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSender appends every message as a JSON line to a file instead of sending it,
+// which is handy for local development.
+type FileSender struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+type fileRecord struct {
+	SentAt time.Time `json:"sent_at"`
+	*Message
+}
+
+func NewFileSender(path string) (*FileSender, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: open %s: %w", path, err)
+	}
+
+	return &FileSender{
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+func (s *FileSender) Send(_ context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enc.Encode(fileRecord{SentAt: time.Now().UTC(), Message: msg})
+}
+
+func (s *FileSender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"context"
+
+	"golang.org/x/text/language"
+)
+
+// anyLanguage is what the "*" wildcard of Accept-Language parses to.
+var anyLanguage = language.MustParse("mul")
+
+type localeKey struct{}
+
+// WithLocale sets the locale messages sent on behalf of the request are rendered in.
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns the locale of the request, empty outside of one.
+func LocaleFromContext(ctx context.Context) string {
+	locale, _ := ctx.Value(localeKey{}).(string)
+
+	return locale
+}
+
+// PreferredLocale returns the most preferred locale of an Accept-Language header, empty when there is none.
+func PreferredLocale(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return ""
+	}
+
+	for _, tag := range tags {
+		if tag != language.Und && tag != anyLanguage {
+			return tag.String()
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,168 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/savioruz/goth/pkg/logger"
+)
+
+//go:generate go run go.uber.org/mock/mockgen -source=mailer.go -destination=mock/mailer_mock.go -package=mock github.com/savioruz/goth/pkg/mailer Interface
+
+const (
+	_defaultWorkers     = 2
+	_defaultQueueSize   = 100
+	_defaultSendTimeout = 30 * time.Second
+)
+
+var (
+	ErrQueueFull = errors.New("mailer: queue full")
+	ErrClosed    = errors.New("mailer: closed")
+)
+
+// Interface renders a template and queues the resulting message for delivery.
+type Interface interface {
+	Send(ctx context.Context, to, template, locale string, data any) error
+}
+
+// Sender delivers a rendered message, e.g. over SMTP.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+type Message struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+type Mailer struct {
+	sender    Sender
+	templates *Templates
+	logger    logger.Interface
+
+	from        string
+	workers     int
+	queueSize   int
+	sendTimeout time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *Message
+	wg     sync.WaitGroup
+}
+
+// New starts a mailer that delivers through sender. Messages are rendered when they are sent and
+// delivered by background workers, so callers never wait on the sender.
+func New(sender Sender, templates *Templates, l logger.Interface, opts ...Option) *Mailer {
+	m := &Mailer{
+		sender:      sender,
+		templates:   templates,
+		logger:      l,
+		workers:     _defaultWorkers,
+		queueSize:   _defaultQueueSize,
+		sendTimeout: _defaultSendTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.workers > 0 {
+		m.queue = make(chan *Message, m.queueSize)
+
+		for range m.workers {
+			m.wg.Add(1)
+
+			go m.work()
+		}
+	}
+
+	return m
+}
+
+// Send renders the template in the given locale and queues the message. Rendering errors are returned
+// right away; delivery errors are only logged. A mailer without workers delivers before returning.
+func (m *Mailer) Send(ctx context.Context, to, template, locale string, data any) error {
+	subject, text, html, err := m.templates.Render(template, locale, data)
+	if err != nil {
+		return err
+	}
+
+	msg := &Message{
+		From:    m.from,
+		To:      []string{to},
+		Subject: subject,
+		Text:    text,
+		HTML:    html,
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	if m.queue == nil {
+		return m.deliver(ctx, msg)
+	}
+
+	select {
+	case m.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting messages, waits for the queued ones to be delivered and closes the sender.
+func (m *Mailer) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+
+		return nil
+	}
+
+	m.closed = true
+	if m.queue != nil {
+		close(m.queue)
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+
+	if closer, ok := m.sender.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+func (m *Mailer) work() {
+	defer m.wg.Done()
+
+	for msg := range m.queue {
+		if err := m.deliver(context.Background(), msg); err != nil {
+			m.logger.Error("mailer - failed to deliver %q to %v: %w", msg.Subject, msg.To, err)
+		}
+	}
+}
+
+func (m *Mailer) deliver(ctx context.Context, msg *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, m.sendTimeout)
+	defer cancel()
+
+	if err := m.sender.Send(ctx, msg); err != nil {
+		return fmt.Errorf("mailer: send failed: %w", err)
+	}
+
+	return nil
+}
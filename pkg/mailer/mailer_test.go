@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	log "github.com/savioruz/goth/pkg/logger/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// blockingSender holds every delivery until it is released.
+type blockingSender struct {
+	MemorySender
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (s *blockingSender) Send(ctx context.Context, msg *Message) error {
+	s.started <- struct{}{}
+	<-s.release
+
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.MemorySender.Send(ctx, msg)
+}
+
+func newTestTemplates(t *testing.T) *Templates {
+	t.Helper()
+
+	templates, err := ParseTemplates(fstest.MapFS{
+		"en/welcome.txt": {Data: []byte(`{{define "subject"}}Welcome{{end}}Hello {{.}}`)},
+	}, "en")
+	require.NoError(t, err)
+
+	return templates
+}
+
+func TestMailer_Send(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mockLogger := log.NewMockInterface(ctrl)
+	templates := newTestTemplates(t)
+
+	t.Run("error: rendering fails right away", func(t *testing.T) {
+		m := New(NewMemorySender(), templates, mockLogger)
+		defer m.Close()
+
+		err := m.Send(ctx, "ann@example.com", "goodbye", "en", "Ann")
+
+		assert.ErrorIs(t, err, ErrTemplateNotFound)
+	})
+
+	t.Run("success: synchronous delivery", func(t *testing.T) {
+		sender := NewMemorySender()
+		m := New(sender, templates, mockLogger, From("Goth <no-reply@example.com>"), Workers(0))
+
+		err := m.Send(ctx, "ann@example.com", "welcome", "en", "Ann")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Message{{
+			From:    "Goth <no-reply@example.com>",
+			To:      []string{"ann@example.com"},
+			Subject: "Welcome",
+			Text:    "Hello Ann",
+		}}, sender.Messages())
+		assert.NoError(t, m.Close())
+	})
+
+	t.Run("error: synchronous delivery failure is returned", func(t *testing.T) {
+		sender := &blockingSender{started: make(chan struct{}, 1), release: make(chan struct{}), err: errors.New("down")}
+		close(sender.release)
+
+		m := New(sender, templates, mockLogger, Workers(0))
+
+		err := m.Send(ctx, "ann@example.com", "welcome", "en", "Ann")
+
+		assert.Error(t, err)
+	})
+
+	t.Run("error: queue full", func(t *testing.T) {
+		sender := &blockingSender{started: make(chan struct{}), release: make(chan struct{})}
+		m := New(sender, templates, mockLogger, Workers(1), QueueSize(1))
+
+		assert.NoError(t, m.Send(ctx, "ann@example.com", "welcome", "en", "Ann"))
+		<-sender.started
+
+		assert.NoError(t, m.Send(ctx, "bob@example.com", "welcome", "en", "Bob"))
+		assert.ErrorIs(t, m.Send(ctx, "eve@example.com", "welcome", "en", "Eve"), ErrQueueFull)
+
+		close(sender.release)
+		go func() {
+			for range sender.started {
+			}
+		}()
+
+		assert.NoError(t, m.Close())
+		assert.Len(t, sender.Messages(), 2)
+		close(sender.started)
+	})
+
+	t.Run("error: delivery failure is logged", func(t *testing.T) {
+		mockLogger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+
+		sender := &blockingSender{started: make(chan struct{}, 1), release: make(chan struct{}), err: errors.New("down")}
+		close(sender.release)
+
+		m := New(sender, templates, mockLogger, Workers(1))
+
+		assert.NoError(t, m.Send(ctx, "ann@example.com", "welcome", "en", "Ann"))
+		assert.NoError(t, m.Close())
+	})
+
+	t.Run("error: closed", func(t *testing.T) {
+		m := New(NewMemorySender(), templates, mockLogger)
+		assert.NoError(t, m.Close())
+		assert.NoError(t, m.Close())
+
+		err := m.Send(ctx, "ann@example.com", "welcome", "en", "Ann")
+
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import "time"
+
+type Option func(*Mailer)
+
+// From sets the sender address, e.g. "Goth <no-reply@example.com>".
+func From(from string) Option {
+	return func(m *Mailer) {
+		m.from = from
+	}
+}
+
+// Workers sets the number of background deliveries. Zero delivers synchronously within Send.
+func Workers(workers int) Option {
+	return func(m *Mailer) {
+		m.workers = workers
+	}
+}
+
+// QueueSize sets how many messages may wait for a worker before Send fails with ErrQueueFull.
+func QueueSize(size int) Option {
+	return func(m *Mailer) {
+		m.queueSize = size
+	}
+}
+
+func SendTimeout(timeout time.Duration) Option {
+	return func(m *Mailer) {
+		m.sendTimeout = timeout
+	}
+}
@@ -0,0 +1,183 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPSender delivers messages to an SMTP server. It upgrades plain connections with STARTTLS when the
+// server offers it, or speaks TLS from the start when implicitTLS is set (usually port 465).
+type SMTPSender struct {
+	host        string
+	addr        string
+	username    string
+	password    string
+	implicitTLS bool
+}
+
+func NewSMTPSender(host string, port int, username, password string, implicitTLS bool) *SMTPSender {
+	return &SMTPSender{
+		host:        host,
+		addr:        net.JoinHostPort(host, strconv.Itoa(port)),
+		username:    username,
+		password:    password,
+		implicitTLS: implicitTLS,
+	}
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid from address: %w", err)
+	}
+
+	body, err := buildMIME(msg)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("mailer: dial %s: %w", s.addr, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}
+	if s.implicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+
+		return fmt.Errorf("mailer: smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !s.implicitTLS {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("mailer: starttls: %w", err)
+		}
+	}
+
+	if s.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("mailer: smtp auth: %w", err)
+		}
+	}
+
+	if err = client.Mail(from.Address); err != nil {
+		return fmt.Errorf("mailer: smtp mail from: %w", err)
+	}
+
+	for _, to := range msg.To {
+		if err = client.Rcpt(to); err != nil {
+			return fmt.Errorf("mailer: smtp rcpt to %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: smtp data: %w", err)
+	}
+
+	if _, err = w.Write(body); err != nil {
+		return fmt.Errorf("mailer: smtp write: %w", err)
+	}
+
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("mailer: smtp data: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildMIME encodes the message as multipart/alternative with a plain text and, when present, an HTML part.
+func buildMIME(msg *Message) ([]byte, error) {
+	var body bytes.Buffer
+
+	parts := multipart.NewWriter(&body)
+
+	if err := writePart(parts, "text/plain", msg.Text); err != nil {
+		return nil, err
+	}
+
+	if msg.HTML != "" {
+		if err := writePart(parts, "text/html", msg.HTML); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("mailer: build message: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+
+	header("From", msg.From)
+	header("To", strings.Join(msg.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(msg.From))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+func writePart(parts *multipart.Writer, contentType, content string) error {
+	part, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return fmt.Errorf("mailer: build message: %w", err)
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err = qp.Write([]byte(content)); err != nil {
+		return fmt.Errorf("mailer: build message: %w", err)
+	}
+
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,175 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// smtpSession is what the fake server saw of one delivery.
+type smtpSession struct {
+	auth string
+	from string
+	rcpt []string
+	data string
+}
+
+// serveSMTP accepts a single connection and speaks just enough SMTP for SMTPSender.
+func serveSMTP(t *testing.T) (host string, port int, session <-chan smtpSession) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	done := make(chan smtpSession, 1)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var s smtpSession
+
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 localhost ready")
+
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+
+			verb, arg, _ := strings.Cut(line, " ")
+
+			switch strings.ToUpper(verb) {
+			case "EHLO":
+				_ = tp.PrintfLine("250-localhost")
+				_ = tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				s.auth = arg
+				_ = tp.PrintfLine("235 ok")
+			case "MAIL":
+				s.from = arg
+				_ = tp.PrintfLine("250 ok")
+			case "RCPT":
+				s.rcpt = append(s.rcpt, arg)
+				_ = tp.PrintfLine("250 ok")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+
+				s.data = string(data)
+				_ = tp.PrintfLine("250 ok")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				done <- s
+
+				return
+			default:
+				_ = tp.PrintfLine("502 unknown")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+
+	return addr.IP.String(), addr.Port, done
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg := &Message{
+		From:    "Goth <no-reply@example.com>",
+		To:      []string{"ann@example.com"},
+		Subject: "Atur ulang kata sandi Anda",
+		Text:    "Hello Ann",
+		HTML:    "<p>Hello Ann</p>",
+	}
+
+	t.Run("success: authenticated multipart delivery", func(t *testing.T) {
+		host, port, session := serveSMTP(t)
+
+		err := NewSMTPSender(host, port, "user", "pass", false).Send(ctx, msg)
+		require.NoError(t, err)
+
+		s := <-session
+
+		auth, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s.auth, "PLAIN "))
+		require.NoError(t, err)
+		assert.Equal(t, "\x00user\x00pass", string(auth))
+		assert.Equal(t, "FROM:<no-reply@example.com>", s.from)
+		assert.Equal(t, []string{"TO:<ann@example.com>"}, s.rcpt)
+
+		parsed, err := mail.ReadMessage(strings.NewReader(s.data))
+		require.NoError(t, err)
+
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		require.NoError(t, err)
+		assert.Equal(t, msg.Subject, subject)
+		assert.Contains(t, parsed.Header.Get("Message-ID"), "@example.com>")
+
+		mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/alternative", mediaType)
+
+		var bodies []string
+
+		parts := multipart.NewReader(parsed.Body, params["boundary"])
+		for {
+			part, err := parts.NextPart()
+			if err == io.EOF {
+				break
+			}
+
+			require.NoError(t, err)
+
+			body, err := io.ReadAll(part)
+			require.NoError(t, err)
+
+			bodies = append(bodies, part.Header.Get("Content-Type")+" "+string(body))
+		}
+
+		assert.Equal(t, []string{
+			"text/plain; charset=UTF-8 Hello Ann",
+			"text/html; charset=UTF-8 <p>Hello Ann</p>",
+		}, bodies)
+	})
+
+	t.Run("error: invalid from address", func(t *testing.T) {
+		err := NewSMTPSender("127.0.0.1", 1, "", "", false).Send(ctx, &Message{From: "not an address"})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("error: server unreachable", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+
+		err = NewSMTPSender("127.0.0.1", port, "", "", false).Send(ctx, msg)
+
+		assert.ErrorContains(t, err, "dial")
+	})
+}
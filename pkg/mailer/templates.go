@@ -0,0 +1,157 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+const subjectTemplate = "subject"
+
+var (
+	ErrTemplateNotFound = errors.New("mailer: template not found")
+	ErrMissingSubject   = errors.New("mailer: template does not define a subject")
+)
+
+// Templates holds email templates per locale. Every locale is a directory holding, for each template,
+// a text/template file "<name>.txt" that defines a "subject" block and the plain text body, and
+// optionally an html/template file "<name>.html" with the HTML body:
+//
+//	en/email_verification.txt
+//	en/email_verification.html
+//	id/email_verification.txt
+type Templates struct {
+	defaultLocale string
+	text          map[string]*texttemplate.Template
+	html          map[string]*htmltemplate.Template
+}
+
+// ParseTemplates parses every template in fsys. Lookups fall back from a regional locale such as
+// "pt-BR" to its language "pt", then to defaultLocale.
+func ParseTemplates(fsys fs.FS, defaultLocale string) (*Templates, error) {
+	t := &Templates{
+		defaultLocale: normalizeLocale(defaultLocale),
+		text:          make(map[string]*texttemplate.Template),
+		html:          make(map[string]*htmltemplate.Template),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		locale := path.Dir(file)
+		if locale == "." {
+			return nil
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		base := path.Base(file)
+		name := strings.TrimSuffix(base, path.Ext(base))
+		key := templateKey(normalizeLocale(locale), name)
+
+		switch path.Ext(base) {
+		case ".txt":
+			tmpl, err := texttemplate.New(name).Parse(string(content))
+			if err != nil {
+				return fmt.Errorf("mailer: parse %s: %w", file, err)
+			}
+
+			if tmpl.Lookup(subjectTemplate) == nil {
+				return fmt.Errorf("%w: %s", ErrMissingSubject, file)
+			}
+
+			t.text[key] = tmpl
+		case ".html":
+			tmpl, err := htmltemplate.New(name).Parse(string(content))
+			if err != nil {
+				return fmt.Errorf("mailer: parse %s: %w", file, err)
+			}
+
+			t.html[key] = tmpl
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Render executes the named template in the best matching locale.
+func (t *Templates) Render(name, locale string, data any) (subject, text, html string, err error) {
+	key, ok := t.resolve(name, locale)
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: %s (%s)", ErrTemplateNotFound, name, locale)
+	}
+
+	tmpl := t.text[key]
+
+	var buf bytes.Buffer
+
+	if err = tmpl.ExecuteTemplate(&buf, subjectTemplate, data); err != nil {
+		return "", "", "", fmt.Errorf("mailer: render %s subject: %w", key, err)
+	}
+
+	subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", "", "", fmt.Errorf("mailer: render %s: %w", key, err)
+	}
+
+	text = strings.TrimSpace(buf.String())
+
+	if htmlTmpl, ok := t.html[key]; ok {
+		buf.Reset()
+
+		if err = htmlTmpl.Execute(&buf, data); err != nil {
+			return "", "", "", fmt.Errorf("mailer: render %s html: %w", key, err)
+		}
+
+		html = buf.String()
+	}
+
+	return subject, text, html, nil
+}
+
+func (t *Templates) resolve(name, locale string) (string, bool) {
+	locale = normalizeLocale(locale)
+
+	candidates := []string{locale}
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, lang)
+	}
+
+	candidates = append(candidates, t.defaultLocale)
+
+	for _, candidate := range candidates {
+		key := templateKey(candidate, name)
+		if _, ok := t.text[key]; ok {
+			return key, true
+		}
+	}
+
+	return "", false
+}
+
+func templateKey(locale, name string) string {
+	return locale + "/" + name
+}
+
+// normalizeLocale turns "pt_BR" and "PT-br" into "pt-br".
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplates_Render(t *testing.T) {
+	fsys := fstest.MapFS{
+		"en/welcome.txt":    {Data: []byte(`{{define "subject"}}Welcome {{.}}{{end}}Hello {{.}}`)},
+		"en/welcome.html":   {Data: []byte(`<p>Hello {{.}}</p>`)},
+		"pt/welcome.txt":    {Data: []byte(`{{define "subject"}}Bem-vindo {{.}}{{end}}Olá {{.}}`)},
+		"pt-BR/welcome.txt": {Data: []byte(`{{define "subject"}}Bem-vindo, {{.}}{{end}}Oi {{.}}`)},
+		"README.md":         {Data: []byte("ignored")},
+	}
+
+	templates, err := ParseTemplates(fsys, "en")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		locale  string
+		subject string
+		text    string
+		html    string
+	}{
+		{name: "exact locale", locale: "en", subject: "Welcome <Ann>", text: "Hello <Ann>", html: "<p>Hello &lt;Ann&gt;</p>"},
+		{name: "regional locale", locale: "pt_br", subject: "Bem-vindo, <Ann>", text: "Oi <Ann>"},
+		{name: "language of a regional locale", locale: "pt-PT", subject: "Bem-vindo <Ann>", text: "Olá <Ann>"},
+		{name: "default locale", locale: "fr", subject: "Welcome <Ann>", text: "Hello <Ann>", html: "<p>Hello &lt;Ann&gt;</p>"},
+		{name: "empty locale", locale: "", subject: "Welcome <Ann>", text: "Hello <Ann>", html: "<p>Hello &lt;Ann&gt;</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, text, html, err := templates.Render("welcome", tt.locale, "<Ann>")
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.subject, subject)
+			assert.Equal(t, tt.text, text)
+			assert.Equal(t, tt.html, html)
+		})
+	}
+
+	t.Run("error: unknown template", func(t *testing.T) {
+		_, _, _, err := templates.Render("goodbye", "en", nil)
+
+		assert.ErrorIs(t, err, ErrTemplateNotFound)
+	})
+}
+
+func TestParseTemplates(t *testing.T) {
+	t.Run("error: missing subject", func(t *testing.T) {
+		_, err := ParseTemplates(fstest.MapFS{"en/welcome.txt": {Data: []byte("Hello")}}, "en")
+
+		assert.ErrorIs(t, err, ErrMissingSubject)
+	})
+
+	t.Run("error: invalid template", func(t *testing.T) {
+		_, err := ParseTemplates(fstest.MapFS{"en/welcome.html": {Data: []byte("{{.Name")}}, "en")
+
+		assert.Error(t, err)
+	})
+}
+
+func TestPreferredLocale(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "id-ID,id;q=0.9,en;q=0.8", want: "id-ID"},
+		{header: "en;q=0.5, pt-BR", want: "pt-BR"},
+		{header: "*", want: ""},
+		{header: "not a header;q=x", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, PreferredLocale(tt.header))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const _githubAPI = "https://api.github.com"
+
+// GitHubProvider signs users in with GitHub or a GitHub Enterprise Server. GitHub is not an OpenID
+// Connect issuer, so the user is read from its REST API.
+type GitHubProvider struct {
+	name   string
+	config *oauth2.Config
+	apiURL string
+	client *http.Client
+}
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// NewGitHubProvider returns a GitHub provider. baseURL is the address of a GitHub Enterprise Server,
+// empty for github.com. The scopes default to read:user and user:email.
+func NewGitHubProvider(name, baseURL, clientID, clientSecret, redirectURL string, opts ...Option) *GitHubProvider {
+	o := newOptions([]string{"read:user", "user:email"}, opts)
+
+	endpoint, apiURL := github.Endpoint, _githubAPI
+	if baseURL != "" {
+		baseURL = strings.TrimSuffix(baseURL, "/")
+		endpoint = oauth2.Endpoint{
+			AuthURL:  baseURL + "/login/oauth/authorize",
+			TokenURL: baseURL + "/login/oauth/access_token",
+		}
+		apiURL = baseURL + "/api/v3"
+	}
+
+	return &GitHubProvider{
+		name: name,
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       o.scopes,
+			Endpoint:     endpoint,
+		},
+		apiURL: apiURL,
+		client: o.client,
+	}
+}
+
+func (p *GitHubProvider) Name() string {
+	return p.name
+}
+
+// AuthURL ignores nonce, GitHub issues no ID token to put it in.
+func (p *GitHubProvider) AuthURL(state, verifier, _ string) string {
+	return p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (p *GitHubProvider) Exchange(ctx context.Context, code, verifier, _ string) (*UserInfo, error) {
+	token, err := exchange(ctx, p.config, p.client, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var user githubUser
+	if err = getJSON(ctx, p.client, p.apiURL+"/user", token, &user); err != nil {
+		return nil, fmt.Errorf("oauth: %s: failed to get user: %w", p.name, err)
+	}
+
+	// The public email on the profile may be unverified or missing, the primary address is neither.
+	var emails []githubEmail
+	if err = getJSON(ctx, p.client, p.apiURL+"/user/emails", token, &emails); err != nil {
+		return nil, fmt.Errorf("oauth: %s: failed to get emails: %w", p.name, err)
+	}
+
+	info := &UserInfo{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Name:    firstNonEmpty(user.Name, user.Login),
+		Picture: user.AvatarURL,
+	}
+
+	for _, e := range emails {
+		if e.Primary {
+			info.Email, info.EmailVerified = e.Email, e.Verified
+
+			break
+		}
+	}
+
+	if info.Email == "" {
+		return nil, ErrNoEmail
+	}
+
+	return info, nil
+}
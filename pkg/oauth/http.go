@@ -0,0 +1,56 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// _maxResponseSize bounds what is read from a provider.
+const _maxResponseSize = 1 << 20
+
+// getJSON fetches url into v, authenticated with token when it is set.
+func getJSON(ctx context.Context, client *http.Client, url string, token *oauth2.Token, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if token != nil {
+		token.SetAuthHeader(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+
+	if err = json.NewDecoder(io.LimitReader(resp.Body, _maxResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+
+	return nil
+}
+
+// exchange redeems an authorization code with the PKCE verifier, using client for the token request.
+func exchange(ctx context.Context, config *oauth2.Config, client *http.Client, code, verifier string) (*oauth2.Token, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,310 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/savioruz/goth/pkg/jwt"
+	"golang.org/x/oauth2"
+)
+
+// _minKeyRefresh limits how often an unknown key ID makes the provider fetch its keys again, so that
+// forged tokens cannot be used to flood the issuer.
+const _minKeyRefresh = time.Minute
+
+// _idTokenMethods are the signing algorithms accepted for ID tokens. "none" and HMAC never are.
+var _idTokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCProvider signs users in with any OpenID Connect issuer, such as Google or Microsoft. Endpoints
+// and signing keys are discovered from the issuer, and who signed in is taken from the ID token,
+// which is checked for signature, issuer, audience, expiry and nonce.
+type OIDCProvider struct {
+	name        string
+	issuer      string
+	config      *oauth2.Config
+	userInfoURL string
+	jwksURL     string
+	client      *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	gojwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified flag   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+type userInfoClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified flag   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// flag is a boolean claim that some issuers send as the string "true" or "false".
+type flag bool
+
+func (f *flag) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*f = flag(b)
+
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	*f = flag(strings.EqualFold(s, "true"))
+
+	return nil
+}
+
+// NewOIDCProvider discovers the endpoints of issuer. The scopes default to openid, email and profile.
+func NewOIDCProvider(
+	ctx context.Context,
+	name, issuer, clientID, clientSecret, redirectURL string,
+	opts ...Option,
+) (*OIDCProvider, error) {
+	o := newOptions([]string{"openid", "email", "profile"}, opts)
+
+	var doc discovery
+
+	err := getJSON(ctx, o.client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("oauth: %s: failed to discover issuer: %w", name, err)
+	}
+
+	// The issuer must be the one configured, or its ID tokens could be passed off as another's.
+	if doc.Issuer != issuer {
+		return nil, fmt.Errorf("oauth: %s: issuer %q does not match the configured %q", name, doc.Issuer, issuer)
+	}
+
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("oauth: %s: incomplete discovery document", name)
+	}
+
+	return &OIDCProvider{
+		name:   name,
+		issuer: doc.Issuer,
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       o.scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  doc.AuthorizationEndpoint,
+				TokenURL: doc.TokenEndpoint,
+			},
+		},
+		userInfoURL: doc.UserInfoEndpoint,
+		jwksURL:     doc.JWKSURI,
+		client:      o.client,
+	}, nil
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+func (p *OIDCProvider) AuthURL(state, verifier, nonce string) string {
+	return p.config.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	)
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*UserInfo, error) {
+	token, err := exchange(ctx, p.config, p.client, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("oauth: token response has no id_token")
+	}
+
+	claims, err := p.verify(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &UserInfo{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}
+
+	// Some issuers leave the profile out of the ID token; the UserInfo endpoint has it.
+	if info.Email == "" && p.userInfoURL != "" {
+		var extra userInfoClaims
+		if err = getJSON(ctx, p.client, p.userInfoURL, token, &extra); err != nil {
+			return nil, fmt.Errorf("oauth: %s: failed to get user info: %w", p.name, err)
+		}
+
+		if extra.Subject != info.Subject {
+			return nil, fmt.Errorf("oauth: %s: user info is for another subject", p.name)
+		}
+
+		info.Email, info.EmailVerified = extra.Email, bool(extra.EmailVerified)
+		info.Name = firstNonEmpty(info.Name, extra.Name)
+		info.Picture = firstNonEmpty(info.Picture, extra.Picture)
+	}
+
+	if info.Email == "" {
+		return nil, ErrNoEmail
+	}
+
+	return info, nil
+}
+
+func (p *OIDCProvider) verify(ctx context.Context, raw, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+
+	_, err := gojwt.ParseWithClaims(raw, claims, func(token *gojwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		return p.key(ctx, kid, token.Method)
+	},
+		gojwt.WithValidMethods(_idTokenMethods),
+		gojwt.WithIssuer(p.issuer),
+		gojwt.WithAudience(p.config.ClientID),
+		gojwt.WithExpirationRequired(),
+		gojwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oauth: %s: invalid id_token: %w", p.name, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("oauth: %s: id_token has no subject", p.name)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("oauth: %s: id_token nonce does not match", p.name)
+	}
+
+	return claims, nil
+}
+
+// key returns the signing key with the given ID, fetching the keys of the issuer when it is unknown,
+// since issuers rotate their keys. Without an ID, every key of the issuer that fits method is tried.
+func (p *OIDCProvider) key(ctx context.Context, kid string, method gojwt.SigningMethod) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookup(kid, method); ok {
+		return key, nil
+	}
+
+	if p.keys != nil && time.Since(p.fetchedAt) < _minKeyRefresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set jwt.JWKS
+	if err := getJSON(ctx, p.client, p.jwksURL, nil, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// Keys of unsupported types are skipped, the issuer may sign with another one.
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+
+	p.keys, p.fetchedAt = keys, time.Now()
+
+	if key, ok := p.lookup(kid, method); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) lookup(kid string, method gojwt.SigningMethod) (any, bool) {
+	if kid != "" {
+		key, ok := p.keys[kid]
+
+		return key, ok
+	}
+
+	var set gojwt.VerificationKeySet
+
+	for _, key := range p.keys {
+		if fits(method, key) {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+
+	return set, len(set.Keys) > 0
+}
+
+// fits reports whether key can verify signatures of method.
+func fits(method gojwt.SigningMethod, key crypto.PublicKey) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *gojwt.SigningMethodRSA, *gojwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := method.(*gojwt.SigningMethodECDSA)
+
+		return ok
+	case ed25519.PublicKey:
+		_, ok := method.(*gojwt.SigningMethodEd25519)
+
+		return ok
+	}
+
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
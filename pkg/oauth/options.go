@@ -0,0 +1,44 @@
+package oauth
+
+import (
+	"net/http"
+	"time"
+)
+
+const _defaultTimeout = 10 * time.Second
+
+type options struct {
+	client *http.Client
+	scopes []string
+}
+
+type Option func(*options)
+
+// HTTPClient sets the client used to talk to the provider.
+func HTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// Scopes replaces the scopes requested from the provider. Empty keeps the defaults of the provider.
+func Scopes(scopes ...string) Option {
+	return func(o *options) {
+		if len(scopes) > 0 {
+			o.scopes = scopes
+		}
+	}
+}
+
+func newOptions(scopes []string, opts []Option) *options {
+	o := &options{
+		client: &http.Client{Timeout: _defaultTimeout},
+		scopes: scopes,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
@@ -0,0 +1,66 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+//go:generate go run go.uber.org/mock/mockgen -source=provider.go -destination=mock/provider_mock.go -package=mock github.com/savioruz/goth/pkg/oauth Interface
+
+// ErrNoEmail is returned by providers that could not tell the email address of the user.
+var ErrNoEmail = errors.New("oauth: provider returned no email address")
+
+// Provider signs users in through an OAuth2 or OpenID Connect identity provider with the
+// authorization code flow and PKCE.
+type Provider interface {
+	Name() string
+	// AuthURL returns the consent screen URL for a login attempt. state is echoed back to the
+	// callback, the S256 challenge of verifier binds the code to whoever holds the verifier, and
+	// OpenID Connect providers put nonce in the ID token.
+	AuthURL(state, verifier, nonce string) string
+	// Exchange redeems the authorization code and returns who signed in.
+	Exchange(ctx context.Context, code, verifier, nonce string) (*UserInfo, error)
+}
+
+// UserInfo is a user as told by a provider, normalized across providers.
+type UserInfo struct {
+	// Subject identifies the user at the provider and never changes, unlike the email address.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider, len(providers))}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+
+	return r
+}
+
+func (r *Registry) Get(name string) (Provider, bool) {
+	p, ok := r.providers[name]
+
+	return p, ok
+}
+
+// Names returns the names of the providers in alphabetical order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,106 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	_argon2SaltLength = 16
+	_argon2KeyLength  = 32
+)
+
+type argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// NewArgon2id returns a hasher of argon2id hashes, using memory KiB, the given number of iterations
+// over it and parallelism threads. Hashes are in the PHC string format, e.g.
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func NewArgon2id(memory, iterations uint32, parallelism uint8) Hasher {
+	return &argon2idHasher{
+		memory:      memory,
+		iterations:  iterations,
+		parallelism: parallelism,
+	}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, _argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, _argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.iterations, h.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2idHasher) Verify(password, hash string) (bool, bool, error) {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return false, false, ErrUnsupportedHash
+	}
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false, errors.New("password: malformed hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, fmt.Errorf("password: malformed version: %w", err)
+	}
+
+	if version != argon2.Version {
+		return false, false, fmt.Errorf("password: unsupported version %d", version)
+	}
+
+	var (
+		memory, iterations uint32
+		parallelism        uint8
+	)
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, false, fmt.Errorf("password: malformed parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("password: malformed salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, fmt.Errorf("password: malformed key: %w", err)
+	}
+
+	// An empty key would match every password, and argon2 panics without threads.
+	if len(key) == 0 || parallelism == 0 || iterations == 0 {
+		return false, false, errors.New("password: malformed hash")
+	}
+
+	//nolint:gosec // the key length comes from a hash this package wrote
+	other := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	outdated := memory != h.memory || iterations != h.iterations || parallelism != h.parallelism ||
+		len(salt) != _argon2SaltLength || len(key) != _argon2KeyLength
+
+	return true, outdated, nil
+}
@@ -0,0 +1,49 @@
+package password
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcrypt returns a hasher of bcrypt hashes with the given cost. bcrypt only uses the first 72
+// bytes of a password and refuses longer ones.
+func NewBcrypt(cost int) Hasher {
+	return &bcryptHasher{cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Verify(password, hash string) (bool, bool, error) {
+	if !strings.HasPrefix(hash, "$2") {
+		return false, false, ErrUnsupportedHash
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+
+	if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, cost != h.cost, nil
+}
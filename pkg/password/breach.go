@@ -0,0 +1,187 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // SHA-1 is what Pwned Passwords is keyed by, it does not protect anything here
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachChecker tells whether a password is known from a data breach.
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+const (
+	_hashLength   = 40
+	_prefixLength = 5
+
+	// Lines are a 40 character hash or 35 character suffix, a colon, a count and a line break.
+	_lineBufferSize = 128
+)
+
+// BreachFile looks passwords up in a local copy of the Pwned Passwords SHA-1 hashes of HaveIBeenPwned,
+// so that passwords are never sent anywhere. The copy is either
+//
+//   - a directory of range files as served by the range API, one per 5 character hash prefix, named
+//     after the prefix with an optional .txt extension and holding SUFFIX:COUNT lines, or
+//   - a single file of full hashes sorted in ascending order, one HASH:COUNT or HASH per line.
+//
+// Entries with a count of 0 are the padding of the range API and do not count as breached.
+type BreachFile struct {
+	dir  string
+	file *os.File
+	size int64
+}
+
+// OpenBreaches opens the copy of Pwned Passwords at path, which may be a directory or a file.
+func OpenBreaches(path string) (*BreachFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("password: failed to open %s: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return &BreachFile{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("password: failed to open %s: %w", path, err)
+	}
+
+	return &BreachFile{file: file, size: info.Size()}, nil
+}
+
+func (b *BreachFile) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password)) //nolint:gosec // see the import
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	if b.file != nil {
+		return b.search(hash)
+	}
+
+	return b.scanRange(hash)
+}
+
+func (b *BreachFile) Close() error {
+	if b.file == nil {
+		return nil
+	}
+
+	return b.file.Close()
+}
+
+// scanRange reads the range file of the hash prefix, which is small enough to scan.
+func (b *BreachFile) scanRange(hash string) (bool, error) {
+	prefix, suffix := hash[:_prefixLength], hash[_prefixLength:]
+
+	file, err := os.Open(filepath.Join(b.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(b.dir, prefix+".txt"))
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("password: failed to open range %s: %w", prefix, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, count := parseLine(scanner.Text())
+		if strings.EqualFold(entry, suffix) {
+			return count != "0", nil
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return false, fmt.Errorf("password: failed to read range %s: %w", prefix, err)
+	}
+
+	return false, nil
+}
+
+// search binary searches the sorted file for the hash. The line it is on, if any, always starts
+// within [lo, hi).
+func (b *BreachFile) search(hash string) (bool, error) {
+	lo, hi := int64(0), b.size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		line, start, next, err := b.lineAt(mid)
+		if err != nil {
+			return false, err
+		}
+
+		if start >= hi {
+			hi = mid
+
+			continue
+		}
+
+		entry, count := parseLine(line)
+		if len(entry) != _hashLength {
+			return false, fmt.Errorf("password: malformed line at offset %d", start)
+		}
+
+		switch strings.Compare(strings.ToUpper(entry), hash) {
+		case 0:
+			return count != "0", nil
+		case -1:
+			lo = next
+		default:
+			hi = mid
+		}
+	}
+
+	return false, nil
+}
+
+// lineAt returns the first line that starts at or after offset, where it starts and where the line
+// after it starts. At the end of the file the line is empty and starts at the size of the file.
+func (b *BreachFile) lineAt(offset int64) (string, int64, int64, error) {
+	start := offset
+	if offset > 0 {
+		// Start reading at the byte before offset, to tell whether a line starts right at it.
+		start = offset - 1
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(b.file, start, b.size-start), _lineBufferSize)
+
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return "", b.size, b.size, nil
+		}
+
+		if err != nil {
+			return "", 0, 0, fmt.Errorf("password: failed to read: %w", err)
+		}
+
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", 0, 0, fmt.Errorf("password: failed to read: %w", err)
+	}
+
+	return line, start, start + int64(len(line)), nil
+}
+
+// parseLine splits a HASH:COUNT line into the hash and the count, which is empty when missing.
+func parseLine(line string) (string, string) {
+	entry, count, _ := strings.Cut(strings.TrimSpace(line), ":")
+
+	return strings.TrimSpace(entry), strings.TrimSpace(count)
+}
@@ -0,0 +1,184 @@
+package password
+
+import (
+	"crypto/sha1" //nolint:gosec // see breach.go
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password)) //nolint:gosec // see breach.go
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeBreachFile writes the hashes of passwords, sorted, with the given count and line ending.
+func writeBreachFile(t *testing.T, passwords map[string]string, eol string) string {
+	t.Helper()
+
+	lines := make([]string, 0, len(passwords))
+	for pw, count := range passwords {
+		line := sha1Hex(pw)
+		if count != "" {
+			line += ":" + count
+		}
+
+		lines = append(lines, line)
+	}
+
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, eol)+eol), 0o600))
+
+	return path
+}
+
+func TestBreachFile_Sorted(t *testing.T) {
+	passwords := map[string]string{"padding": "0", "no count": ""}
+	for i := range 500 {
+		passwords[fmt.Sprintf("password%d", i)] = fmt.Sprint(i + 1)
+	}
+
+	hashes := make([]string, 0, len(passwords))
+	for pw := range passwords {
+		hashes = append(hashes, pw)
+	}
+
+	sort.Slice(hashes, func(i, j int) bool { return sha1Hex(hashes[i]) < sha1Hex(hashes[j]) })
+	first, last := hashes[0], hashes[len(hashes)-1]
+
+	var below, above, between string
+
+	for i := 0; below == "" || above == "" || between == ""; i++ {
+		candidate := fmt.Sprintf("unlisted%d", i)
+		switch hash := sha1Hex(candidate); {
+		case hash < sha1Hex(first):
+			below = candidate
+		case hash > sha1Hex(last):
+			above = candidate
+		default:
+			between = candidate
+		}
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{name: "first entry", password: first, want: passwords[first] != "0"},
+		{name: "last entry", password: last, want: passwords[last] != "0"},
+		{name: "middle entry", password: "password250", want: true},
+		{name: "entry without count", password: "no count", want: true},
+		{name: "count of 0", password: "padding", want: false},
+		{name: "missing before the first entry", password: below, want: false},
+		{name: "missing after the last entry", password: above, want: false},
+		{name: "missing between entries", password: between, want: false},
+	}
+
+	for _, eol := range []string{"\n", "\r\n"} {
+		b, err := OpenBreaches(writeBreachFile(t, passwords, eol))
+		require.NoError(t, err)
+
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s %q", tt.name, eol), func(t *testing.T) {
+				breached, err := b.Breached(tt.password)
+
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, breached)
+			})
+		}
+
+		assert.NoError(t, b.Close())
+	}
+
+	t.Run("single entry", func(t *testing.T) {
+		b, err := OpenBreaches(writeBreachFile(t, map[string]string{"password1": "3"}, "\n"))
+		require.NoError(t, err)
+		defer b.Close()
+
+		breached, err := b.Breached("password1")
+		assert.NoError(t, err)
+		assert.True(t, breached)
+
+		breached, err = b.Breached("password2")
+		assert.NoError(t, err)
+		assert.False(t, breached)
+	})
+
+	t.Run("empty file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "empty.txt")
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+		b, err := OpenBreaches(path)
+		require.NoError(t, err)
+		defer b.Close()
+
+		breached, err := b.Breached("password1")
+		assert.NoError(t, err)
+		assert.False(t, breached)
+	})
+
+	t.Run("error: malformed line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "malformed.txt")
+		require.NoError(t, os.WriteFile(path, []byte("not a hash:1\n"), 0o600))
+
+		b, err := OpenBreaches(path)
+		require.NoError(t, err)
+		defer b.Close()
+
+		_, err = b.Breached("password1")
+		assert.Error(t, err)
+	})
+}
+
+func TestBreachFile_Ranges(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name string, lines ...string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\r\n")), 0o600))
+	}
+
+	breached, padding, plain := sha1Hex("password1"), sha1Hex("padding"), sha1Hex("letmein")
+	write(breached[:5], strings.ToLower(breached[5:])+":42")
+	write(padding[:5]+".txt", "0000000000000000000000000000000000A:1", padding[5:]+":0")
+	write(plain[:5], plain[5:]+":7")
+
+	b, err := OpenBreaches(dir)
+	require.NoError(t, err)
+	defer b.Close()
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{name: "range file without extension", password: "password1", want: true},
+		{name: "range file with extension and count of 0", password: "padding", want: false},
+		{name: "last line without line break", password: "letmein", want: true},
+		{name: "missing range file", password: "correct horse battery staple", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.Breached(tt.password)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("error: missing path", func(t *testing.T) {
+		_, err := OpenBreaches(filepath.Join(dir, "missing"))
+
+		assert.Error(t, err)
+	})
+}
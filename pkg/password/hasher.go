@@ -0,0 +1,67 @@
+package password
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrUnsupportedHash is returned when verifying against a hash in a format the hasher does not know.
+var ErrUnsupportedHash = errors.New("password: unsupported hash format")
+
+// Hasher hashes passwords in a single format. Hashes encode the algorithm and the parameters they
+// were made with, so that they can still be verified after the parameters change.
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, and whether hash was made with other parameters
+	// than the hasher uses now. Hashes in another format return ErrUnsupportedHash.
+	Verify(password, hash string) (ok, outdated bool, err error)
+}
+
+// Hashers hashes new passwords with the preferred hasher and verifies passwords against hashes made
+// by any of the hashers, so that users can be moved to a new algorithm or cost as they sign in.
+type Hashers struct {
+	preferred Hasher
+	others    []Hasher
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+func NewHashers(preferred Hasher, others ...Hasher) *Hashers {
+	return &Hashers{
+		preferred: preferred,
+		others:    others,
+	}
+}
+
+func (h *Hashers) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify reports whether password matches hash, and whether hash should be replaced by a new hash of
+// the password because it was made by another hasher or with outdated parameters.
+func (h *Hashers) Verify(password, hash string) (ok, rehash bool, err error) {
+	ok, rehash, err = h.preferred.Verify(password, hash)
+	if !errors.Is(err, ErrUnsupportedHash) {
+		return ok, ok && rehash, err
+	}
+
+	for _, other := range h.others {
+		ok, _, err = other.Verify(password, hash)
+		if !errors.Is(err, ErrUnsupportedHash) {
+			return ok, ok, err
+		}
+	}
+
+	return false, false, ErrUnsupportedHash
+}
+
+// VerifyDummy verifies password against the hash of a made-up password, so that rejecting an unknown
+// user takes as long as rejecting a wrong password.
+func (h *Hashers) VerifyDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummy, _ = h.preferred.Hash("dummy password")
+	})
+
+	_, _, _ = h.preferred.Verify(password, h.dummy)
+}
@@ -0,0 +1,208 @@
+package password
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// referenceArgon2id is the hash of "password" with salt "somesalt" made by the reference
+// implementation: echo -n password | argon2 somesalt -id -t 2 -m 16 -p 1
+const referenceArgon2id = "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"
+
+func TestArgon2id(t *testing.T) {
+	hasher := NewArgon2id(1024, 1, 2)
+
+	t.Run("success: round trip", func(t *testing.T) {
+		hash, err := hasher.Hash("correct horse")
+		require.NoError(t, err)
+
+		assert.Regexp(t, regexp.MustCompile(`^\$argon2id\$v=19\$m=1024,t=1,p=2\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`), hash)
+
+		other, err := hasher.Hash("correct horse")
+		require.NoError(t, err)
+		assert.NotEqual(t, hash, other, "salts must differ")
+
+		ok, outdated, err := hasher.Verify("correct horse", hash)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.False(t, outdated)
+
+		ok, outdated, err = hasher.Verify("correct horsE", hash)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.False(t, outdated)
+	})
+
+	t.Run("success: reference hash", func(t *testing.T) {
+		ok, _, err := hasher.Verify("password", referenceArgon2id)
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("outdated parameters", func(t *testing.T) {
+		hash, err := hasher.Hash("correct horse")
+		require.NoError(t, err)
+
+		for name, current := range map[string]Hasher{
+			"memory":      NewArgon2id(2048, 1, 2),
+			"iterations":  NewArgon2id(1024, 2, 2),
+			"parallelism": NewArgon2id(1024, 1, 1),
+		} {
+			t.Run(name, func(t *testing.T) {
+				ok, outdated, err := current.Verify("correct horse", hash)
+
+				assert.NoError(t, err)
+				assert.True(t, ok)
+				assert.True(t, outdated)
+			})
+		}
+
+		t.Run("salt and key length", func(t *testing.T) {
+			salt := []byte("8 bytes!")
+			key := argon2.IDKey([]byte("correct horse"), salt, 1, 1024, 2, 16)
+			short := fmt.Sprintf("$argon2id$v=19$m=1024,t=1,p=2$%s$%s",
+				base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+			ok, outdated, err := hasher.Verify("correct horse", short)
+
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.True(t, outdated)
+		})
+	})
+
+	tests := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{name: "bcrypt hash", hash: "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", err: ErrUnsupportedHash},
+		{name: "argon2i hash", hash: "$argon2i$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc", err: ErrUnsupportedHash},
+		{name: "empty", hash: "", err: ErrUnsupportedHash},
+		{name: "missing key", hash: "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ"},
+		{name: "extra segment", hash: referenceArgon2id + "$x"},
+		{name: "malformed version", hash: "$argon2id$v=x$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{name: "other version", hash: "$argon2id$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{name: "malformed parameters", hash: "$argon2id$v=19$m=65536;t=2;p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{name: "malformed salt", hash: "$argon2id$v=19$m=65536,t=2,p=1$c29t!ZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{name: "malformed key", hash: "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc="},
+		{name: "empty key", hash: "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$"},
+		{name: "no threads", hash: "$argon2id$v=19$m=65536,t=2,p=0$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{name: "no iterations", hash: "$argon2id$v=19$m=65536,t=0,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+	}
+
+	for _, tt := range tests {
+		t.Run("error: "+tt.name, func(t *testing.T) {
+			ok, outdated, err := hasher.Verify("password", tt.hash)
+
+			require.Error(t, err)
+			assert.True(t, strings.HasPrefix(err.Error(), "password: "), err.Error())
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			} else {
+				assert.NotErrorIs(t, err, ErrUnsupportedHash)
+			}
+
+			assert.False(t, ok)
+			assert.False(t, outdated)
+		})
+	}
+}
+
+func TestBcrypt(t *testing.T) {
+	hasher := NewBcrypt(bcrypt.MinCost)
+
+	hash, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+
+	ok, outdated, err := hasher.Verify("correct horse", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, outdated)
+
+	ok, outdated, err = NewBcrypt(bcrypt.MinCost+1).Verify("correct horse", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, outdated)
+
+	ok, _, err = hasher.Verify("wrong", hash)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = hasher.Verify("correct horse", referenceArgon2id)
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+
+	_, _, err = hasher.Verify("correct horse", "$2a$10$short")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnsupportedHash)
+}
+
+func TestHashers_Verify(t *testing.T) {
+	argon := NewArgon2id(1024, 1, 2)
+	legacy := NewBcrypt(bcrypt.MinCost)
+	hashers := NewHashers(argon, legacy)
+
+	current, err := hashers.Hash("correct horse")
+	require.NoError(t, err)
+	assert.Regexp(t, `^\$argon2id\$`, current, "new hashes use the preferred hasher")
+
+	outdated, err := NewArgon2id(512, 1, 2).Hash("correct horse")
+	require.NoError(t, err)
+
+	bcryptHash, err := legacy.Hash("correct horse")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		hashers  *Hashers
+		password string
+		hash     string
+		ok       bool
+		rehash   bool
+		err      error
+	}{
+		{name: "preferred hash", hashers: hashers, password: "correct horse", hash: current, ok: true},
+		{name: "preferred hash, wrong password", hashers: hashers, password: "wrong", hash: current},
+		{name: "outdated parameters", hashers: hashers, password: "correct horse", hash: outdated, ok: true, rehash: true},
+		{name: "outdated parameters, wrong password", hashers: hashers, password: "wrong", hash: outdated},
+		{name: "fallback hasher", hashers: hashers, password: "correct horse", hash: bcryptHash, ok: true, rehash: true},
+		{name: "fallback hasher, wrong password", hashers: hashers, password: "wrong", hash: bcryptHash},
+		{name: "no fallback hasher", hashers: NewHashers(argon), password: "correct horse", hash: bcryptHash, err: ErrUnsupportedHash},
+		{name: "unknown format", hashers: hashers, password: "correct horse", hash: "plaintext", err: ErrUnsupportedHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := tt.hashers.Verify(tt.password, tt.hash)
+
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.rehash, rehash)
+		})
+	}
+
+	t.Run("malformed preferred hash is not passed on", func(t *testing.T) {
+		ok, rehash, err := hashers.Verify("password", "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$")
+
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrUnsupportedHash)
+		assert.False(t, ok)
+		assert.False(t, rehash)
+	})
+
+	t.Run("dummy verification", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			hashers.VerifyDummy("correct horse")
+			hashers.VerifyDummy("correct horse")
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package password
+
+type Option func(*Policy)
+
+// MinLength sets the minimum number of characters.
+func MinLength(length int) Option {
+	return func(p *Policy) {
+		p.minLength = length
+	}
+}
+
+// MaxLength sets the maximum length in bytes. bcrypt ignores everything past 72 bytes.
+func MaxLength(length int) Option {
+	return func(p *Policy) {
+		p.maxLength = length
+	}
+}
+
+// RequireUpper sets whether an uppercase letter is required.
+func RequireUpper(required bool) Option {
+	return func(p *Policy) {
+		p.requireUpper = required
+	}
+}
+
+// RequireLower sets whether a lowercase letter is required.
+func RequireLower(required bool) Option {
+	return func(p *Policy) {
+		p.requireLower = required
+	}
+}
+
+// RequireDigit sets whether a digit is required.
+func RequireDigit(required bool) Option {
+	return func(p *Policy) {
+		p.requireDigit = required
+	}
+}
+
+// RequireSymbol sets whether a character other than a letter or digit is required.
+func RequireSymbol(required bool) Option {
+	return func(p *Policy) {
+		p.requireSymbol = required
+	}
+}
+
+// MinScore sets the minimum strength score, from 0 to 4. See Score.
+func MinScore(score int) Option {
+	return func(p *Policy) {
+		p.minScore = score
+	}
+}
+
+// Breaches sets where breached passwords are looked up. Nil disables the check.
+func Breaches(b BreachChecker) Option {
+	return func(p *Policy) {
+		p.breaches = b
+	}
+}
@@ -0,0 +1,191 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Codes of the rules a password can break.
+const (
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeMissingUpper  = "missing_upper"
+	CodeMissingLower  = "missing_lower"
+	CodeMissingDigit  = "missing_digit"
+	CodeMissingSymbol = "missing_symbol"
+	CodeTooWeak       = "too_weak"
+	CodePersonalInfo  = "contains_personal_info"
+	CodeBreached      = "breached"
+
+	_defaultMinLength = 8
+	_defaultMaxLength = 72
+
+	// Personal details shorter than this are too common to reject passwords for.
+	_minPersonalLength = 3
+)
+
+// Violation is a rule a password breaks.
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// Policy decides whether a password may be set. By default it only requires at least 8 characters and
+// at most 72 bytes.
+type Policy struct {
+	minLength     int
+	maxLength     int
+	requireUpper  bool
+	requireLower  bool
+	requireDigit  bool
+	requireSymbol bool
+	minScore      int
+	breaches      BreachChecker
+}
+
+func NewPolicy(opts ...Option) *Policy {
+	p := &Policy{
+		minLength: _defaultMinLength,
+		maxLength: _defaultMaxLength,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Check returns every rule password breaks, or none if it may be set. personal holds details of the
+// user, such as the email address and name, that must not appear in the password. An error is only
+// returned when the breach lookup fails.
+func (p *Policy) Check(password string, personal ...string) ([]Violation, error) {
+	var violations []Violation
+
+	if utf8.RuneCountInString(password) < p.minLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("must be at least %d characters long", p.minLength),
+		})
+	}
+
+	if p.maxLength > 0 && len(password) > p.maxLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("must be at most %d bytes long, non-ASCII characters take several", p.maxLength),
+		})
+	}
+
+	violations = append(violations, p.checkClasses(password)...)
+
+	inputs := personalInputs(personal)
+	if containsAny(strings.ToLower(password), inputs) {
+		violations = append(violations, Violation{
+			Code:    CodePersonalInfo,
+			Message: "must not contain your email address or name",
+		})
+	}
+
+	if p.minScore > 0 && Score(password, inputs...) < p.minScore {
+		violations = append(violations, Violation{
+			Code:    CodeTooWeak,
+			Message: "is too easy to guess",
+		})
+	}
+
+	if p.breaches != nil {
+		breached, err := p.breaches.Breached(password)
+		if err != nil {
+			return nil, err
+		}
+
+		if breached {
+			violations = append(violations, Violation{
+				Code:    CodeBreached,
+				Message: "appeared in a data breach, choose another one",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+func (p *Policy) checkClasses(password string) []Violation {
+	var upper, lower, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsLetter(r):
+			symbol = true
+		}
+	}
+
+	var violations []Violation
+
+	if p.requireUpper && !upper {
+		violations = append(violations, Violation{Code: CodeMissingUpper, Message: "must contain an uppercase letter"})
+	}
+
+	if p.requireLower && !lower {
+		violations = append(violations, Violation{Code: CodeMissingLower, Message: "must contain a lowercase letter"})
+	}
+
+	if p.requireDigit && !digit {
+		violations = append(violations, Violation{Code: CodeMissingDigit, Message: "must contain a digit"})
+	}
+
+	if p.requireSymbol && !symbol {
+		violations = append(violations, Violation{Code: CodeMissingSymbol, Message: "must contain a symbol"})
+	}
+
+	return violations
+}
+
+// personalInputs splits personal details into the lowercase words a password must not contain, e.g.
+// "Jane.Doe@example.com" into "jane.doe@example.com", "jane.doe", "jane" and "doe". The domain of an
+// email address is shared with other users, so only the address as a whole counts.
+func personalInputs(personal []string) []string {
+	var inputs []string
+
+	add := func(s string) {
+		if utf8.RuneCountInString(s) >= _minPersonalLength {
+			inputs = append(inputs, s)
+		}
+	}
+
+	for _, s := range personal {
+		s = strings.ToLower(strings.TrimSpace(s))
+		add(s)
+
+		if local, _, ok := strings.Cut(s, "@"); ok {
+			add(local)
+			s = local
+		}
+
+		for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			add(word)
+		}
+	}
+
+	return inputs
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+
+	return false
+}
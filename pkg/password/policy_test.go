@@ -0,0 +1,136 @@
+package password
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type breachFunc func(string) (bool, error)
+
+func (f breachFunc) Breached(password string) (bool, error) {
+	return f(password)
+}
+
+func codes(violations []Violation) []string {
+	var c []string
+	for _, v := range violations {
+		c = append(c, v.Code)
+	}
+
+	return c
+}
+
+func TestPolicy_Check(t *testing.T) {
+	breaches := breachFunc(func(password string) (bool, error) {
+		return password == "Tr0ub4dor&3", nil
+	})
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		password string
+		personal []string
+		want     []string
+	}{
+		{name: "default accepts 8 characters", policy: NewPolicy(), password: "abcdefgh"},
+		{name: "too short", policy: NewPolicy(), password: "abcdefg", want: []string{CodeTooShort}},
+		{name: "length counts characters", policy: NewPolicy(), password: "ééééééé", want: []string{CodeTooShort}},
+		{name: "at the maximum", policy: NewPolicy(MaxLength(10)), password: "abcdefghij"},
+		{name: "too long", policy: NewPolicy(MaxLength(10)), password: "abcdefghijk", want: []string{CodeTooLong}},
+		{name: "maximum counts bytes", policy: NewPolicy(MinLength(6), MaxLength(10)), password: "éééééé", want: []string{CodeTooLong}},
+		{name: "no maximum", policy: NewPolicy(MaxLength(0)), password: string(make([]byte, 1000))},
+		{
+			name:     "every class missing",
+			policy:   NewPolicy(RequireUpper(true), RequireLower(true), RequireDigit(true), RequireSymbol(true)),
+			password: "        ",
+			want:     []string{CodeMissingUpper, CodeMissingLower, CodeMissingDigit},
+		},
+		{
+			name:     "every class present",
+			policy:   NewPolicy(RequireUpper(true), RequireLower(true), RequireDigit(true), RequireSymbol(true)),
+			password: "Abcdef1!",
+		},
+		{name: "missing symbol", policy: NewPolicy(RequireSymbol(true)), password: "Abcdefg1", want: []string{CodeMissingSymbol}},
+		{name: "non-ASCII letters", policy: NewPolicy(RequireUpper(true), RequireLower(true)), password: "ÄÖÜäöüßx"},
+		{
+			name:     "contains the email address",
+			policy:   NewPolicy(),
+			password: "xx jane.doe@example.com",
+			personal: []string{"Jane.Doe@example.com"},
+			want:     []string{CodePersonalInfo},
+		},
+		{
+			name:     "contains part of the name",
+			policy:   NewPolicy(),
+			password: "ilovejANE2024",
+			personal: []string{"jane@example.com", "Jane Doe"},
+			want:     []string{CodePersonalInfo},
+		},
+		{name: "email domain is allowed", policy: NewPolicy(), password: "example-horse-battery", personal: []string{"jd@example.com"}},
+		{name: "short names are allowed", policy: NewPolicy(), password: "al-horse-battery", personal: []string{"Al"}},
+		{name: "too weak", policy: NewPolicy(MinScore(3)), password: "password1", want: []string{CodeTooWeak}},
+		{name: "strong enough", policy: NewPolicy(MinScore(3)), password: "vY7#kq2!Lm9@zR"},
+		{
+			name:     "personal info lowers the score",
+			policy:   NewPolicy(MinScore(3)),
+			password: "Rumpelstiltskin",
+			personal: []string{"rumpelstiltskin@example.com"},
+			want:     []string{CodePersonalInfo, CodeTooWeak},
+		},
+		{name: "breached", policy: NewPolicy(Breaches(breaches)), password: "Tr0ub4dor&3", want: []string{CodeBreached}},
+		{name: "not breached", policy: NewPolicy(Breaches(breaches)), password: "Tr0ub4dor&4"},
+		{
+			name:     "every violation is reported",
+			policy:   NewPolicy(RequireDigit(true), MinScore(2), Breaches(breaches)),
+			password: "jane",
+			personal: []string{"Jane"},
+			want:     []string{CodeTooShort, CodeMissingDigit, CodePersonalInfo, CodeTooWeak},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := tt.policy.Check(tt.password, tt.personal...)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, codes(violations))
+		})
+	}
+
+	t.Run("error: breach lookup fails", func(t *testing.T) {
+		policy := NewPolicy(Breaches(breachFunc(func(string) (bool, error) {
+			return false, errors.New("unavailable")
+		})))
+
+		violations, err := policy.Check("correct horse battery staple")
+
+		assert.Error(t, err)
+		assert.Nil(t, violations)
+	})
+}
+
+func TestPersonalInputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		personal []string
+		want     []string
+	}{
+		{name: "none", personal: nil, want: nil},
+		{
+			name:     "email address",
+			personal: []string{" Jane.Doe@Example.com "},
+			want:     []string{"jane.doe@example.com", "jane.doe", "jane", "doe"},
+		},
+		{name: "full name", personal: []string{"Mary-Ann O'Neil"}, want: []string{"mary-ann o'neil", "mary", "ann", "neil"}},
+		{name: "short words are dropped", personal: []string{"Al Bo", "", "x@y.z"}, want: []string{"al bo", "x@y.z"}},
+		{name: "digits are kept", personal: []string{"j.d2024@x.io"}, want: []string{"j.d2024@x.io", "j.d2024", "d2024"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, personalInputs(tt.personal))
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package password
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Score estimates how many guesses an attacker needs for password, on the scale of zxcvbn:
+//
+//	0: fewer than 10^3 guesses, too guessable
+//	1: fewer than 10^6 guesses, very guessable
+//	2: fewer than 10^8 guesses, somewhat guessable
+//	3: fewer than 10^10 guesses, safely unguessable
+//	4: very unguessable
+//
+// Like zxcvbn, the password is split into the cheapest sequence of common passwords and words
+// (also reversed or with l33t substitutions), repeated characters, alphabet and keyboard runs and
+// years, with everything else guessed by brute force. Personal inputs count as the most common words.
+func Score(password string, inputs ...string) int {
+	guesses := log10Guesses([]rune(password), inputs)
+
+	for score, limit := range _scoreLimits {
+		if guesses < limit {
+			return score
+		}
+	}
+
+	return len(_scoreLimits)
+}
+
+const (
+	// Brute force is assumed to need 10 guesses per character, as in zxcvbn.
+	_bruteforceCardinality = 10
+
+	_minMatchLength = 3
+	_maxWordLength  = 24
+
+	// Only the start of very long passwords is scored; it is already very unguessable.
+	_maxScoredLength = 100
+)
+
+// _scoreLimits are the log10 guesses below which a password gets the score at that index.
+var _scoreLimits = []float64{3, 6, 8, 10}
+
+//go:embed common.txt
+var commonList string
+
+// commonRanks ranks common passwords and words by frequency, starting at 1.
+var commonRanks = func() map[string]int {
+	ranks := make(map[string]int)
+
+	for i, word := range strings.Fields(commonList) {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+
+	return ranks
+}()
+
+var leet = strings.NewReplacer("4", "a", "@", "a", "8", "b", "3", "e", "6", "g", "1", "i", "!", "i",
+	"0", "o", "5", "s", "$", "s", "7", "t", "+", "t", "2", "z")
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+// match covers password[i:j] and needs 10^guesses guesses.
+type match struct {
+	i, j    int
+	guesses float64
+}
+
+func log10Guesses(password []rune, inputs []string) float64 {
+	if len(password) > _maxScoredLength {
+		password = password[:_maxScoredLength]
+	}
+
+	ranks := commonRanks
+	if len(inputs) > 0 {
+		ranks = make(map[string]int, len(commonRanks)+len(inputs))
+		for word, rank := range commonRanks {
+			ranks[word] = rank
+		}
+
+		for _, input := range inputs {
+			ranks[strings.ToLower(input)] = 1
+		}
+	}
+
+	var matches []match
+	matches = append(matches, dictionaryMatches(password, ranks)...)
+	matches = append(matches, repeatMatches(password)...)
+	matches = append(matches, sequenceMatches(password)...)
+	matches = append(matches, keyboardMatches(password)...)
+	matches = append(matches, yearMatches(password)...)
+
+	// best[j] is the fewest guesses for password[:j].
+	best := make([]float64, len(password)+1)
+	for j := 1; j <= len(password); j++ {
+		best[j] = best[j-1] + math.Log10(_bruteforceCardinality)
+
+		for _, m := range matches {
+			if m.j == j && best[m.i]+m.guesses < best[j] {
+				best[j] = best[m.i] + m.guesses
+			}
+		}
+	}
+
+	return best[len(password)]
+}
+
+func dictionaryMatches(password []rune, ranks map[string]int) []match {
+	var matches []match
+
+	lower := toLower(password)
+
+	for i := range lower {
+		for j := i + _minMatchLength; j <= len(lower) && j-i <= _maxWordLength; j++ {
+			word := string(lower[i:j])
+			variations := uppercaseVariations(password[i:j])
+
+			if rank, ok := ranks[word]; ok {
+				matches = append(matches, match{i, j, math.Log10(float64(rank)) + variations})
+			}
+
+			if rank, ok := ranks[reverse(word)]; ok {
+				matches = append(matches, match{i, j, math.Log10(float64(rank)) + variations + math.Log10(2)})
+			}
+
+			if unleet := leet.Replace(word); unleet != word {
+				if rank, ok := ranks[unleet]; ok {
+					matches = append(matches, match{i, j, math.Log10(float64(rank)) + variations + math.Log10(2)})
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+// uppercaseVariations returns the log10 of the ways the word could have been capitalized. Lowercase,
+// capitalized and all uppercase words are the usual choices and cost one extra guess at most.
+func uppercaseVariations(word []rune) float64 {
+	var upper, lower int
+
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 0
+	case lower == 0 || (upper == 1 && unicode.IsUpper(word[0])):
+		return math.Log10(2)
+	default:
+		return float64(min(upper, lower)) * math.Log10(2)
+	}
+}
+
+// repeatMatches finds runs of the same character, such as "aaaa".
+func repeatMatches(password []rune) []match {
+	var matches []match
+
+	for i := 0; i < len(password); {
+		j := i + 1
+		for j < len(password) && password[j] == password[i] {
+			j++
+		}
+
+		if j-i >= _minMatchLength {
+			matches = append(matches, match{i, j, math.Log10(float64(_bruteforceCardinality * (j - i)))})
+		}
+
+		i = j
+	}
+
+	return matches
+}
+
+// sequenceMatches finds runs of consecutive characters, such as "abcd" or "4321".
+func sequenceMatches(password []rune) []match {
+	var matches []match
+
+	for i := 0; i < len(password)-1; {
+		delta := password[i+1] - password[i]
+		if delta != 1 && delta != -1 {
+			i++
+
+			continue
+		}
+
+		j := i + 2
+		for j < len(password) && password[j]-password[j-1] == delta {
+			j++
+		}
+
+		if j-i >= _minMatchLength {
+			matches = append(matches, match{i, j, math.Log10(sequenceBase(password[i]) * float64(j-i))})
+		}
+
+		i = j - 1
+	}
+
+	return matches
+}
+
+func sequenceBase(first rune) float64 {
+	switch {
+	case strings.ContainsRune("aAzZ019", first):
+		return 4
+	case unicode.IsDigit(first):
+		return 10
+	default:
+		return 26
+	}
+}
+
+// keyboardMatches finds runs along a row of a QWERTY keyboard, such as "qwerty" or "lkjh".
+func keyboardMatches(password []rune) []match {
+	var matches []match
+
+	runes := toLower(password)
+
+	for i := range runes {
+		for j := len(runes); j-i >= _minMatchLength+1; j-- {
+			run := string(runes[i:j])
+			if onKeyboardRow(run) || onKeyboardRow(reverse(run)) {
+				matches = append(matches, match{i, j, math.Log10(float64(len(keyboardRows) * 10 * (j - i)))})
+
+				break
+			}
+		}
+	}
+
+	return matches
+}
+
+func onKeyboardRow(run string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, run) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// yearMatches finds years from 1900 to 2099.
+func yearMatches(password []rune) []match {
+	var matches []match
+
+	for i := 0; i+4 <= len(password); i++ {
+		year := string(password[i : i+4])
+		if (strings.HasPrefix(year, "19") || strings.HasPrefix(year, "20")) &&
+			unicode.IsDigit(password[i+2]) && unicode.IsDigit(password[i+3]) {
+			matches = append(matches, match{i, i + 4, math.Log10(200)})
+		}
+	}
+
+	return matches
+}
+
+// toLower lowercases rune by rune, so that indexes keep pointing at the same characters.
+func toLower(password []rune) []rune {
+	lower := make([]rune, len(password))
+	for i, r := range password {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	return lower
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,37 @@
+package password
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		inputs   []string
+		want     int
+	}{
+		{name: "empty", password: "", want: 0},
+		{name: "common password", password: "password", want: 0},
+		{name: "capitalized common password", password: "Password", want: 0},
+		{name: "reversed common password", password: "drowssap", want: 0},
+		{name: "l33t common password", password: "p@ssw0rd", want: 0},
+		{name: "repeated character", password: "aaaaaaaaaaaa", want: 0},
+		{name: "alphabet run", password: "abcdefghijkl", want: 0},
+		{name: "keyboard run", password: "qwertyuiop", want: 0},
+		{name: "year", password: "1987", want: 0},
+		{name: "short random", password: "x7#q", want: 1},
+		{name: "common word and year", password: "monkey1987", want: 1},
+		{name: "personal input", password: "rumpelstiltskin", inputs: []string{"rumpelstiltskin"}, want: 0},
+		{name: "long random", password: "vY7#kq2!Lm9@zR", want: 4},
+		{name: "passphrase", password: "correct horse battery staple", want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Score(tt.password, tt.inputs...))
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// UniqueViolation is the SQLSTATE of a unique constraint violation.
+const UniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err is, or wraps, a unique constraint violation.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == UniqueViolation
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	t.Run("success: unique violation", func(t *testing.T) {
+		assert.True(t, IsUniqueViolation(&pgconn.PgError{Code: UniqueViolation}))
+	})
+
+	t.Run("success: wrapped unique violation", func(t *testing.T) {
+		err := fmt.Errorf("create user: %w", &pgconn.PgError{Code: UniqueViolation})
+
+		assert.True(t, IsUniqueViolation(err))
+	})
+
+	t.Run("success: other postgres error", func(t *testing.T) {
+		assert.False(t, IsUniqueViolation(&pgconn.PgError{Code: "23503"}))
+	})
+
+	t.Run("success: other error", func(t *testing.T) {
+		assert.False(t, IsUniqueViolation(errors.New("error")))
+		assert.False(t, IsUniqueViolation(nil))
+	})
+}
@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CrossTenantRole is the role, created by the migrations, that row-level security does not apply to.
+// The role the application connects as must be a member of it.
+const CrossTenantRole = "app_cross_tenant"
+
+// Scope is whom a query runs for. Row-level security policies read it through the app.user_id and
+// app.tenant_id settings, which are empty when unknown, and then see no organization data at all.
+// CrossTenant runs the query as the CrossTenantRole instead.
+type Scope struct {
+	UserID      string
+	TenantID    string
+	CrossTenant bool
+}
+
+type scopeKey struct{}
+
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext returns the scope of the request, empty outside of one.
+func ScopeFromContext(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+
+	return scope
+}
+
+// CrossTenant returns a context whose queries may act on any organization, for the few things that
+// happen outside of one, such as creating an organization or accepting an invitation to it.
+func CrossTenant(ctx context.Context) context.Context {
+	scope := ScopeFromContext(ctx)
+	scope.CrossTenant = true
+
+	return WithScope(ctx, scope)
+}
+
+type scoped struct {
+	PgxIface
+}
+
+// Scoped wraps db so that everything runs with the scope of its context, the equivalent of SET LOCAL
+// app.user_id and app.tenant_id, and SET LOCAL ROLE for a cross-tenant scope. The settings end with
+// the transaction, so they never leak to the next user of the connection. A query outside of a
+// transaction runs in one of its own when there is a scope.
+func Scoped(db PgxIface) PgxIface {
+	return &scoped{PgxIface: db}
+}
+
+func (s *scoped) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := s.PgxIface.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := ScopeFromContext(ctx)
+
+	role := "none"
+	if scope.CrossTenant {
+		role = CrossTenantRole
+	}
+
+	// SET LOCAL takes no parameters; set_config with is_local does the same.
+	_, err = tx.Exec(ctx, "SELECT set_config('app.user_id', $1, true), set_config('app.tenant_id', $2, true), "+
+		"set_config('role', $3, true)", scope.UserID, scope.TenantID, role)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+
+		return nil, fmt.Errorf("postgres: failed to scope transaction: %w", err)
+	}
+
+	return tx, nil
+}
+
+func (s *scoped) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if ScopeFromContext(ctx) == (Scope{}) {
+		return s.PgxIface.Exec(ctx, sql, args...)
+	}
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+
+		return pgconn.CommandTag{}, err
+	}
+
+	return tag, tx.Commit(ctx)
+}
+
+func (s *scoped) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if ScopeFromContext(ctx) == (Scope{}) {
+		return s.PgxIface.Query(ctx, sql, args...)
+	}
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+
+		return nil, err
+	}
+
+	return &scopedRows{Rows: rows, ctx: ctx, tx: tx}, nil
+}
+
+func (s *scoped) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if ScopeFromContext(ctx) == (Scope{}) {
+		return s.PgxIface.QueryRow(ctx, sql, args...)
+	}
+
+	tx, err := s.Begin(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+
+	return &scopedRow{Row: tx.QueryRow(ctx, sql, args...), ctx: ctx, tx: tx}
+}
+
+// scopedRows ends the transaction of a query when its rows are closed.
+type scopedRows struct {
+	pgx.Rows
+	ctx    context.Context
+	tx     pgx.Tx
+	err    error
+	closed bool
+}
+
+func (r *scopedRows) Close() {
+	if r.closed {
+		return
+	}
+
+	r.closed = true
+	r.Rows.Close()
+
+	if r.Rows.Err() != nil {
+		_ = r.tx.Rollback(r.ctx)
+
+		return
+	}
+
+	r.err = r.tx.Commit(r.ctx)
+}
+
+func (r *scopedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+
+	r.Close()
+
+	return false
+}
+
+func (r *scopedRows) Err() error {
+	if err := r.Rows.Err(); err != nil {
+		return err
+	}
+
+	return r.err
+}
+
+// scopedRow ends the transaction of a query when its row is scanned.
+type scopedRow struct {
+	pgx.Row
+	ctx context.Context
+	tx  pgx.Tx
+}
+
+func (r *scopedRow) Scan(dest ...any) error {
+	if err := r.Row.Scan(dest...); err != nil {
+		_ = r.tx.Rollback(r.ctx)
+
+		return err
+	}
+
+	return r.tx.Commit(r.ctx)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
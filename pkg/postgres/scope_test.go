@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const setScope = `SELECT set_config\('app.user_id', \$1, true\), set_config\('app.tenant_id', \$2, true\), set_config\('role', \$3, true\)`
+
+func TestScoped(t *testing.T) {
+	scope := Scope{UserID: "user", TenantID: "org"}
+	ctx := WithScope(context.Background(), scope)
+
+	t.Run("success: transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setScope).WithArgs("user", "org", "none").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectCommit()
+
+		tx, err := Scoped(mock).Begin(ctx)
+		require.NoError(t, err)
+
+		assert.NoError(t, tx.Commit(ctx))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success: cross-tenant transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setScope).WithArgs("user", "", CrossTenantRole).WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectRollback()
+
+		tx, err := Scoped(mock).Begin(CrossTenant(WithScope(context.Background(), Scope{UserID: "user"})))
+		require.NoError(t, err)
+
+		assert.NoError(t, tx.Rollback(ctx))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success: query outside of a transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setScope).WithArgs("user", "org", "none").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery("SELECT id FROM organizations").WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow("org"))
+		mock.ExpectCommit()
+
+		rows, err := Scoped(mock).Query(ctx, "SELECT id FROM organizations")
+		require.NoError(t, err)
+
+		var ids []string
+		for rows.Next() {
+			var id string
+			require.NoError(t, rows.Scan(&id))
+			ids = append(ids, id)
+		}
+
+		rows.Close()
+
+		assert.NoError(t, rows.Err())
+		assert.Equal(t, []string{"org"}, ids)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success: row outside of a transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setScope).WithArgs("user", "org", "none").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery("SELECT name FROM organizations").WillReturnRows(pgxmock.NewRows([]string{"name"}).AddRow("a"))
+		mock.ExpectCommit()
+
+		var name string
+		err = Scoped(mock).QueryRow(ctx, "SELECT name FROM organizations").Scan(&name)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "a", name)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success: exec outside of a transaction", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setScope).WithArgs("user", "org", "none").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectExec("DELETE FROM organization_members").WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectCommit()
+
+		tag, err := Scoped(mock).Exec(ctx, "DELETE FROM organization_members")
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), tag.RowsAffected())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("success: no scope runs on the pool", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectQuery("SELECT name FROM organizations").WillReturnRows(pgxmock.NewRows([]string{"name"}))
+
+		var name string
+		err = Scoped(mock).QueryRow(context.Background(), "SELECT name FROM organizations").Scan(&name)
+
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error: failed query rolls back", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setScope).WithArgs("user", "org", "none").WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery("SELECT name FROM organizations").WillReturnError(errors.New("boom"))
+		mock.ExpectRollback()
+
+		var name string
+		err = Scoped(mock).QueryRow(ctx, "SELECT name FROM organizations").Scan(&name)
+
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("error: scope cannot be set", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setScope).WithArgs("user", "", CrossTenantRole).WillReturnError(errors.New("permission denied to set role"))
+		mock.ExpectRollback()
+
+		_, err = Scoped(mock).Exec(CrossTenant(WithScope(context.Background(), Scope{UserID: "user"})), "DELETE FROM organizations")
+
+		assert.ErrorContains(t, err, "failed to scope transaction")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
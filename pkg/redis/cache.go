@@ -10,9 +10,17 @@ import (
 
 //go:generate go run go.uber.org/mock/mockgen -source=cache.go -destination=mock/cache.go -package=mock github.com/savioruz/goth/pkg/redis Interface
 
+// ErrCacheMiss is returned by Get when the key does not exist.
+var ErrCacheMiss = redis.Nil
+
 type IRedisCache interface {
 	Save(ctx context.Context, key string, value any, duration int) (err error)
+	SaveNX(ctx context.Context, key string, value any, duration int) (ok bool, err error)
 	Get(ctx context.Context, key string, value any) (err error)
+	Take(ctx context.Context, key string, value any) (err error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Increment(ctx context.Context, key string, duration int) (int64, error)
+	IncrementSliding(ctx context.Context, key string, duration int) (int64, error)
 	Delete(ctx context.Context, key string) error
 	Clear(ctx context.Context, prefix string) error
 	Pipeline() IRedisCacheWithPipe
@@ -89,6 +97,27 @@ func (i *iRedisCacheImpl) Get(ctx context.Context, key string, value any) (err e
 	return err
 }
 
+// Take implements IRedisCache. It gets and deletes the key at once, so that a value can only be taken once.
+func (i *iRedisCacheImpl) Take(ctx context.Context, key string, value any) error {
+	cacheValue, err := i.client.GetDel(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case *string:
+		*v = cacheValue
+	default:
+		if err = json.Unmarshal([]byte(cacheValue), value); err != nil {
+			i.log.Error("redis - take - failed to unmarshal value", err)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Pipeline implements IRedisCache.
 func (i *iRedisCacheImpl) Pipeline() IRedisCacheWithPipe {
 	pipe := i.client.Pipeline()
@@ -125,6 +154,78 @@ func (i *iRedisCacheImpl) Save(ctx context.Context, key string, value any, durat
 	return
 }
 
+// SaveNX implements IRedisCache.
+func (i *iRedisCacheImpl) SaveNX(ctx context.Context, key string, value any, duration int) (ok bool, err error) {
+	var strValue []byte
+	switch v := value.(type) {
+	case string:
+		strValue = []byte(v)
+	default:
+		strValue, err = json.Marshal(v)
+
+		if err != nil {
+			i.log.Error("redis - save nx - failed to marshal value", err)
+
+			return false, err
+		}
+	}
+
+	ok, err = i.client.SetNX(ctx, key, strValue, time.Second*time.Duration(duration)).Result()
+
+	if err != nil {
+		i.log.Error("redis - save nx - failed to save value", err)
+
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// Exists implements IRedisCache.
+func (i *iRedisCacheImpl) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := i.client.Exists(ctx, key).Result()
+
+	if err != nil {
+		i.log.Error("redis - exists - failed to check key", err)
+
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// Increment implements IRedisCache. The expiry is set by the first increment only, so the counter
+// covers a fixed window that starts with the first hit.
+func (i *iRedisCacheImpl) Increment(ctx context.Context, key string, duration int) (int64, error) {
+	pipe := i.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, time.Second*time.Duration(duration))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		i.log.Error("redis - increment - failed to increment value", err)
+
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+// IncrementSliding implements IRedisCache. Every increment sets the expiry again, so the counter
+// lasts until duration after the last hit.
+func (i *iRedisCacheImpl) IncrementSliding(ctx context.Context, key string, duration int) (int64, error) {
+	pipe := i.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, time.Second*time.Duration(duration))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		i.log.Error("redis - increment sliding - failed to increment value", err)
+
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
 type IRedisCacheWithPipe interface {
 	Clear(ctx context.Context, prefix string) IRedisCacheWithPipe
 	Delete(ctx context.Context, key string) IRedisCacheWithPipe
@@ -0,0 +1,30 @@
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const tokenBytes = 32
+
+// NewToken returns a random URL-safe token to hand out and the hash to store in its place,
+// so that a leaked database cannot be used to redeem tokens.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, tokenBytes)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+
+	return token, Hash(token), nil
+}
+
+// Hash returns the hex encoded SHA-256 of a token. Tokens carry enough entropy that a fast hash is sufficient.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
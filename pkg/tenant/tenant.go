@@ -0,0 +1,26 @@
+// Package tenant carries the organization a request acts in. Services take the organization from the
+// context rather than from the request, so that every query on tenant data is scoped to an
+// organization the signed in user is a member of.
+package tenant
+
+import "context"
+
+// Tenant is the active organization of a request and the membership of the signed in user in it.
+type Tenant struct {
+	OrgID  string
+	UserID string
+	Role   string
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, ctxKey{}, t)
+}
+
+// FromContext returns the tenant of the request, false outside of a tenant-scoped one.
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(ctxKey{}).(Tenant)
+
+	return t, ok && t.OrgID != ""
+}
@@ -0,0 +1,123 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 6238 defaults to HMAC-SHA1, the only algorithm every authenticator app supports.
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Codes follow the defaults of RFC 6238 so that they work with every authenticator app:
+// HMAC-SHA1, six digits and a 30 second period.
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	_secretBytes = 20
+	_skew        = 1
+	_modulo      = 1_000_000
+)
+
+var (
+	ErrInvalidSecret = errors.New("totp: invalid secret")
+	ErrInvalidCode   = errors.New("totp: invalid code")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 encoded shared secret.
+func GenerateSecret() (string, error) {
+	b := make([]byte, _secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns the otpauth:// key URI that authenticator apps read from a QR code.
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+
+	return u.String()
+}
+
+// Step returns the time step t falls in.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the time step t falls in.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return code(key, Step(t)), nil
+}
+
+// Validate checks passcode against the time step t falls in and one step either side to allow for
+// clock drift. It returns the matched step so that callers can refuse to accept it twice.
+func Validate(passcode, secret string, t time.Time) (int64, error) {
+	key, err := decode(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(passcode) != Digits {
+		return 0, ErrInvalidCode
+	}
+
+	current := Step(t)
+	for step := current - _skew; step <= current+_skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(code(key, step)), []byte(passcode)) == 1 {
+			return step, nil
+		}
+	}
+
+	return 0, ErrInvalidCode
+}
+
+// code implements the dynamic truncation of RFC 4226 section 5.3.
+func code(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step)) //nolint:gosec // steps are never negative
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%_modulo)
+}
+
+func decode(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return key, nil
+}
@@ -0,0 +1,96 @@
+package totp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA-1 seed of RFC 6238 Appendix B, "12345678901234567890" in base32.
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// rfcVectors are the SHA-1 test vectors of RFC 6238 Appendix B. They are eight digits long and
+// codes here have six, which are the last six digits of the same truncated value.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCode(t *testing.T) {
+	for _, v := range rfcVectors {
+		t.Run(fmt.Sprintf("success: rfc 6238 at %d", v.unix), func(t *testing.T) {
+			code, err := Code(rfcSecret, time.Unix(v.unix, 0))
+
+			require.NoError(t, err)
+			assert.Len(t, code, Digits)
+			assert.Equal(t, v.code[len(v.code)-Digits:], code)
+		})
+	}
+
+	t.Run("error: invalid secret", func(t *testing.T) {
+		_, err := Code("not base32!", time.Unix(59, 0))
+
+		assert.ErrorIs(t, err, ErrInvalidSecret)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	for _, v := range rfcVectors {
+		t.Run(fmt.Sprintf("success: rfc 6238 at %d", v.unix), func(t *testing.T) {
+			now := time.Unix(v.unix, 0)
+
+			step, err := Validate(v.code[len(v.code)-Digits:], rfcSecret, now)
+
+			require.NoError(t, err)
+			assert.Equal(t, Step(now), step)
+		})
+	}
+
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for _, skew := range []int64{-1, 1} {
+		t.Run(fmt.Sprintf("success: code of step %+d accepted", skew), func(t *testing.T) {
+			code, err := Code(rfcSecret, now.Add(time.Duration(skew)*Period))
+			require.NoError(t, err)
+
+			step, err := Validate(code, rfcSecret, now)
+
+			require.NoError(t, err)
+			assert.Equal(t, current+skew, step)
+		})
+	}
+
+	for _, skew := range []int64{-2, 2} {
+		t.Run(fmt.Sprintf("error: code of step %+d rejected", skew), func(t *testing.T) {
+			code, err := Code(rfcSecret, now.Add(time.Duration(skew)*Period))
+			require.NoError(t, err)
+
+			_, err = Validate(code, rfcSecret, now)
+
+			assert.ErrorIs(t, err, ErrInvalidCode)
+		})
+	}
+
+	t.Run("error: wrong length", func(t *testing.T) {
+		_, err := Validate("94287082", rfcSecret, time.Unix(59, 0))
+
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	})
+
+	t.Run("error: invalid secret", func(t *testing.T) {
+		_, err := Validate("287082", "not base32!", time.Unix(59, 0))
+
+		assert.ErrorIs(t, err, ErrInvalidSecret)
+	})
+}